@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/ipdetect"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/mapping"
+)
+
+// TestUpdateIPAndDNS_ApexMapping verifies that in proxy mode, which
+// otherwise publishes no apex records, an "@" mapping gets a proxied apex
+// record next to the subdomain records, and that a later cleanup keeps it.
+func TestUpdateIPAndDNS_ApexMapping(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		prefix bool
+		apex   string
+		app    string
+	}{
+		{name: "normal", apex: "zone.example.com", app: "app.zone.example.com"},
+		{name: "prefix", prefix: true, apex: "zone.example.com", app: "app-zone.example.com"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "mappings.yaml")
+			content := `mappings:
+  - subdomain: "@"
+    target: "homepage:8080"
+  - subdomain: app
+    target: "app:8080"
+`
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatalf("write mappings: %v", err)
+			}
+			mgr := mapping.New(path)
+			if err := mgr.Load(); err != nil {
+				t.Fatalf("load mappings: %v", err)
+			}
+
+			fake := newFakeCloudflare(t)
+			cfg := &config.Config{
+				Domain:          "zone.example.com",
+				SubdomainPrefix: tt.prefix,
+				CloudflareProxy: true,
+				ManualIPv4:      "203.0.113.10",
+			}
+			cfClient := fake.client(t, cfg)
+			gen := caddy.New(cfg, mgr)
+
+			for range 2 {
+				(&Controller{cfg: cfg, detector: ipdetect.New(cfg), dns: cfClient, caddyGen: gen}).Reconcile(context.Background())
+			}
+
+			want := []snapshotRecord{
+				{Name: tt.app, Type: "A", Content: "203.0.113.10", Proxied: true},
+				{Name: tt.apex, Type: "A", Content: "203.0.113.10", Proxied: true},
+			}
+			sortRecords(want)
+			if got := fake.list(); fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("records = %+v\nwant %+v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/ipdetect"
+)
+
+// TestUpdateIPAndDNS_ApexProxied verifies that in direct mode the apex
+// records follow APEX_PROXIED while the wildcard records stay grey-cloud.
+func TestUpdateIPAndDNS_ApexProxied(t *testing.T) {
+	for _, apexProxied := range []bool{false, true} {
+		t.Run(fmt.Sprintf("apex_proxied=%v", apexProxied), func(t *testing.T) {
+			fake := newFakeCloudflare(t)
+			cfg := &config.Config{
+				Domain:      "example.com",
+				ManualIPv4:  "203.0.113.10",
+				ManualIPv6:  "2001:db8::10",
+				ApexProxied: apexProxied,
+			}
+			cfClient := fake.client(t, cfg)
+
+			(&Controller{cfg: cfg, detector: ipdetect.New(cfg), dns: cfClient, caddyGen: caddy.New(cfg, nil)}).Reconcile(context.Background())
+
+			want := []snapshotRecord{
+				{Name: "*.example.com", Type: "A", Content: "203.0.113.10"},
+				{Name: "*.example.com", Type: "AAAA", Content: "2001:db8::10"},
+				{Name: "example.com", Type: "A", Content: "203.0.113.10", Proxied: apexProxied},
+				{Name: "example.com", Type: "AAAA", Content: "2001:db8::10", Proxied: apexProxied},
+			}
+			if got := fake.list(); fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("records = %+v\nwant %+v", got, want)
+			}
+		})
+	}
+}
+
+// TestUpdateIPAndDNS_ApexProxiedIgnoredInProxyMode verifies proxy mode
+// keeps publishing only the subdomain records.
+func TestUpdateIPAndDNS_ApexProxiedIgnoredInProxyMode(t *testing.T) {
+	fake := newFakeCloudflare(t)
+	cfg := &config.Config{
+		Domain:            "example.com",
+		CloudflareProxy:   true,
+		ManualIPv4:        "203.0.113.10",
+		ApexProxied:       true,
+		CatchallSubdomain: "www",
+	}
+	cfClient := fake.client(t, cfg)
+
+	(&Controller{cfg: cfg, detector: ipdetect.New(cfg), dns: cfClient, caddyGen: caddy.New(cfg, nil)}).Reconcile(context.Background())
+
+	want := []snapshotRecord{
+		{Name: "www.example.com", Type: "A", Content: "203.0.113.10"},
+	}
+	if got := fake.list(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("records = %+v\nwant %+v", got, want)
+	}
+}
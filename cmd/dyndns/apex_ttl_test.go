@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/ipdetect"
+)
+
+// TestUpdateIPAndDNS_ApexTTL verifies the direct-mode apex and wildcard
+// records get APEX_TTL, a proxied apex gets automatic TTL, and proxy-mode
+// subdomain records keep DNS_TTL.
+func TestUpdateIPAndDNS_ApexTTL(t *testing.T) {
+	t.Run("direct", func(t *testing.T) {
+		fake := newFakeCloudflare(t)
+		cfg := &config.Config{
+			Domain:     "example.com",
+			ManualIPv4: "203.0.113.10",
+			ManualIPv6: "2001:db8::10",
+			DNSTTL:     60,
+			ApexTTL:    3600,
+		}
+		(&Controller{cfg: cfg, detector: ipdetect.New(cfg), dns: fake.client(t, cfg), caddyGen: caddy.New(cfg, nil)}).Reconcile(context.Background())
+
+		for _, name := range []string{"example.com", "*.example.com"} {
+			for _, recordType := range []string{"A", "AAAA"} {
+				if got := fake.ttl(name, recordType); got != 3600 {
+					t.Errorf("%s %s TTL = %d, want 3600", recordType, name, got)
+				}
+			}
+		}
+	})
+
+	t.Run("proxied apex", func(t *testing.T) {
+		fake := newFakeCloudflare(t)
+		cfg := &config.Config{
+			Domain:      "example.com",
+			ManualIPv4:  "203.0.113.10",
+			DNSTTL:      60,
+			ApexTTL:     3600,
+			ApexProxied: true,
+		}
+		(&Controller{cfg: cfg, detector: ipdetect.New(cfg), dns: fake.client(t, cfg), caddyGen: caddy.New(cfg, nil)}).Reconcile(context.Background())
+
+		if got := fake.ttl("example.com", "A"); got != 1 {
+			t.Errorf("proxied apex TTL = %d, want 1 (automatic)", got)
+		}
+		if got := fake.ttl("*.example.com", "A"); got != 3600 {
+			t.Errorf("wildcard TTL = %d, want 3600", got)
+		}
+	})
+
+	t.Run("subdomains", func(t *testing.T) {
+		fake := newFakeCloudflare(t)
+		cfg := &config.Config{
+			Domain:          "example.com",
+			CloudflareProxy: true,
+			ManualIPv4:      "203.0.113.10",
+			DNSTTL:          60,
+			ApexTTL:         3600,
+		}
+		gen := caddy.New(cfg, nil)
+		gen.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "direct", Port: 8080, Direct: true}})
+		(&Controller{cfg: cfg, detector: ipdetect.New(cfg), dns: fake.client(t, cfg), caddyGen: gen}).Reconcile(context.Background())
+
+		if got := fake.ttl("direct.example.com", "A"); got != 60 {
+			t.Errorf("subdomain TTL = %d, want DNS_TTL (60)", got)
+		}
+	})
+}
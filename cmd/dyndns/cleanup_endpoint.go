@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/cloudflare"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+)
+
+// cleanupRecord is one record in the /cleanup response.
+type cleanupRecord struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// cleanupSummary is the /cleanup response.
+type cleanupSummary struct {
+	// Active is the number of names kept.
+	Active  int             `json:"active"`
+	Removed []cleanupRecord `json:"removed"`
+	// Error reports the deletes that failed or were cut off by
+	// STALE_CLEANUP_TIMEOUT; the next cycle retries them.
+	Error string `json:"error,omitempty"`
+}
+
+// cleanupHandler sweeps the stale subdomain records on POST: every managed
+// record whose name is not active is deleted right away, without waiting
+// for the next cycle or REMOVAL_GRACE. Like the per-cycle cleanup it only
+// applies to proxy mode and refuses an empty active set unless
+// ALLOW_EMPTY_RECONCILE is set.
+func cleanupHandler(cfg *config.Config, cfClient *cloudflare.Client, gen *caddy.Generator) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !cfClient.IsProxied() {
+			http.Error(w, "stale record cleanup only applies to proxy mode", http.StatusConflict)
+			return
+		}
+		activeSubdomains := gen.GetActiveSubdomains()
+		if len(activeSubdomains) == 0 && !cfg.AllowEmptyReconcile {
+			slog.Warn("NO ACTIVE SUBDOMAINS: refusing on-demand stale DNS record cleanup; set ALLOW_EMPTY_RECONCILE=true if this is intended")
+			http.Error(w, "no active subdomains; set ALLOW_EMPTY_RECONCILE=true to remove every managed record", http.StatusConflict)
+			return
+		}
+		if cfg.CatchallSubdomain != "" && !slices.Contains(activeSubdomains, cfg.CatchallSubdomain) {
+			activeSubdomains = append(activeSubdomains, cfg.CatchallSubdomain)
+		}
+		active := activeFQDNSet(cfg, activeSubdomains)
+
+		// The managed records (the listing behind GetManagedRecordFQDNs)
+		// are needed with their types to delete each orphan.
+		existing, err := cfClient.ListManagedRecords(r.Context())
+		if err != nil {
+			slog.Error("Failed to get existing DNS records for on-demand cleanup", "error", err)
+			http.Error(w, "failed to list DNS records", http.StatusBadGateway)
+			return
+		}
+		var stale []cloudflare.ManagedRecord
+		for _, rec := range existing {
+			if !active[strings.ToLower(rec.Name)] {
+				stale = append(stale, rec)
+			}
+		}
+
+		slog.Info("On-demand stale DNS record cleanup", "stale", len(stale), "active_fqdns", len(active))
+		deleted, err := deleteStaleRecords(r.Context(), cfClient, stale, cfg.StaleCleanupConcurrency, cfg.StaleCleanupTimeout)
+		summary := cleanupSummary{Active: len(active), Removed: []cleanupRecord{}}
+		for _, rec := range deleted {
+			summary.Removed = append(summary.Removed, cleanupRecord{Name: rec.Name, Type: rec.Type})
+		}
+		slices.SortFunc(summary.Removed, func(a, b cleanupRecord) int {
+			return strings.Compare(a.Name+" "+a.Type, b.Name+" "+b.Type)
+		})
+		if err != nil {
+			slog.Warn("On-demand stale DNS record cleanup incomplete", "stale", len(stale), "error", err)
+			summary.Error = err.Error()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(summary)
+	})
+}
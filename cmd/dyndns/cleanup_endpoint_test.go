@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+)
+
+// TestCleanupHandler verifies POST /cleanup deletes the managed records
+// whose names are not active, keeps the active ones and reports what it
+// removed.
+func TestCleanupHandler(t *testing.T) {
+	fake := newFakeCloudflare(t, staleRecords(1)...)
+	cfg := &config.Config{
+		Domain:                  "example.com",
+		CloudflareProxy:         true,
+		StatusToken:             "secret",
+		StaleCleanupConcurrency: 2,
+	}
+	cfClient := fake.client(t, cfg)
+	gen := caddy.New(cfg, nil)
+	gen.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "app", Port: 8080}})
+	handler := newStatusMux(cfg, nil, cfClient, gen, nil, nil, nil)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/cleanup", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("without token: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/cleanup", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	var summary cleanupSummary
+	if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil {
+		t.Fatalf("decode: %v\n%s", err, rec.Body.String())
+	}
+	want := []cleanupRecord{{Name: "old0.example.com", Type: "A"}}
+	if fmt.Sprint(summary.Removed) != fmt.Sprint(want) || summary.Active != 1 || summary.Error != "" {
+		t.Errorf("summary = %+v, want %v removed with 1 active name", summary, want)
+	}
+	if got := fake.list(); len(got) != 1 || got[0].Name != "app.example.com" {
+		t.Errorf("records = %+v, want only app.example.com", got)
+	}
+}
+
+// TestCleanupHandler_EmptyActiveSet verifies the on-demand sweep honors
+// the empty-set guard: with no active subdomain nothing is deleted unless
+// ALLOW_EMPTY_RECONCILE is set.
+func TestCleanupHandler_EmptyActiveSet(t *testing.T) {
+	for _, allow := range []bool{false, true} {
+		t.Run(fmt.Sprintf("allow=%t", allow), func(t *testing.T) {
+			fake := newFakeCloudflare(t, staleRecords(1)...)
+			cfg := &config.Config{
+				Domain:              "example.com",
+				CloudflareProxy:     true,
+				AllowEmptyReconcile: allow,
+			}
+			handler := cleanupHandler(cfg, fake.client(t, cfg), caddy.New(cfg, nil))
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/cleanup", nil))
+
+			wantCode, wantRecords := http.StatusConflict, 2
+			if allow {
+				wantCode, wantRecords = http.StatusOK, 0
+			}
+			if rec.Code != wantCode {
+				t.Errorf("status = %d, want %d: %s", rec.Code, wantCode, rec.Body.String())
+			}
+			if got := fake.list(); len(got) != wantRecords {
+				t.Errorf("records = %+v, want %d left", got, wantRecords)
+			}
+		})
+	}
+}
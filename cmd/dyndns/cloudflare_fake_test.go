@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/cloudflare"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+)
+
+// fakeCloudflare is an in-memory DNS records API: list (filtered by name
+// and type), create, update and delete, plus the zone details of an
+// example.com zone. writes counts the create, update and delete calls;
+// ttls holds the TTL last written per record ID.
+type fakeCloudflare struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	records map[string]snapshotRecord // keyed by record ID
+	nextID  int
+	writes  int
+	ttls    map[string]int
+	// failList rejects zone-wide list calls (no name filter), as used by
+	// the stale record cleanup; per-name lookups still succeed.
+	failList bool
+
+	// deleteDelay holds each delete that long before it is applied;
+	// maxDeletes records the most deletes seen in flight at once.
+	deleteDelay time.Duration
+	inDeletes   atomic.Int32
+	maxDeletes  atomic.Int32
+}
+
+func newFakeCloudflare(t *testing.T, initial ...snapshotRecord) *fakeCloudflare {
+	t.Helper()
+	f := &fakeCloudflare{records: make(map[string]snapshotRecord), ttls: make(map[string]int)}
+	for _, rec := range initial {
+		f.add(rec)
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// client returns a Cloudflare client for cfg pointed at the fake.
+func (f *fakeCloudflare) client(t *testing.T, cfg *config.Config) *cloudflare.Client {
+	t.Helper()
+	cfg.CloudflareAPIToken = "test-token"
+	cfg.CloudflareZoneID = "test-zone"
+	cfg.CloudflareAPIBaseURL = f.URL + "/client/v4"
+	c, err := cloudflare.New(cfg)
+	if err != nil {
+		t.Fatalf("cloudflare.New: %v", err)
+	}
+	return c
+}
+
+func (f *fakeCloudflare) add(rec snapshotRecord) string {
+	f.nextID++
+	id := fmt.Sprintf("rec%d", f.nextID)
+	f.records[id] = rec
+	return id
+}
+
+// list returns the current records sorted by name and type.
+func (f *fakeCloudflare) list() []snapshotRecord {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make([]snapshotRecord, 0, len(f.records))
+	for _, rec := range f.records {
+		out = append(out, rec)
+	}
+	sortRecords(out)
+	return out
+}
+
+// ttl returns the TTL last written for the record name and type.
+func (f *fakeCloudflare) ttl(name, recordType string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for id, rec := range f.records {
+		if rec.Name == name && rec.Type == recordType {
+			return f.ttls[id]
+		}
+	}
+	return 0
+}
+
+// setContent changes a record's content out-of-band, as an edit in the
+// Cloudflare dashboard would.
+func (f *fakeCloudflare) setContent(name, recordType, content string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for id, rec := range f.records {
+		if rec.Name == name && rec.Type == recordType {
+			rec.Content = content
+			f.records[id] = rec
+		}
+	}
+}
+
+// setProxied toggles a record's proxied flag and sets its TTL
+// out-of-band, as the cloud toggle in the Cloudflare dashboard would.
+func (f *fakeCloudflare) setProxied(name, recordType string, proxied bool, ttl int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for id, rec := range f.records {
+		if rec.Name == name && rec.Type == recordType {
+			rec.Proxied = proxied
+			f.records[id] = rec
+			f.ttls[id] = ttl
+		}
+	}
+}
+
+// writeCount returns the number of create, update and delete calls.
+func (f *fakeCloudflare) writeCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.writes
+}
+
+func (f *fakeCloudflare) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodDelete && f.deleteDelay > 0 {
+		n := f.inDeletes.Add(1)
+		for {
+			peak := f.maxDeletes.Load()
+			if n <= peak || f.maxDeletes.CompareAndSwap(peak, n) {
+				break
+			}
+		}
+		time.Sleep(f.deleteDelay)
+		f.inDeletes.Add(-1)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+
+	_, recordID, _ := strings.Cut(r.URL.Path, "/dns_records/")
+	if r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/zones/test-zone") {
+		fmt.Fprint(w, `{"success":true,"result":{"id":"test-zone","name":"example.com","status":"active"}}`)
+		return
+	}
+	if !strings.Contains(r.URL.Path, "/dns_records") {
+		http.NotFound(w, r)
+		return
+	}
+
+	writeRecord := func(id string, rec snapshotRecord) string {
+		return fmt.Sprintf(`{"id":%q,"name":%q,"type":%q,"content":%q,"proxied":%t,"ttl":%d}`, id, rec.Name, rec.Type, rec.Content, rec.Proxied, f.ttls[id])
+	}
+
+	switch {
+	case r.Method == http.MethodGet && recordID == "":
+		name, recordType := r.URL.Query().Get("name"), r.URL.Query().Get("type")
+		if f.failList && name == "" {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"success":false,"errors":[{"code":10000,"message":"Authentication error"}]}`)
+			return
+		}
+		var items []string
+		for id, rec := range f.records {
+			if (name == "" || rec.Name == name) && (recordType == "" || rec.Type == recordType) {
+				items = append(items, writeRecord(id, rec))
+			}
+		}
+		fmt.Fprintf(w, `{"success":true,"result":[%s],"result_info":{"page":1,"per_page":100,"count":%d,"total_count":%d,"total_pages":1}}`,
+			strings.Join(items, ","), len(items), len(items))
+	case r.Method == http.MethodPost, r.Method == http.MethodPatch && recordID != "":
+		var body struct {
+			Name    string `json:"name"`
+			Type    string `json:"type"`
+			Content string `json:"content"`
+			Proxied *bool  `json:"proxied"`
+			TTL     int    `json:"ttl"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		rec := snapshotRecord{Name: body.Name, Type: body.Type, Content: body.Content, Proxied: body.Proxied != nil && *body.Proxied}
+		f.writes++
+		if recordID == "" {
+			recordID = f.add(rec)
+		} else {
+			f.records[recordID] = rec
+		}
+		f.ttls[recordID] = body.TTL
+		fmt.Fprintf(w, `{"success":true,"result":%s}`, writeRecord(recordID, rec))
+	case r.Method == http.MethodDelete && recordID != "":
+		f.writes++
+		delete(f.records, recordID)
+		fmt.Fprintf(w, `{"success":true,"result":{"id":%q}}`, recordID)
+	default:
+		http.Error(w, "unexpected request", http.StatusMethodNotAllowed)
+	}
+}
+
+func sortRecords(records []snapshotRecord) {
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Name != records[j].Name {
+			return records[i].Name < records[j].Name
+		}
+		return records[i].Type < records[j].Type
+	})
+}
@@ -0,0 +1,465 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/cloudflare"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/mapping"
+)
+
+// dnsProvider is the part of *cloudflare.Client the reconcile uses.
+type dnsProvider interface {
+	IsProxied() bool
+	UpdateNameRecords(ctx context.Context, name string, updates []cloudflare.RecordUpdate) *cloudflare.NameUpdateResult
+	ListManagedRecords(ctx context.Context) ([]cloudflare.ManagedRecord, error)
+	ListZoneRecords(ctx context.Context) ([]cloudflare.ManagedRecord, error)
+	GetManagedRecordFQDNs(ctx context.Context) ([]string, error)
+	DeleteRecord(ctx context.Context, name string, recordType string) error
+}
+
+// Controller reconciles the DNS records with the detected IPs and the
+// active subdomains. It holds the dependencies and the state carried
+// between reconciles, so a reconcile can run against fakes.
+type Controller struct {
+	cfg      *config.Config
+	detector ipDetector
+	dns      dnsProvider
+	caddyGen *caddy.Generator
+
+	// The trackers are nil-safe; a nil tracker disables its feature.
+	failures *detectionFailures
+	probes   *proxyProbes
+	family   *familyProbes
+	quiet    *quietHours
+	grace    *removalGrace
+	startup  *startupPush
+}
+
+// newController returns a controller with the trackers the configuration
+// enables.
+func newController(cfg *config.Config, detector ipDetector, dns dnsProvider, caddyGen *caddy.Generator) *Controller {
+	return &Controller{
+		cfg:      cfg,
+		detector: detector,
+		dns:      dns,
+		caddyGen: caddyGen,
+		failures: &detectionFailures{},
+		probes:   newProxyProbes(cfg),
+		family:   newFamilyProbes(cfg),
+		quiet:    newQuietHours(cfg, nil),
+		grace:    newRemovalGrace(cfg, nil),
+		startup:  newStartupPush(cfg),
+	}
+}
+
+// Run loads the initial services, starts discovery polling or mappings
+// watching, and reconciles on the IP-check schedule, on every signal from
+// reconnect and every RECONCILE_INTERVAL until ctx is cancelled.
+func (c *Controller) Run(
+	ctx context.Context,
+	mappingMgr *mapping.Manager,
+	discoveryClient *discovery.Client,
+	ready *readiness,
+	reconnect <-chan struct{},
+) {
+	// Load initial services BEFORE IP update (so subdomains are known).
+	// YAML mappings were already loaded by main (see loadInitialMappings).
+	var initialServices []discovery.Service
+	initialFetched := false
+	fallback := newDiscoveryFallback(c.cfg, c.caddyGen, nil)
+	if discoveryClient != nil {
+		// Discovery mode: fetch services from stevedore socket
+		services, err := discoveryClient.GetIngressServices(ctx)
+		if err != nil {
+			slog.Error("Failed to fetch initial services from discovery", "error", err)
+			fallback.failed(ctx)
+		} else {
+			slog.Info("Loaded services from discovery", "count", len(services))
+			c.caddyGen.UpdateDiscoveredServices(services)
+			initialServices = append([]discovery.Service(nil), services...)
+			initialFetched = true
+		}
+	}
+
+	// Generate initial Caddy config
+	if err := generateTimed(ctx, c.caddyGen); err != nil {
+		slog.Error("Failed to generate Caddy config", "error", err)
+	}
+
+	// Initial IP detection and DNS update (after discovery, so subdomains
+	// are known) and before discovery polling or mappings watching starts,
+	// unless the startup jitter or alignment delays it; then periodic IP
+	// checks.
+	schedule := newCheckSchedule(c.cfg.IPCheckInterval, c.cfg.IPCheckJitter, c.cfg.IPCheckAlign, nil)
+
+	reconcile := func(full bool) {
+		var snapshot *recordSnapshot
+		if full {
+			snapshot = c.ReconcileFull(ctx)
+		} else {
+			snapshot = c.Reconcile(ctx)
+		}
+		if snapshot != nil && !snapshot.failed {
+			ready.markReconciled(snapshot.IPv4, snapshot.IPv6)
+		}
+	}
+
+	first := schedule.firstDelay(time.Now())
+	if first == 0 {
+		reconcile(false)
+		first = schedule.nextDelay(time.Now())
+	} else {
+		slog.Info("Delaying first IP check", "delay", first, "aligned", schedule.align)
+	}
+
+	// Start service discovery polling or file watching
+	if discoveryClient != nil {
+		go runDiscoveryLoop(ctx, discoveryClient, c.caddyGen, initialServices, initialFetched, c.cfg.DiscoveryDryRun, c.cfg.DiscoveryDebounce, fallback)
+	} else if mappingMgr != nil {
+		go mappingMgr.Watch(ctx, func() {
+			slog.Info("Mappings changed, regenerating Caddy config")
+			if err := generateTimed(ctx, c.caddyGen); err != nil {
+				slog.Error("Failed to regenerate Caddy config", "error", err)
+			}
+		})
+	}
+
+	runReconcileLoop(ctx, schedule, first, c.cfg.ReconcileInterval, reconnect, reconcile)
+}
+
+// Reconcile runs one scheduled reconcile and returns its record snapshot,
+// or nil when IP detection failed or quiet hours skipped it.
+func (c *Controller) Reconcile(ctx context.Context) *recordSnapshot {
+	return c.reconcile(ctx, c.quiet)
+}
+
+// ReconcileFull runs a reconcile that bypasses the quiet-hours gate, to
+// heal records changed out-of-band. The records it applied are still
+// recorded there.
+func (c *Controller) ReconcileFull(ctx context.Context) *recordSnapshot {
+	return c.reconcile(ctx, nil)
+}
+
+// reconcile detects the IPs and updates the records, gated by quiet. The
+// applied records are recorded in c.quiet either way.
+func (c *Controller) reconcile(ctx context.Context, quiet *quietHours) *recordSnapshot {
+	// Debug timing of the phases and the whole cycle.
+	timer := startCycleTimer(ctx)
+	defer timer.done("Reconcile cycle timing")
+
+	// Detect current IPs. Records are kept as-is on failure unless
+	// ON_DETECTION_FAILURE=remove and consecutive detection failures persist.
+	end := timer.phase("detect")
+	ipv4, ipv6, err := c.detector.Detect(ctx)
+	end()
+	if err != nil {
+		slog.Error("Failed to detect IP addresses", "error", err)
+		if c.failures.failed(ctx, c.cfg, c.dns, c.caddyGen) {
+			c.quiet.reset()
+			c.startup.discard()
+			markSnapshotStale(c.cfg.SnapshotFile)
+		}
+		return nil
+	}
+	c.failures.succeeded()
+
+	// When DISABLE_IPV6 is set, honor the flag by dropping the detected
+	// address before any AAAA reconciliation path runs. Useful when the
+	// upstream router's WAN IPv6 is not routable to this host.
+	if c.cfg.DisableIPv6 && ipv6 != "" {
+		slog.Debug("DISABLE_IPV6 set, ignoring detected IPv6 address", "ipv6", ipv6)
+		ipv6 = ""
+	}
+
+	slog.Info("Detected IP addresses",
+		"ipv4", ipv4,
+		"ipv6", ipv6,
+	)
+
+	// FAMILY_PROBE_WITHDRAW: keep an IPv6 address that did not answer
+	// while IPv4 did out of the records until it answers again.
+	ipv6 = c.family.withhold(ipv6)
+
+	// QUIET_HOURS: an unconfirmed new IP is held back.
+	ipv4, ipv6 = quiet.gate(ipv4, ipv6)
+
+	snapshot := &recordSnapshot{Domain: c.cfg.Domain, IPv4: ipv4, IPv6: ipv6}
+
+	// MAX_MANAGED_SUBDOMAINS: a runaway active set writes nothing.
+	if !c.withinSubdomainLimit() {
+		snapshot.failed = true
+		return snapshot
+	}
+
+	plan := c.planReconcile(ipv4, ipv6)
+	planned := plan.records
+
+	// QUIET_HOURS: nothing to publish or clean up beyond what was applied.
+	if quiet.idle(ipv4, ipv6, planned, c.grace.pending()) {
+		slog.Info("Quiet hours: skipping DNS reconcile, records unchanged", "ipv4", ipv4, "ipv6", ipv6)
+		return nil
+	}
+
+	// SKIP_STARTUP_PUSH: the records persisted before the restart are
+	// still current, so the first cycle writes nothing.
+	if c.startup.unchanged(c.cfg.Domain, ipv4, ipv6, planned) {
+		slog.Info("Skipping startup DNS push: records unchanged since the last snapshot", "path", c.cfg.SnapshotFile, "records", len(planned))
+		snapshot.Records = planned
+		c.quiet.markApplied(ipv4, ipv6, planned)
+		return snapshot
+	}
+
+	// A name planned with a CNAME and another record, or planned next to a
+	// zone record it cannot share the name with, would fail at the API;
+	// refuse the whole cycle before any write instead. Without the zone
+	// records only the plan itself is checked.
+	zone, err := c.dns.ListZoneRecords(ctx)
+	if err != nil {
+		slog.Warn("Failed to list the zone records, checking the planned records only", "error", err)
+	}
+	if err := recordConflicts(planned, zone); err != nil {
+		slog.Error("CONFLICTING DNS RECORDS: skipping this DNS reconcile, fix the subdomain configuration or the records in the zone", "error", err)
+		snapshot.failed = true
+		return snapshot
+	}
+
+	// Handle DNS records based on proxy mode
+	if c.dns.IsProxied() {
+		// Proxy mode: Only update individual subdomain records
+		// We don't need root domain records in proxy mode - only the specific
+		// subdomains that services are using get DNS records
+		slog.Debug("Proxy mode: skipping root domain DNS records, updating subdomains only")
+	} else {
+		// Direct mode: Update root domain DNS records (A+AAAA grouped).
+		// APEX_PROXIED puts only the apex behind Cloudflare.
+		updates := withTTL(familyUpdates(ipv4, ipv6, c.cfg.ApexProxied), c.cfg.ApexTTL)
+		end := timer.phase("cloudflare_apex")
+		res := c.dns.UpdateNameRecords(ctx, c.cfg.Domain, updates)
+		end()
+		logNameUpdate(res, "ipv4", ipv4, "ipv6", ipv6)
+		snapshot.addNameUpdate(res, updates)
+	}
+
+	// Handle subdomain records based on proxy mode
+	if c.dns.IsProxied() {
+		// Proxy mode: create individual subdomain records (required for Cloudflare Universal SSL)
+		end := timer.phase("cloudflare_subdomains")
+		c.updateSubdomainRecords(ctx, plan, snapshot)
+		end()
+	} else {
+		// Direct mode: use wildcard records, with the apex TTL. Subdomains
+		// get no records of their own, so ip_override cannot apply.
+		if overrides := c.caddyGen.IPOverrides(); len(overrides) > 0 {
+			slog.Warn("ip_override ignored: without CLOUDFLARE_PROXY only the apex and wildcard records are published",
+				"subdomains", slices.Sorted(maps.Keys(overrides)))
+		}
+		updates := withTTL(familyUpdates(ipv4, ipv6, c.dns.IsProxied()), c.cfg.ApexTTL)
+		end := timer.phase("cloudflare_wildcard")
+		res := c.dns.UpdateNameRecords(ctx, "*."+c.cfg.Domain, updates)
+		end()
+		logNameUpdate(res, "ipv4", ipv4, "ipv6", ipv6)
+		snapshot.addNameUpdate(res, updates)
+		if c.cfg.DirectRemoveSubdomainRecords {
+			c.removeRedundantSubdomainRecords(ctx, res, updates)
+		}
+	}
+
+	if c.cfg.ManageWWW {
+		end := timer.phase("cloudflare_www")
+		updateWWWRecord(ctx, c.cfg, c.dns, c.caddyGen, snapshot)
+		end()
+	}
+
+	// If IPv6 is disabled, ensure no AAAA records are left over from prior
+	// runs: delete them idempotently for the root, the wildcard, and every
+	// currently-active subdomain. DeleteRecord is a no-op when the record
+	// doesn't exist.
+	if c.cfg.DisableIPv6 {
+		end := timer.phase("cloudflare_purge_aaaa")
+		purgeAAAARecords(ctx, c.cfg, c.dns, c.caddyGen)
+		end()
+	}
+
+	c.family.observe(ctx, c.dns, snapshot)
+	if c.cfg.SnapshotFile != "" {
+		writeSnapshot(c.cfg, c.caddyGen, snapshot)
+	}
+	c.probes.observe(ctx, snapshot)
+	if !snapshot.failed {
+		c.quiet.markApplied(ipv4, ipv6, planned)
+	}
+	return snapshot
+}
+
+// updateSubdomainRecords creates/updates individual subdomain DNS records.
+// This is required when Cloudflare proxy is enabled because Cloudflare Universal SSL
+// doesn't cover wildcard subdomains (*.domain.com).
+//
+// Mixed mode: subdomains marked direct in stevedore discovery are published as
+// grey-cloud (Proxied=false) so Caddy can terminate TLS with its own LE cert.
+// Other subdomains keep orange-cloud (Proxied=true) behavior, and IPv6 is
+// handled by Cloudflare edge automatically — only A records are emitted for
+// proxied subdomains. Direct subdomains additionally receive AAAA records when
+// an IPv6 address is known, because clients connect to the origin directly.
+func (c *Controller) updateSubdomainRecords(ctx context.Context, plan *reconcilePlan, snapshot *recordSnapshot) {
+	// Active subdomains from Caddy config, as planned for this cycle
+	activeSubdomains := plan.active
+
+	// An empty active set is more likely a discovery hiccup than an intent
+	// to unpublish everything, so the cleanup keeps the records unless
+	// ALLOW_EMPTY_RECONCILE is set.
+	keepStale := len(activeSubdomains) == 0 && !c.cfg.AllowEmptyReconcile
+	if keepStale {
+		slog.Warn("NO ACTIVE SUBDOMAINS: skipping stale DNS record cleanup to avoid removing every managed record; set ALLOW_EMPTY_RECONCILE=true if this is intended")
+	}
+
+	activeSubdomains = withCatchall(c.cfg, activeSubdomains)
+	activeFQDNs := activeFQDNSet(c.cfg, activeSubdomains)
+
+	slog.Info("Updating subdomain DNS records",
+		"prefix_mode", c.cfg.SubdomainPrefix,
+		"active_subdomains", len(activeSubdomains),
+		"catchall", c.cfg.CatchallSubdomain,
+	)
+
+	desired := plan.subdomains
+
+	// DNS_PLAN: diff against the records in Cloudflare and apply only the
+	// changes. If the records cannot be listed, fall back to publishing
+	// every record.
+	if c.cfg.DNSPlan {
+		actual, err := c.dns.ListManagedRecords(ctx)
+		if err == nil {
+			var records []snapshotRecord
+			for _, d := range desired {
+				for _, u := range d.updates {
+					records = append(records, snapshotRecord{Name: d.fqdn, Type: u.Type, Content: u.Content, Proxied: u.Proxied})
+				}
+			}
+			plan := planRecords(c.cfg, records, actual)
+			if keepStale {
+				plan.Delete = nil
+			}
+			// Names published outside the plan (the www alias) stay, as
+			// do names still within the removal grace period.
+			plan.Delete = slices.DeleteFunc(plan.Delete, func(r plannedRecord) bool {
+				return activeFQDNs[strings.ToLower(r.Name)]
+			})
+			var staleNames []string
+			for _, r := range plan.Delete {
+				staleNames = append(staleNames, r.Name)
+			}
+			due := c.grace.reap(staleNames)
+			plan.Delete = slices.DeleteFunc(plan.Delete, func(r plannedRecord) bool {
+				return !due[strings.ToLower(r.Name)]
+			})
+			applyDNSPlan(ctx, c.cfg, c.dns, plan, snapshot)
+			return
+		}
+		slog.Error("Failed to list DNS records for the plan, updating all records", "error", err)
+	}
+
+	for _, d := range desired {
+		res := c.dns.UpdateNameRecords(ctx, d.fqdn, d.updates)
+		logNameUpdate(res, "subdomain", d.subdomain, "direct", d.direct)
+		snapshot.addNameUpdate(res, d.updates)
+	}
+
+	if keepStale {
+		return
+	}
+
+	// Clean up old subdomain records that are no longer active (terraform-like reconciliation)
+	// Get all records of the managed types from Cloudflare that belong to this deployment.
+	// A failed list skips the cleanup: deleting based on incomplete data could
+	// remove live records.
+	existing, err := c.dns.ListManagedRecords(ctx)
+	if err != nil {
+		slog.Error("Failed to get existing DNS records, skipping stale record cleanup", "error", err)
+		snapshot.failed = true
+		return
+	}
+
+	slog.Debug("DNS reconciliation",
+		"existing_records", len(existing),
+		"active_fqdns", len(activeFQDNs),
+	)
+
+	// Delete records that exist in Cloudflare but shouldn't (stale records).
+	// Only managed types are listed, so other records of the same name stay.
+	// Names removed less than REMOVAL_GRACE ago are kept for now.
+	var staleNames []string
+	for _, r := range existing {
+		if !activeFQDNs[strings.ToLower(r.Name)] {
+			staleNames = append(staleNames, r.Name)
+		}
+	}
+	due := c.grace.reap(staleNames)
+	var stale []cloudflare.ManagedRecord
+	for _, r := range existing {
+		if due[strings.ToLower(r.Name)] {
+			stale = append(stale, r)
+		}
+	}
+	if _, err := deleteStaleRecords(ctx, c.dns, stale, c.cfg.StaleCleanupConcurrency, c.cfg.StaleCleanupTimeout); err != nil {
+		slog.Warn("Stale DNS record cleanup incomplete", "stale", len(stale), "error", err)
+	}
+}
+
+// withCatchall appends the 451 catchall to the active subdomains unless it
+// is one of them already.
+func withCatchall(cfg *config.Config, activeSubdomains []string) []string {
+	if cfg.CatchallSubdomain != "" && !slices.Contains(activeSubdomains, cfg.CatchallSubdomain) {
+		activeSubdomains = append(activeSubdomains, cfg.CatchallSubdomain)
+	}
+	return activeSubdomains
+}
+
+// subdomainUpdate is the records one subdomain is published with.
+type subdomainUpdate struct {
+	subdomain string
+	fqdn      string
+	direct    bool
+	updates   []cloudflare.RecordUpdate
+}
+
+// subdomainUpdates returns the records of each active subdomain. The 451
+// catchall always behaves as direct-mode: its own LE cert, grey-cloud.
+func (c *Controller) subdomainUpdates(activeSubdomains []string, ipv4, ipv6 string) []subdomainUpdate {
+	overrides := c.caddyGen.IPOverrides()
+	var desired []subdomainUpdate
+	for _, subdomain := range activeSubdomains {
+		fqdn := c.cfg.GetSubdomainFQDN(subdomain)
+		direct := c.caddyGen.IsSubdomainDirect(subdomain) || subdomain == c.cfg.CatchallSubdomain
+		proxied := !direct
+
+		// An ip_override pins the subdomain to fixed addresses (e.g. an
+		// external VPS) in place of the detected ones.
+		subIPv4, subIPv6 := ipv4, ipv6
+		if o, ok := overrides[subdomain]; ok {
+			subIPv4, subIPv6 = o.IPv4, o.IPv6
+		}
+
+		// AAAA records only make sense when the client reaches the origin directly.
+		// In proxied mode Cloudflare provides IPv6 to clients while connecting to
+		// the origin over IPv4; adding an AAAA would expose the origin's IPv6.
+		if !direct {
+			subIPv6 = ""
+		}
+		desired = append(desired, subdomainUpdate{
+			subdomain: subdomain,
+			fqdn:      fqdn,
+			direct:    direct,
+			updates:   familyUpdates(subIPv4, subIPv6, proxied),
+		})
+	}
+	return desired
+}
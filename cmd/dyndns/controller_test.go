@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/cloudflare"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+)
+
+// memoryDNS is an in-memory dnsProvider keyed by lowercased name and type.
+type memoryDNS struct {
+	proxied bool
+
+	mu      sync.Mutex
+	records map[[2]string]cloudflare.ManagedRecord
+}
+
+func newMemoryDNS(proxied bool, records ...cloudflare.ManagedRecord) *memoryDNS {
+	m := &memoryDNS{proxied: proxied, records: make(map[[2]string]cloudflare.ManagedRecord)}
+	for _, r := range records {
+		m.records[[2]string{strings.ToLower(r.Name), r.Type}] = r
+	}
+	return m
+}
+
+func (m *memoryDNS) IsProxied() bool { return m.proxied }
+
+func (m *memoryDNS) UpdateNameRecords(_ context.Context, name string, updates []cloudflare.RecordUpdate) *cloudflare.NameUpdateResult {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := &cloudflare.NameUpdateResult{Name: name}
+	for _, u := range updates {
+		m.records[[2]string{strings.ToLower(name), u.Type}] = cloudflare.ManagedRecord{Name: name, Type: u.Type, Content: u.Content, Proxied: u.Proxied}
+		res.Updated = append(res.Updated, u.Type)
+	}
+	return res
+}
+
+func (m *memoryDNS) ListManagedRecords(context.Context) ([]cloudflare.ManagedRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []cloudflare.ManagedRecord
+	for _, r := range m.records {
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+func (m *memoryDNS) ListZoneRecords(ctx context.Context) ([]cloudflare.ManagedRecord, error) {
+	return m.ListManagedRecords(ctx)
+}
+
+func (m *memoryDNS) GetManagedRecordFQDNs(ctx context.Context) ([]string, error) {
+	records, _ := m.ListManagedRecords(ctx)
+	var names []string
+	for _, r := range records {
+		names = append(names, r.Name)
+	}
+	return names, nil
+}
+
+func (m *memoryDNS) DeleteRecord(_ context.Context, name, recordType string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.records, [2]string{strings.ToLower(name), recordType})
+	return nil
+}
+
+func (m *memoryDNS) list() []snapshotRecord {
+	records, _ := m.ListManagedRecords(context.Background())
+	var out []snapshotRecord
+	for _, r := range records {
+		out = append(out, snapshotRecord{Name: r.Name, Type: r.Type, Content: r.Content, Proxied: r.Proxied})
+	}
+	sortRecords(out)
+	return out
+}
+
+// TestController_Reconcile runs a proxy-mode reconcile against fake
+// detection and DNS: proxied subdomains get an orange-cloud A, direct ones
+// a grey-cloud A and AAAA, and records of removed subdomains are deleted.
+func TestController_Reconcile(t *testing.T) {
+	cfg := &config.Config{Domain: "example.com", CloudflareProxy: true}
+	dns := newMemoryDNS(true,
+		cloudflare.ManagedRecord{Name: "app.example.com", Type: "A", Content: "198.51.100.1", Proxied: true},
+		cloudflare.ManagedRecord{Name: "old.example.com", Type: "A", Content: "198.51.100.1", Proxied: true},
+	)
+	gen := caddy.New(cfg, nil)
+	gen.UpdateDiscoveredServices([]discovery.Service{
+		{Subdomain: "app", Port: 8080},
+		{Subdomain: "git", Port: 3000, Direct: true},
+	})
+	controller := newController(cfg, &staticDetector{ipv4: "203.0.113.10", ipv6: "2001:db8::10"}, dns, gen)
+
+	snapshot := controller.Reconcile(context.Background())
+	if snapshot == nil || snapshot.failed {
+		t.Fatalf("Reconcile() = %+v, want a successful snapshot", snapshot)
+	}
+
+	want := []snapshotRecord{
+		{Name: "app.example.com", Type: "A", Content: "203.0.113.10", Proxied: true},
+		{Name: "git.example.com", Type: "A", Content: "203.0.113.10"},
+		{Name: "git.example.com", Type: "AAAA", Content: "2001:db8::10"},
+	}
+	if got := dns.list(); !reflect.DeepEqual(got, want) {
+		t.Errorf("records = %+v, want %+v", got, want)
+	}
+	sortRecords(snapshot.Records)
+	if !reflect.DeepEqual(snapshot.Records, want) {
+		t.Errorf("snapshot records = %+v, want %+v", snapshot.Records, want)
+	}
+	if snapshot.IPv4 != "203.0.113.10" || snapshot.IPv6 != "2001:db8::10" {
+		t.Errorf("snapshot IPs = %q, %q", snapshot.IPv4, snapshot.IPv6)
+	}
+
+	// Detection failing keeps the records.
+	controller.detector = failingDetector{}
+	if snapshot := controller.Reconcile(context.Background()); snapshot != nil {
+		t.Errorf("Reconcile() with failing detection = %+v, want nil", snapshot)
+	}
+	if got := dns.list(); !reflect.DeepEqual(got, want) {
+		t.Errorf("records after failed detection = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+)
+
+// ipDetector is the part of *ipdetect.Detector the reconcile uses.
+type ipDetector interface {
+	Detect(ctx context.Context) (ipv4, ipv6 string, err error)
+}
+
+// detectionFailures counts consecutive IP detection failures and applies
+// the ON_DETECTION_FAILURE policy. A nil tracker keeps the records.
+type detectionFailures struct {
+	count int
+	// removed is set once the records were deleted, so later failures
+	// don't repeat the deletion until detection recovers.
+	removed bool
+}
+
+// failed records a detection failure. Under the remove policy, reaching the
+// threshold deletes the managed records; a deletion that fails is retried
+// on the next failure. It reports whether records were deleted.
+func (f *detectionFailures) failed(ctx context.Context, cfg *config.Config, cfClient dnsProvider, caddyGen *caddy.Generator) bool {
+	if f == nil {
+		return false
+	}
+	f.count++
+	if cfg.OnDetectionFailure != config.DetectionFailureRemove || f.removed || f.count < cfg.OnDetectionFailureThreshold {
+		return false
+	}
+
+	slog.Warn("IP detection failed repeatedly, removing managed DNS records (ON_DETECTION_FAILURE=remove)",
+		"consecutive_failures", f.count)
+	f.removed = removeManagedRecords(ctx, cfg, cfClient, caddyGen)
+	return true
+}
+
+// succeeded resets the failure count after a successful detection.
+func (f *detectionFailures) succeeded() {
+	if f == nil {
+		return
+	}
+	if f.removed {
+		slog.Info("IP detection recovered, republishing DNS records", "failures", f.count)
+	}
+	f.count = 0
+	f.removed = false
+}
+
+// removeManagedRecords deletes the A and AAAA records dyndns publishes: the
+// root and wildcard in direct mode, the subdomain records in proxy mode.
+// Reports whether every deletion succeeded.
+func removeManagedRecords(ctx context.Context, cfg *config.Config, cfClient dnsProvider, caddyGen *caddy.Generator) bool {
+	var names []string
+	if cfClient.IsProxied() {
+		managed, err := cfClient.GetManagedRecordFQDNs(ctx)
+		if err != nil {
+			slog.Error("Failed to list managed DNS records, removing active subdomains only", "error", err)
+		}
+		names = append(names, managed...)
+		for _, sub := range caddyGen.GetActiveSubdomains() {
+			names = append(names, cfg.GetSubdomainFQDN(sub))
+		}
+		if cfg.CatchallSubdomain != "" {
+			names = append(names, cfg.GetSubdomainFQDN(cfg.CatchallSubdomain))
+		}
+	} else {
+		names = []string{cfg.Domain, "*." + cfg.Domain}
+	}
+	return deleteAddressRecords(ctx, cfClient, names)
+}
+
+// deleteAddressRecords deletes the A and AAAA records of each distinct
+// name and reports whether every deletion succeeded.
+func deleteAddressRecords(ctx context.Context, cfClient dnsProvider, names []string) bool {
+	ok := true
+	seen := make(map[string]bool)
+	for _, name := range names {
+		key := strings.ToLower(name)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		for _, recordType := range []string{"A", "AAAA"} {
+			if err := cfClient.DeleteRecord(ctx, name, recordType); err != nil {
+				slog.Error("Failed to remove DNS record", "fqdn", name, "type", recordType, "error", err)
+				ok = false
+			}
+		}
+	}
+	return ok
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+)
+
+// failingDetector always fails, as when every detection method is down.
+type failingDetector struct{}
+
+func (failingDetector) Detect(context.Context) (string, string, error) {
+	return "", "", errors.New("all IP detection methods failed")
+}
+
+// TestUpdateIPAndDNS_RemovesRecordsAfterDetectionFailures verifies
+// ON_DETECTION_FAILURE=remove keeps the records through failures below the
+// threshold and deletes them once it is reached.
+func TestUpdateIPAndDNS_RemovesRecordsAfterDetectionFailures(t *testing.T) {
+	fake := newFakeCloudflare(t,
+		snapshotRecord{Name: "example.com", Type: "A", Content: "203.0.113.10"},
+		snapshotRecord{Name: "*.example.com", Type: "A", Content: "203.0.113.10"},
+		snapshotRecord{Name: "other.org", Type: "A", Content: "198.51.100.1"},
+	)
+	cfg := &config.Config{
+		Domain:                      "example.com",
+		OnDetectionFailure:          config.DetectionFailureRemove,
+		OnDetectionFailureThreshold: 2,
+	}
+	cfClient := fake.client(t, cfg)
+	gen := caddy.New(cfg, nil)
+	failures := &detectionFailures{}
+
+	(&Controller{cfg: cfg, detector: failingDetector{}, dns: cfClient, caddyGen: gen, failures: failures}).Reconcile(context.Background())
+	if got := len(fake.list()); got != 3 {
+		t.Fatalf("after 1 failure: %d records, want all 3 kept: %+v", got, fake.list())
+	}
+
+	(&Controller{cfg: cfg, detector: failingDetector{}, dns: cfClient, caddyGen: gen, failures: failures}).Reconcile(context.Background())
+	remaining := fake.list()
+	if len(remaining) != 1 || remaining[0].Name != "other.org" {
+		t.Fatalf("after threshold: records = %+v, want only the unmanaged other.org", remaining)
+	}
+	if !failures.removed {
+		t.Error("removed not recorded after a successful removal")
+	}
+
+	failures.succeeded()
+	if failures.count != 0 || failures.removed {
+		t.Errorf("after recovery: count=%d removed=%v, want reset", failures.count, failures.removed)
+	}
+}
+
+// TestUpdateIPAndDNS_KeepsRecordsByDefault verifies the default keep
+// policy never removes records, however many detections fail.
+func TestUpdateIPAndDNS_KeepsRecordsByDefault(t *testing.T) {
+	fake := newFakeCloudflare(t, snapshotRecord{Name: "example.com", Type: "A", Content: "203.0.113.10"})
+	cfg := &config.Config{
+		Domain:                      "example.com",
+		OnDetectionFailure:          config.DetectionFailureKeep,
+		OnDetectionFailureThreshold: 1,
+	}
+	cfClient := fake.client(t, cfg)
+	failures := &detectionFailures{}
+
+	for i := 0; i < 3; i++ {
+		(&Controller{cfg: cfg, detector: failingDetector{}, dns: cfClient, caddyGen: caddy.New(cfg, nil), failures: failures}).Reconcile(context.Background())
+	}
+	if got := len(fake.list()); got != 1 {
+		t.Errorf("records = %d, want 1 kept", got)
+	}
+	if failures.count != 3 {
+		t.Errorf("count = %d, want 3", failures.count)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/cloudflare"
+)
+
+// removeRedundantSubdomainRecords deletes, in direct mode, the managed
+// per-subdomain records the wildcard covers: a record under the domain
+// whose type was just published on the wildcard with the same address.
+// Records with another address (e.g. pinned by hand) are kept, as is the
+// www alias.
+func (c *Controller) removeRedundantSubdomainRecords(ctx context.Context, res *cloudflare.NameUpdateResult, updates []cloudflare.RecordUpdate) {
+	wildcard := make(map[string]string)
+	for _, u := range updates {
+		if slices.Contains(res.Updated, u.Type) {
+			wildcard[u.Type] = u.Content
+		}
+	}
+	if len(wildcard) == 0 {
+		return
+	}
+
+	existing, err := c.dns.ListManagedRecords(ctx)
+	if err != nil {
+		slog.Error("Failed to get existing DNS records, skipping redundant subdomain record cleanup", "error", err)
+		return
+	}
+	domain := strings.ToLower(c.cfg.Domain)
+	www := strings.ToLower(wwwFQDN(c.cfg))
+	var redundant []cloudflare.ManagedRecord
+	for _, r := range existing {
+		name := strings.ToLower(r.Name)
+		if !strings.HasSuffix(name, "."+domain) || (c.cfg.ManageWWW && name == www) {
+			continue
+		}
+		if content, ok := wildcard[r.Type]; ok && r.Content == content {
+			redundant = append(redundant, r)
+		}
+	}
+	if len(redundant) == 0 {
+		return
+	}
+
+	slog.Info("Removing subdomain records covered by the wildcard", "records", len(redundant), "wildcard", "*."+c.cfg.Domain)
+	if _, err := deleteStaleRecords(ctx, c.dns, redundant, c.cfg.StaleCleanupConcurrency, c.cfg.StaleCleanupTimeout); err != nil {
+		slog.Warn("Redundant subdomain record cleanup incomplete", "records", len(redundant), "error", err)
+	}
+}
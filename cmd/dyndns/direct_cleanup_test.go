@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/ipdetect"
+)
+
+// TestUpdateIPAndDNS_DirectRemovesRedundantSubdomainRecords verifies that
+// after switching to direct mode the per-subdomain records left from proxy
+// mode are removed once the wildcard covers them with the same address,
+// while a record with another address is kept.
+func TestUpdateIPAndDNS_DirectRemovesRedundantSubdomainRecords(t *testing.T) {
+	proxyModeRecords := []snapshotRecord{
+		{Name: "app.example.com", Type: "A", Content: "203.0.113.10", Proxied: true},
+		{Name: "git.example.com", Type: "A", Content: "203.0.113.10"},
+		{Name: "git.example.com", Type: "AAAA", Content: "2001:db8::10"},
+		{Name: "vps.example.com", Type: "A", Content: "198.51.100.7"},
+	}
+	tests := []struct {
+		name   string
+		remove bool
+		want   []snapshotRecord
+	}{
+		{
+			name:   "enabled",
+			remove: true,
+			want: []snapshotRecord{
+				{Name: "*.example.com", Type: "A", Content: "203.0.113.10"},
+				{Name: "*.example.com", Type: "AAAA", Content: "2001:db8::10"},
+				{Name: "example.com", Type: "A", Content: "203.0.113.10"},
+				{Name: "example.com", Type: "AAAA", Content: "2001:db8::10"},
+				{Name: "vps.example.com", Type: "A", Content: "198.51.100.7"},
+			},
+		},
+		{
+			name: "disabled",
+			want: append([]snapshotRecord{
+				{Name: "*.example.com", Type: "A", Content: "203.0.113.10"},
+				{Name: "*.example.com", Type: "AAAA", Content: "2001:db8::10"},
+				{Name: "example.com", Type: "A", Content: "203.0.113.10"},
+				{Name: "example.com", Type: "AAAA", Content: "2001:db8::10"},
+			}, proxyModeRecords...),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeCloudflare(t, proxyModeRecords...)
+			cfg := &config.Config{
+				Domain:                       "example.com",
+				ManualIPv4:                   "203.0.113.10",
+				ManualIPv6:                   "2001:db8::10",
+				DirectRemoveSubdomainRecords: tt.remove,
+			}
+			cfClient := fake.client(t, cfg)
+
+			(&Controller{cfg: cfg, detector: ipdetect.New(cfg), dns: cfClient, caddyGen: caddy.New(cfg, nil)}).Reconcile(context.Background())
+
+			want := append([]snapshotRecord(nil), tt.want...)
+			sortRecords(want)
+			if got := fake.list(); fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("records = %+v\nwant %+v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+)
+
+// discoveryDebounceMaxWindows bounds how long changes are held: at most
+// this many windows after the first pending change, so a service flapping
+// faster than the window cannot starve regeneration.
+const discoveryDebounceMaxWindows = 5
+
+// discoveryApplier applies discovered services to the generator, coalescing
+// bursts: with a non-zero window, changes are held until no new change
+// arrived for the window, or at most maxWait after the first pending
+// change, then only the latest services are applied.
+type discoveryApplier struct {
+	window  time.Duration
+	maxWait time.Duration
+	// now returns the current time; injectable for tests.
+	now func() time.Time
+	// apply regenerates for services and returns the list to compare the
+	// next change against (see applyDiscoveredServices).
+	apply func(services, last []discovery.Service) []discovery.Service
+
+	mu sync.Mutex
+	// last is the service list most recently applied.
+	last []discovery.Service
+	// pending is the latest unapplied service list while timer runs;
+	// pendingSince is when the first of its changes arrived.
+	pending      []discovery.Service
+	pendingSince time.Time
+	timer        *time.Timer
+}
+
+func newDiscoveryApplier(caddyGen *caddy.Generator, last []discovery.Service, dryRun bool, window time.Duration) *discoveryApplier {
+	return &discoveryApplier{
+		window:  window,
+		maxWait: discoveryDebounceMaxWindows * window,
+		now:     time.Now,
+		apply: func(services, last []discovery.Service) []discovery.Service {
+			return applyDiscoveredServices(caddyGen, services, last, dryRun)
+		},
+		last: last,
+	}
+}
+
+// submit schedules services to be applied once the window settles or
+// maxWait passed since the first pending change, or applies them right
+// away when debouncing is disabled.
+func (a *discoveryApplier) submit(services []discovery.Service) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.window <= 0 {
+		a.last = a.apply(services, a.last)
+		return
+	}
+	a.pending = services
+	if a.timer == nil {
+		a.pendingSince = a.now()
+		a.timer = time.AfterFunc(a.window, a.flush)
+		return
+	}
+	a.timer.Reset(max(min(a.window, a.pendingSince.Add(a.maxWait).Sub(a.now())), 0))
+}
+
+// applyNow applies services immediately, superseding any pending change.
+func (a *discoveryApplier) applyNow(services []discovery.Service) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.stopLocked()
+	a.last = a.apply(services, a.last)
+}
+
+// flush applies the pending services once the window settled.
+func (a *discoveryApplier) flush() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.timer == nil {
+		return
+	}
+	services := a.pending
+	a.stopLocked()
+	a.last = a.apply(services, a.last)
+}
+
+// stop drops any pending change.
+func (a *discoveryApplier) stop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.stopLocked()
+}
+
+func (a *discoveryApplier) stopLocked() {
+	if a.timer != nil {
+		a.timer.Stop()
+		a.timer = nil
+	}
+	a.pending = nil
+}
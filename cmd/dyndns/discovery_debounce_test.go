@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+)
+
+// TestDiscoveryApplier_CoalescesBurst verifies a burst of discovery changes
+// inside the debounce window is applied once, with the latest services.
+func TestDiscoveryApplier_CoalescesBurst(t *testing.T) {
+	var mu sync.Mutex
+	var applied [][]discovery.Service
+	a := newDiscoveryApplier(nil, nil, false, 200*time.Millisecond)
+	a.apply = func(services, _ []discovery.Service) []discovery.Service {
+		mu.Lock()
+		defer mu.Unlock()
+		applied = append(applied, services)
+		return services
+	}
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(applied)
+	}
+
+	const n = 10
+	for i := 0; i < n; i++ {
+		a.submit([]discovery.Service{{Subdomain: fmt.Sprintf("app%d", i), Port: 8080}})
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := count(); got != 0 {
+		t.Fatalf("applied %d times during the burst, want 0", got)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for count() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(applied) != 1 {
+		t.Fatalf("%d rapid updates applied %d times, want 1", n, len(applied))
+	}
+	if got := applied[0]; len(got) != 1 || got[0].Subdomain != fmt.Sprintf("app%d", n-1) {
+		t.Errorf("applied %+v, want the latest services (app%d)", got, n-1)
+	}
+}
+
+// TestDiscoveryApplier_NoWindow verifies a zero window applies every change
+// immediately.
+func TestDiscoveryApplier_NoWindow(t *testing.T) {
+	calls := 0
+	a := newDiscoveryApplier(nil, nil, false, 0)
+	a.apply = func(services, _ []discovery.Service) []discovery.Service {
+		calls++
+		return services
+	}
+	for i := 0; i < 3; i++ {
+		a.submit([]discovery.Service{{Subdomain: fmt.Sprintf("app%d", i)}})
+	}
+	if calls != 3 {
+		t.Errorf("applied %d times, want 3", calls)
+	}
+}
+
+// TestDiscoveryApplier_MaxWait verifies changes arriving more often than
+// the window are still applied once maxWait passed since the first one.
+func TestDiscoveryApplier_MaxWait(t *testing.T) {
+	var mu sync.Mutex
+	var applied [][]discovery.Service
+	a := newDiscoveryApplier(nil, nil, false, 100*time.Millisecond)
+	a.apply = func(services, _ []discovery.Service) []discovery.Service {
+		mu.Lock()
+		defer mu.Unlock()
+		applied = append(applied, services)
+		return services
+	}
+	defer a.stop()
+
+	// Flap every 20ms for well over maxWait (500ms).
+	start := time.Now()
+	for i := 0; time.Since(start) < 1200*time.Millisecond; i++ {
+		a.submit([]discovery.Service{{Subdomain: fmt.Sprintf("app%d", i), Port: 8080}})
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(applied) < 2 {
+		t.Fatalf("applied %d times during a 1.2s flap with a 500ms max wait, want at least 2", len(applied))
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/mapping"
+)
+
+// discoveryFallback routes the YAML mappings file while discovery is
+// unreachable (DISCOVERY_FALLBACK_AFTER), so a standalone config keeps
+// serving when the stevedore socket never comes up. A nil
+// *discoveryFallback never falls back.
+type discoveryFallback struct {
+	after time.Duration
+	path  string
+	// unknownFields is the MAPPINGS_UNKNOWN_FIELDS policy.
+	unknownFields string
+	gen           *caddy.Generator
+	// now returns the current time; injectable for tests.
+	now func() time.Time
+
+	// failingSince is when the current run of discovery failures started;
+	// zero while discovery answers.
+	failingSince time.Time
+	// stopWatch stops watching the mappings file; non-nil while the
+	// fallback is active.
+	stopWatch context.CancelFunc
+}
+
+// newDiscoveryFallback returns the fallback, or nil when it is disabled.
+func newDiscoveryFallback(cfg *config.Config, gen *caddy.Generator, now func() time.Time) *discoveryFallback {
+	if cfg.DiscoveryFallbackAfter <= 0 {
+		return nil
+	}
+	if now == nil {
+		now = time.Now
+	}
+	return &discoveryFallback{
+		after:         cfg.DiscoveryFallbackAfter,
+		path:          cfg.MappingsFile,
+		unknownFields: cfg.MappingsUnknownFields,
+		gen:           gen,
+		now:           now,
+	}
+}
+
+// failed records a failed discovery request and activates the fallback
+// once discovery has been failing for the configured duration.
+func (f *discoveryFallback) failed(ctx context.Context) {
+	if f == nil || f.stopWatch != nil {
+		return
+	}
+	now := f.now()
+	if f.failingSince.IsZero() {
+		f.failingSince = now
+	}
+	unreachable := now.Sub(f.failingSince)
+	if unreachable < f.after {
+		return
+	}
+
+	mgr := mapping.New(f.path)
+	mgr.SetUnknownFields(f.unknownFields)
+	if err := mgr.Load(); err != nil {
+		slog.Error("Failed to load fallback mappings", "path", f.path, "error", err)
+	}
+	slog.Warn("DISCOVERY UNREACHABLE: falling back to the YAML mappings file until it recovers",
+		"path", f.path, "unreachable_for", unreachable.Round(time.Second), "mappings", len(mgr.Get()))
+
+	watchCtx, stop := context.WithCancel(ctx)
+	f.stopWatch = stop
+	f.gen.SetMappingManager(mgr)
+	f.regenerate()
+	go mgr.Watch(watchCtx, func() {
+		slog.Info("Fallback mappings changed, regenerating Caddy config")
+		f.regenerate()
+	})
+}
+
+// succeeded records a discovery response, dropping the fallback mappings
+// if they were active.
+func (f *discoveryFallback) succeeded() {
+	if f == nil {
+		return
+	}
+	f.failingSince = time.Time{}
+	if f.stopWatch == nil {
+		return
+	}
+	f.stopWatch()
+	f.stopWatch = nil
+	f.gen.SetMappingManager(nil)
+	slog.Info("Discovery reachable again, dropping the fallback YAML mappings", "path", f.path)
+	f.regenerate()
+}
+
+func (f *discoveryFallback) regenerate() {
+	if err := generateTimed(context.Background(), f.gen); err != nil {
+		slog.Error("Failed to regenerate Caddy config", "error", err)
+	}
+}
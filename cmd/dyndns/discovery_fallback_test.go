@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+)
+
+// TestRunDiscoveryLoop_FallsBackToMappings verifies that once discovery
+// has been unreachable for DISCOVERY_FALLBACK_AFTER the YAML mappings are
+// routed, and that they are dropped when discovery answers again.
+func TestRunDiscoveryLoop_FallsBackToMappings(t *testing.T) {
+	oldDelay := discoveryRetryDelay
+	discoveryRetryDelay = 10 * time.Millisecond
+	t.Cleanup(func() { discoveryRetryDelay = oldDelay })
+
+	// Unix socket paths are length-limited; keep it short.
+	dir, err := os.MkdirTemp("", "dyndns")
+	if err != nil {
+		t.Fatalf("MkdirTemp: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socketPath := filepath.Join(dir, "s.sock")
+
+	mappingsPath := filepath.Join(dir, "mappings.yaml")
+	content := `mappings:
+  - subdomain: standalone
+    target: "app:8080"
+`
+	if err := os.WriteFile(mappingsPath, []byte(content), 0644); err != nil {
+		t.Fatalf("write mappings: %v", err)
+	}
+
+	cfg := &config.Config{
+		Domain:                 "example.com",
+		CaddyFile:              filepath.Join(dir, "Caddyfile"),
+		MappingsFile:           mappingsPath,
+		DiscoveryFallbackAfter: 100 * time.Millisecond,
+	}
+	gen := caddy.New(cfg, nil)
+	gen.TemplateContent = "{{range .Mappings}}{{.FQDN}}\n{{end}}"
+	client := discovery.New(discovery.Config{SocketPath: socketPath, Token: "test-token"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan struct{})
+	go func() {
+		runDiscoveryLoop(ctx, client, gen, nil, false, false, 0, newDiscoveryFallback(cfg, gen, nil))
+		close(done)
+	}()
+
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	waitFor("the fallback mappings", func() bool {
+		return slices.Equal(gen.GetActiveSubdomains(), []string{"standalone"})
+	})
+	if elapsed := time.Since(start); elapsed < cfg.DiscoveryFallbackAfter {
+		t.Errorf("fell back after %v, before DISCOVERY_FALLBACK_AFTER", elapsed)
+	}
+	written, err := os.ReadFile(cfg.CaddyFile)
+	if err != nil || string(written) != "standalone.example.com\n" {
+		t.Errorf("Caddyfile = %q, %v; want the fallback mapping", written, err)
+	}
+
+	// Discovery comes up with a service of its own.
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Failed to create socket: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/services", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[{"deployment": "app", "container_name": "app-1", "ingress": {"enabled": true, "subdomain": "app", "port": 8080}}]`)
+	})
+	mux.HandleFunc("/poll", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"changed": false, "timestamp": %d}`, time.Now().Unix())
+	})
+	server := &http.Server{Handler: mux}
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(func() { server.Close() })
+
+	waitFor("discovery to replace the fallback mappings", func() bool {
+		return slices.Equal(gen.GetActiveSubdomains(), []string{"app"})
+	})
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("runDiscoveryLoop did not stop after cancel")
+	}
+}
+
+// TestDiscoveryFallback_ResetsOnSuccess verifies a discovery response
+// restarts the unreachable window.
+func TestDiscoveryFallback_ResetsOnSuccess(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	cfg := &config.Config{
+		Domain:                 "example.com",
+		CaddyFile:              filepath.Join(t.TempDir(), "Caddyfile"),
+		MappingsFile:           filepath.Join(t.TempDir(), "missing.yaml"),
+		DiscoveryFallbackAfter: time.Minute,
+	}
+	gen := caddy.New(cfg, nil)
+	gen.TemplateContent = "{{range .Mappings}}{{.FQDN}}\n{{end}}"
+	f := newDiscoveryFallback(cfg, gen, func() time.Time { return now })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	f.failed(ctx)
+	now = now.Add(50 * time.Second)
+	f.succeeded()
+	now = now.Add(time.Second)
+	f.failed(ctx)
+	now = now.Add(50 * time.Second)
+	f.failed(ctx)
+	if f.stopWatch != nil {
+		t.Fatal("fallback active although discovery answered within the window")
+	}
+
+	now = now.Add(10 * time.Second)
+	f.failed(ctx)
+	if f.stopWatch == nil {
+		t.Fatal("fallback not active after a full unreachable window")
+	}
+
+	if newDiscoveryFallback(&config.Config{}, gen, nil) != nil {
+		t.Error("fallback enabled without DISCOVERY_FALLBACK_AFTER")
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+)
+
+// TestRunDiscoveryLoop_ReconcilesAfterFailedStartupFetch verifies that when
+// the startup GetIngressServices call failed, the discovery loop fetches the
+// services itself even though every poll reports changed=false.
+func TestRunDiscoveryLoop_ReconcilesAfterFailedStartupFetch(t *testing.T) {
+	oldDelay := discoveryRetryDelay
+	discoveryRetryDelay = 10 * time.Millisecond
+	t.Cleanup(func() { discoveryRetryDelay = oldDelay })
+
+	// Unix socket paths are length-limited; keep it short.
+	dir, err := os.MkdirTemp("", "dyndns")
+	if err != nil {
+		t.Fatalf("MkdirTemp: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socketPath := filepath.Join(dir, "s.sock")
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Failed to create socket: %v", err)
+	}
+
+	var serviceCalls atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/services", func(w http.ResponseWriter, r *http.Request) {
+		// The startup fetch and the first reconciliation attempt fail.
+		if serviceCalls.Add(1) <= 2 {
+			http.Error(w, "stevedore starting", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[{"deployment": "app", "container_name": "app-1", "ingress": {"enabled": true, "subdomain": "app", "port": 8080}}]`)
+	})
+	mux.HandleFunc("/poll", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"changed": false, "timestamp": %d}`, time.Now().Unix())
+	})
+	server := &http.Server{Handler: mux}
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(func() { server.Close() })
+
+	client := discovery.New(discovery.Config{SocketPath: socketPath, Token: "test-token"})
+	gen := caddy.New(&config.Config{
+		Domain:    "example.com",
+		CaddyFile: filepath.Join(dir, "Caddyfile"),
+	}, nil)
+	gen.TemplateContent = "{{range .Mappings}}{{.FQDN}}\n{{end}}"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Startup fetch, as in runControlLoop.
+	if _, err := client.GetIngressServices(ctx); err == nil {
+		t.Fatal("startup GetIngressServices() succeeded, want failure")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		runDiscoveryLoop(ctx, client, gen, nil, false, false, 0, nil)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(gen.GetActiveSubdomains()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("services were never reconciled after the failed startup fetch")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := gen.GetActiveSubdomains(); len(got) != 1 || got[0] != "app" {
+		t.Errorf("active subdomains = %v, want [app]", got)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "Caddyfile"))
+	if err != nil {
+		t.Fatalf("Caddyfile not written: %v", err)
+	}
+	if string(content) != "app.example.com\n" {
+		t.Errorf("Caddyfile = %q, want %q", content, "app.example.com\n")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("runDiscoveryLoop did not stop after cancel")
+	}
+}
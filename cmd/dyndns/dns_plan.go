@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/cloudflare"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+)
+
+// lastDNSPlan is the plan of the most recent DNS_PLAN reconcile, reported
+// by the status endpoint.
+var lastDNSPlan atomic.Pointer[dnsPlan]
+
+// dnsPlan is the difference between the desired subdomain records and the
+// managed records found in Cloudflare. Only its creates, updates and
+// deletes are applied.
+type dnsPlan struct {
+	GeneratedAt time.Time        `json:"generated_at"`
+	Create      []plannedRecord  `json:"create"`
+	Update      []plannedRecord  `json:"update"`
+	Delete      []plannedRecord  `json:"delete"`
+	Unchanged   []snapshotRecord `json:"unchanged"`
+}
+
+// plannedRecord is one change in a plan.
+type plannedRecord struct {
+	snapshotRecord
+	// Old is the record an update replaces.
+	Old *snapshotRecord `json:"old,omitempty"`
+	// OldTTL is the drifted TTL an update corrects; zero when the TTL
+	// matched.
+	OldTTL int `json:"old_ttl,omitempty"`
+}
+
+// planRecords diffs desired against actual. A desired record missing from
+// actual is created, and one whose content, proxied flag or TTL (see
+// ttlMatches) differs is updated, so dashboard edits are reverted. Actual
+// records are deleted only when their name is not desired at all, matching
+// the stale-record cleanup: a family that is merely absent from the
+// desired set (e.g. AAAA while IPv6 is undetected) is left alone. Names
+// compare case-insensitively.
+func planRecords(cfg *config.Config, desired []snapshotRecord, actual []cloudflare.ManagedRecord) *dnsPlan {
+	plan := &dnsPlan{}
+
+	existing := make(map[string]cloudflare.ManagedRecord)
+	for _, r := range actual {
+		key := strings.ToLower(r.Name) + ":" + r.Type
+		if _, dup := existing[key]; !dup {
+			existing[key] = r
+		}
+	}
+
+	desiredNames := make(map[string]bool)
+	for _, d := range desired {
+		desiredNames[strings.ToLower(d.Name)] = true
+
+		cur, ok := existing[strings.ToLower(d.Name)+":"+d.Type]
+		ttlDrifted := ok && !ttlMatches(cfg, d, cur.TTL)
+		switch {
+		case !ok:
+			plan.Create = append(plan.Create, plannedRecord{snapshotRecord: d})
+		case cur.Content != d.Content || cur.Proxied != d.Proxied || ttlDrifted:
+			old := snapshotRecord{Name: cur.Name, Type: cur.Type, Content: cur.Content, Proxied: cur.Proxied}
+			update := plannedRecord{snapshotRecord: d, Old: &old}
+			if ttlDrifted {
+				update.OldTTL = cur.TTL
+			}
+			plan.Update = append(plan.Update, update)
+		default:
+			plan.Unchanged = append(plan.Unchanged, d)
+		}
+	}
+
+	for _, r := range actual {
+		if !desiredNames[strings.ToLower(r.Name)] {
+			plan.Delete = append(plan.Delete, plannedRecord{snapshotRecord: snapshotRecord{
+				Name: r.Name, Type: r.Type, Content: r.Content, Proxied: r.Proxied,
+			}})
+		}
+	}
+	sort.Slice(plan.Delete, func(i, j int) bool {
+		a, b := plan.Delete[i], plan.Delete[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Type < b.Type
+	})
+
+	return plan
+}
+
+// ttlMatches reports whether ttl, as listed from Cloudflare, is what a
+// write of r produces: automatic (1) when proxied, otherwise DNS_TTL within
+// the DNS_TTL_JITTER spread. An unknown TTL (zero) matches.
+func ttlMatches(cfg *config.Config, r snapshotRecord, ttl int) bool {
+	if ttl == 0 {
+		return true
+	}
+	if r.Proxied {
+		return ttl == 1
+	}
+	lo, hi := cloudflare.TTLRange(cfg.DNSTTL, cfg.DNSTTLJitter)
+	return ttl >= lo && ttl <= hi
+}
+
+// empty reports whether the plan changes nothing.
+func (p *dnsPlan) empty() bool {
+	return len(p.Create) == 0 && len(p.Update) == 0 && len(p.Delete) == 0
+}
+
+// changes renders the plan terraform-style: "+" creates, "~" updates and
+// "-" deletes.
+func (p *dnsPlan) changes() []string {
+	var out []string
+	for _, r := range p.Create {
+		out = append(out, fmt.Sprintf("+ %s %s %s proxied=%t", r.Type, r.Name, r.Content, r.Proxied))
+	}
+	for _, r := range p.Update {
+		change := fmt.Sprintf("~ %s %s %s proxied=%t -> %s proxied=%t",
+			r.Type, r.Name, r.Old.Content, r.Old.Proxied, r.Content, r.Proxied)
+		if r.OldTTL != 0 {
+			change += fmt.Sprintf(" (ttl %d drifted)", r.OldTTL)
+		}
+		out = append(out, change)
+	}
+	for _, r := range p.Delete {
+		out = append(out, fmt.Sprintf("- %s %s %s", r.Type, r.Name, r.Content))
+	}
+	return out
+}
+
+// log reports the plan as a single structured event.
+func (p *dnsPlan) log() {
+	attrs := []any{
+		"create", len(p.Create),
+		"update", len(p.Update),
+		"delete", len(p.Delete),
+		"unchanged", len(p.Unchanged),
+	}
+	if p.empty() {
+		slog.Info("DNS plan: no changes", attrs...)
+		return
+	}
+	slog.Info("DNS plan", append(attrs, "changes", p.changes())...)
+}
+
+// applyDNSPlan publishes the plan's creates and updates (grouped per name),
+// deletes its stale records, and records the outcome in the snapshot.
+func applyDNSPlan(ctx context.Context, cfg *config.Config, cfClient dnsProvider, plan *dnsPlan, snapshot *recordSnapshot) {
+	plan.GeneratedAt = time.Now().UTC()
+	plan.log()
+	lastDNSPlan.Store(plan)
+
+	snapshot.Records = append(snapshot.Records, plan.Unchanged...)
+
+	var names []string
+	byName := make(map[string][]cloudflare.RecordUpdate)
+	for _, r := range append(append([]plannedRecord(nil), plan.Create...), plan.Update...) {
+		if _, ok := byName[r.Name]; !ok {
+			names = append(names, r.Name)
+		}
+		byName[r.Name] = append(byName[r.Name], cloudflare.RecordUpdate{Type: r.Type, Content: r.Content, Proxied: r.Proxied})
+	}
+	for _, name := range names {
+		updates := byName[name]
+		res := cfClient.UpdateNameRecords(ctx, name, updates)
+		logNameUpdate(res)
+		snapshot.addNameUpdate(res, updates)
+	}
+
+	stale := make([]cloudflare.ManagedRecord, 0, len(plan.Delete))
+	for _, r := range plan.Delete {
+		stale = append(stale, cloudflare.ManagedRecord{Name: r.Name, Type: r.Type, Content: r.Content, Proxied: r.Proxied})
+	}
+	if _, err := deleteStaleRecords(ctx, cfClient, stale, cfg.StaleCleanupConcurrency, cfg.StaleCleanupTimeout); err != nil {
+		slog.Warn("Stale DNS record cleanup incomplete", "stale", len(stale), "error", err)
+	}
+}
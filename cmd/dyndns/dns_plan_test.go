@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/cloudflare"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/ipdetect"
+)
+
+func TestPlanRecords(t *testing.T) {
+	desired := []snapshotRecord{
+		{Name: "app.example.com", Type: "A", Content: "203.0.113.10", Proxied: true},
+		{Name: "api.example.com", Type: "A", Content: "203.0.113.10", Proxied: true},
+		{Name: "direct.example.com", Type: "A", Content: "203.0.113.10"},
+		{Name: "direct.example.com", Type: "AAAA", Content: "2001:db8::10"},
+		{Name: "new.example.com", Type: "A", Content: "203.0.113.10", Proxied: true},
+	}
+	actual := []cloudflare.ManagedRecord{
+		{Name: "app.example.com", Type: "A", Content: "203.0.113.10", Proxied: true},
+		{Name: "api.example.com", Type: "A", Content: "198.51.100.1", Proxied: true},
+		{Name: "direct.example.com", Type: "A", Content: "203.0.113.10", Proxied: true},
+		{Name: "direct.example.com", Type: "AAAA", Content: "2001:db8::10"},
+		{Name: "old.example.com", Type: "AAAA", Content: "2001:db8::1"},
+		{Name: "old.example.com", Type: "A", Content: "198.51.100.1", Proxied: true},
+	}
+
+	plan := planRecords(&config.Config{}, desired, actual)
+
+	want := []string{
+		"+ A new.example.com 203.0.113.10 proxied=true",
+		"~ A api.example.com 198.51.100.1 proxied=true -> 203.0.113.10 proxied=true",
+		"~ A direct.example.com 203.0.113.10 proxied=true -> 203.0.113.10 proxied=false",
+		"- A old.example.com 198.51.100.1",
+		"- AAAA old.example.com 2001:db8::1",
+	}
+	if got := plan.changes(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("changes =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if len(plan.Unchanged) != 2 {
+		t.Errorf("unchanged = %+v, want app A and direct AAAA", plan.Unchanged)
+	}
+}
+
+// TestPlanRecords_KeepsFamiliesOfActiveNames verifies a record family that
+// is not desired for an active name (here AAAA while IPv6 is unknown) is
+// not deleted, and names compare case-insensitively.
+func TestPlanRecords_KeepsFamiliesOfActiveNames(t *testing.T) {
+	desired := []snapshotRecord{{Name: "App.example.com", Type: "A", Content: "203.0.113.10"}}
+	actual := []cloudflare.ManagedRecord{
+		{Name: "app.example.com", Type: "A", Content: "203.0.113.10"},
+		{Name: "app.example.com", Type: "AAAA", Content: "2001:db8::10"},
+	}
+
+	plan := planRecords(&config.Config{}, desired, actual)
+	if !plan.empty() {
+		t.Errorf("plan changes = %v, want none", plan.changes())
+	}
+}
+
+// TestPlanRecords_TTLDrift verifies a TTL outside what a write produces
+// is planned as an update: automatic for proxied records, DNS_TTL within
+// the DNS_TTL_JITTER spread otherwise. An unknown TTL is left alone.
+func TestPlanRecords_TTLDrift(t *testing.T) {
+	cfg := &config.Config{DNSTTL: 300, DNSTTLJitter: 10}
+	desired := []snapshotRecord{
+		{Name: "app.example.com", Type: "A", Content: "203.0.113.10", Proxied: true},
+		{Name: "api.example.com", Type: "A", Content: "203.0.113.10", Proxied: true},
+		{Name: "direct.example.com", Type: "A", Content: "203.0.113.10"},
+		{Name: "direct.example.com", Type: "AAAA", Content: "2001:db8::10"},
+		{Name: "grey.example.com", Type: "A", Content: "203.0.113.10"},
+	}
+	actual := []cloudflare.ManagedRecord{
+		{Name: "app.example.com", Type: "A", Content: "203.0.113.10", Proxied: true, TTL: 1},
+		{Name: "api.example.com", Type: "A", Content: "203.0.113.10", Proxied: true, TTL: 300},
+		{Name: "direct.example.com", Type: "A", Content: "203.0.113.10", TTL: 321},
+		{Name: "direct.example.com", Type: "AAAA", Content: "2001:db8::10", TTL: 3600},
+		{Name: "grey.example.com", Type: "A", Content: "203.0.113.10"},
+	}
+
+	plan := planRecords(cfg, desired, actual)
+	want := []string{
+		"~ A api.example.com 203.0.113.10 proxied=true -> 203.0.113.10 proxied=true (ttl 300 drifted)",
+		"~ AAAA direct.example.com 2001:db8::10 proxied=false -> 2001:db8::10 proxied=false (ttl 3600 drifted)",
+	}
+	if got := plan.changes(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("changes =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if len(plan.Unchanged) != 3 {
+		t.Errorf("unchanged = %+v, want app, direct A and grey", plan.Unchanged)
+	}
+}
+
+// TestUpdateIPAndDNS_DNSPlanCorrectsDrift verifies DNS_PLAN reverts a
+// proxied flag toggled in the Cloudflare dashboard, together with the
+// TTL, and writes nothing once the record matches again.
+func TestUpdateIPAndDNS_DNSPlanCorrectsDrift(t *testing.T) {
+	fake := newFakeCloudflare(t)
+	cfg := &config.Config{
+		Domain:          "example.com",
+		CloudflareProxy: true,
+		ManualIPv4:      "203.0.113.10",
+		DNSPlan:         true,
+		DNSTTL:          300,
+	}
+	cfClient := fake.client(t, cfg)
+	gen := caddy.New(cfg, nil)
+	gen.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "app", Port: 8080}})
+	controller := &Controller{cfg: cfg, detector: ipdetect.New(cfg), dns: cfClient, caddyGen: gen}
+
+	controller.Reconcile(context.Background())
+	fake.setProxied("app.example.com", "A", false, 300)
+	writes := fake.writeCount()
+
+	controller.Reconcile(context.Background())
+	want := []snapshotRecord{{Name: "app.example.com", Type: "A", Content: "203.0.113.10", Proxied: true}}
+	if got := fake.list(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("records = %+v\nwant %+v", got, want)
+	}
+	if ttl := fake.ttl("app.example.com", "A"); ttl != 1 {
+		t.Errorf("ttl = %d, want 1 (automatic)", ttl)
+	}
+	if got := fake.writeCount() - writes; got != 1 {
+		t.Errorf("writes correcting the drift = %d, want 1", got)
+	}
+
+	controller.Reconcile(context.Background())
+	if plan := lastDNSPlan.Load(); !plan.empty() {
+		t.Errorf("plan after the correction = %v, want none", plan.changes())
+	}
+}
+
+// TestUpdateIPAndDNS_DNSPlan verifies that with DNS_PLAN the reconcile
+// writes only the planned changes and reports the plan.
+func TestUpdateIPAndDNS_DNSPlan(t *testing.T) {
+	fake := newFakeCloudflare(t,
+		snapshotRecord{Name: "app.example.com", Type: "A", Content: "203.0.113.10", Proxied: true},
+		snapshotRecord{Name: "api.example.com", Type: "A", Content: "198.51.100.1", Proxied: true},
+		snapshotRecord{Name: "old.example.com", Type: "A", Content: "198.51.100.1", Proxied: true},
+	)
+	cfg := &config.Config{
+		Domain:          "example.com",
+		CloudflareProxy: true,
+		ManualIPv4:      "203.0.113.10",
+		DNSPlan:         true,
+	}
+	cfClient := fake.client(t, cfg)
+	gen := caddy.New(cfg, nil)
+	gen.UpdateDiscoveredServices([]discovery.Service{
+		{Subdomain: "app", Port: 8080},
+		{Subdomain: "api", Port: 8081},
+		{Subdomain: "new", Port: 8082},
+	})
+
+	(&Controller{cfg: cfg, detector: ipdetect.New(cfg), dns: cfClient, caddyGen: gen}).Reconcile(context.Background())
+
+	want := []snapshotRecord{
+		{Name: "api.example.com", Type: "A", Content: "203.0.113.10", Proxied: true},
+		{Name: "app.example.com", Type: "A", Content: "203.0.113.10", Proxied: true},
+		{Name: "new.example.com", Type: "A", Content: "203.0.113.10", Proxied: true},
+	}
+	if got := fake.list(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("records = %+v\nwant %+v", got, want)
+	}
+	// One create, one update, one delete; the unchanged app record is not written.
+	if fake.writeCount() != 3 {
+		t.Errorf("writes = %d, want 3", fake.writeCount())
+	}
+
+	plan := lastDNSPlan.Load()
+	if plan == nil || len(plan.Create) != 1 || len(plan.Update) != 1 || len(plan.Delete) != 1 || len(plan.Unchanged) != 1 {
+		t.Fatalf("last plan = %+v, want 1 create, 1 update, 1 delete, 1 unchanged", plan)
+	}
+
+	// A second cycle has nothing to do.
+	(&Controller{cfg: cfg, detector: ipdetect.New(cfg), dns: cfClient, caddyGen: gen}).Reconcile(context.Background())
+	if fake.writeCount() != 3 {
+		t.Errorf("writes after second cycle = %d, want 3", fake.writeCount())
+	}
+	if plan := lastDNSPlan.Load(); !plan.empty() {
+		t.Errorf("second plan changes = %v, want none", plan.changes())
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+)
+
+// lastFamilyProbe is the result of the most recent FAMILY_PROBE, reported
+// in /status.
+var lastFamilyProbe atomic.Pointer[familyReachability]
+
+// familyReachability reports whether the host answered on each published
+// address. A family without an address is not probed and omitted.
+type familyReachability struct {
+	IPv4          string    `json:"ipv4,omitempty"`
+	IPv4Reachable *bool     `json:"ipv4_reachable,omitempty"`
+	IPv6          string    `json:"ipv6,omitempty"`
+	IPv6Reachable *bool     `json:"ipv6_reachable,omitempty"`
+	IPv6Withheld  bool      `json:"ipv6_withheld,omitempty"`
+	CheckedAt     time.Time `json:"checked_at"`
+}
+
+// familyProbes dials the host's published addresses after a reconcile to
+// catch a family that resolves but does not connect, typically an AAAA
+// whose address the router firewall blocks. Clients that prefer IPv6 then
+// stall on every connection. Only grey-cloud records are checked: clients
+// reach proxied names through Cloudflare. A nil value disables probing.
+type familyProbes struct {
+	port     int
+	timeout  time.Duration
+	withdraw bool
+	dial     func(ctx context.Context, network, address string) (net.Conn, error)
+
+	mu sync.Mutex
+	// withheld is the IPv6 address withdrawn from the grey-cloud AAAA
+	// records because it was unreachable while IPv4 was not.
+	withheld string
+}
+
+// newFamilyProbes returns a prober when FAMILY_PROBE is enabled, else nil.
+func newFamilyProbes(cfg *config.Config) *familyProbes {
+	if !cfg.FamilyProbe {
+		return nil
+	}
+	return &familyProbes{
+		port:     cfg.FamilyProbePort,
+		timeout:  cfg.FamilyProbeTimeout,
+		withdraw: cfg.FamilyProbeWithdraw,
+		dial:     (&net.Dialer{}).DialContext,
+	}
+}
+
+// withhold returns "" while ipv6 is the address withdrawn by an earlier
+// probe, so the reconcile does not publish it again; any other address is
+// returned unchanged and gets probed afresh.
+func (p *familyProbes) withhold(ipv6 string) string {
+	if p == nil || ipv6 == "" {
+		return ipv6
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.withheld == ipv6 {
+		slog.Debug("FAMILY_PROBE: IPv6 withheld from grey-cloud records", "ipv6", ipv6)
+		return ""
+	}
+	p.withheld = ""
+	return ipv6
+}
+
+// observe probes the families of the snapshot's grey-cloud records on the
+// host's addresses and logs which are reachable. When IPv6 is unreachable
+// and IPv4 reachable, it warns and, with FAMILY_PROBE_WITHDRAW, deletes
+// the grey-cloud AAAA records of the host address and withholds it until
+// it answers again. An unreachable IPv4 is only reported: proxied records
+// depend on it, and hairpin NAT often makes it unreachable from inside.
+func (p *familyProbes) observe(ctx context.Context, dns dnsProvider, snapshot *recordSnapshot) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	withheld := p.withheld
+	p.mu.Unlock()
+
+	ipv4, ipv6 := "", withheld
+	for _, r := range snapshot.Records {
+		if r.Proxied {
+			continue
+		}
+		switch {
+		case r.Type == "A" && r.Content == snapshot.IPv4:
+			ipv4 = r.Content
+		case r.Type == "AAAA" && r.Content == snapshot.IPv6:
+			ipv6 = r.Content
+		}
+	}
+	if ipv4 == "" && ipv6 == "" {
+		return
+	}
+
+	result := &familyReachability{IPv4: ipv4, IPv6: ipv6, CheckedAt: time.Now().UTC()}
+	if ipv4 != "" {
+		ok := p.reachable(ctx, "tcp4", ipv4)
+		result.IPv4Reachable = &ok
+	}
+	if ipv6 != "" {
+		ok := p.reachable(ctx, "tcp6", ipv6)
+		result.IPv6Reachable = &ok
+	}
+	defer lastFamilyProbe.Store(result)
+
+	slog.Info("Address family reachability",
+		"ipv4", ipv4, "ipv4_reachable", reachability(result.IPv4Reachable),
+		"ipv6", ipv6, "ipv6_reachable", reachability(result.IPv6Reachable),
+	)
+
+	if withheld != "" && result.IPv6Reachable != nil && *result.IPv6Reachable {
+		slog.Info("FAMILY_PROBE: withheld IPv6 is reachable again, republishing AAAA records on the next reconcile", "ipv6", ipv6)
+		p.release(ipv6)
+	}
+
+	switch {
+	case result.IPv4Reachable == nil || result.IPv6Reachable == nil:
+		// A single family has nothing to disagree with.
+	case !*result.IPv4Reachable && *result.IPv6Reachable:
+		slog.Warn("IPv4 address is unreachable while IPv6 is reachable - check the port forwarding (or hairpin NAT) on the router",
+			"ipv4", ipv4, "ipv6", ipv6, "port", p.port)
+	case *result.IPv4Reachable && !*result.IPv6Reachable:
+		if !p.withdraw {
+			slog.Warn("IPv6 address is unreachable while IPv4 is reachable - IPv6 clients will fail or stall; check the router firewall or set FAMILY_PROBE_WITHDRAW=true",
+				"ipv4", ipv4, "ipv6", ipv6, "port", p.port)
+			break
+		}
+		if withheld == "" {
+			slog.Warn("IPv6 ADDRESS UNREACHABLE while IPv4 is reachable: withdrawing grey-cloud AAAA records until it answers",
+				"ipv4", ipv4, "ipv6", ipv6, "port", p.port)
+		}
+		p.withdrawIPv6(ctx, dns, snapshot, ipv6)
+	}
+	result.IPv6Withheld = p.isWithheld()
+}
+
+// withdrawIPv6 withholds ipv6 from later reconciles and deletes the
+// snapshot's grey-cloud AAAA records of it. Records that fail to delete
+// stay in the snapshot and are retried on the next probe.
+func (p *familyProbes) withdrawIPv6(ctx context.Context, dns dnsProvider, snapshot *recordSnapshot, ipv6 string) {
+	p.mu.Lock()
+	p.withheld = ipv6
+	p.mu.Unlock()
+
+	kept := snapshot.Records[:0]
+	for _, r := range snapshot.Records {
+		if r.Proxied || r.Type != "AAAA" || r.Content != ipv6 {
+			kept = append(kept, r)
+			continue
+		}
+		if err := dns.DeleteRecord(ctx, r.Name, "AAAA"); err != nil {
+			slog.Error("Failed to withdraw unreachable AAAA record", "name", r.Name, "ipv6", ipv6, "error", err)
+			kept = append(kept, r)
+			continue
+		}
+		slog.Info("Withdrew unreachable AAAA record", "name", r.Name, "ipv6", ipv6)
+	}
+	snapshot.Records = kept
+}
+
+// reachable reports whether a TCP connection to address on the probe
+// port succeeds within the timeout.
+func (p *familyProbes) reachable(ctx context.Context, network, address string) bool {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	conn, err := p.dial(ctx, network, net.JoinHostPort(address, strconv.Itoa(p.port)))
+	if err != nil {
+		slog.Debug("Family probe failed", "network", network, "address", address, "error", err)
+		return false
+	}
+	_ = conn.Close()
+	return true
+}
+
+// release stops withholding ipv6.
+func (p *familyProbes) release(ipv6 string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.withheld == ipv6 {
+		p.withheld = ""
+	}
+}
+
+func (p *familyProbes) isWithheld() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.withheld != ""
+}
+
+// reachability renders a probe result for the log.
+func reachability(ok *bool) string {
+	switch {
+	case ok == nil:
+		return "not probed"
+	case *ok:
+		return "yes"
+	default:
+		return "no"
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+)
+
+// familyDialer connects over IPv4 and, unless ipv6Up is set, refuses IPv6.
+type familyDialer struct {
+	ipv6Up bool
+	dialed []string
+}
+
+func (d *familyDialer) dial(_ context.Context, network, address string) (net.Conn, error) {
+	d.dialed = append(d.dialed, network+" "+address)
+	if network == "tcp6" && !d.ipv6Up {
+		return nil, errors.New("connection refused")
+	}
+	client, server := net.Pipe()
+	_ = server.Close()
+	return client, nil
+}
+
+// TestFamilyProbes_UnreachableIPv6 runs direct-mode reconciles with an
+// IPv6 address that does not answer: the AAAA records are flagged, and
+// with FAMILY_PROBE_WITHDRAW removed and kept out until IPv6 answers,
+// while the A records stay.
+func TestFamilyProbes_UnreachableIPv6(t *testing.T) {
+	withA := []snapshotRecord{
+		{Name: "*.example.com", Type: "A", Content: "203.0.113.10"},
+		{Name: "example.com", Type: "A", Content: "203.0.113.10"},
+	}
+	withAAAA := []snapshotRecord{
+		{Name: "*.example.com", Type: "A", Content: "203.0.113.10"},
+		{Name: "*.example.com", Type: "AAAA", Content: "2001:db8::10"},
+		{Name: "example.com", Type: "A", Content: "203.0.113.10"},
+		{Name: "example.com", Type: "AAAA", Content: "2001:db8::10"},
+	}
+
+	for _, withdraw := range []bool{false, true} {
+		cfg := &config.Config{
+			Domain:              "example.com",
+			FamilyProbe:         true,
+			FamilyProbePort:     443,
+			FamilyProbeTimeout:  time.Second,
+			FamilyProbeWithdraw: withdraw,
+		}
+		dns := newMemoryDNS(false)
+		dialer := &familyDialer{}
+		controller := newController(cfg, &staticDetector{ipv4: "203.0.113.10", ipv6: "2001:db8::10"}, dns, caddy.New(cfg, nil))
+		controller.family.dial = dialer.dial
+
+		snapshot := controller.Reconcile(context.Background())
+		if snapshot == nil {
+			t.Fatalf("withdraw=%v: Reconcile() = nil", withdraw)
+		}
+		wantDialed := []string{"tcp4 203.0.113.10:443", "tcp6 [2001:db8::10]:443"}
+		if !reflect.DeepEqual(dialer.dialed, wantDialed) {
+			t.Errorf("withdraw=%v: dialed %v, want %v", withdraw, dialer.dialed, wantDialed)
+		}
+		probe := lastFamilyProbe.Load()
+		if probe == nil || probe.IPv4Reachable == nil || !*probe.IPv4Reachable ||
+			probe.IPv6Reachable == nil || *probe.IPv6Reachable || probe.IPv6Withheld != withdraw {
+			t.Errorf("withdraw=%v: family probe = %+v, want IPv4 reachable, IPv6 unreachable", withdraw, probe)
+		}
+
+		if !withdraw {
+			if got := dns.list(); !reflect.DeepEqual(got, withAAAA) {
+				t.Errorf("flagged records = %+v, want %+v", got, withAAAA)
+			}
+			continue
+		}
+
+		if got := dns.list(); !reflect.DeepEqual(got, withA) {
+			t.Errorf("records after withdrawal = %+v, want %+v", got, withA)
+		}
+		sortRecords(snapshot.Records)
+		if !reflect.DeepEqual(snapshot.Records, withA) {
+			t.Errorf("snapshot records = %+v, want %+v", snapshot.Records, withA)
+		}
+
+		// The next reconcile does not publish the withheld address again.
+		controller.Reconcile(context.Background())
+		if got := dns.list(); !reflect.DeepEqual(got, withA) {
+			t.Errorf("records while withheld = %+v, want %+v", got, withA)
+		}
+
+		// Once IPv6 answers, the AAAA records come back.
+		dialer.ipv6Up = true
+		controller.Reconcile(context.Background())
+		controller.Reconcile(context.Background())
+		if got := dns.list(); !reflect.DeepEqual(got, withAAAA) {
+			t.Errorf("records after IPv6 recovered = %+v, want %+v", got, withAAAA)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/ipdetect"
+)
+
+// TestUpdateIPAndDNS_IPOverride verifies a subdomain with ip_override gets
+// its fixed addresses while the others follow the detected IP, and an
+// invalid override falls back to the detected IP.
+func TestUpdateIPAndDNS_IPOverride(t *testing.T) {
+	fake := newFakeCloudflare(t)
+	cfg := &config.Config{
+		Domain:          "example.com",
+		CloudflareProxy: true,
+		ManualIPv4:      "203.0.113.10",
+		ManualIPv6:      "2001:db8::10",
+	}
+	cfClient := fake.client(t, cfg)
+	gen := caddy.New(cfg, nil)
+	gen.UpdateDiscoveredServices([]discovery.Service{
+		{Subdomain: "vps", Port: 8080, Direct: true, IPOverride: "198.51.100.7, 2a01:4f8::7"},
+		{Subdomain: "home", Port: 8081},
+		{Subdomain: "lan", Port: 8082, Direct: true, IPOverride: "192.168.1.10"},
+	})
+
+	(&Controller{cfg: cfg, detector: ipdetect.New(cfg), dns: cfClient, caddyGen: gen}).Reconcile(context.Background())
+
+	got := fake.list()
+	want := []snapshotRecord{
+		{Name: "home.example.com", Type: "A", Content: "203.0.113.10", Proxied: true},
+		{Name: "lan.example.com", Type: "A", Content: "203.0.113.10"},
+		{Name: "lan.example.com", Type: "AAAA", Content: "2001:db8::10"},
+		{Name: "vps.example.com", Type: "A", Content: "198.51.100.7"},
+		{Name: "vps.example.com", Type: "AAAA", Content: "2a01:4f8::7"},
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("records = %+v\nwant %+v", got, want)
+	}
+}
+
+// TestUpdateIPAndDNS_IPOverrideDirectMode verifies an ip_override without
+// CLOUDFLARE_PROXY is reported instead of silently ignored: only the apex
+// and wildcard records are published.
+func TestUpdateIPAndDNS_IPOverrideDirectMode(t *testing.T) {
+	logs := captureLogs(t, slog.LevelWarn)
+	fake := newFakeCloudflare(t)
+	cfg := &config.Config{
+		Domain:     "example.com",
+		ManualIPv4: "203.0.113.10",
+	}
+	cfClient := fake.client(t, cfg)
+	gen := caddy.New(cfg, nil)
+	gen.UpdateDiscoveredServices([]discovery.Service{
+		{Subdomain: "vps", Port: 8080, IPOverride: "198.51.100.7"},
+		{Subdomain: "home", Port: 8081},
+	})
+
+	(&Controller{cfg: cfg, detector: ipdetect.New(cfg), dns: cfClient, caddyGen: gen}).Reconcile(context.Background())
+
+	got := fake.list()
+	want := []snapshotRecord{
+		{Name: "*.example.com", Type: "A", Content: "203.0.113.10"},
+		{Name: "example.com", Type: "A", Content: "203.0.113.10"},
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("records = %+v\nwant %+v", got, want)
+	}
+	if !strings.Contains(logs.String(), "ip_override ignored") || !strings.Contains(logs.String(), "vps") {
+		t.Errorf("missing ip_override warning, logs:\n%s", logs)
+	}
+}
@@ -2,8 +2,11 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"math"
 	"net/http"
 	"os"
 	"os/signal"
@@ -16,6 +19,7 @@ import (
 	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
 	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
 	"github.com/jonnyzzz/stevedore-dyndns/internal/ipdetect"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/logging"
 	"github.com/jonnyzzz/stevedore-dyndns/internal/mapping"
 	"github.com/jonnyzzz/stevedore-dyndns/internal/mtproto"
 	"github.com/jonnyzzz/stevedore-dyndns/internal/telegram"
@@ -29,28 +33,28 @@ var (
 )
 
 func main() {
-	// Setup logging
+	// Setup logging: global LOG_LEVEL plus LOG_LEVEL_<COMPONENT> overrides
 	logLevel := os.Getenv("LOG_LEVEL")
-	var level slog.Level
-	switch logLevel {
-	case "debug":
-		level = slog.LevelDebug
-	case "warn":
-		level = slog.LevelWarn
-	case "error":
-		level = slog.LevelError
-	default:
-		level = slog.LevelInfo
-	}
+	level, levelErr := logging.ParseLevel(logLevel)
+	componentLevels, componentErrs := logging.ComponentLevels(os.Environ())
 
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level}))
+	inner := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.Level(math.MinInt)})
+	logger := slog.New(logging.NewHandler(inner, level, componentLevels))
 	slog.SetDefault(logger)
 
+	if levelErr != nil {
+		slog.Warn("Ignoring invalid LOG_LEVEL, using info", "error", levelErr)
+	}
+	for _, err := range componentErrs {
+		slog.Warn("Ignoring invalid component log level", "error", err)
+	}
+
 	slog.Info("Starting stevedore-dyndns",
 		"version", Version,
 		"commit", GitCommit,
 		"build_date", BuildDate,
-		"log_level", logLevel,
+		"log_level", level.String(),
+		"component_log_levels", fmt.Sprint(componentLevels),
 	)
 
 	// Load configuration
@@ -59,6 +63,7 @@ func main() {
 		slog.Error("Failed to load configuration", "error", err)
 		os.Exit(1)
 	}
+	cfg.UserAgent = userAgent()
 
 	slog.Info("Configuration loaded",
 		"domain", cfg.Domain,
@@ -73,6 +78,14 @@ func main() {
 
 	// IP detector
 	detector := ipdetect.New(cfg)
+	if cfg.FritzboxAutodiscover && !cfg.UseManualIP() {
+		detector.DiscoverFritzbox(ctx)
+	}
+
+	if cfg.UnsafeAllowAnyRecordName {
+		slog.Warn("UNSAFE_ALLOW_ANY_RECORD_NAME ENABLED: records outside the configured domain can be modified; the scope assertion only logs a warning",
+			"domain", cfg.Domain)
+	}
 
 	// Cloudflare client
 	cfClient, err := cloudflare.New(cfg)
@@ -81,6 +94,22 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Report missing token permissions up front instead of failing later.
+	cfClient.DiagnoseToken(ctx)
+
+	// A domain outside the zone makes every record write fail; stop here
+	// with a clear message instead.
+	if err := cfClient.CheckZone(ctx); err != nil {
+		var mismatch *cloudflare.ErrZoneMismatch
+		if errors.As(err, &mismatch) {
+			slog.Error("DOMAIN IS NOT IN THE CLOUDFLARE ZONE", "domain", mismatch.Domain, "zone", mismatch.Zone, "error", err)
+			os.Exit(1)
+		}
+		slog.Warn("Could not verify the Cloudflare zone", "error", err)
+	}
+	// Prefix-mode names go directly under the zone, however deep DOMAIN is.
+	cfg.ZoneName = cfClient.ZoneName()
+
 	// Configure Cloudflare for proxy mode if enabled
 	if cfg.CloudflareProxy {
 		slog.Info("Cloudflare proxy mode enabled, configuring SSL and mTLS...")
@@ -89,12 +118,32 @@ func main() {
 			// Don't exit - this might fail if token doesn't have zone settings permissions
 			// The service can still work, it just won't auto-configure Cloudflare
 		}
+
+		// Entering proxy mode: drop the wildcard records direct mode created
+		removed, err := cfClient.RemoveWildcardRecords(ctx)
+		if err != nil {
+			slog.Warn("Failed to remove stale wildcard records", "error", err)
+		}
+		if len(removed) > 0 {
+			slog.Info("Removed stale wildcard records left from direct mode",
+				"name", "*."+cfg.Domain, "types", removed)
+		}
+	}
+
+	// MANAGE_WWW off: drop the www alias an earlier run published.
+	if !cfg.ManageWWW {
+		removeWWWRecord(ctx, cfg, cfClient)
 	}
 
 	// Mapping manager (for backwards compatibility with YAML files)
 	var mappingMgr *mapping.Manager
 	if !cfg.UseDiscovery() {
 		mappingMgr = mapping.New(cfg.MappingsFile)
+		mappingMgr.SetUnknownFields(cfg.MappingsUnknownFields)
+		if err := loadInitialMappings(cfg, mappingMgr); err != nil {
+			slog.Error("Refusing to start with an invalid mappings file", "path", cfg.MappingsFile, "error", err)
+			os.Exit(1)
+		}
 	}
 
 	// Caddy config generator
@@ -104,10 +153,12 @@ func main() {
 	var discoveryClient *discovery.Client
 	if cfg.UseDiscovery() {
 		discoveryClient = discovery.New(discovery.Config{
-			SocketPath: cfg.StevedoreSocket,
-			Token:      cfg.StevedoreToken,
+			SocketPath:     cfg.StevedoreSocket,
+			Token:          cfg.StevedoreToken,
+			PollTimeout:    cfg.DiscoveryPollTimeout,
+			IncludeStopped: cfg.DiscoveryIncludeStopped,
 		})
-		slog.Info("Discovery mode enabled", "socket", cfg.StevedoreSocket)
+		slog.Info("Discovery mode enabled", "socket", cfg.StevedoreSocket, "poll_timeout", cfg.DiscoveryPollTimeout, "dry_run", cfg.DiscoveryDryRun)
 	}
 
 	// MTProto dispatcher (optional) — binds :443 and forwards non-MTProto
@@ -151,11 +202,46 @@ func main() {
 		}
 	}
 
+	// Keep the origin-pull CA current; Cloudflare rotates it and a stale
+	// copy baked into the image breaks mTLS.
+	if cfg.RefreshOriginPullCA {
+		go runOriginPullCARefresh(ctx, cfg, caddyGen)
+	}
+
+	// A router reconnect usually means a new IP; update right away
+	// instead of waiting for the next scheduled check.
+	reconnect := make(chan struct{}, 1)
+	if cfg.FritzboxReconnectWatch && !cfg.UseManualIP() {
+		go detector.WatchReconnects(ctx, cfg.FritzboxReconnectPoll, func() {
+			select {
+			case reconnect <- struct{}{}:
+			default:
+			}
+		})
+	}
+
 	// Start the main control loop
-	go runControlLoop(ctx, cfg, detector, cfClient, caddyGen, mappingMgr, discoveryClient)
+	ready := newReadiness(cfg)
+	controller := newController(cfg, detector, cfClient, caddyGen)
+	go controller.Run(ctx, mappingMgr, discoveryClient, ready, reconnect)
+
+	// Caddy admin self-test. Caddy starts only after the first Caddyfile is
+	// written, so allow it up to a minute to come up. Not fatal.
+	adminProbe := caddy.NewAdminProbe(cfg.CaddyAdmin)
+	go func() {
+		status := adminProbe.WaitReachable(ctx, 30, 2*time.Second)
+		if status.Reachable {
+			slog.Info("Caddy admin API reachable", "address", status.Address)
+		} else if ctx.Err() == nil {
+			slog.Warn("CADDY ADMIN API UNREACHABLE - config reloads will fail until this is fixed",
+				"address", status.Address,
+				"error", status.Error,
+			)
+		}
+	}()
 
 	// Start HTTP status server
-	go runStatusServer(ctx, cfg, detector, cfClient, mtprotoRuntime)
+	go runStatusServer(ctx, cfg, detector, cfClient, caddyGen, mtprotoRuntime, adminProbe, ready)
 
 	// Wait for shutdown signal
 	sigChan := make(chan os.Signal, 1)
@@ -170,6 +256,9 @@ func main() {
 		shutdownCancel()
 	}
 	time.Sleep(time.Second) // Grace period
+	cleanupCtx, cleanupCancel := context.WithTimeout(context.Background(), shutdownCleanupTimeout)
+	cleanupOnShutdown(cleanupCtx, cfg, cfClient, caddyGen)
+	cleanupCancel()
 	slog.Info("Goodbye!")
 }
 
@@ -327,71 +416,57 @@ func logMTProtoBindings(rt *mtproto.Runtime, cfg *config.Config) {
 	}
 }
 
-func runControlLoop(
-	ctx context.Context,
-	cfg *config.Config,
-	detector *ipdetect.Detector,
-	cfClient *cloudflare.Client,
-	caddyGen *caddy.Generator,
-	mappingMgr *mapping.Manager,
-	discoveryClient *discovery.Client,
-) {
-	// Load initial services/mappings BEFORE IP update (so subdomains are known)
-	var initialServices []discovery.Service
-	if discoveryClient != nil {
-		// Discovery mode: fetch services from stevedore socket
-		services, err := discoveryClient.GetIngressServices(ctx)
-		if err != nil {
-			slog.Error("Failed to fetch initial services from discovery", "error", err)
-		} else {
-			slog.Info("Loaded services from discovery", "count", len(services))
-			caddyGen.UpdateDiscoveredServices(services)
-			initialServices = append([]discovery.Service(nil), services...)
-		}
-	} else if mappingMgr != nil {
-		// Legacy mode: load mappings from YAML file
-		if err := mappingMgr.Load(); err != nil {
-			slog.Error("Failed to load initial mappings", "error", err)
-		}
-	}
+// runReconcileLoop calls reconcile(false) after first, then on the IP-check
+// schedule and on router reconnects, and reconcile(true) every fullInterval
+// (when non-zero) to heal records changed out-of-band. Reconciles never
+// overlap. It blocks until ctx is cancelled.
+func runReconcileLoop(ctx context.Context, schedule checkSchedule, first, fullInterval time.Duration, reconnect <-chan struct{}, reconcile func(full bool)) {
+	timer := time.NewTimer(first)
+	defer timer.Stop()
 
-	// Generate initial Caddy config
-	if err := caddyGen.Generate(); err != nil {
-		slog.Error("Failed to generate Caddy config", "error", err)
+	var full <-chan time.Time
+	if fullInterval > 0 {
+		ticker := time.NewTicker(fullInterval)
+		defer ticker.Stop()
+		full = ticker.C
 	}
 
-	// Initial IP detection and DNS update (after discovery, so subdomains are known)
-	updateIPAndDNS(ctx, cfg, detector, cfClient, caddyGen)
-
-	// Start service discovery polling or file watching
-	if discoveryClient != nil {
-		go runDiscoveryLoop(ctx, discoveryClient, caddyGen, initialServices)
-	} else if mappingMgr != nil {
-		go mappingMgr.Watch(ctx, func() {
-			slog.Info("Mappings changed, regenerating Caddy config")
-			if err := caddyGen.Generate(); err != nil {
-				slog.Error("Failed to regenerate Caddy config", "error", err)
-			}
-		})
-	}
-
-	// Periodic IP check
-	ticker := time.NewTicker(cfg.IPCheckInterval)
-	defer ticker.Stop()
-
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
-			updateIPAndDNS(ctx, cfg, detector, cfClient, caddyGen)
+		case <-timer.C:
+			reconcile(false)
+			timer.Reset(schedule.nextDelay(time.Now()))
+		case <-reconnect:
+			reconcile(false)
+		case <-full:
+			slog.Info("Running periodic full DNS reconcile", "interval", fullInterval)
+			reconcile(true)
 		}
 	}
 }
 
-// runDiscoveryLoop polls the stevedore socket for service changes
-func runDiscoveryLoop(ctx context.Context, client *discovery.Client, caddyGen *caddy.Generator, lastServices []discovery.Service) {
+// discoveryRetryDelay is the wait after a failed discovery request.
+var discoveryRetryDelay = 5 * time.Second
+
+// runDiscoveryLoop polls the stevedore socket for service changes. In dry-run
+// mode changes are only diffed and logged; the generator (and therefore the
+// Caddyfile and DNS subdomain set) keeps the services loaded at startup.
+//
+// When the startup fetch failed (seeded is false), the loop first fetches the
+// full service list until it succeeds, so the services are applied even if
+// the following polls report changed=false.
+//
+// Changes arriving within debounce of each other are coalesced into a single
+// regeneration with the latest services.
+//
+// Every request outcome is reported to fallback, which routes the YAML
+// mappings while discovery stays unreachable.
+func runDiscoveryLoop(ctx context.Context, client *discovery.Client, caddyGen *caddy.Generator, lastServices []discovery.Service, seeded, dryRun bool, debounce time.Duration, fallback *discoveryFallback) {
 	var since time.Time
+	applier := newDiscoveryApplier(caddyGen, lastServices, dryRun, debounce)
+	defer applier.stop()
 
 	for {
 		select {
@@ -400,123 +475,145 @@ func runDiscoveryLoop(ctx context.Context, client *discovery.Client, caddyGen *c
 		default:
 		}
 
+		if !seeded {
+			services, err := client.GetIngressServices(ctx)
+			if err != nil {
+				slog.Error("Discovery reconciliation failed", "error", err)
+				fallback.failed(ctx)
+				if !sleepCtx(ctx, discoveryRetryDelay) {
+					return
+				}
+				continue
+			}
+			seeded = true
+			fallback.succeeded()
+			slog.Info("Reconciled services after failed startup fetch", "count", len(services))
+			applier.applyNow(services)
+		}
+
 		services, newSince, err := client.Poll(ctx, since)
 		if err != nil {
 			slog.Error("Discovery poll failed", "error", err)
+			fallback.failed(ctx)
 			// Wait before retrying on error
-			select {
-			case <-ctx.Done():
+			if !sleepCtx(ctx, discoveryRetryDelay) {
 				return
-			case <-time.After(5 * time.Second):
-				continue
 			}
+			continue
 		}
 
 		since = newSince
+		fallback.succeeded()
 
 		// If services changed (not nil), update and regenerate
 		if services != nil {
-			if discovery.ServicesEqual(services, lastServices) {
-				slog.Debug("Discovery poll returned unchanged services, skipping Caddy reload", "count", len(services))
-				continue
-			}
-			slog.Info("Services changed via discovery", "count", len(services))
-			caddyGen.UpdateDiscoveredServices(services)
-			lastServices = append([]discovery.Service(nil), services...)
-			if err := caddyGen.Generate(); err != nil {
-				slog.Error("Failed to regenerate Caddy config", "error", err)
-			}
+			applier.submit(services)
 		}
 	}
 }
 
-func updateIPAndDNS(
-	ctx context.Context,
-	cfg *config.Config,
-	detector *ipdetect.Detector,
-	cfClient *cloudflare.Client,
-	caddyGen *caddy.Generator,
-) {
-	// Detect current IPs
-	ipv4, ipv6, err := detector.Detect(ctx)
-	if err != nil {
-		slog.Error("Failed to detect IP addresses", "error", err)
-		return
+// applyDiscoveredServices regenerates the Caddy config for services unless
+// they equal lastServices (or only previews the change in dry-run mode). It
+// returns the services to compare the next result against.
+func applyDiscoveredServices(caddyGen *caddy.Generator, services, lastServices []discovery.Service, dryRun bool) []discovery.Service {
+	if discovery.ServicesEqual(services, lastServices) {
+		slog.Debug("Discovery returned unchanged services, skipping Caddy reload", "count", len(services))
+		return lastServices
+	}
+	if dryRun {
+		if _, err := caddyGen.PreviewDiscoveredServices(services); err != nil {
+			slog.Error("Failed to preview discovery changes", "error", err)
+		}
+		return append([]discovery.Service(nil), services...)
 	}
-
-	// When DISABLE_IPV6 is set, honor the flag by dropping the detected
-	// address before any AAAA reconciliation path runs. Useful when the
-	// upstream router's WAN IPv6 is not routable to this host.
-	if cfg.DisableIPv6 && ipv6 != "" {
-		slog.Debug("DISABLE_IPV6 set, ignoring detected IPv6 address", "ipv6", ipv6)
-		ipv6 = ""
+	slog.Info("Services changed via discovery", "count", len(services))
+	caddyGen.UpdateDiscoveredServices(services)
+	if err := generateTimed(context.Background(), caddyGen); err != nil {
+		slog.Error("Failed to regenerate Caddy config", "error", err)
 	}
+	return append([]discovery.Service(nil), services...)
+}
 
-	slog.Info("Detected IP addresses",
-		"ipv4", ipv4,
-		"ipv6", ipv6,
-	)
+// sleepCtx waits for d, returning false if ctx is cancelled first.
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
 
-	// Handle DNS records based on proxy mode
-	if cfClient.IsProxied() {
-		// Proxy mode: Only update individual subdomain records
-		// We don't need root domain records in proxy mode - only the specific
-		// subdomains that services are using get DNS records
-		slog.Debug("Proxy mode: skipping root domain DNS records, updating subdomains only")
-	} else {
-		// Direct mode: Update root domain DNS records
-		if ipv4 != "" {
-			if err := cfClient.UpdateRecord(ctx, cfg.Domain, "A", ipv4); err != nil {
-				slog.Error("Failed to update A record", "error", err)
-			} else {
-				slog.Info("Updated A record", "domain", cfg.Domain, "ip", ipv4)
-			}
-		}
+// writeSnapshot completes the snapshot with the active subdomains and
+// writes it to SNAPSHOT_FILE. A reconcile with failed updates leaves the
+// previous snapshot in place.
+func writeSnapshot(cfg *config.Config, caddyGen *caddy.Generator, snapshot *recordSnapshot) {
+	if snapshot.failed {
+		slog.Warn("Skipping record snapshot: reconcile had failed updates", "path", cfg.SnapshotFile)
+		return
+	}
+	for _, sub := range caddyGen.GetActiveSubdomains() {
+		snapshot.Subdomains = append(snapshot.Subdomains, snapshotSubdomain{
+			Name:   sub,
+			FQDN:   cfg.GetSubdomainFQDN(sub),
+			Direct: caddyGen.IsSubdomainDirect(sub),
+		})
+	}
+	snapshot.GeneratedAt = time.Now().UTC()
+	if err := snapshot.write(cfg.SnapshotFile); err != nil {
+		slog.Error("Failed to write record snapshot", "path", cfg.SnapshotFile, "error", err)
+		return
+	}
+	slog.Debug("Wrote record snapshot", "path", cfg.SnapshotFile, "records", len(snapshot.Records))
+}
 
-		if ipv6 != "" {
-			if err := cfClient.UpdateRecord(ctx, cfg.Domain, "AAAA", ipv6); err != nil {
-				slog.Error("Failed to update AAAA record", "error", err)
-			} else {
-				slog.Info("Updated AAAA record", "domain", cfg.Domain, "ip", ipv6)
-			}
-		}
+// familyUpdates builds the per-name A/AAAA update set, skipping families
+// whose address is unknown.
+func familyUpdates(ipv4, ipv6 string, proxied bool) []cloudflare.RecordUpdate {
+	var updates []cloudflare.RecordUpdate
+	if ipv4 != "" {
+		updates = append(updates, cloudflare.RecordUpdate{Type: "A", Content: ipv4, Proxied: proxied})
 	}
+	if ipv6 != "" {
+		updates = append(updates, cloudflare.RecordUpdate{Type: "AAAA", Content: ipv6, Proxied: proxied})
+	}
+	return updates
+}
 
-	// Handle subdomain records based on proxy mode
-	if cfClient.IsProxied() {
-		// Proxy mode: create individual subdomain records (required for Cloudflare Universal SSL)
-		updateSubdomainRecords(ctx, cfg, cfClient, caddyGen, ipv4, ipv6)
-	} else {
-		// Direct mode: use wildcard records
-		if ipv4 != "" {
-			if err := cfClient.UpdateRecord(ctx, "*."+cfg.Domain, "A", ipv4); err != nil {
-				slog.Error("Failed to update wildcard A record", "error", err)
-			} else {
-				slog.Info("Updated wildcard A record", "domain", "*."+cfg.Domain, "ip", ipv4)
-			}
-		}
-		if ipv6 != "" {
-			if err := cfClient.UpdateRecord(ctx, "*."+cfg.Domain, "AAAA", ipv6); err != nil {
-				slog.Error("Failed to update wildcard AAAA record", "error", err)
-			} else {
-				slog.Info("Updated wildcard AAAA record", "domain", "*."+cfg.Domain, "ip", ipv6)
-			}
-		}
+// withTTL sets the TTL of every update; zero keeps DNS_TTL.
+func withTTL(updates []cloudflare.RecordUpdate, ttl int) []cloudflare.RecordUpdate {
+	for i := range updates {
+		updates[i].TTL = ttl
 	}
+	return updates
+}
 
-	// If IPv6 is disabled, ensure no AAAA records are left over from prior
-	// runs: delete them idempotently for the root, the wildcard, and every
-	// currently-active subdomain. DeleteRecord is a no-op when the record
-	// doesn't exist.
-	if cfg.DisableIPv6 {
-		purgeAAAARecords(ctx, cfg, cfClient, caddyGen)
+// logNameUpdate reports a grouped A+AAAA update as a single event. A partial
+// failure is called out explicitly; the failed families are retried on the
+// next cycle by UpdateNameRecords.
+func logNameUpdate(res *cloudflare.NameUpdateResult, attrs ...any) {
+	attrs = append([]any{"fqdn", res.Name, "updated", res.Updated}, attrs...)
+	if len(res.Retried) > 0 {
+		attrs = append(attrs, "retried", res.Retried)
+	}
+	switch {
+	case len(res.Failed) == 0:
+		if len(res.Updated) > 0 {
+			slog.Info("Updated DNS records", attrs...)
+		}
+	case res.Partial():
+		slog.Error(fmt.Sprintf("Partial DNS update: %s updated %s but %s failed; retrying failed records next cycle",
+			res.Name, strings.Join(res.Updated, "+"), strings.Join(res.FailedTypes(), "+")),
+			append(attrs, "failed", res.FailedTypes(), "error", res.Err())...)
+	default:
+		slog.Error("Failed to update DNS records", append(attrs, "failed", res.FailedTypes(), "error", res.Err())...)
 	}
 }
 
 // purgeAAAARecords deletes AAAA records that dyndns may have published in
 // earlier runs. Called only when DISABLE_IPV6 is set. DeleteRecord is
 // idempotent, so missing records are silently ignored.
-func purgeAAAARecords(ctx context.Context, cfg *config.Config, cfClient *cloudflare.Client, caddyGen *caddy.Generator) {
+func purgeAAAARecords(ctx context.Context, cfg *config.Config, cfClient dnsProvider, caddyGen *caddy.Generator) {
 	targets := []string{cfg.Domain, "*." + cfg.Domain}
 	for _, sub := range caddyGen.GetActiveSubdomains() {
 		targets = append(targets, cfg.GetSubdomainFQDN(sub))
@@ -531,118 +628,67 @@ func purgeAAAARecords(ctx context.Context, cfg *config.Config, cfClient *cloudfl
 	}
 }
 
-// updateSubdomainRecords creates/updates individual subdomain DNS records.
-// This is required when Cloudflare proxy is enabled because Cloudflare Universal SSL
-// doesn't cover wildcard subdomains (*.domain.com).
-//
-// Mixed mode: subdomains marked direct in stevedore discovery are published as
-// grey-cloud (Proxied=false) so Caddy can terminate TLS with its own LE cert.
-// Other subdomains keep orange-cloud (Proxied=true) behavior, and IPv6 is
-// handled by Cloudflare edge automatically — only A records are emitted for
-// proxied subdomains. Direct subdomains additionally receive AAAA records when
-// an IPv6 address is known, because clients connect to the origin directly.
-func updateSubdomainRecords(
+func runStatusServer(
 	ctx context.Context,
 	cfg *config.Config,
+	detector *ipdetect.Detector,
 	cfClient *cloudflare.Client,
 	caddyGen *caddy.Generator,
-	ipv4, ipv6 string,
+	mtprotoRuntime *mtproto.Runtime,
+	adminProbe *caddy.AdminProbe,
+	ready *readiness,
 ) {
-	// Get active subdomains from Caddy config
-	activeSubdomains := caddyGen.GetActiveSubdomains()
-
-	// The 451 catchall always behaves as direct-mode: its own LE cert, grey-cloud.
-	catchallSub := cfg.CatchallSubdomain
-	if catchallSub != "" {
-		found := false
-		for _, s := range activeSubdomains {
-			if s == catchallSub {
-				found = true
-				break
-			}
-		}
-		if !found {
-			activeSubdomains = append(activeSubdomains, catchallSub)
-		}
-	}
-
-	// Create a set for quick lookup (stores normalized FQDNs for case-insensitive comparison)
-	activeFQDNs := make(map[string]bool)
-	for _, sub := range activeSubdomains {
-		fqdn := strings.ToLower(cfg.GetSubdomainFQDN(sub))
-		activeFQDNs[fqdn] = true
-	}
-
-	slog.Info("Updating subdomain DNS records",
-		"prefix_mode", cfg.SubdomainPrefix,
-		"active_subdomains", len(activeSubdomains),
-		"catchall", catchallSub,
-	)
-
-	for _, subdomain := range activeSubdomains {
-		fqdn := cfg.GetSubdomainFQDN(subdomain)
-		direct := caddyGen.IsSubdomainDirect(subdomain) || subdomain == catchallSub
-		proxied := !direct
-
-		if ipv4 != "" {
-			if err := cfClient.UpdateRecordProxied(ctx, fqdn, "A", ipv4, proxied); err != nil {
-				slog.Error("Failed to update subdomain A record", "subdomain", subdomain, "fqdn", fqdn, "direct", direct, "error", err)
-			} else {
-				slog.Info("Updated subdomain A record", "subdomain", subdomain, "fqdn", fqdn, "direct", direct)
-			}
-		}
+	mux := newStatusMux(cfg, detector, cfClient, caddyGen, mtprotoRuntime, adminProbe, ready)
 
-		// AAAA records only make sense when the client reaches the origin directly.
-		// In proxied mode Cloudflare provides IPv6 to clients while connecting to
-		// the origin over IPv4; adding an AAAA would expose the origin's IPv6.
-		if direct && ipv6 != "" {
-			if err := cfClient.UpdateRecordProxied(ctx, fqdn, "AAAA", ipv6, false); err != nil {
-				slog.Error("Failed to update subdomain AAAA record", "subdomain", subdomain, "fqdn", fqdn, "error", err)
-			} else {
-				slog.Info("Updated subdomain AAAA record", "subdomain", subdomain, "fqdn", fqdn)
+	// The same endpoints on a unix socket for local tooling.
+	if cfg.StatusSocket != "" {
+		go func() {
+			if err := serveStatusSocket(ctx, cfg.StatusSocket, mux); err != nil {
+				slog.Error("Status socket error", "path", cfg.StatusSocket, "error", err)
 			}
-		}
+		}()
 	}
 
-	// Clean up old subdomain records that are no longer active (terraform-like reconciliation)
-	// Get all FQDNs from Cloudflare that belong to this deployment
-	existingFQDNs, err := cfClient.GetManagedRecordFQDNs(ctx)
+	tlsConfig, err := cfg.StatusTLSConfig()
 	if err != nil {
-		slog.Error("Failed to get existing DNS records", "error", err)
+		slog.Error("Status server TLS setup failed", "error", err)
 		return
 	}
 
-	slog.Debug("DNS reconciliation",
-		"existing_fqdns", len(existingFQDNs),
-		"active_fqdns", len(activeFQDNs),
-	)
-
-	// Delete records that exist in Cloudflare but shouldn't (stale records)
-	for _, existingFQDN := range existingFQDNs {
-		// Normalize for comparison
-		normalizedFQDN := strings.ToLower(existingFQDN)
+	server := &http.Server{
+		Addr:      "127.0.0.1:8081",
+		Handler:   mux,
+		TLSConfig: tlsConfig,
+	}
 
-		if !activeFQDNs[normalizedFQDN] {
-			slog.Info("Removing stale DNS record", "fqdn", existingFQDN)
+	go func() {
+		<-ctx.Done()
+		_ = server.Shutdown(context.Background())
+	}()
 
-			if err := cfClient.DeleteRecord(ctx, existingFQDN, "A"); err != nil {
-				slog.Error("Failed to delete stale A record", "fqdn", existingFQDN, "error", err)
-			}
-			// Also clean up any stale AAAA records from previous configurations
-			if err := cfClient.DeleteRecord(ctx, existingFQDN, "AAAA"); err != nil {
-				slog.Error("Failed to delete stale AAAA record", "fqdn", existingFQDN, "error", err)
-			}
-		}
+	slog.Info("Starting status server", "addr", "127.0.0.1:8081",
+		"tls", tlsConfig != nil, "client_auth", cfg.StatusTLSClientCA != "")
+	if tlsConfig != nil {
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		slog.Error("Status server error", "error", err)
 	}
 }
 
-func runStatusServer(
-	ctx context.Context,
+// newStatusMux builds the status server's handlers, shared by the TCP
+// listener and STATUS_SOCKET.
+func newStatusMux(
 	cfg *config.Config,
 	detector *ipdetect.Detector,
 	cfClient *cloudflare.Client,
+	caddyGen *caddy.Generator,
 	mtprotoRuntime *mtproto.Runtime,
-) {
+	adminProbe *caddy.AdminProbe,
+	ready *readiness,
+) *http.ServeMux {
 	mux := http.NewServeMux()
 
 	// Health endpoint
@@ -651,6 +697,25 @@ func runStatusServer(
 		_, _ = w.Write([]byte("OK"))
 	})
 
+	// Deep health endpoint: reflects Cloudflare API reachability. The probe
+	// result is cached so orchestrator polling doesn't hit the API per request.
+	cfHealth := cloudflare.NewHealthChecker(cfClient.Ping, 30*time.Second, 3)
+	mux.HandleFunc("/health/deep", func(w http.ResponseWriter, r *http.Request) {
+		status := cfHealth.Check(r.Context())
+		w.Header().Set("Content-Type", "application/json")
+		if !status.Healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"cloudflare": status})
+	})
+
+	// Readiness: a reconcile succeeded and, with READY_REQUIRE_PROPAGATION,
+	// the records resolve publicly.
+	mux.Handle("/ready", ready.handler())
+
+	// Build metadata injected via -ldflags
+	mux.Handle("/version", versionHandler())
+
 	// Status endpoint
 	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
 		ipv4, ipv6, _ := detector.GetLastKnown()
@@ -669,21 +734,59 @@ func runStatusServer(
 			}
 			fmt.Fprint(w, `]`)
 		}
+		if adminStatus, err := json.Marshal(adminProbe.Status()); err == nil {
+			fmt.Fprintf(w, `, "caddy_admin": %s`, adminStatus)
+		}
+		if plan := lastDNSPlan.Load(); plan != nil {
+			if planStatus, err := json.Marshal(plan); err == nil {
+				fmt.Fprintf(w, `, "dns_plan": %s`, planStatus)
+			}
+		}
+		if probe := lastFamilyProbe.Load(); probe != nil {
+			if probeStatus, err := json.Marshal(probe); err == nil {
+				fmt.Fprintf(w, `, "family_probe": %s`, probeStatus)
+			}
+		}
+		if limit := lastSubdomainLimit.Load(); limit != nil {
+			if limitStatus, err := json.Marshal(limit); err == nil {
+				fmt.Fprintf(w, `, "subdomain_limit": %s`, limitStatus)
+			}
+		}
+		if diag := cfClient.LastTokenDiagnostics(); diag != nil {
+			if tokenStatus, err := json.Marshal(diag); err == nil {
+				fmt.Fprintf(w, `, "cloudflare_token": %s`, tokenStatus)
+			}
+		}
 		fmt.Fprint(w, `}`)
 	})
 
-	server := &http.Server{
-		Addr:    "127.0.0.1:8081",
-		Handler: mux,
-	}
+	// Recent detected address changes, oldest first.
+	mux.HandleFunc("/status/history", func(w http.ResponseWriter, r *http.Request) {
+		history := detector.History()
+		if history == nil {
+			history = []ipdetect.IPChange{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"changes": history})
+	})
 
-	go func() {
-		<-ctx.Done()
-		_ = server.Shutdown(context.Background())
-	}()
+	// Effective mappings (YAML merged with discovery); requires the status token.
+	mux.Handle("/mappings", requireBearerToken(cfg.StatusToken, mappingsHandler(caddyGen)))
 
-	slog.Info("Starting status server", "addr", "127.0.0.1:8081")
-	if err := server.ListenAndServe(); err != http.ErrServerClosed {
-		slog.Error("Status server error", "error", err)
+	// On-demand stale record sweep; requires the status token.
+	mux.Handle("/cleanup", requireBearerToken(cfg.StatusToken,
+		rateLimited(cfg.StatusRateLimit, cleanupHandler(cfg, cfClient, caddyGen))))
+
+	// On-demand TLS ask check: Caddy issues certificates only for active hosts.
+	if cfg.CaddyOnDemandTLS {
+		mux.Handle(caddy.OnDemandAskPath, tlsAskHandler(caddyGen))
 	}
+
+	// Profiling for diagnosing goroutine leaks; requires the status token.
+	if cfg.EnablePprof {
+		registerPprof(mux, cfg.StatusToken)
+		slog.Warn("Profiling endpoints enabled on status server", "path", "/debug/pprof/")
+	}
+
+	return mux
 }
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/ipdetect"
+)
+
+// TestUpdateIPAndDNS_CleanupHonorsManagedTypes verifies the stale record
+// cleanup removes exactly the managed types of an inactive name and
+// leaves its other records alone.
+func TestUpdateIPAndDNS_CleanupHonorsManagedTypes(t *testing.T) {
+	fake := newFakeCloudflare(t,
+		snapshotRecord{Name: "old.example.com", Type: "A", Content: "198.51.100.1", Proxied: true},
+		snapshotRecord{Name: "old.example.com", Type: "CNAME", Content: "elsewhere.example.net"},
+		snapshotRecord{Name: "old.example.com", Type: "TXT", Content: "keep-me"},
+		snapshotRecord{Name: "gone.example.com", Type: "CNAME", Content: "elsewhere.example.net"},
+	)
+	cfg := &config.Config{
+		Domain:             "example.com",
+		CloudflareProxy:    true,
+		ManualIPv4:         "203.0.113.10",
+		ManagedRecordTypes: []string{"A", "AAAA", "CNAME"},
+	}
+	cfClient := fake.client(t, cfg)
+	gen := caddy.New(cfg, nil)
+	gen.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "app", Port: 8080}})
+
+	(&Controller{cfg: cfg, detector: ipdetect.New(cfg), dns: cfClient, caddyGen: gen}).Reconcile(context.Background())
+
+	want := []snapshotRecord{
+		{Name: "app.example.com", Type: "A", Content: "203.0.113.10", Proxied: true},
+		{Name: "old.example.com", Type: "TXT", Content: "keep-me"},
+	}
+	if got := fake.list(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("records = %+v\nwant %+v", got, want)
+	}
+}
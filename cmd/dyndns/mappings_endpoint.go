@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/mapping"
+)
+
+// effectiveMapping is one entry of the /mappings response.
+type effectiveMapping struct {
+	Subdomain string                 `json:"subdomain"`
+	FQDN      string                 `json:"fqdn"`
+	Target    string                 `json:"target"`
+	Direct    bool                   `json:"direct"`
+	Options   mapping.MappingOptions `json:"options"`
+}
+
+// mappingsHandler serves the effective mappings (YAML merged with
+// discovery) the Caddyfile is rendered from. A mapping conflict rejected
+// by MAPPING_CONFLICT_STRATEGY=error is reported as 409.
+func mappingsHandler(gen *caddy.Generator) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		mappings, err := gen.EffectiveMappings()
+		if err != nil {
+			slog.Warn("Failed to collect effective mappings", "error", err)
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		out := make([]effectiveMapping, 0, len(mappings))
+		for _, m := range mappings {
+			out = append(out, effectiveMapping{
+				Subdomain: m.Subdomain,
+				FQDN:      m.FQDN,
+				Target:    m.Target,
+				Direct:    m.Direct,
+				Options:   m.Options,
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"mappings": out})
+	})
+}
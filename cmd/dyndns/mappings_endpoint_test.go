@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/mapping"
+)
+
+// TestMappingsHandler verifies /mappings returns YAML and discovered
+// mappings merged, with the discovered service winning a duplicate subdomain.
+func TestMappingsHandler(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mappings.yaml")
+	content := `mappings:
+  - subdomain: wiki
+    target: "wiki:3000"
+    options:
+      websocket: true
+  - subdomain: app
+    target: "old-app:9000"
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("write mappings: %v", err)
+	}
+	mgr := mapping.New(path)
+	if err := mgr.Load(); err != nil {
+		t.Fatalf("load mappings: %v", err)
+	}
+
+	gen := caddy.New(&config.Config{Domain: "example.com"}, mgr)
+	gen.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "app", Container: "app", Port: 8080, Direct: true}})
+
+	handler := requireBearerToken("secret", mappingsHandler(gen))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/mappings", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("without token: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/mappings", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	var body struct {
+		Mappings []effectiveMapping `json:"mappings"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v\n%s", err, rec.Body.String())
+	}
+	if len(body.Mappings) != 2 {
+		t.Fatalf("mappings = %+v, want 2 entries", body.Mappings)
+	}
+
+	app, wiki := body.Mappings[0], body.Mappings[1]
+	if app.Subdomain != "app" || app.FQDN != "app.example.com" || app.Target != "127.0.0.1:8080" || !app.Direct {
+		t.Errorf("app = %+v, want the discovered service", app)
+	}
+	if wiki.Subdomain != "wiki" || wiki.FQDN != "wiki.example.com" || wiki.Target != "wiki:3000" || !wiki.Options.Websocket {
+		t.Errorf("wiki = %+v, want the YAML mapping", wiki)
+	}
+}
+
+// TestMappingsHandler_Conflict verifies a conflict rejected by
+// MAPPING_CONFLICT_STRATEGY=error is reported instead of a partial list.
+func TestMappingsHandler_Conflict(t *testing.T) {
+	gen := caddy.New(&config.Config{Domain: "example.com", MappingConflictStrategy: config.ConflictError}, nil)
+	gen.UpdateDiscoveredServices([]discovery.Service{
+		{Subdomain: "app", Container: "a", Port: 8080},
+		{Subdomain: "app", Container: "b", Port: 8080},
+	})
+
+	rec := httptest.NewRecorder()
+	mappingsHandler(gen).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/mappings", nil))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+}
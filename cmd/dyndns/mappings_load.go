@@ -0,0 +1,28 @@
+package main
+
+import (
+	"log/slog"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/mapping"
+)
+
+// loadInitialMappings loads the YAML mappings before the first Caddyfile
+// is generated. A file that fails to load (e.g. invalid YAML) would
+// otherwise silently drop every route: with ON_INVALID_MAPPINGS=exit the
+// error is returned so main refuses to start, and with warn dyndns starts
+// without mappings until the watcher loads the next valid edit.
+func loadInitialMappings(cfg *config.Config, mgr *mapping.Manager) error {
+	err := mgr.Load()
+	if err == nil {
+		return nil
+	}
+	if cfg.OnInvalidMappings == config.InvalidMappingsExit {
+		return err
+	}
+	slog.Warn("MAPPINGS FILE COULD NOT BE LOADED - starting without mappings, all YAML routes are down until the file is fixed",
+		"path", cfg.MappingsFile,
+		"error", err,
+	)
+	return nil
+}
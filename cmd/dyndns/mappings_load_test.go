@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/mapping"
+)
+
+func TestLoadInitialMappings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mappings.yaml")
+	if err := os.WriteFile(path, []byte("mappings: [\n"), 0644); err != nil {
+		t.Fatalf("write mappings: %v", err)
+	}
+
+	tests := []struct {
+		policy  string
+		wantErr bool
+	}{
+		{policy: config.InvalidMappingsWarn, wantErr: false},
+		{policy: config.InvalidMappingsExit, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			cfg := &config.Config{MappingsFile: path, OnInvalidMappings: tt.policy}
+			mgr := mapping.New(path)
+
+			err := loadInitialMappings(cfg, mgr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadInitialMappings() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := mgr.Get(); len(got) != 0 {
+				t.Errorf("mappings = %+v, want none", got)
+			}
+		})
+	}
+}
+
+func TestLoadInitialMappings_ValidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mappings.yaml")
+	content := "mappings:\n  - subdomain: app\n    target: \"app:8080\"\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("write mappings: %v", err)
+	}
+	cfg := &config.Config{MappingsFile: path, OnInvalidMappings: config.InvalidMappingsExit}
+	mgr := mapping.New(path)
+
+	if err := loadInitialMappings(cfg, mgr); err != nil {
+		t.Fatalf("loadInitialMappings() unexpected error: %v", err)
+	}
+	if got := mgr.Get(); len(got) != 1 {
+		t.Errorf("got %d mappings, want 1", len(got))
+	}
+}
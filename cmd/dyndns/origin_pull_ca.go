@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/atomicfile"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+)
+
+// originPullCAURL is where Cloudflare publishes the Authenticated Origin
+// Pull CA (the same URL the Dockerfile downloads at build time).
+const originPullCAURL = "https://developers.cloudflare.com/ssl/static/authenticated_origin_pull_ca.pem"
+
+// originPullCAPath is the CA file the Caddyfile template trusts for
+// Cloudflare client certificates.
+const originPullCAPath = "/etc/cloudflare/origin-pull-ca.pem"
+
+// runOriginPullCARefresh refreshes the origin-pull CA at startup and then
+// every interval, reloading Caddy whenever the CA changed.
+func runOriginPullCARefresh(ctx context.Context, cfg *config.Config, caddyGen *caddy.Generator) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	ticker := time.NewTicker(cfg.OriginPullCARefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		syncOriginPullCA(ctx, client, originPullCAURL, originPullCAPath, cfg.UserAgent, caddyGen.Reload)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// syncOriginPullCA refreshes the CA at path once and calls reload when it
+// changed. Failures are logged; the current CA stays in place.
+func syncOriginPullCA(ctx context.Context, client *http.Client, url, path, userAgent string, reload func() error) {
+	changed, err := refreshOriginPullCA(ctx, client, url, path, userAgent)
+	switch {
+	case err != nil:
+		slog.Warn("Failed to refresh Cloudflare origin-pull CA", "error", err)
+	case changed:
+		slog.Info("Cloudflare origin-pull CA changed, reloading Caddy", "path", path)
+		if err := reload(); err != nil {
+			slog.Warn("Failed to reload Caddy", "error", err)
+		}
+	default:
+		slog.Debug("Cloudflare origin-pull CA unchanged", "path", path)
+	}
+}
+
+// refreshOriginPullCA downloads the CA from url and replaces path when the
+// content differs. The download must parse as PEM certificates, so a bad
+// response never replaces a working CA. It reports whether path changed.
+func refreshOriginPullCA(ctx context.Context, client *http.Client, url, path, userAgent string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, err
+	}
+	if userAgent != "" {
+		req.Header.Set("User-Agent", userAgent)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to download CA: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("failed to download CA: unexpected status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return false, fmt.Errorf("failed to read CA: %w", err)
+	}
+	if err := validateCAPEM(data); err != nil {
+		return false, err
+	}
+
+	existing, err := os.ReadFile(path)
+	if err == nil && bytes.Equal(existing, data) {
+		return false, nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to read current CA: %w", err)
+	}
+
+	if err := atomicfile.Write(path, data, 0o644); err != nil {
+		return false, fmt.Errorf("failed to write CA: %w", err)
+	}
+	return true, nil
+}
+
+// validateCAPEM checks that data holds at least one PEM certificate and
+// that every certificate parses.
+func validateCAPEM(data []byte) error {
+	count := 0
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return fmt.Errorf("invalid CA certificate: %w", err)
+		}
+		count++
+	}
+	if count == 0 {
+		return fmt.Errorf("invalid CA: no PEM certificate found")
+	}
+	return nil
+}
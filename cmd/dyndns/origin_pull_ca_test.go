@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testCAPEM returns a freshly generated self-signed CA certificate as PEM.
+func testCAPEM(t *testing.T, name string) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// TestSyncOriginPullCA verifies a changed CA is written and reloads Caddy,
+// an unchanged one does not, and an unparseable download never replaces
+// the current CA.
+func TestSyncOriginPullCA(t *testing.T) {
+	var mu sync.Mutex
+	served := testCAPEM(t, "rotated CA")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Write(served)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "origin-pull-ca.pem")
+	if err := os.WriteFile(path, testCAPEM(t, "baked-in CA"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	reloads := 0
+	reload := func() error {
+		reloads++
+		return nil
+	}
+	refresh := func() {
+		syncOriginPullCA(context.Background(), server.Client(), server.URL, path, "test-agent", reload)
+	}
+
+	refresh()
+	if reloads != 1 {
+		t.Fatalf("changed CA: reloads = %d, want 1", reloads)
+	}
+	if got, _ := os.ReadFile(path); string(got) != string(served) {
+		t.Fatalf("CA file not replaced with the downloaded CA")
+	}
+
+	refresh()
+	if reloads != 1 {
+		t.Errorf("unchanged CA: reloads = %d, want still 1", reloads)
+	}
+
+	mu.Lock()
+	good := served
+	served = []byte("<html>maintenance</html>")
+	mu.Unlock()
+	refresh()
+	if reloads != 1 {
+		t.Errorf("invalid CA: reloads = %d, want still 1", reloads)
+	}
+	if got, _ := os.ReadFile(path); string(got) != string(good) {
+		t.Errorf("invalid download replaced the CA file")
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+)
+
+// registerPprof mounts the net/http/pprof handlers under /debug/pprof/ on
+// mux. Every request must carry the status token as a bearer token.
+func registerPprof(mux *http.ServeMux, token string) {
+	protect := func(h http.HandlerFunc) http.Handler {
+		return requireBearerToken(token, h)
+	}
+	mux.Handle("/debug/pprof/", protect(pprof.Index))
+	mux.Handle("/debug/pprof/cmdline", protect(pprof.Cmdline))
+	mux.Handle("/debug/pprof/profile", protect(pprof.Profile))
+	mux.Handle("/debug/pprof/symbol", protect(pprof.Symbol))
+	mux.Handle("/debug/pprof/trace", protect(pprof.Trace))
+}
+
+// requireBearerToken rejects requests whose Authorization header is not
+// "Bearer <token>" with 401. An empty token rejects every request.
+func requireBearerToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="dyndns-status"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestRegisterPprof verifies /debug/pprof/ requires the status token when
+// enabled and is not mounted at all otherwise.
+func TestRegisterPprof(t *testing.T) {
+	get := func(mux *http.ServeMux, auth string) int {
+		req := httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	enabled := http.NewServeMux()
+	registerPprof(enabled, "s3cret")
+
+	if code := get(enabled, "Bearer s3cret"); code != http.StatusOK {
+		t.Errorf("with token: status = %d, want 200", code)
+	}
+	if code := get(enabled, ""); code != http.StatusUnauthorized {
+		t.Errorf("without token: status = %d, want 401", code)
+	}
+	if code := get(enabled, "Bearer wrong"); code != http.StatusUnauthorized {
+		t.Errorf("wrong token: status = %d, want 401", code)
+	}
+
+	disabled := http.NewServeMux()
+	if code := get(disabled, "Bearer s3cret"); code != http.StatusNotFound {
+		t.Errorf("pprof disabled: status = %d, want 404", code)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+)
+
+// cloudflareErrorCode extracts the code from Cloudflare's plain-text error
+// pages ("error code: 1001").
+var cloudflareErrorCode = regexp.MustCompile(`error code: (\d+)`)
+
+// proxyProbes checks newly proxied subdomains through Cloudflare after a
+// reconcile, warning when Cloudflare cannot reach the origin, e.g. because
+// the DNS record went live before Caddy served the site. A nil value
+// disables probing.
+type proxyProbes struct {
+	delay     time.Duration
+	userAgent string
+	client    *http.Client
+	// url builds the probed URL for a record name.
+	url func(name string) string
+
+	mu sync.Mutex
+	// proxied holds the names published as proxied by the last reconcile.
+	proxied map[string]bool
+}
+
+// newProxyProbes returns a prober when PROXY_PROBE is enabled, else nil.
+func newProxyProbes(cfg *config.Config) *proxyProbes {
+	if !cfg.ProxyProbe {
+		return nil
+	}
+	return &proxyProbes{
+		delay:     cfg.ProxyProbeDelay,
+		userAgent: cfg.UserAgent,
+		client: &http.Client{
+			Timeout: 15 * time.Second,
+			// A redirect (e.g. to a login page) means the origin answered.
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		url:     func(name string) string { return "https://" + name + "/" },
+		proxied: make(map[string]bool),
+	}
+}
+
+// observe starts a delayed probe for every name the snapshot published as
+// proxied that was not proxied after the previous reconcile.
+func (p *proxyProbes) observe(ctx context.Context, snapshot *recordSnapshot) {
+	if p == nil {
+		return
+	}
+	for _, name := range p.newlyProxied(snapshot) {
+		go func(name string) {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(p.delay):
+			}
+			p.probe(ctx, name)
+		}(name)
+	}
+}
+
+// newlyProxied records the proxied names of the snapshot and returns those
+// that were not proxied before.
+func (p *proxyProbes) newlyProxied(snapshot *recordSnapshot) []string {
+	current := make(map[string]bool)
+	for _, rec := range snapshot.Records {
+		if rec.Proxied {
+			current[strings.ToLower(rec.Name)] = true
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var fresh []string
+	for name := range current {
+		if !p.proxied[name] {
+			fresh = append(fresh, name)
+		}
+	}
+	p.proxied = current
+	return fresh
+}
+
+// probe requests name through Cloudflare and logs a warning when the
+// response is a Cloudflare origin error (HTTP 52x or a 530 with a
+// 1000-series code). It reports whether such an error was seen.
+func (p *proxyProbes) probe(ctx context.Context, name string) bool {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url(name), nil)
+	if err != nil {
+		slog.Debug("Failed to build proxy probe request", "name", name, "error", err)
+		return false
+	}
+	if p.userAgent != "" {
+		req.Header.Set("User-Agent", p.userAgent)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		slog.Debug("Proxy probe failed", "name", name, "error", err)
+		return false
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 520 || resp.StatusCode > 530 || !strings.EqualFold(resp.Header.Get("Server"), "cloudflare") {
+		slog.Debug("Proxy probe passed", "name", name, "status", resp.StatusCode)
+		return false
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	code := ""
+	if m := cloudflareErrorCode.FindSubmatch(body); m != nil {
+		code = string(m[1])
+	}
+	slog.Warn("Cloudflare cannot reach the origin for a newly proxied subdomain - was the DNS record published before Caddy served the site?",
+		"name", name,
+		"status", resp.StatusCode,
+		"cloudflare_error", code,
+		"cf_ray", resp.Header.Get("Cf-Ray"),
+	)
+	return true
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+)
+
+// TestProxyProbes_NewlyProxied verifies only names that were not proxied
+// after the previous reconcile are probed.
+func TestProxyProbes_NewlyProxied(t *testing.T) {
+	p := newProxyProbes(&config.Config{ProxyProbe: true})
+
+	snap := func(names ...string) *recordSnapshot {
+		s := &recordSnapshot{}
+		for _, n := range names {
+			s.Records = append(s.Records, snapshotRecord{Name: n, Type: "A", Proxied: true})
+		}
+		s.Records = append(s.Records, snapshotRecord{Name: "direct.example.com", Type: "A"})
+		return s
+	}
+
+	got := p.newlyProxied(snap("app.example.com", "api.example.com"))
+	sort.Strings(got)
+	if strings.Join(got, ",") != "api.example.com,app.example.com" {
+		t.Errorf("first reconcile: %v, want both proxied names", got)
+	}
+	if got := p.newlyProxied(snap("app.example.com", "wiki.example.com")); strings.Join(got, ",") != "wiki.example.com" {
+		t.Errorf("second reconcile: %v, want [wiki.example.com]", got)
+	}
+	if got := p.newlyProxied(snap("app.example.com", "api.example.com")); strings.Join(got, ",") != "api.example.com" {
+		t.Errorf("re-proxied name: %v, want [api.example.com]", got)
+	}
+
+	if newProxyProbes(&config.Config{}) != nil {
+		t.Error("newProxyProbes without PROXY_PROBE should return nil")
+	}
+}
+
+// TestProxyProbes_OriginUnreachable verifies a Cloudflare origin error is
+// logged as a warning and a normal answer is not.
+func TestProxyProbes_OriginUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "cloudflare")
+		w.Header().Set("Cf-Ray", "8a1b2c3d4e5f-AMS")
+		if r.URL.Query().Get("name") == "broken.example.com" {
+			w.WriteHeader(530)
+			fmt.Fprint(w, "error code: 1001")
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	var logs bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	p := newProxyProbes(&config.Config{ProxyProbe: true})
+	p.url = func(name string) string { return server.URL + "/?name=" + name }
+
+	if p.probe(context.Background(), "app.example.com") {
+		t.Error("healthy site reported as origin error")
+	}
+	if strings.Contains(logs.String(), "level=WARN") {
+		t.Errorf("healthy site logged a warning:\n%s", logs.String())
+	}
+
+	if !p.probe(context.Background(), "broken.example.com") {
+		t.Fatal("origin error not detected")
+	}
+	for _, want := range []string{"level=WARN", "name=broken.example.com", "status=530", "cloudflare_error=1001", "cf_ray=8a1b2c3d4e5f-AMS"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("warning missing %q:\n%s", want, logs.String())
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+)
+
+// quietHoursConfirmations is how many consecutive checks must report the
+// same new IP during quiet hours before it is applied.
+const quietHoursConfirmations = 2
+
+// quietHours suppresses DNS churn inside the QUIET_HOURS window: a new IP
+// is applied only once quietHoursConfirmations checks in a row reported
+// it, and until then the records keep the applied IPs. A reconcile that
+// would publish exactly the records applied last is skipped; new names and
+// the stale record cleanup still go through. A nil *quietHours never
+// suppresses.
+type quietHours struct {
+	start, end time.Duration
+	// now returns the current local time; injectable for tests.
+	now func() time.Time
+
+	mu sync.Mutex
+	// applied is set once a reconcile published appliedIPv4/appliedIPv6
+	// as appliedRecords. It is cleared when dyndns deletes records.
+	applied                  bool
+	appliedIPv4, appliedIPv6 string
+	appliedRecords           []snapshotRecord
+	// pendingIPv4/pendingIPv6 is the new IP awaiting confirmation, seen
+	// pendingSeen times in a row.
+	pendingIPv4, pendingIPv6 string
+	pendingSeen              int
+}
+
+// newQuietHours returns the QUIET_HOURS gate, or nil when no window is set.
+func newQuietHours(cfg *config.Config, now func() time.Time) *quietHours {
+	if !cfg.QuietHours {
+		return nil
+	}
+	if now == nil {
+		now = time.Now
+	}
+	return &quietHours{start: cfg.QuietHoursStart, end: cfg.QuietHoursEnd, now: now}
+}
+
+// inWindow reports whether t falls in the window, which may wrap past
+// midnight.
+func (q *quietHours) inWindow(t time.Time) bool {
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+	if q.start < q.end {
+		return offset >= q.start && offset < q.end
+	}
+	return offset >= q.start || offset < q.end
+}
+
+// gate returns the IPs the reconcile should publish for the detected
+// ipv4/ipv6: inside the window a new IP is held back, keeping the applied
+// ones, until quietHoursConfirmations checks in a row reported it.
+func (q *quietHours) gate(ipv4, ipv6 string) (string, string) {
+	if q == nil {
+		return ipv4, ipv6
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.inWindow(q.now()) || !q.applied || (ipv4 == q.appliedIPv4 && ipv6 == q.appliedIPv6) {
+		q.pendingIPv4, q.pendingIPv6, q.pendingSeen = "", "", 0
+		return ipv4, ipv6
+	}
+	if ipv4 == q.pendingIPv4 && ipv6 == q.pendingIPv6 {
+		q.pendingSeen++
+	} else {
+		q.pendingIPv4, q.pendingIPv6, q.pendingSeen = ipv4, ipv6, 1
+	}
+	if q.pendingSeen < quietHoursConfirmations {
+		slog.Info("Quiet hours: new IP awaiting confirmation, keeping the applied IP",
+			"ipv4", ipv4, "ipv6", ipv6, "applied_ipv4", q.appliedIPv4, "applied_ipv6", q.appliedIPv6)
+		return q.appliedIPv4, q.appliedIPv6
+	}
+	return ipv4, ipv6
+}
+
+// idle reports whether, inside the window, the reconcile would publish
+// exactly the records applied last with nothing left to clean up, so it
+// can be skipped.
+func (q *quietHours) idle(ipv4, ipv6 string, planned []snapshotRecord, cleanupPending bool) bool {
+	if q == nil || cleanupPending {
+		return false
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.inWindow(q.now()) && q.applied &&
+		ipv4 == q.appliedIPv4 && ipv6 == q.appliedIPv6 && sameRecords(planned, q.appliedRecords)
+}
+
+// markApplied records the IPs and records a reconcile published without
+// failures.
+func (q *quietHours) markApplied(ipv4, ipv6 string, records []snapshotRecord) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.applied = true
+	q.appliedIPv4, q.appliedIPv6 = ipv4, ipv6
+	q.appliedRecords = records
+}
+
+// reset forgets the applied state after dyndns deleted records, so the
+// next reconcile republishes them even inside the window.
+func (q *quietHours) reset() {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.applied = false
+	q.appliedRecords = nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+)
+
+// staticDetector reports fixed addresses.
+type staticDetector struct{ ipv4, ipv6 string }
+
+func (d *staticDetector) Detect(context.Context) (string, string, error) {
+	return d.ipv4, d.ipv6, nil
+}
+
+func TestQuietHours_InWindow(t *testing.T) {
+	at := func(hh, mm int) time.Time { return time.Date(2026, 1, 1, hh, mm, 0, 0, time.Local) }
+	tests := []struct {
+		start, end time.Duration
+		t          time.Time
+		want       bool
+	}{
+		{1 * time.Hour, 6 * time.Hour, at(3, 0), true},
+		{1 * time.Hour, 6 * time.Hour, at(6, 0), false},
+		{1 * time.Hour, 6 * time.Hour, at(0, 59), false},
+		{23 * time.Hour, 6 * time.Hour, at(23, 30), true},
+		{23 * time.Hour, 6 * time.Hour, at(2, 0), true},
+		{23 * time.Hour, 6 * time.Hour, at(12, 0), false},
+	}
+	for _, tt := range tests {
+		q := &quietHours{start: tt.start, end: tt.end}
+		if got := q.inWindow(tt.t); got != tt.want {
+			t.Errorf("inWindow(%v-%v, %s) = %v, want %v", tt.start, tt.end, tt.t.Format("15:04"), got, tt.want)
+		}
+	}
+}
+
+// TestUpdateIPAndDNS_QuietHours verifies that inside the window an
+// unchanged reconcile is skipped and a new IP waits for a confirming
+// check, while outside the window every check reconciles.
+func TestUpdateIPAndDNS_QuietHours(t *testing.T) {
+	fake := newFakeCloudflare(t)
+	cfg := &config.Config{
+		Domain:          "example.com",
+		QuietHours:      true,
+		QuietHoursStart: 1 * time.Hour,
+		QuietHoursEnd:   6 * time.Hour,
+	}
+	cfClient := fake.client(t, cfg)
+	gen := caddy.New(cfg, nil)
+
+	now := time.Date(2026, 1, 1, 3, 0, 0, 0, time.Local)
+	quiet := newQuietHours(cfg, func() time.Time { return now })
+	detector := &staticDetector{ipv4: "203.0.113.10"}
+	reconcile := func() *recordSnapshot {
+		return (&Controller{cfg: cfg, detector: detector, dns: cfClient, caddyGen: gen, quiet: quiet}).Reconcile(context.Background())
+	}
+	apex := func() string {
+		for _, r := range fake.list() {
+			if r.Name == "example.com" && r.Type == "A" {
+				return r.Content
+			}
+		}
+		return ""
+	}
+
+	// Nothing applied yet: the first reconcile always runs.
+	if reconcile() == nil || apex() != "203.0.113.10" {
+		t.Fatalf("first reconcile: apex = %q, want 203.0.113.10", apex())
+	}
+	writes := fake.writeCount()
+
+	// Unchanged IP during quiet hours: suppressed, no API writes.
+	if snapshot := reconcile(); snapshot != nil {
+		t.Errorf("unchanged reconcile during quiet hours ran: %+v", snapshot)
+	}
+	if got := fake.writeCount(); got != writes {
+		t.Errorf("writes = %d, want %d (no churn)", got, writes)
+	}
+
+	// A new IP seen once is held back; the confirming check applies it.
+	detector.ipv4 = "203.0.113.20"
+	if reconcile() != nil || apex() != "203.0.113.10" {
+		t.Errorf("unconfirmed new IP applied: apex = %q", apex())
+	}
+	if reconcile() == nil || apex() != "203.0.113.20" {
+		t.Errorf("confirmed new IP not applied: apex = %q", apex())
+	}
+
+	// A flap back and forth is never confirmed.
+	detector.ipv4 = "203.0.113.30"
+	reconcile()
+	detector.ipv4 = "203.0.113.20"
+	reconcile()
+	if apex() != "203.0.113.20" {
+		t.Errorf("flapping IP applied: apex = %q", apex())
+	}
+
+	// Outside the window every check reconciles.
+	now = time.Date(2026, 1, 1, 12, 0, 0, 0, time.Local)
+	if reconcile() == nil {
+		t.Error("reconcile outside quiet hours was suppressed")
+	}
+}
+
+// TestUpdateIPAndDNS_QuietHoursNewNames verifies that inside the window
+// with an unchanged IP a new subdomain still gets its record and a
+// removed one is cleaned up, while an unchanged set writes nothing.
+func TestUpdateIPAndDNS_QuietHoursNewNames(t *testing.T) {
+	fake := newFakeCloudflare(t)
+	cfg := &config.Config{
+		Domain:                  "example.com",
+		CloudflareProxy:         true,
+		QuietHours:              true,
+		QuietHoursStart:         1 * time.Hour,
+		QuietHoursEnd:           6 * time.Hour,
+		StaleCleanupConcurrency: 1,
+		StaleCleanupTimeout:     time.Minute,
+	}
+	cfClient := fake.client(t, cfg)
+	gen := caddy.New(cfg, nil)
+	gen.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "app", Port: 8080}})
+	quiet := newQuietHours(cfg, func() time.Time { return time.Date(2026, 1, 1, 3, 0, 0, 0, time.Local) })
+	controller := &Controller{cfg: cfg, detector: &staticDetector{ipv4: "203.0.113.10"}, dns: cfClient, caddyGen: gen, quiet: quiet}
+	names := func() []string {
+		var out []string
+		for _, r := range fake.list() {
+			out = append(out, r.Name)
+		}
+		return out
+	}
+
+	controller.Reconcile(context.Background())
+	writes := fake.writeCount()
+	if snapshot := controller.Reconcile(context.Background()); snapshot != nil || fake.writeCount() != writes {
+		t.Fatalf("unchanged reconcile ran: snapshot=%+v writes=%d, want %d", snapshot, fake.writeCount(), writes)
+	}
+
+	gen.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "api", Port: 9090}})
+	if controller.Reconcile(context.Background()) == nil {
+		t.Fatal("reconcile with a new subdomain was skipped")
+	}
+	if got := names(); !slices.Equal(got, []string{"api.example.com"}) {
+		t.Errorf("records = %v, want the new api.example.com only", got)
+	}
+}
+
+// TestUpdateIPAndDNS_QuietHoursDetectionRecovery verifies records deleted
+// by ON_DETECTION_FAILURE=remove are republished inside the window once
+// detection recovers, even on the same IP.
+func TestUpdateIPAndDNS_QuietHoursDetectionRecovery(t *testing.T) {
+	fake := newFakeCloudflare(t)
+	cfg := &config.Config{
+		Domain:                      "example.com",
+		QuietHours:                  true,
+		QuietHoursStart:             1 * time.Hour,
+		QuietHoursEnd:               6 * time.Hour,
+		OnDetectionFailure:          config.DetectionFailureRemove,
+		OnDetectionFailureThreshold: 1,
+	}
+	cfClient := fake.client(t, cfg)
+	gen := caddy.New(cfg, nil)
+	quiet := newQuietHours(cfg, func() time.Time { return time.Date(2026, 1, 1, 3, 0, 0, 0, time.Local) })
+	failures := &detectionFailures{}
+	reconcile := func(detector ipDetector) *recordSnapshot {
+		return (&Controller{cfg: cfg, detector: detector, dns: cfClient, caddyGen: gen, quiet: quiet, failures: failures}).Reconcile(context.Background())
+	}
+
+	reconcile(&staticDetector{ipv4: "203.0.113.10"})
+	reconcile(failingDetector{})
+	if got := fake.list(); len(got) != 0 {
+		t.Fatalf("records after detection failure = %+v, want none", got)
+	}
+
+	if reconcile(&staticDetector{ipv4: "203.0.113.10"}) == nil {
+		t.Fatal("recovery reconcile was skipped")
+	}
+	if got := len(fake.list()); got != 2 {
+		t.Errorf("records after recovery = %+v, want the apex and wildcard", fake.list())
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimited allows one call to next per window and answers 429 Too Many
+// Requests (with Retry-After) otherwise. Each wrapped endpoint has its own
+// window, so mutating routes can't be used to hammer Cloudflare or thrash
+// Caddy. A zero window disables the limit.
+func rateLimited(window time.Duration, next http.Handler) http.Handler {
+	if window <= 0 {
+		return next
+	}
+	return (&windowLimiter{window: window, now: time.Now}).wrap(next)
+}
+
+// windowLimiter admits one call per window.
+type windowLimiter struct {
+	window time.Duration
+	now    func() time.Time
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+func (l *windowLimiter) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wait := l.reserve(); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// reserve admits a call and returns 0, or returns how long until the next
+// call is admitted. Rejected calls don't extend the window.
+func (l *windowLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if !l.last.IsZero() {
+		if wait := l.last.Add(l.window).Sub(now); wait > 0 {
+			return wait
+		}
+	}
+	l.last = now
+	return 0
+}
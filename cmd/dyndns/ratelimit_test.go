@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestRateLimited verifies a second call within the window gets 429 with
+// Retry-After, and calls are admitted again once the window has passed.
+func TestRateLimited(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limiter := &windowLimiter{window: 30 * time.Second, now: func() time.Time { return now }}
+
+	calls := 0
+	h := limiter.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	post := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/refresh", nil))
+		return rec
+	}
+
+	if rec := post(); rec.Code != http.StatusAccepted {
+		t.Fatalf("first call = %d, want %d", rec.Code, http.StatusAccepted)
+	}
+
+	now = now.Add(10 * time.Second)
+	rec := post()
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("second call within window = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "20" {
+		t.Errorf("Retry-After = %q, want %q", got, "20")
+	}
+
+	now = now.Add(20 * time.Second)
+	if rec := post(); rec.Code != http.StatusAccepted {
+		t.Errorf("call after window = %d, want %d", rec.Code, http.StatusAccepted)
+	}
+	if calls != 2 {
+		t.Errorf("handler calls = %d, want 2", calls)
+	}
+}
+
+// TestRateLimited_ZeroWindowDisables verifies a zero window leaves the
+// endpoint unlimited.
+func TestRateLimited_ZeroWindowDisables(t *testing.T) {
+	h := rateLimited(0, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/refresh", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("call %d = %d, want 200", i+1, rec.Code)
+		}
+	}
+}
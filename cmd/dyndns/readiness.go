@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+)
+
+// hostResolver looks up the addresses of a name; *net.Resolver satisfies it.
+type hostResolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// readiness backs /ready: dyndns is ready once a reconcile published the
+// records without failures and, with READY_REQUIRE_PROPAGATION, once the
+// propagation name resolves to the published IPs through a public resolver.
+type readiness struct {
+	requirePropagation bool
+	name               string
+	timeout            time.Duration
+	resolver           hostResolver
+
+	mu         sync.Mutex
+	reconciled bool
+	ipv4, ipv6 string
+	// propagated is cached until the next reconcile changes the IPs.
+	propagated bool
+}
+
+// newReadiness builds the readiness state from the READY_* settings. The
+// resolver queries READY_RESOLVER directly, bypassing the host's resolver.
+func newReadiness(cfg *config.Config) *readiness {
+	server := cfg.ReadyResolver
+	return &readiness{
+		requirePropagation: cfg.ReadyRequirePropagation,
+		name:               cfg.ReadyPropagationName,
+		timeout:            cfg.ReadyPropagationTimeout,
+		resolver: &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, server)
+			},
+		},
+	}
+}
+
+// markReconciled records a reconcile that published ipv4/ipv6 without failures.
+func (r *readiness) markReconciled(ipv4, ipv6 string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ipv4 != ipv4 || r.ipv6 != ipv6 {
+		r.propagated = false
+	}
+	r.reconciled = true
+	r.ipv4, r.ipv6 = ipv4, ipv6
+}
+
+// check reports whether dyndns is ready, with the reason when it is not.
+func (r *readiness) check(ctx context.Context) (bool, string) {
+	r.mu.Lock()
+	reconciled, propagated := r.reconciled, r.propagated
+	ipv4, ipv6 := r.ipv4, r.ipv6
+	r.mu.Unlock()
+
+	if !reconciled {
+		return false, "no successful reconcile yet"
+	}
+	if !r.requirePropagation || propagated {
+		return true, ""
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	addrs, err := r.resolver.LookupHost(ctx, r.name)
+	if err != nil {
+		slog.Debug("Propagation check lookup failed", "name", r.name, "error", err)
+		return false, "waiting for " + r.name + " to resolve: " + err.Error()
+	}
+	for _, want := range []string{ipv4, ipv6} {
+		if want != "" && !slices.ContainsFunc(addrs, func(a string) bool { return sameIP(a, want) }) {
+			return false, "waiting for " + r.name + " to resolve to " + want
+		}
+	}
+
+	r.mu.Lock()
+	if r.ipv4 == ipv4 && r.ipv6 == ipv6 {
+		r.propagated = true
+	}
+	r.mu.Unlock()
+	slog.Info("DNS propagation confirmed", "name", r.name, "ipv4", ipv4, "ipv6", ipv6)
+	return true, ""
+}
+
+// sameIP compares two textual addresses, ignoring IPv6 formatting.
+func sameIP(a, b string) bool {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	return ipA != nil && ipA.Equal(ipB)
+}
+
+// handler answers 200 when ready and 503 with the reason otherwise.
+func (r *readiness) handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if ok, reason := r.check(req.Context()); !ok {
+			http.Error(w, reason, http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("READY"))
+	})
+}
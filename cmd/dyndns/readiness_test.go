@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeResolver answers LookupHost from a settable address list.
+type fakeResolver struct {
+	mu    sync.Mutex
+	addrs []string
+	err   error
+	calls int
+}
+
+func (f *fakeResolver) LookupHost(_ context.Context, _ string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	return f.addrs, f.err
+}
+
+func (f *fakeResolver) set(addrs []string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.addrs, f.err = addrs, err
+}
+
+func readyStatus(t *testing.T, r *readiness) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	r.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	return rec.Code
+}
+
+func TestReadiness_WithoutPropagation(t *testing.T) {
+	resolver := &fakeResolver{}
+	r := &readiness{resolver: resolver, timeout: time.Second}
+
+	if got := readyStatus(t, r); got != http.StatusServiceUnavailable {
+		t.Errorf("before reconcile: status = %d, want 503", got)
+	}
+	r.markReconciled("203.0.113.10", "")
+	if got := readyStatus(t, r); got != http.StatusOK {
+		t.Errorf("after reconcile: status = %d, want 200", got)
+	}
+	if resolver.calls != 0 {
+		t.Errorf("resolver called %d times without READY_REQUIRE_PROPAGATION", resolver.calls)
+	}
+}
+
+// TestReadiness_RequiresPropagation verifies readiness flips only once the
+// record resolves to the published addresses, and is re-checked after the
+// IP changes.
+func TestReadiness_RequiresPropagation(t *testing.T) {
+	resolver := &fakeResolver{err: errors.New("no such host")}
+	r := &readiness{
+		requirePropagation: true,
+		name:               "example.com",
+		timeout:            time.Second,
+		resolver:           resolver,
+	}
+	r.markReconciled("203.0.113.10", "2001:db8::10")
+
+	steps := []struct {
+		addrs []string
+		err   error
+		want  int
+	}{
+		{err: errors.New("no such host"), want: http.StatusServiceUnavailable},
+		{addrs: []string{"198.51.100.1"}, want: http.StatusServiceUnavailable},
+		{addrs: []string{"203.0.113.10"}, want: http.StatusServiceUnavailable}, // AAAA not there yet
+		{addrs: []string{"203.0.113.10", "2001:0db8::0010"}, want: http.StatusOK},
+	}
+	for i, step := range steps {
+		resolver.set(step.addrs, step.err)
+		if got := readyStatus(t, r); got != step.want {
+			t.Errorf("step %d (%v, %v): status = %d, want %d", i, step.addrs, step.err, got, step.want)
+		}
+	}
+
+	// Confirmed propagation is cached until the IP changes.
+	resolver.set(nil, errors.New("resolver down"))
+	if got := readyStatus(t, r); got != http.StatusOK {
+		t.Errorf("cached: status = %d, want 200", got)
+	}
+	r.markReconciled("203.0.113.20", "2001:db8::10")
+	if got := readyStatus(t, r); got != http.StatusServiceUnavailable {
+		t.Errorf("after IP change: status = %d, want 503", got)
+	}
+	resolver.set([]string{"203.0.113.20", "2001:db8::10"}, nil)
+	if got := readyStatus(t, r); got != http.StatusOK {
+		t.Errorf("after new IP propagated: status = %d, want 200", got)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+)
+
+// TestRunReconcileLoop_FullInterval verifies the full reconcile runs on its
+// own ticker, independent of the (here hourly) IP-check schedule.
+func TestRunReconcileLoop_FullInterval(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	checks, fulls := 0, 0
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runReconcileLoop(ctx, newCheckSchedule(time.Hour, 0, false, nil), 0, 10*time.Millisecond, nil, func(full bool) {
+			mu.Lock()
+			defer mu.Unlock()
+			if full {
+				fulls++
+			} else {
+				checks++
+			}
+		})
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := fulls
+		mu.Unlock()
+		if n >= 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("full reconciles = %d, want at least 3", n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if checks != 1 {
+		t.Errorf("IP-check reconciles = %d, want only the initial one", checks)
+	}
+}
+
+// TestFullReconcile_HealsDrift verifies a full reconcile re-pushes a record
+// edited out-of-band even though the IP and services are unchanged and
+// quiet hours skip the regular check.
+func TestFullReconcile_HealsDrift(t *testing.T) {
+	fake := newFakeCloudflare(t)
+	cfg := &config.Config{
+		Domain:          "example.com",
+		CloudflareProxy: true,
+		QuietHours:      true,
+		QuietHoursStart: 0,
+		QuietHoursEnd:   24*time.Hour - time.Second,
+	}
+	cfClient := fake.client(t, cfg)
+	gen := caddy.New(cfg, nil)
+	gen.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "app", Port: 8080}})
+	detector := &staticDetector{ipv4: "203.0.113.10"}
+	quiet := newQuietHours(cfg, func() time.Time { return time.Date(2026, 1, 1, 12, 0, 0, 0, time.Local) })
+	controller := &Controller{cfg: cfg, detector: detector, dns: cfClient, caddyGen: gen, quiet: quiet}
+
+	controller.Reconcile(context.Background())
+	fake.setContent("app.example.com", "A", "198.51.100.66")
+
+	appIP := func() string {
+		for _, r := range fake.list() {
+			if r.Name == "app.example.com" && r.Type == "A" {
+				return r.Content
+			}
+		}
+		return ""
+	}
+
+	// The regular check sees an unchanged IP and leaves the drift alone.
+	controller.Reconcile(context.Background())
+	if got := appIP(); got != "198.51.100.66" {
+		t.Fatalf("regular check touched the record: %q", got)
+	}
+
+	// The full reconcile bypasses the gate and restores the desired state.
+	if snapshot := controller.ReconcileFull(context.Background()); snapshot == nil {
+		t.Fatal("full reconcile was skipped")
+	}
+	if got := appIP(); got != "203.0.113.10" {
+		t.Errorf("app.example.com A = %q after full reconcile, want 203.0.113.10", got)
+	}
+}
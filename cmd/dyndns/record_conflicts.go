@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/cloudflare"
+)
+
+// reconcilePlan is what one reconcile publishes, computed once per cycle
+// ahead of the writes.
+type reconcilePlan struct {
+	// active is the active subdomains without the catchall (proxy mode).
+	active []string
+	// subdomains is the records of each active subdomain and the
+	// catchall (proxy mode).
+	subdomains []subdomainUpdate
+	// records is every planned record: the apex and wildcard in direct
+	// mode, the subdomain records in proxy mode, and the MANAGE_WWW alias.
+	records []snapshotRecord
+}
+
+// planReconcile returns the plan of a reconcile with ipv4 and ipv6.
+func (c *Controller) planReconcile(ipv4, ipv6 string) *reconcilePlan {
+	plan := &reconcilePlan{}
+	add := func(name string, updates []cloudflare.RecordUpdate) {
+		for _, u := range updates {
+			plan.records = append(plan.records, snapshotRecord{Name: name, Type: u.Type, Content: u.Content, Proxied: u.Proxied})
+		}
+	}
+
+	if c.dns.IsProxied() {
+		plan.active = c.caddyGen.GetActiveSubdomains()
+		plan.subdomains = c.subdomainUpdates(withCatchall(c.cfg, slices.Clone(plan.active)), ipv4, ipv6)
+		for _, d := range plan.subdomains {
+			add(d.fqdn, d.updates)
+		}
+	} else {
+		add(c.cfg.Domain, familyUpdates(ipv4, ipv6, c.cfg.ApexProxied))
+		add("*."+c.cfg.Domain, familyUpdates(ipv4, ipv6, false))
+	}
+	if c.cfg.ManageWWW && wwwOwner(c.cfg, c.caddyGen) == "" {
+		add(wwwFQDN(c.cfg), wwwUpdates(c.cfg, c.dns))
+	}
+	return plan
+}
+
+// recordConflicts reports the names the planned records would give both
+// a CNAME and another record, counting the zone records of other types
+// already at a planned name (records of a planned type are overwritten).
+// DNS forbids a CNAME sharing its name, so Cloudflare would reject the
+// writes with an opaque API error.
+func recordConflicts(planned []snapshotRecord, zone []cloudflare.ManagedRecord) error {
+	types := make(map[string][]string)
+	var names []string
+	for _, r := range planned {
+		name := strings.ToLower(strings.TrimSuffix(r.Name, "."))
+		if _, ok := types[name]; !ok {
+			names = append(names, name)
+		}
+		if !slices.Contains(types[name], r.Type) {
+			types[name] = append(types[name], r.Type)
+		}
+	}
+	for _, r := range zone {
+		name := strings.ToLower(strings.TrimSuffix(r.Name, "."))
+		if _, ok := types[name]; ok && !slices.Contains(types[name], r.Type) {
+			types[name] = append(types[name], r.Type)
+		}
+	}
+
+	var conflicts []string
+	for _, name := range names {
+		if len(types[name]) > 1 && slices.Contains(types[name], "CNAME") {
+			conflicts = append(conflicts, fmt.Sprintf("%s (%s)", name, strings.Join(types[name], "+")))
+		}
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+	return fmt.Errorf("a CNAME cannot share its name with other records: %s", strings.Join(conflicts, ", "))
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/cloudflare"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+)
+
+func TestRecordConflicts(t *testing.T) {
+	tests := []struct {
+		name    string
+		records []snapshotRecord
+		zone    []cloudflare.ManagedRecord
+		want    string
+	}{
+		{
+			name: "A and CNAME",
+			records: []snapshotRecord{
+				{Name: "www.example.com", Type: "A", Content: "203.0.113.10"},
+				{Name: "app.example.com", Type: "A", Content: "203.0.113.10"},
+				{Name: "WWW.example.com.", Type: "CNAME", Content: "example.com"},
+			},
+			want: "www.example.com (A+CNAME)",
+		},
+		{
+			name: "AAAA and CNAME",
+			records: []snapshotRecord{
+				{Name: "www.example.com", Type: "CNAME", Content: "example.com"},
+				{Name: "www.example.com", Type: "AAAA", Content: "2001:db8::10"},
+			},
+			want: "www.example.com (CNAME+AAAA)",
+		},
+		{
+			name: "CNAME planned at a zone A record",
+			records: []snapshotRecord{
+				{Name: "www.example.com", Type: "CNAME", Content: "example.com"},
+			},
+			zone: []cloudflare.ManagedRecord{
+				{Name: "www.example.com", Type: "A", Content: "192.0.2.1"},
+			},
+			want: "www.example.com (CNAME+A)",
+		},
+		{
+			name: "A planned at a zone CNAME",
+			records: []snapshotRecord{
+				{Name: "app.example.com", Type: "A", Content: "203.0.113.10"},
+			},
+			zone: []cloudflare.ManagedRecord{
+				{Name: "app.example.com", Type: "CNAME", Content: "elsewhere.example.net"},
+			},
+			want: "app.example.com (A+CNAME)",
+		},
+		{
+			name: "zone records overwritten or elsewhere",
+			records: []snapshotRecord{
+				{Name: "www.example.com", Type: "CNAME", Content: "example.com"},
+				{Name: "app.example.com", Type: "A", Content: "203.0.113.10"},
+			},
+			zone: []cloudflare.ManagedRecord{
+				{Name: "www.example.com", Type: "CNAME", Content: "old.example.com"},
+				{Name: "app.example.com", Type: "A", Content: "192.0.2.1"},
+				{Name: "app.example.com", Type: "TXT", Content: "verification"},
+				{Name: "mail.example.com", Type: "CNAME", Content: "mail.example.net"},
+			},
+		},
+		{
+			name: "distinct names",
+			records: []snapshotRecord{
+				{Name: "example.com", Type: "A", Content: "203.0.113.10"},
+				{Name: "example.com", Type: "AAAA", Content: "2001:db8::10"},
+				{Name: "www.example.com", Type: "CNAME", Content: "example.com"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := recordConflicts(tt.records, tt.zone)
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("recordConflicts() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("recordConflicts() = %v, want a conflict on %s", err, tt.want)
+			}
+		})
+	}
+}
+
+// TestController_PlannedRecords verifies the records checked ahead of the
+// writes match what the reconcile publishes, and that a subdomain owning
+// the www name keeps the alias out of the plan instead of conflicting.
+func TestController_PlannedRecords(t *testing.T) {
+	cfg := &config.Config{Domain: "example.com", CloudflareProxy: true, ManageWWW: true}
+	gen := caddy.New(cfg, nil)
+	gen.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "app", Port: 8080}})
+	dns := newMemoryDNS(true)
+	controller := newController(cfg, &staticDetector{ipv4: "203.0.113.10"}, dns, gen)
+
+	planned := controller.planReconcile("203.0.113.10", "").records
+	if err := recordConflicts(planned, nil); err != nil {
+		t.Fatalf("recordConflicts() = %v, want nil", err)
+	}
+	controller.Reconcile(context.Background())
+	sortRecords(planned)
+	if got := dns.list(); !reflect.DeepEqual(got, planned) {
+		t.Errorf("published records = %+v, want the planned %+v", got, planned)
+	}
+
+	gen.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "www", Port: 8080}})
+	for _, r := range controller.planReconcile("203.0.113.10", "").records {
+		if r.Type == "CNAME" {
+			t.Errorf("planned %+v while www is a subdomain, want no alias", r)
+		}
+	}
+}
+
+// TestController_ZoneRecordConflict verifies a hand-made A record at www
+// refuses the MANAGE_WWW alias before any write, instead of the cycle
+// failing at the API halfway through.
+func TestController_ZoneRecordConflict(t *testing.T) {
+	handMade := snapshotRecord{Name: "www.example.com", Type: "A", Content: "192.0.2.1"}
+	fake := newFakeCloudflare(t, handMade)
+	cfg := &config.Config{Domain: "example.com", CloudflareProxy: true, ManageWWW: true}
+	gen := caddy.New(cfg, nil)
+	gen.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "app", Port: 8080}})
+	controller := newController(cfg, &staticDetector{ipv4: "203.0.113.10"}, fake.client(t, cfg), gen)
+
+	snapshot := controller.reconcile(context.Background(), nil)
+	if snapshot == nil || !snapshot.failed {
+		t.Errorf("reconcile() = %+v, want a failed cycle", snapshot)
+	}
+	if n := fake.writeCount(); n != 0 {
+		t.Errorf("writes = %d, want none", n)
+	}
+	if got := fake.list(); !reflect.DeepEqual(got, []snapshotRecord{handMade}) {
+		t.Errorf("records = %+v, want only the hand-made %+v", got, handMade)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+)
+
+// removalGrace holds back the deletion of stale records for REMOVAL_GRACE.
+// A deployment restart can drop its subdomain from discovery for a moment;
+// deleting and recreating the record would cost propagation time, so a
+// name is only reaped once it has been stale for the whole grace. A nil
+// *removalGrace reaps immediately.
+type removalGrace struct {
+	grace time.Duration
+	// now returns the current time; injectable for tests.
+	now func() time.Time
+
+	mu sync.Mutex
+	// removedAt is when each stale name (lowercased FQDN) was first seen
+	// stale.
+	removedAt map[string]time.Time
+}
+
+// newRemovalGrace returns the grace tracker, or nil when REMOVAL_GRACE is zero.
+func newRemovalGrace(cfg *config.Config, now func() time.Time) *removalGrace {
+	if cfg.RemovalGrace <= 0 {
+		return nil
+	}
+	if now == nil {
+		now = time.Now
+	}
+	return &removalGrace{grace: cfg.RemovalGrace, now: now, removedAt: make(map[string]time.Time)}
+}
+
+// reap returns the subset of this cycle's stale names that have been stale
+// for the whole grace. Names that are no longer stale are forgotten, so a
+// subdomain re-added within the grace keeps its record and starts a fresh
+// grace if it is removed again.
+func (r *removalGrace) reap(stale []string) map[string]bool {
+	due := make(map[string]bool, len(stale))
+	if r == nil {
+		for _, name := range stale {
+			due[strings.ToLower(name)] = true
+		}
+		return due
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	removedAt := make(map[string]time.Time, len(stale))
+	for _, name := range stale {
+		name = strings.ToLower(name)
+		if _, seen := removedAt[name]; seen {
+			continue
+		}
+		since, ok := r.removedAt[name]
+		if !ok {
+			since = now
+		}
+		removedAt[name] = since
+		if now.Sub(since) >= r.grace {
+			due[name] = true
+		} else if !ok {
+			slog.Info("Subdomain removed, keeping its DNS record for the removal grace",
+				"fqdn", name, "grace", r.grace)
+		}
+	}
+	r.removedAt = removedAt
+	return due
+}
+
+// pending reports whether a stale name is still waiting out the grace.
+func (r *removalGrace) pending() bool {
+	if r == nil {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.removedAt) > 0
+}
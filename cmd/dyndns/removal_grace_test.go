@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/ipdetect"
+)
+
+// TestUpdateIPAndDNS_RemovalGrace verifies a subdomain that drops out of
+// discovery and comes back within REMOVAL_GRACE keeps its record, and one
+// that stays removed is deleted once the grace has passed.
+func TestUpdateIPAndDNS_RemovalGrace(t *testing.T) {
+	for _, plan := range []bool{false, true} {
+		t.Run(fmt.Sprintf("plan=%t", plan), func(t *testing.T) {
+			both := []snapshotRecord{
+				{Name: "api.example.com", Type: "A", Content: "203.0.113.10", Proxied: true},
+				{Name: "app.example.com", Type: "A", Content: "203.0.113.10", Proxied: true},
+			}
+			fake := newFakeCloudflare(t, both...)
+			cfg := &config.Config{
+				Domain:          "example.com",
+				CloudflareProxy: true,
+				ManualIPv4:      "203.0.113.10",
+				DNSPlan:         plan,
+				RemovalGrace:    2 * time.Minute,
+			}
+			cfClient := fake.client(t, cfg)
+			gen := caddy.New(cfg, nil)
+			now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+			grace := newRemovalGrace(cfg, func() time.Time { return now })
+
+			app := discovery.Service{Subdomain: "app", Port: 8080}
+			api := discovery.Service{Subdomain: "api", Port: 8081}
+			reconcile := func(services ...discovery.Service) {
+				gen.UpdateDiscoveredServices(services)
+				(&Controller{cfg: cfg, detector: ipdetect.New(cfg), dns: cfClient, caddyGen: gen, grace: grace}).Reconcile(context.Background())
+			}
+
+			// api restarts: dropped, then back a minute later.
+			reconcile(app)
+			now = now.Add(time.Minute)
+			reconcile(app, api)
+			if got := fake.list(); fmt.Sprint(got) != fmt.Sprint(both) {
+				t.Fatalf("records = %+v\nwant untouched %+v", got, both)
+			}
+
+			// api removed for good: kept within the grace, deleted after.
+			now = now.Add(time.Minute)
+			reconcile(app)
+			now = now.Add(time.Minute)
+			reconcile(app)
+			if got := fake.list(); fmt.Sprint(got) != fmt.Sprint(both) {
+				t.Fatalf("records = %+v\nwant kept within the grace %+v", got, both)
+			}
+			now = now.Add(time.Minute)
+			reconcile(app)
+			if got := fake.list(); fmt.Sprint(got) != fmt.Sprint(both[1:]) {
+				t.Errorf("records = %+v\nwant %+v", got, both[1:])
+			}
+		})
+	}
+}
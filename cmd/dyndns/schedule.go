@@ -0,0 +1,55 @@
+package main
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// checkSchedule decides when IP checks run: after a random startup jitter,
+// then every interval, or on wall-clock multiples of the interval shifted
+// by the same jitter offset when aligned.
+type checkSchedule struct {
+	interval time.Duration
+	align    bool
+	// offset is this instance's jitter, drawn once in [0, jitter).
+	offset time.Duration
+}
+
+// newCheckSchedule draws the startup jitter from rng, which returns a value
+// in [0, n) (rand.Int64N in production; injectable for tests).
+func newCheckSchedule(interval, jitter time.Duration, align bool, rng func(n int64) int64) checkSchedule {
+	if rng == nil {
+		rng = rand.Int64N
+	}
+	s := checkSchedule{interval: interval, align: align}
+	if jitter > 0 {
+		s.offset = time.Duration(rng(int64(jitter)))
+	}
+	return s
+}
+
+// firstDelay is how long to wait before the first IP check.
+func (s checkSchedule) firstDelay(now time.Time) time.Duration {
+	if s.align {
+		return s.untilAligned(now)
+	}
+	return s.offset
+}
+
+// nextDelay is how long to wait after a check that finished at now.
+func (s checkSchedule) nextDelay(now time.Time) time.Duration {
+	if s.align {
+		return s.untilAligned(now)
+	}
+	return s.interval
+}
+
+// untilAligned returns the time until the next interval boundary plus the
+// jitter offset, strictly after now.
+func (s checkSchedule) untilAligned(now time.Time) time.Duration {
+	next := now.Truncate(s.interval).Add(s.offset)
+	for !next.After(now) {
+		next = next.Add(s.interval)
+	}
+	return next.Sub(now)
+}
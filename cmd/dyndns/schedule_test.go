@@ -0,0 +1,64 @@
+package main
+
+import (
+	"math/rand/v2"
+	"testing"
+	"time"
+)
+
+// TestCheckSchedule_FirstDelayWithinJitter verifies the first reconcile is
+// delayed by the injected random jitter, always below the configured bound.
+func TestCheckSchedule_FirstDelayWithinJitter(t *testing.T) {
+	const jitter = 30 * time.Second
+	now := time.Date(2026, 1, 1, 12, 3, 10, 0, time.UTC)
+
+	s := newCheckSchedule(5*time.Minute, jitter, false, func(n int64) int64 {
+		if n != int64(jitter) {
+			t.Errorf("rng bound = %v, want %v", time.Duration(n), jitter)
+		}
+		return int64(12 * time.Second)
+	})
+	if got := s.firstDelay(now); got != 12*time.Second {
+		t.Errorf("firstDelay = %v, want 12s from the injected rng", got)
+	}
+	if got := s.nextDelay(now); got != 5*time.Minute {
+		t.Errorf("nextDelay = %v, want the plain interval", got)
+	}
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	for i := 0; i < 1000; i++ {
+		d := newCheckSchedule(5*time.Minute, jitter, false, rng.Int64N).firstDelay(now)
+		if d < 0 || d >= jitter {
+			t.Fatalf("firstDelay = %v, want within [0, %v)", d, jitter)
+		}
+	}
+
+	if d := newCheckSchedule(5*time.Minute, 0, false, nil).firstDelay(now); d != 0 {
+		t.Errorf("firstDelay without jitter = %v, want 0", d)
+	}
+}
+
+// TestCheckSchedule_Aligned verifies aligned checks land on interval
+// boundaries shifted by the jitter offset.
+func TestCheckSchedule_Aligned(t *testing.T) {
+	s := newCheckSchedule(5*time.Minute, 30*time.Second, true, func(int64) int64 {
+		return int64(20 * time.Second)
+	})
+
+	now := time.Date(2026, 1, 1, 12, 3, 10, 0, time.UTC)
+	if got, want := s.firstDelay(now), 2*time.Minute+10*time.Second; got != want {
+		t.Errorf("firstDelay = %v, want %v (12:05:20)", got, want)
+	}
+
+	// Just after a check at the offset boundary: the next is a full interval away.
+	now = time.Date(2026, 1, 1, 12, 5, 20, 0, time.UTC)
+	if got := s.nextDelay(now); got != 5*time.Minute {
+		t.Errorf("nextDelay = %v, want 5m (12:10:20)", got)
+	}
+
+	// Before this boundary's offset: still lands on the current boundary.
+	now = time.Date(2026, 1, 1, 12, 5, 5, 0, time.UTC)
+	if got := s.nextDelay(now); got != 15*time.Second {
+		t.Errorf("nextDelay = %v, want 15s (12:05:20)", got)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+)
+
+// shutdownCleanupTimeout bounds the record cleanup on shutdown; docker
+// stop kills the container 10s after SIGTERM.
+const shutdownCleanupTimeout = 8 * time.Second
+
+// cleanupOnShutdown deletes the A and AAAA records in the SHUTDOWN_CLEANUP
+// scope, so names of a stopped deployment do not keep pointing at the host.
+// The SNAPSHOT_FILE is marked stale first, so the next start pushes again.
+func cleanupOnShutdown(ctx context.Context, cfg *config.Config, cfClient dnsProvider, caddyGen *caddy.Generator) {
+	if cfg.ShutdownCleanup == "" || cfg.ShutdownCleanup == config.ShutdownCleanupNone {
+		return
+	}
+	markSnapshotStale(cfg.SnapshotFile)
+	names := shutdownCleanupNames(ctx, cfg, cfClient, caddyGen)
+	slog.Info("Removing DNS records on shutdown", "scope", cfg.ShutdownCleanup, "names", len(names))
+	if !deleteAddressRecords(ctx, cfClient, names) {
+		slog.Warn("Shutdown DNS cleanup incomplete; the remaining records stay until the next run updates or removes them")
+	}
+}
+
+// shutdownCleanupNames returns the names whose records the shutdown
+// cleanup deletes: the managed and active subdomain names, and with
+// ShutdownCleanupAll also the apex, the wildcard and the MANAGE_WWW alias.
+// In subdomain scope those three are kept even when a subdomain resolves
+// to them (the apex mapping), so DOMAIN keeps resolving.
+func shutdownCleanupNames(ctx context.Context, cfg *config.Config, cfClient dnsProvider, caddyGen *caddy.Generator) []string {
+	candidates, err := cfClient.GetManagedRecordFQDNs(ctx)
+	if err != nil {
+		slog.Error("Failed to list managed DNS records, removing active subdomains only", "error", err)
+	}
+	for _, sub := range caddyGen.GetActiveSubdomains() {
+		candidates = append(candidates, cfg.GetSubdomainFQDN(sub))
+	}
+	if cfg.CatchallSubdomain != "" {
+		candidates = append(candidates, cfg.GetSubdomainFQDN(cfg.CatchallSubdomain))
+	}
+
+	apex := strings.ToLower(strings.TrimSuffix(cfg.Domain, "."))
+	www := strings.ToLower(wwwFQDN(cfg))
+	var names []string
+	for _, name := range candidates {
+		key := strings.ToLower(strings.TrimSuffix(name, "."))
+		if key == apex || strings.HasPrefix(key, "*.") || (cfg.ManageWWW && key == www) {
+			continue
+		}
+		names = append(names, name)
+	}
+
+	if cfg.ShutdownCleanup == config.ShutdownCleanupAll {
+		names = append(names, cfg.Domain, "*."+cfg.Domain)
+		if cfg.ManageWWW {
+			names = append(names, wwwFQDN(cfg))
+		}
+	}
+	return names
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/cloudflare"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+)
+
+// TestCleanupOnShutdown verifies each SHUTDOWN_CLEANUP scope: subdomain
+// scope removes the subdomain records and leaves the apex, wildcard and
+// www alias intact, all removes everything, none leaves every record.
+func TestCleanupOnShutdown(t *testing.T) {
+	apex := []snapshotRecord{
+		{Name: "*.example.com", Type: "A", Content: "203.0.113.10"},
+		{Name: "*.example.com", Type: "AAAA", Content: "2001:db8::10"},
+		{Name: "example.com", Type: "A", Content: "203.0.113.10"},
+		{Name: "example.com", Type: "AAAA", Content: "2001:db8::10"},
+		{Name: "www.example.com", Type: "A", Content: "203.0.113.10"},
+	}
+	subdomains := []snapshotRecord{
+		{Name: "app.example.com", Type: "A", Content: "203.0.113.10"},
+		{Name: "app.example.com", Type: "AAAA", Content: "2001:db8::10"},
+		{Name: "old.example.com", Type: "A", Content: "203.0.113.10"},
+	}
+
+	tests := []struct {
+		scope string
+		want  []snapshotRecord
+	}{
+		{scope: config.ShutdownCleanupNone, want: append(append([]snapshotRecord{}, apex...), subdomains...)},
+		{scope: config.ShutdownCleanupSubdomains, want: apex},
+		{scope: config.ShutdownCleanupAll},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scope, func(t *testing.T) {
+			var records []cloudflare.ManagedRecord
+			for _, r := range append(append([]snapshotRecord{}, apex...), subdomains...) {
+				records = append(records, cloudflare.ManagedRecord{Name: r.Name, Type: r.Type, Content: r.Content})
+			}
+			dns := newMemoryDNS(false, records...)
+			cfg := &config.Config{Domain: "example.com", ManageWWW: true, ShutdownCleanup: tt.scope}
+			gen := caddy.New(cfg, nil)
+			gen.UpdateDiscoveredServices([]discovery.Service{
+				{Subdomain: "app", Port: 8080, Direct: true},
+				{Subdomain: config.ApexSubdomain, Port: 8081, Direct: true},
+			})
+
+			cleanupOnShutdown(context.Background(), cfg, dns, gen)
+
+			want := tt.want
+			sortRecords(want)
+			if got := dns.list(); !reflect.DeepEqual(got, want) {
+				t.Errorf("records after cleanup = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
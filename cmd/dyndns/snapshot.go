@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/atomicfile"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/cloudflare"
+)
+
+// recordSnapshot is the state of the records dyndns manages after a
+// reconcile, written to SNAPSHOT_FILE for disaster recovery and GitOps.
+type recordSnapshot struct {
+	Domain      string              `json:"domain" yaml:"domain"`
+	GeneratedAt time.Time           `json:"generated_at" yaml:"generated_at"`
+	IPv4        string              `json:"ipv4,omitempty" yaml:"ipv4,omitempty"`
+	IPv6        string              `json:"ipv6,omitempty" yaml:"ipv6,omitempty"`
+	Subdomains  []snapshotSubdomain `json:"subdomains" yaml:"subdomains"`
+	Records     []snapshotRecord    `json:"records" yaml:"records"`
+	// Stale is set when dyndns deleted records after the snapshot was
+	// written (SHUTDOWN_CLEANUP, ON_DETECTION_FAILURE=remove), so the
+	// records no longer match it.
+	Stale bool `json:"stale,omitempty" yaml:"stale,omitempty"`
+
+	// failed marks a reconcile with update errors; its snapshot is not
+	// written so the file keeps the last fully applied state.
+	failed bool
+}
+
+// snapshotSubdomain is one active subdomain.
+type snapshotSubdomain struct {
+	Name   string `json:"name" yaml:"name"`
+	FQDN   string `json:"fqdn" yaml:"fqdn"`
+	Direct bool   `json:"direct" yaml:"direct"`
+}
+
+// snapshotRecord is one published DNS record.
+type snapshotRecord struct {
+	Name    string `json:"name" yaml:"name"`
+	Type    string `json:"type" yaml:"type"`
+	Content string `json:"content" yaml:"content"`
+	Proxied bool   `json:"proxied" yaml:"proxied"`
+}
+
+// addNameUpdate records the families of a grouped update that were
+// published, and marks the snapshot failed when any family failed.
+func (s *recordSnapshot) addNameUpdate(res *cloudflare.NameUpdateResult, updates []cloudflare.RecordUpdate) {
+	if len(res.Failed) > 0 {
+		s.failed = true
+	}
+	for _, u := range updates {
+		if _, failed := res.Failed[u.Type]; failed {
+			continue
+		}
+		s.Records = append(s.Records, snapshotRecord{
+			Name:    res.Name,
+			Type:    u.Type,
+			Content: u.Content,
+			Proxied: u.Proxied,
+		})
+	}
+}
+
+// write stores the snapshot atomically at path, as YAML for .yaml/.yml
+// and JSON otherwise.
+func (s *recordSnapshot) write(path string) error {
+	var data []byte
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		data, err = yaml.Marshal(s)
+	default:
+		data, err = json.MarshalIndent(s, "", "  ")
+		data = append(data, '\n')
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	if err := atomicfile.Write(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return nil
+}
+
+// readSnapshot loads a snapshot written by write, as YAML for .yaml/.yml
+// and JSON otherwise.
+func readSnapshot(path string) (*recordSnapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s recordSnapshot
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &s)
+	default:
+		err = json.Unmarshal(data, &s)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+	return &s, nil
+}
+
+// markSnapshotStale flags the snapshot at path as no longer matching the
+// records in Cloudflare, so SKIP_STARTUP_PUSH does not trust it. A missing
+// snapshot is left alone.
+func markSnapshotStale(path string) {
+	if path == "" {
+		return
+	}
+	s, err := readSnapshot(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Warn("Failed to read record snapshot to mark it stale", "path", path, "error", err)
+		}
+		return
+	}
+	if s.Stale {
+		return
+	}
+	s.Stale = true
+	if err := s.write(path); err != nil {
+		slog.Error("Failed to mark record snapshot stale", "path", path, "error", err)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/cloudflare"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/ipdetect"
+)
+
+// TestUpdateIPAndDNS_WritesSnapshot verifies SNAPSHOT_FILE receives the
+// records published by a reconcile, together with the active subdomains.
+func TestUpdateIPAndDNS_WritesSnapshot(t *testing.T) {
+	fake := newFakeCloudflare(t)
+	snapshotPath := filepath.Join(t.TempDir(), "snapshot.json")
+
+	cfg := &config.Config{
+		Domain:       "example.com",
+		ManualIPv4:   "203.0.113.10",
+		ManualIPv6:   "2001:db8::10",
+		SnapshotFile: snapshotPath,
+	}
+	cfClient := fake.client(t, cfg)
+	gen := caddy.New(cfg, nil)
+	gen.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "app", Port: 8080}})
+
+	(&Controller{cfg: cfg, detector: ipdetect.New(cfg), dns: cfClient, caddyGen: gen}).Reconcile(context.Background())
+
+	data, err := os.ReadFile(snapshotPath)
+	if err != nil {
+		t.Fatalf("snapshot not written: %v", err)
+	}
+	var got recordSnapshot
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("snapshot is not valid JSON: %v\n%s", err, data)
+	}
+
+	if got.Domain != "example.com" || got.IPv4 != "203.0.113.10" || got.IPv6 != "2001:db8::10" {
+		t.Errorf("domain/ipv4/ipv6 = %q/%q/%q", got.Domain, got.IPv4, got.IPv6)
+	}
+	if got.GeneratedAt.IsZero() {
+		t.Error("generated_at not set")
+	}
+	if len(got.Subdomains) != 1 || got.Subdomains[0] != (snapshotSubdomain{Name: "app", FQDN: "app.example.com"}) {
+		t.Errorf("subdomains = %+v, want [app app.example.com]", got.Subdomains)
+	}
+
+	want := fake.list()
+	if len(want) != 4 {
+		t.Fatalf("zone has %d records, want 4 (root and wildcard A+AAAA): %+v", len(want), want)
+	}
+	sortRecords(got.Records)
+	if fmt.Sprint(got.Records) != fmt.Sprint(want) {
+		t.Errorf("snapshot records = %+v\nwant (as created) %+v", got.Records, want)
+	}
+}
+
+// TestRecordSnapshot_WriteYAML verifies a .yaml path is written as YAML
+// and a failed reconcile is not recorded.
+func TestRecordSnapshot_WriteYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.yaml")
+	snap := &recordSnapshot{Domain: "example.com", IPv4: "203.0.113.10"}
+	snap.addNameUpdate(
+		&cloudflare.NameUpdateResult{Name: "example.com", Updated: []string{"A"}},
+		[]cloudflare.RecordUpdate{{Type: "A", Content: "203.0.113.10"}},
+	)
+	if err := snap.write(path); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	var got recordSnapshot
+	if err := yaml.Unmarshal(data, &got); err != nil {
+		t.Fatalf("snapshot is not valid YAML: %v\n%s", err, data)
+	}
+	if len(got.Records) != 1 || got.Records[0].Name != "example.com" || got.Records[0].Content != "203.0.113.10" {
+		t.Errorf("records = %+v", got.Records)
+	}
+
+	failed := &recordSnapshot{}
+	failed.addNameUpdate(
+		&cloudflare.NameUpdateResult{Name: "example.com", Updated: []string{"A"}, Failed: map[string]error{"AAAA": fmt.Errorf("boom")}},
+		[]cloudflare.RecordUpdate{{Type: "A", Content: "203.0.113.10"}, {Type: "AAAA", Content: "2001:db8::10"}},
+	)
+	if !failed.failed || len(failed.Records) != 1 {
+		t.Errorf("partial update: failed=%v records=%+v, want failed with only the A record", failed.failed, failed.Records)
+	}
+}
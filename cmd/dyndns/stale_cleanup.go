@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/cloudflare"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+)
+
+// activeFQDNSet returns the lowercased names the stale record cleanup keeps:
+// those of the active subdomains (including the catchall) and the
+// MANAGE_WWW alias, which is published separately.
+func activeFQDNSet(cfg *config.Config, activeSubdomains []string) map[string]bool {
+	active := make(map[string]bool)
+	for _, sub := range activeSubdomains {
+		active[strings.ToLower(cfg.GetSubdomainFQDN(sub))] = true
+	}
+	if cfg.ManageWWW {
+		active[strings.ToLower(wwwFQDN(cfg))] = true
+	}
+	return active
+}
+
+// deleteStaleRecords deletes records with at most concurrency requests in
+// flight, giving up on the ones not yet deleted once timeout elapses (zero
+// means no deadline); the next cycle lists them again. The deleted records
+// are returned, in no particular order, with the failed deletes joined.
+func deleteStaleRecords(ctx context.Context, cfClient dnsProvider, records []cloudflare.ManagedRecord, concurrency int, timeout time.Duration) ([]cloudflare.ManagedRecord, error) {
+	if len(records) == 0 {
+		return nil, nil
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var (
+		mu      sync.Mutex
+		deleted []cloudflare.ManagedRecord
+		errs    []error
+		wg      sync.WaitGroup
+	)
+	sem := make(chan struct{}, concurrency)
+	for _, r := range records {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			mu.Lock()
+			errs = append(errs, fmt.Errorf("failed to delete %s %s: %w", r.Type, r.Name, ctx.Err()))
+			mu.Unlock()
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			slog.Info("Removing stale DNS record", "fqdn", r.Name, "type", r.Type)
+			if err := cfClient.DeleteRecord(ctx, r.Name, r.Type); err != nil {
+				slog.Error("Failed to delete stale DNS record", "fqdn", r.Name, "type", r.Type, "error", err)
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("failed to delete %s %s: %w", r.Type, r.Name, err))
+				mu.Unlock()
+				return
+			}
+			mu.Lock()
+			deleted = append(deleted, r)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return deleted, errors.Join(errs...)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/ipdetect"
+)
+
+func staleRecords(n int) []snapshotRecord {
+	records := []snapshotRecord{{Name: "app.example.com", Type: "A", Content: "203.0.113.10", Proxied: true}}
+	for i := range n {
+		records = append(records, snapshotRecord{Name: fmt.Sprintf("old%d.example.com", i), Type: "A", Content: "198.51.100.1", Proxied: true})
+	}
+	return records
+}
+
+// TestUpdateIPAndDNS_StaleCleanupConcurrent verifies stale records are
+// deleted in parallel, never exceeding STALE_CLEANUP_CONCURRENCY. The
+// Cloudflare client paces requests (4/s), so each delete is held long
+// enough for the next ones to start.
+func TestUpdateIPAndDNS_StaleCleanupConcurrent(t *testing.T) {
+	fake := newFakeCloudflare(t, staleRecords(5)...)
+	fake.deleteDelay = 800 * time.Millisecond
+	cfg := &config.Config{
+		Domain:                  "example.com",
+		CloudflareProxy:         true,
+		ManualIPv4:              "203.0.113.10",
+		StaleCleanupConcurrency: 3,
+		StaleCleanupTimeout:     time.Minute,
+	}
+	cfClient := fake.client(t, cfg)
+	gen := caddy.New(cfg, nil)
+	gen.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "app", Port: 8080}})
+
+	(&Controller{cfg: cfg, detector: ipdetect.New(cfg), dns: cfClient, caddyGen: gen}).Reconcile(context.Background())
+
+	want := []snapshotRecord{{Name: "app.example.com", Type: "A", Content: "203.0.113.10", Proxied: true}}
+	if got := fake.list(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("records = %+v\nwant %+v", got, want)
+	}
+	if peak := fake.maxDeletes.Load(); peak < 2 || peak > 3 {
+		t.Errorf("peak concurrent deletes = %d, want 2..3", peak)
+	}
+}
+
+// TestUpdateIPAndDNS_StaleCleanupListFailure verifies a failed list call
+// skips the cleanup instead of deleting on incomplete data.
+func TestUpdateIPAndDNS_StaleCleanupListFailure(t *testing.T) {
+	initial := staleRecords(3)
+	fake := newFakeCloudflare(t, initial...)
+	fake.failList = true
+	cfg := &config.Config{
+		Domain:                  "example.com",
+		CloudflareProxy:         true,
+		ManualIPv4:              "203.0.113.10",
+		StaleCleanupConcurrency: 3,
+		StaleCleanupTimeout:     time.Minute,
+	}
+	cfClient := fake.client(t, cfg)
+	gen := caddy.New(cfg, nil)
+	gen.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "app", Port: 8080}})
+
+	snapshot := (&Controller{cfg: cfg, detector: ipdetect.New(cfg), dns: cfClient, caddyGen: gen}).Reconcile(context.Background())
+
+	sortRecords(initial)
+	if got := fake.list(); fmt.Sprint(got) != fmt.Sprint(initial) {
+		t.Errorf("records = %+v\nwant untouched %+v", got, initial)
+	}
+	if snapshot == nil || !snapshot.failed {
+		t.Error("snapshot should be marked failed when the cleanup list fails")
+	}
+}
+
+// TestUpdateIPAndDNS_PrefixModeLegacyNames verifies that in prefix mode
+// with a DOMAIN two labels below the zone, records published under the
+// names derived before the zone was used (app-a.b.example.com) are removed
+// as stale, while the zone-level names (app-a-b.example.com) are created
+// and unrelated records stay.
+func TestUpdateIPAndDNS_PrefixModeLegacyNames(t *testing.T) {
+	fake := newFakeCloudflare(t,
+		snapshotRecord{Name: "app-a.b.example.com", Type: "A", Content: "203.0.113.10", Proxied: true},
+		snapshotRecord{Name: "old-a.b.example.com", Type: "A", Content: "203.0.113.10", Proxied: true},
+		snapshotRecord{Name: "app-x.b.example.com", Type: "A", Content: "198.51.100.1", Proxied: true},
+		snapshotRecord{Name: "www.example.com", Type: "A", Content: "198.51.100.1", Proxied: true},
+	)
+	cfg := &config.Config{
+		Domain:                  "a.b.example.com",
+		SubdomainPrefix:         true,
+		CloudflareProxy:         true,
+		ManualIPv4:              "203.0.113.10",
+		StaleCleanupConcurrency: 3,
+		StaleCleanupTimeout:     time.Minute,
+	}
+	cfClient := fake.client(t, cfg)
+	if err := cfClient.CheckZone(context.Background()); err != nil {
+		t.Fatalf("CheckZone: %v", err)
+	}
+	cfg.ZoneName = cfClient.ZoneName()
+	gen := caddy.New(cfg, nil)
+	gen.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "app", Port: 8080}})
+
+	(&Controller{cfg: cfg, detector: ipdetect.New(cfg), dns: cfClient, caddyGen: gen}).Reconcile(context.Background())
+
+	want := []snapshotRecord{
+		{Name: "app-a-b.example.com", Type: "A", Content: "203.0.113.10", Proxied: true},
+		{Name: "app-x.b.example.com", Type: "A", Content: "198.51.100.1", Proxied: true},
+		{Name: "www.example.com", Type: "A", Content: "198.51.100.1", Proxied: true},
+	}
+	if got := fake.list(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("records = %+v\nwant %+v", got, want)
+	}
+}
+
+// TestDeleteStaleRecords_Timeout verifies the deadline stops the cleanup
+// and reports the deletes it gave up on.
+func TestDeleteStaleRecords_Timeout(t *testing.T) {
+	fake := newFakeCloudflare(t, staleRecords(4)...)
+	fake.deleteDelay = 200 * time.Millisecond
+	cfg := &config.Config{Domain: "example.com"}
+	cfClient := fake.client(t, cfg)
+
+	existing, err := cfClient.ListManagedRecords(context.Background())
+	if err != nil {
+		t.Fatalf("ListManagedRecords: %v", err)
+	}
+	_, err = deleteStaleRecords(context.Background(), cfClient, existing, 1, 50*time.Millisecond)
+	if err == nil {
+		t.Fatal("deleteStaleRecords() should report the deletes cut off by the deadline")
+	}
+}
+
+// TestUpdateIPAndDNS_EmptyActiveSetKeepsRecords verifies that with no
+// active subdomain the cleanup deletes nothing, unless
+// ALLOW_EMPTY_RECONCILE is set.
+func TestUpdateIPAndDNS_EmptyActiveSetKeepsRecords(t *testing.T) {
+	for _, allow := range []bool{false, true} {
+		for _, plan := range []bool{false, true} {
+			t.Run(fmt.Sprintf("allow=%t/plan=%t", allow, plan), func(t *testing.T) {
+				initial := staleRecords(2)
+				fake := newFakeCloudflare(t, initial...)
+				cfg := &config.Config{
+					Domain:              "example.com",
+					CloudflareProxy:     true,
+					ManualIPv4:          "203.0.113.10",
+					DNSPlan:             plan,
+					AllowEmptyReconcile: allow,
+				}
+				cfClient := fake.client(t, cfg)
+
+				(&Controller{cfg: cfg, detector: ipdetect.New(cfg), dns: cfClient, caddyGen: caddy.New(cfg, nil)}).Reconcile(context.Background())
+
+				got := fake.list()
+				if allow && len(got) != 0 {
+					t.Errorf("records = %+v, want all removed with ALLOW_EMPTY_RECONCILE", got)
+				}
+				if !allow {
+					sortRecords(initial)
+					if fmt.Sprint(got) != fmt.Sprint(initial) {
+						t.Errorf("records = %+v\nwant untouched %+v", got, initial)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"cmp"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+)
+
+// startupPush holds the SNAPSHOT_FILE written before the restart, so the
+// first reconcile can skip its writes when nothing changed since
+// (SKIP_STARTUP_PUSH). Nil-safe; nil always pushes.
+type startupPush struct {
+	mu        sync.Mutex
+	persisted *recordSnapshot
+}
+
+// newStartupPush reads the persisted snapshot when SKIP_STARTUP_PUSH is
+// set. A missing or unreadable snapshot pushes as usual.
+func newStartupPush(cfg *config.Config) *startupPush {
+	if !cfg.SkipStartupPush {
+		return nil
+	}
+	persisted, err := readSnapshot(cfg.SnapshotFile)
+	if err != nil {
+		slog.Info("No usable record snapshot, pushing DNS records on startup", "path", cfg.SnapshotFile, "error", err)
+		return nil
+	}
+	return &startupPush{persisted: persisted}
+}
+
+// unchanged reports whether the persisted snapshot holds exactly the
+// planned records for the domain and IPs. Only the first call compares;
+// later reconciles always push.
+func (s *startupPush) unchanged(domain, ipv4, ipv6 string, planned []snapshotRecord) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	persisted := s.persisted
+	s.persisted = nil
+	s.mu.Unlock()
+
+	if persisted == nil {
+		return false
+	}
+	if persisted.Stale {
+		slog.Info("Records were removed since the last snapshot, pushing DNS records on startup")
+		return false
+	}
+	if persisted.Domain != domain || persisted.IPv4 != ipv4 || persisted.IPv6 != ipv6 {
+		slog.Info("IP addresses changed since the last snapshot, pushing DNS records on startup",
+			"snapshot_ipv4", persisted.IPv4, "snapshot_ipv6", persisted.IPv6)
+		return false
+	}
+	if !sameRecords(persisted.Records, planned) {
+		slog.Info("Records changed since the last snapshot, pushing DNS records on startup")
+		return false
+	}
+	return true
+}
+
+// discard drops the persisted snapshot after dyndns deleted records, so
+// the next reconcile pushes.
+func (s *startupPush) discard() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.persisted = nil
+}
+
+// sameRecords compares two record sets regardless of order and name case.
+func sameRecords(a, b []snapshotRecord) bool {
+	normalize := func(records []snapshotRecord) []snapshotRecord {
+		out := make([]snapshotRecord, len(records))
+		for i, r := range records {
+			r.Name = strings.ToLower(strings.TrimSuffix(r.Name, "."))
+			out[i] = r
+		}
+		slices.SortFunc(out, func(x, y snapshotRecord) int {
+			return cmp.Or(cmp.Compare(x.Name, y.Name), cmp.Compare(x.Type, y.Type), cmp.Compare(x.Content, y.Content))
+		})
+		return out
+	}
+	return slices.Equal(normalize(a), normalize(b))
+}
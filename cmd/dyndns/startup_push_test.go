@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+)
+
+// TestController_SkipStartupPush verifies a restart whose SNAPSHOT_FILE
+// matches the planned records skips the first push, while a changed IP
+// or any later reconcile still pushes.
+func TestController_SkipStartupPush(t *testing.T) {
+	for _, ext := range []string{".json", ".yaml"} {
+		t.Run(ext, func(t *testing.T) {
+			cfg := &config.Config{
+				Domain:          "example.com",
+				CloudflareProxy: true,
+				SnapshotFile:    filepath.Join(t.TempDir(), "snapshot"+ext),
+				SkipStartupPush: true,
+			}
+			gen := caddy.New(cfg, nil)
+			gen.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "app", Port: 8080}})
+			detector := &staticDetector{ipv4: "203.0.113.10"}
+
+			// Before the restart: no snapshot yet, so the first reconcile
+			// pushes and writes one.
+			before := newMemoryDNS(true)
+			if snapshot := newController(cfg, detector, before, gen).Reconcile(context.Background()); snapshot == nil || snapshot.failed {
+				t.Fatalf("Reconcile() = %+v, want success", snapshot)
+			}
+			if len(before.list()) == 0 {
+				t.Fatal("first start without a snapshot wrote no records")
+			}
+
+			// Restart with the same IP: nothing is written.
+			dns := newMemoryDNS(true)
+			controller := newController(cfg, detector, dns, gen)
+			snapshot := controller.Reconcile(context.Background())
+			if snapshot == nil || snapshot.failed || len(snapshot.Records) != 1 {
+				t.Fatalf("Reconcile() = %+v, want a successful snapshot of the persisted records", snapshot)
+			}
+			if got := dns.list(); len(got) != 0 {
+				t.Errorf("restart with an unchanged snapshot wrote %+v, want no writes", got)
+			}
+
+			// Only the startup push is skipped.
+			controller.Reconcile(context.Background())
+			if got := dns.list(); len(got) != 1 {
+				t.Errorf("second reconcile wrote %+v, want the app record", got)
+			}
+
+			// Restart after the IP changed: the push goes out.
+			dns = newMemoryDNS(true)
+			newController(cfg, &staticDetector{ipv4: "203.0.113.20"}, dns, gen).Reconcile(context.Background())
+			want := []snapshotRecord{{Name: "app.example.com", Type: "A", Content: "203.0.113.20", Proxied: true}}
+			if got := dns.list(); len(got) != 1 || got[0] != want[0] {
+				t.Errorf("restart with a changed IP wrote %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+// TestController_SkipStartupPushAfterShutdownCleanup verifies a restart
+// after SHUTDOWN_CLEANUP removed the records pushes them again, although
+// the IP and services match the snapshot.
+func TestController_SkipStartupPushAfterShutdownCleanup(t *testing.T) {
+	cfg := &config.Config{
+		Domain:          "example.com",
+		CloudflareProxy: true,
+		SnapshotFile:    filepath.Join(t.TempDir(), "snapshot.json"),
+		SkipStartupPush: true,
+		ShutdownCleanup: config.ShutdownCleanupSubdomains,
+	}
+	gen := caddy.New(cfg, nil)
+	gen.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "app", Port: 8080}})
+	detector := &staticDetector{ipv4: "203.0.113.10"}
+
+	dns := newMemoryDNS(true)
+	if snapshot := newController(cfg, detector, dns, gen).Reconcile(context.Background()); snapshot == nil || snapshot.failed {
+		t.Fatalf("Reconcile() = %+v, want success", snapshot)
+	}
+	cleanupOnShutdown(context.Background(), cfg, dns, gen)
+	if got := dns.list(); len(got) != 0 {
+		t.Fatalf("records after shutdown cleanup = %+v, want none", got)
+	}
+
+	newController(cfg, detector, dns, gen).Reconcile(context.Background())
+	want := snapshotRecord{Name: "app.example.com", Type: "A", Content: "203.0.113.10", Proxied: true}
+	if got := dns.list(); len(got) != 1 || got[0] != want {
+		t.Errorf("restart after shutdown cleanup wrote %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+)
+
+// serveStatusSocket serves handler over plain HTTP on a unix socket at
+// path (STATUS_SOCKET) until ctx is cancelled. Access is governed by the
+// socket's file mode (0660); token-protected endpoints still require the
+// status token.
+func serveStatusSocket(ctx context.Context, path string, handler http.Handler) error {
+	// A socket left by a previous run makes Listen fail. Anything else at
+	// the path is not ours to remove.
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return fmt.Errorf("status socket path %s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove stale status socket: %w", err)
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("failed to listen on status socket: %w", err)
+	}
+	if err := os.Chmod(path, 0660); err != nil {
+		_ = ln.Close()
+		return fmt.Errorf("failed to set status socket permissions: %w", err)
+	}
+
+	server := &http.Server{Handler: handler}
+	go func() {
+		<-ctx.Done()
+		_ = server.Shutdown(context.Background())
+	}()
+
+	slog.Info("Starting status socket", "path", path)
+	if err := server.Serve(ln); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
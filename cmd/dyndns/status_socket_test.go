@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/ipdetect"
+)
+
+// TestServeStatusSocket verifies /status is served over STATUS_SOCKET.
+func TestServeStatusSocket(t *testing.T) {
+	cfg := &config.Config{Domain: "example.com", ManualIPv4: "203.0.113.10"}
+	cfClient := newFakeCloudflare(t).client(t, cfg)
+	detector := ipdetect.New(cfg)
+	if _, _, err := detector.Detect(context.Background()); err != nil {
+		t.Fatalf("Detect: %v", err)
+	}
+	mux := newStatusMux(cfg, detector, cfClient, caddy.New(cfg, nil), nil, caddy.NewAdminProbe("127.0.0.1:1"), newReadiness(cfg))
+
+	path := filepath.Join(t.TempDir(), "status.sock")
+	// A socket left by a previous run is replaced.
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("listen stale socket: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = stale.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- serveStatusSocket(ctx, path, mux) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("serveStatusSocket: %v", err)
+		}
+	}()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}}
+	var resp *http.Response
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err = client.Get("http://dyndns/status")
+		if err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("GET /status over socket: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var status struct {
+		IPv4   string `json:"ipv4"`
+		Domain string `json:"domain"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatalf("decode /status: %v", err)
+	}
+	if status.IPv4 != "203.0.113.10" || status.Domain != "example.com" {
+		t.Errorf("status = %+v, want ipv4 203.0.113.10 for example.com", status)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat socket: %v", err)
+	}
+	if mode := info.Mode().Perm(); mode != 0660 {
+		t.Errorf("socket mode = %o, want 660", mode)
+	}
+}
+
+// TestServeStatusSocket_RefusesNonSocket verifies a regular file at the
+// path is left alone.
+func TestServeStatusSocket_RefusesNonSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "status.sock")
+	if err := os.WriteFile(path, []byte("keep"), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if err := serveStatusSocket(context.Background(), path, http.NewServeMux()); err == nil {
+		t.Fatal("serveStatusSocket should refuse a path that is not a socket")
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "keep" {
+		t.Errorf("file = %q, %v; want it untouched", data, err)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// lastSubdomainLimit is the MAX_MANAGED_SUBDOMAINS violation refusing the
+// reconciles, reported in /status; nil while the cap holds.
+var lastSubdomainLimit atomic.Pointer[subdomainLimit]
+
+// subdomainLimit reports active subdomains over MAX_MANAGED_SUBDOMAINS.
+type subdomainLimit struct {
+	Active int `json:"active"`
+	Max    int `json:"max"`
+	// Since is when the cap was first exceeded.
+	Since time.Time `json:"since"`
+}
+
+// withinSubdomainLimit reports whether a proxy-mode reconcile may publish
+// the active subdomains under MAX_MANAGED_SUBDOMAINS. Over the cap it
+// logs a loud error and records the violation for /status; the reconcile
+// then writes nothing, so a runaway discovery source cannot mass-create
+// records. Direct mode publishes a wildcard and is never capped.
+func (c *Controller) withinSubdomainLimit() bool {
+	if c.cfg.MaxManagedSubdomains == 0 || !c.dns.IsProxied() {
+		return true
+	}
+	active := len(withCatchall(c.cfg, c.caddyGen.GetActiveSubdomains()))
+	if active <= c.cfg.MaxManagedSubdomains {
+		if lastSubdomainLimit.Swap(nil) != nil {
+			slog.Info("Active subdomains back within MAX_MANAGED_SUBDOMAINS, resuming DNS reconciles",
+				"active", active, "max", c.cfg.MaxManagedSubdomains)
+		}
+		return true
+	}
+
+	limit := &subdomainLimit{Active: active, Max: c.cfg.MaxManagedSubdomains, Since: time.Now().UTC()}
+	if prev := lastSubdomainLimit.Load(); prev != nil {
+		limit.Since = prev.Since
+	}
+	lastSubdomainLimit.Store(limit)
+	slog.Error("TOO MANY ACTIVE SUBDOMAINS: refusing to reconcile DNS records; check the discovery source or raise MAX_MANAGED_SUBDOMAINS",
+		"active", active, "max", c.cfg.MaxManagedSubdomains, "since", limit.Since)
+	return false
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/cloudflare"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+)
+
+// TestController_SubdomainLimit verifies a reconcile with more active
+// subdomains than MAX_MANAGED_SUBDOMAINS writes and deletes nothing and is
+// reported for /status, and that reconciles resume within the cap.
+func TestController_SubdomainLimit(t *testing.T) {
+	t.Cleanup(func() { lastSubdomainLimit.Store(nil) })
+
+	cfg := &config.Config{Domain: "example.com", CloudflareProxy: true, MaxManagedSubdomains: 2, AllowEmptyReconcile: true}
+	existing := cloudflare.ManagedRecord{Name: "old.example.com", Type: "A", Content: "198.51.100.1", Proxied: true}
+	dns := newMemoryDNS(true, existing)
+	gen := caddy.New(cfg, nil)
+	var services []discovery.Service
+	for i := range 3 {
+		services = append(services, discovery.Service{Subdomain: fmt.Sprintf("app%d", i), Port: 8080 + i})
+	}
+	gen.UpdateDiscoveredServices(services)
+	controller := newController(cfg, &staticDetector{ipv4: "203.0.113.10"}, dns, gen)
+
+	snapshot := controller.Reconcile(context.Background())
+	if snapshot == nil || !snapshot.failed {
+		t.Fatalf("Reconcile() over the cap = %+v, want a failed snapshot", snapshot)
+	}
+	want := []snapshotRecord{{Name: "old.example.com", Type: "A", Content: "198.51.100.1", Proxied: true}}
+	if got := dns.list(); !reflect.DeepEqual(got, want) {
+		t.Errorf("records over the cap = %+v, want untouched %+v", got, want)
+	}
+	limit := lastSubdomainLimit.Load()
+	if limit == nil || limit.Active != 3 || limit.Max != 2 {
+		t.Fatalf("subdomain limit status = %+v, want 3 active over a cap of 2", limit)
+	}
+
+	// Still over the cap: the first violation time is kept.
+	since := limit.Since
+	controller.Reconcile(context.Background())
+	if got := lastSubdomainLimit.Load(); got == nil || !got.Since.Equal(since) {
+		t.Errorf("subdomain limit status = %+v, want since %v", got, since)
+	}
+
+	gen.UpdateDiscoveredServices(services[:2])
+	snapshot = controller.Reconcile(context.Background())
+	if snapshot == nil || snapshot.failed {
+		t.Fatalf("Reconcile() within the cap = %+v, want success", snapshot)
+	}
+	if got := lastSubdomainLimit.Load(); got != nil {
+		t.Errorf("subdomain limit status within the cap = %+v, want nil", got)
+	}
+	want = []snapshotRecord{
+		{Name: "app0.example.com", Type: "A", Content: "203.0.113.10", Proxied: true},
+		{Name: "app1.example.com", Type: "A", Content: "203.0.113.10", Proxied: true},
+	}
+	if got := dns.list(); !reflect.DeepEqual(got, want) {
+		t.Errorf("records within the cap = %+v, want %+v", got, want)
+	}
+}
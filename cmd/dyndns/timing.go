@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+)
+
+// timingNow returns the current time for the debug timing; a variable so
+// tests can substitute a fake clock.
+var timingNow = time.Now
+
+// noopEnd ends a phase of a disabled timer.
+func noopEnd() {}
+
+// cycleTimer measures the phases of a cycle (IP detection, each batch of
+// Cloudflare operations, Caddyfile generation) and logs their durations as
+// structured attributes at debug. It is nil unless debug logging is
+// enabled, so a cycle then reads no clock and allocates nothing; every
+// method is nil-safe.
+type cycleTimer struct {
+	ctx   context.Context
+	start time.Time
+	// phases holds name/duration pairs, repeated in the total.
+	phases []any
+}
+
+// startCycleTimer starts timing a cycle, or returns nil when debug
+// logging is off.
+func startCycleTimer(ctx context.Context) *cycleTimer {
+	if !slog.Default().Enabled(ctx, slog.LevelDebug) {
+		return nil
+	}
+	return &cycleTimer{ctx: ctx, start: timingNow()}
+}
+
+// phase starts timing the named phase; calling the returned func ends it
+// and logs its duration.
+func (t *cycleTimer) phase(name string) func() {
+	if t == nil {
+		return noopEnd
+	}
+	start := timingNow()
+	return func() {
+		d := timingNow().Sub(start)
+		t.phases = append(t.phases, name, d)
+		slog.DebugContext(t.ctx, "Phase timing", "phase", name, "duration", d)
+	}
+}
+
+// done logs the total duration of the cycle together with its phases.
+func (t *cycleTimer) done(msg string) {
+	if t == nil {
+		return
+	}
+	slog.DebugContext(t.ctx, msg, append([]any{"duration", timingNow().Sub(t.start)}, t.phases...)...)
+}
+
+// generateTimed regenerates the Caddyfile, logging the duration at debug.
+func generateTimed(ctx context.Context, gen *caddy.Generator) error {
+	defer startCycleTimer(ctx).phase("generate")()
+	return gen.Generate()
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+)
+
+// fakeTimingClock replaces timingNow with a clock advancing 10ms per
+// read, and returns the number of reads.
+func fakeTimingClock(t *testing.T) *int {
+	t.Helper()
+	reads := 0
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	prev := timingNow
+	timingNow = func() time.Time {
+		reads++
+		now = now.Add(10 * time.Millisecond)
+		return now
+	}
+	t.Cleanup(func() { timingNow = prev })
+	return &reads
+}
+
+// captureLogs sends the default logger to a buffer at level.
+func captureLogs(t *testing.T, level slog.Level) *bytes.Buffer {
+	t.Helper()
+	var logs bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: level})))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &logs
+}
+
+// TestReconcile_Timing verifies a reconcile at debug logs the duration of
+// IP detection, each Cloudflare batch and the whole cycle, and Caddyfile
+// generation its own.
+func TestReconcile_Timing(t *testing.T) {
+	fakeTimingClock(t)
+	logs := captureLogs(t, slog.LevelDebug)
+
+	cfg := &config.Config{Domain: "example.com", CloudflareProxy: true, ManageWWW: true}
+	gen := caddy.New(cfg, nil)
+	gen.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "app", Port: 8080}})
+	controller := newController(cfg, &staticDetector{ipv4: "203.0.113.10"}, newMemoryDNS(true), gen)
+	controller.Reconcile(context.Background())
+
+	for _, want := range []string{
+		`msg="Phase timing" phase=detect duration=10ms`,
+		`msg="Phase timing" phase=cloudflare_subdomains duration=10ms`,
+		`msg="Phase timing" phase=cloudflare_www duration=10ms`,
+		`msg="Reconcile cycle timing" duration=70ms detect=10ms cloudflare_subdomains=10ms cloudflare_www=10ms`,
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("logs missing %s:\n%s", want, logs.String())
+		}
+	}
+
+	logs.Reset()
+	cfg.CaddyFile = filepath.Join(t.TempDir(), "Caddyfile")
+	gen.TemplateContent = "{{range .Mappings}}{{.FQDN}}\n{{end}}"
+	if err := generateTimed(context.Background(), gen); err != nil {
+		t.Fatalf("generateTimed: %v", err)
+	}
+	if want := `msg="Phase timing" phase=generate duration=10ms`; !strings.Contains(logs.String(), want) {
+		t.Errorf("logs missing %s:\n%s", want, logs.String())
+	}
+}
+
+// TestReconcile_TimingDisabled verifies the timing reads no clock and
+// logs nothing above debug.
+func TestReconcile_TimingDisabled(t *testing.T) {
+	reads := fakeTimingClock(t)
+	logs := captureLogs(t, slog.LevelInfo)
+
+	cfg := &config.Config{Domain: "example.com"}
+	controller := newController(cfg, &staticDetector{ipv4: "203.0.113.10"}, newMemoryDNS(false), caddy.New(cfg, nil))
+	controller.Reconcile(context.Background())
+
+	if *reads != 0 {
+		t.Errorf("clock read %d times, want none", *reads)
+	}
+	if strings.Contains(logs.String(), "timing") {
+		t.Errorf("timing logged above debug:\n%s", logs.String())
+	}
+}
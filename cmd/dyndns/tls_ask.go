@@ -0,0 +1,28 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+)
+
+// tlsAskHandler answers Caddy's on_demand_tls ask check: 200 when the
+// ?domain= host is an active subdomain, 404 otherwise, so certificates are
+// only issued for hosts dyndns actually serves.
+func tlsAskHandler(gen *caddy.Generator) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		domain := r.URL.Query().Get("domain")
+		if domain == "" {
+			http.Error(w, "missing domain", http.StatusBadRequest)
+			return
+		}
+		if !gen.IsActiveHost(domain) {
+			slog.Info("Refusing on-demand certificate for inactive host", "domain", domain)
+			http.Error(w, "unknown host", http.StatusNotFound)
+			return
+		}
+		slog.Debug("Approved on-demand certificate", "domain", domain)
+		w.WriteHeader(http.StatusOK)
+	})
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+)
+
+// TestTLSAskHandler verifies the on-demand TLS ask endpoint approves only
+// the FQDNs of active subdomains.
+func TestTLSAskHandler(t *testing.T) {
+	gen := caddy.New(&config.Config{Domain: "example.com"}, nil)
+	gen.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "app", Port: 8080}})
+
+	mux := http.NewServeMux()
+	mux.Handle(caddy.OnDemandAskPath, tlsAskHandler(gen))
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"?domain=app.example.com", http.StatusOK},
+		{"?domain=APP.example.com.", http.StatusOK},
+		{"?domain=gone.example.com", http.StatusNotFound},
+		{"?domain=app.example.org", http.StatusNotFound},
+		{"", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, caddy.OnDemandAskPath+tt.query, nil))
+		if rec.Code != tt.want {
+			t.Errorf("GET %s%s = %d, want %d", caddy.OnDemandAskPath, tt.query, rec.Code, tt.want)
+		}
+	}
+
+	// A service that goes away stops being approved.
+	gen.UpdateDiscoveredServices(nil)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, caddy.OnDemandAskPath+"?domain=app.example.com", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("after removal: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// buildInfo is the build metadata reported by /version.
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+}
+
+func currentBuildInfo() buildInfo {
+	return buildInfo{Version: Version, Commit: GitCommit, BuildDate: BuildDate}
+}
+
+// userAgent identifies dyndns on outbound HTTP requests.
+func userAgent() string {
+	return "stevedore-dyndns/" + Version + " (" + GitCommit + ")"
+}
+
+// versionHandler serves the build metadata injected via -ldflags as JSON.
+func versionHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(currentBuildInfo())
+	})
+}
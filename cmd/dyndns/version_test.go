@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestVersionHandler verifies /version reports the build metadata,
+// defaulting to "dev" when nothing was injected.
+func TestVersionHandler(t *testing.T) {
+	get := func() buildInfo {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		versionHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", rec.Code)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", ct)
+		}
+		var info buildInfo
+		if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil {
+			t.Fatalf("invalid JSON %q: %v", rec.Body.String(), err)
+		}
+		return info
+	}
+
+	if info := get(); info.Version != "dev" {
+		t.Errorf("default version = %q, want %q", info.Version, "dev")
+	}
+
+	oldVersion, oldCommit, oldDate := Version, GitCommit, BuildDate
+	t.Cleanup(func() { Version, GitCommit, BuildDate = oldVersion, oldCommit, oldDate })
+	Version, GitCommit, BuildDate = "1.4.2", "abc1234", "2026-01-02T03:04:05Z"
+
+	want := buildInfo{Version: "1.4.2", Commit: "abc1234", BuildDate: "2026-01-02T03:04:05Z"}
+	if info := get(); info != want {
+		t.Errorf("version info = %+v, want %+v", info, want)
+	}
+	if ua := userAgent(); ua != "stevedore-dyndns/1.4.2 (abc1234)" {
+		t.Errorf("userAgent() = %q", ua)
+	}
+}
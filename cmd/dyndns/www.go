@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/cloudflare"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+)
+
+// wwwFQDN is the name MANAGE_WWW aliases to the apex.
+func wwwFQDN(cfg *config.Config) string {
+	return "www." + cfg.Domain
+}
+
+// wwwOwner returns the active subdomain (or the catchall) whose records
+// already live at the www name, or the empty string when it is free.
+func wwwOwner(cfg *config.Config, caddyGen *caddy.Generator) string {
+	name := strings.ToLower(wwwFQDN(cfg))
+	subs := caddyGen.GetActiveSubdomains()
+	if cfg.CatchallSubdomain != "" {
+		subs = append(subs, cfg.CatchallSubdomain)
+	}
+	for _, sub := range subs {
+		if strings.ToLower(cfg.GetSubdomainFQDN(sub)) == name {
+			return sub
+		}
+	}
+	return ""
+}
+
+// updateWWWRecord publishes www.DOMAIN as a CNAME to the apex, proxied
+// like the apex. A CNAME cannot share its name with other records, so it
+// is skipped while a subdomain owns the www name.
+func updateWWWRecord(ctx context.Context, cfg *config.Config, cfClient dnsProvider, caddyGen *caddy.Generator, snapshot *recordSnapshot) {
+	name := wwwFQDN(cfg)
+	if owner := wwwOwner(cfg, caddyGen); owner != "" {
+		slog.Warn("MANAGE_WWW: www is an active subdomain, not publishing the apex alias", "fqdn", name, "subdomain", owner)
+		return
+	}
+	updates := wwwUpdates(cfg, cfClient)
+	res := cfClient.UpdateNameRecords(ctx, name, updates)
+	logNameUpdate(res, "target", cfg.Domain)
+	snapshot.addNameUpdate(res, updates)
+}
+
+// wwwUpdates is the CNAME of www.DOMAIN to the apex, proxied like the apex.
+func wwwUpdates(cfg *config.Config, cfClient dnsProvider) []cloudflare.RecordUpdate {
+	proxied := cfg.ApexProxied || cfClient.IsProxied()
+	return withTTL([]cloudflare.RecordUpdate{{Type: "CNAME", Content: cfg.Domain, Proxied: proxied}}, cfg.ApexTTL)
+}
+
+// removeWWWRecord deletes the www alias an earlier run with MANAGE_WWW
+// published, as recorded in SNAPSHOT_FILE. Only a CNAME to the apex is
+// removed; without the snapshot record the alias may be the operator's
+// own and is left alone.
+func removeWWWRecord(ctx context.Context, cfg *config.Config, cfClient *cloudflare.Client) {
+	if !publishedWWW(cfg) {
+		return
+	}
+	removed, err := cfClient.RemoveAlias(ctx, wwwFQDN(cfg), cfg.Domain)
+	if err != nil {
+		slog.Warn("Failed to remove the www alias of the apex", "fqdn", wwwFQDN(cfg), "error", err)
+		return
+	}
+	if removed {
+		slog.Info("Removed the www alias of the apex, MANAGE_WWW is off", "fqdn", wwwFQDN(cfg))
+	}
+}
+
+// publishedWWW reports whether the SNAPSHOT_FILE lists the www alias of
+// the apex, i.e. dyndns published it.
+func publishedWWW(cfg *config.Config) bool {
+	if cfg.SnapshotFile == "" {
+		return false
+	}
+	snapshot, err := readSnapshot(cfg.SnapshotFile)
+	if err != nil {
+		return false
+	}
+	name := strings.ToLower(wwwFQDN(cfg))
+	apex := strings.ToLower(strings.TrimSuffix(cfg.Domain, "."))
+	for _, r := range snapshot.Records {
+		if r.Type == "CNAME" && strings.ToLower(strings.TrimSuffix(r.Name, ".")) == name &&
+			strings.ToLower(strings.TrimSuffix(r.Content, ".")) == apex {
+			return true
+		}
+	}
+	return false
+}
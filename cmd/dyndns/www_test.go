@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/caddy"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/ipdetect"
+)
+
+// TestUpdateIPAndDNS_ManageWWW verifies MANAGE_WWW publishes a www CNAME
+// to the apex, proxied like the apex.
+func TestUpdateIPAndDNS_ManageWWW(t *testing.T) {
+	for _, apexProxied := range []bool{false, true} {
+		t.Run(fmt.Sprintf("apex_proxied=%v", apexProxied), func(t *testing.T) {
+			fake := newFakeCloudflare(t)
+			cfg := &config.Config{
+				Domain:      "example.com",
+				ManualIPv4:  "203.0.113.10",
+				ApexProxied: apexProxied,
+				ManageWWW:   true,
+			}
+			cfClient := fake.client(t, cfg)
+
+			(&Controller{cfg: cfg, detector: ipdetect.New(cfg), dns: cfClient, caddyGen: caddy.New(cfg, nil)}).Reconcile(context.Background())
+
+			want := []snapshotRecord{
+				{Name: "*.example.com", Type: "A", Content: "203.0.113.10"},
+				{Name: "example.com", Type: "A", Content: "203.0.113.10", Proxied: apexProxied},
+				{Name: "www.example.com", Type: "CNAME", Content: "example.com", Proxied: apexProxied},
+			}
+			if got := fake.list(); fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("records = %+v\nwant %+v", got, want)
+			}
+		})
+	}
+}
+
+// TestUpdateIPAndDNS_ManageWWWSurvivesCleanup verifies the proxy-mode
+// stale-record cleanup keeps the alias when CNAMEs are managed types.
+func TestUpdateIPAndDNS_ManageWWWSurvivesCleanup(t *testing.T) {
+	for _, plan := range []bool{false, true} {
+		t.Run(fmt.Sprintf("dns_plan=%v", plan), func(t *testing.T) {
+			fake := newFakeCloudflare(t)
+			cfg := &config.Config{
+				Domain:             "example.com",
+				CloudflareProxy:    true,
+				ManualIPv4:         "203.0.113.10",
+				ManageWWW:          true,
+				ManagedRecordTypes: []string{"A", "AAAA", "CNAME"},
+				DNSPlan:            plan,
+			}
+			cfClient := fake.client(t, cfg)
+			gen := caddy.New(cfg, nil)
+			gen.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "app", Container: "app", Port: 8080}})
+
+			for range 2 {
+				(&Controller{cfg: cfg, detector: ipdetect.New(cfg), dns: cfClient, caddyGen: gen}).Reconcile(context.Background())
+			}
+
+			want := []snapshotRecord{
+				{Name: "app.example.com", Type: "A", Content: "203.0.113.10", Proxied: true},
+				{Name: "www.example.com", Type: "CNAME", Content: "example.com", Proxied: true},
+			}
+			if got := fake.list(); fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("records = %+v\nwant %+v", got, want)
+			}
+		})
+	}
+}
+
+// TestUpdateIPAndDNS_ManageWWWYieldsToSubdomain verifies no alias is
+// published while a subdomain (here the catchall) owns the www name.
+func TestUpdateIPAndDNS_ManageWWWYieldsToSubdomain(t *testing.T) {
+	fake := newFakeCloudflare(t)
+	cfg := &config.Config{
+		Domain:            "example.com",
+		CloudflareProxy:   true,
+		ManualIPv4:        "203.0.113.10",
+		ManageWWW:         true,
+		CatchallSubdomain: "www",
+	}
+	cfClient := fake.client(t, cfg)
+
+	(&Controller{cfg: cfg, detector: ipdetect.New(cfg), dns: cfClient, caddyGen: caddy.New(cfg, nil)}).Reconcile(context.Background())
+
+	want := []snapshotRecord{
+		{Name: "www.example.com", Type: "A", Content: "203.0.113.10"},
+	}
+	if got := fake.list(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("records = %+v\nwant %+v", got, want)
+	}
+}
+
+// TestRemoveWWWRecord verifies that with MANAGE_WWW off the www alias of
+// the apex is removed when the snapshot shows dyndns published it, while
+// a hand-made alias and a www CNAME elsewhere are left alone.
+func TestRemoveWWWRecord(t *testing.T) {
+	alias := snapshotRecord{Name: "www.example.com", Type: "CNAME", Content: "example.com"}
+	tests := []struct {
+		name      string
+		initial   snapshotRecord
+		published bool
+		want      int
+	}{
+		{name: "published alias of the apex", initial: alias, published: true, want: 0},
+		{name: "hand-made alias of the apex", initial: alias, want: 1},
+		{name: "foreign target", initial: snapshotRecord{Name: "www.example.com", Type: "CNAME", Content: "shop.example.net"}, published: true, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeCloudflare(t, tt.initial)
+			cfg := &config.Config{Domain: "example.com", SnapshotFile: filepath.Join(t.TempDir(), "snapshot.json")}
+			if tt.published {
+				snapshot := &recordSnapshot{Domain: "example.com", Records: []snapshotRecord{alias}}
+				if err := snapshot.write(cfg.SnapshotFile); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cfClient := fake.client(t, cfg)
+
+			removeWWWRecord(context.Background(), cfg, cfClient)
+
+			if got := fake.list(); len(got) != tt.want {
+				t.Errorf("records = %+v, want %d left", got, tt.want)
+			}
+		})
+	}
+}
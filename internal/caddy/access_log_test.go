@@ -0,0 +1,77 @@
+package caddy
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+)
+
+// TestGenerate_AccessLogSampling verifies ACCESS_LOG_SAMPLE renders a
+// sampling block in every access log and ACCESS_LOG_SKIP_PATHS a log_skip
+// matcher, both inline and in the shared log snippet.
+func TestGenerate_AccessLogSampling(t *testing.T) {
+	for _, shared := range []bool{false, true} {
+		t.Run(fmt.Sprintf("shared_snippets=%t", shared), func(t *testing.T) {
+			cfg := &config.Config{
+				Domain:              "example.com",
+				AcmeEmail:           "admin@example.com",
+				LogLevel:            "info",
+				CloudflareProxy:     true,
+				CatchallSubdomain:   "zone451",
+				CaddySharedSnippets: shared,
+				AccessLogSample:     10,
+				AccessLogSkipPaths:  []string{"/health", "/status/*"},
+			}
+			g := newGeneratorWithDefaults(t, cfg)
+			g.UpdateDiscoveredServices([]discovery.Service{
+				{Subdomain: "app", Port: 8080},
+				{Subdomain: "direct", Port: 9090, Direct: true},
+			})
+
+			content, err := g.GenerateContent()
+			if err != nil {
+				t.Fatalf("GenerateContent: %v", err)
+			}
+
+			blocks := []string{"direct.example.com {", "zone451.example.com {", "*.example.com, example.com {"}
+			if shared {
+				blocks = []string{"(dyndns_access_log) {"}
+			}
+			for _, marker := range blocks {
+				block := blockAfter(t, content, marker)
+				log := blockAfter(t, block, "log {")
+				if !strings.Contains(log, "sampling {\n            first 1\n            thereafter 10\n        }") {
+					t.Errorf("%s access log missing sampling:\n%s", marker, log)
+				}
+				for _, want := range []string{
+					"\n    @dyndns_log_skip path /health /status/*\n",
+					"\n    log_skip @dyndns_log_skip\n",
+				} {
+					if !strings.Contains(block, want) {
+						t.Errorf("%s missing %q:\n%s", marker, strings.TrimSpace(want), block)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestGenerate_AccessLogSamplingDefault verifies every request is logged
+// without the ACCESS_LOG_* settings.
+func TestGenerate_AccessLogSamplingDefault(t *testing.T) {
+	g := newGeneratorWithDefaults(t, &config.Config{Domain: "example.com", CloudflareProxy: true})
+	g.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "app", Port: 8080}})
+
+	content, err := g.GenerateContent()
+	if err != nil {
+		t.Fatalf("GenerateContent: %v", err)
+	}
+	for _, directive := range []string{"sampling", "log_skip"} {
+		if strings.Contains(content, directive) {
+			t.Errorf("no %s expected without ACCESS_LOG_* settings", directive)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package caddy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+)
+
+// TestGenerate_AcmeChallengeHandlerPrecedesProxies verifies that with
+// ACME_CHALLENGE_WEBROOT the well-known handler is rendered in the wildcard
+// and direct-mode sites, ahead of their reverse proxies.
+func TestGenerate_AcmeChallengeHandlerPrecedesProxies(t *testing.T) {
+	cfg := &config.Config{
+		Domain:               "example.com",
+		AcmeEmail:            "admin@example.com",
+		LogLevel:             "info",
+		CloudflareProxy:      true,
+		CloudflareSSLMode:    "flexible",
+		AcmeChallengeWebroot: "/var/www/acme",
+	}
+	g := newGeneratorWithDefaults(t, cfg)
+	g.UpdateDiscoveredServices([]discovery.Service{
+		{Subdomain: "app", Port: 8080},
+		{Subdomain: "direct", Port: 7070, Direct: true},
+	})
+
+	content, err := g.GenerateContent()
+	if err != nil {
+		t.Fatalf("GenerateContent: %v", err)
+	}
+
+	const handler = "handle /.well-known/acme-challenge/* {"
+	if n := strings.Count(content, handler); n != 2 {
+		t.Fatalf("well-known handler rendered %d times, want 2:\n%s", n, content)
+	}
+	if !strings.Contains(content, "root * /var/www/acme") {
+		t.Errorf("webroot not rendered:\n%s", content)
+	}
+
+	for _, site := range []string{"direct.example.com {", "http://*.example.com, http://example.com {"} {
+		block := blockAfter(t, content, site)
+		h := strings.Index(block, handler)
+		p := strings.Index(block, "reverse_proxy")
+		if h < 0 || p < 0 || h > p {
+			t.Errorf("site %q: well-known handler (at %d) must precede reverse_proxy (at %d):\n%s", site, h, p, block)
+		}
+	}
+}
+
+// TestGenerate_AcmeChallengeHandlerDisabled guards the default output.
+func TestGenerate_AcmeChallengeHandlerDisabled(t *testing.T) {
+	cfg := &config.Config{
+		Domain:    "example.com",
+		AcmeEmail: "admin@example.com",
+		LogLevel:  "info",
+	}
+	g := newGeneratorWithDefaults(t, cfg)
+	g.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "app", Port: 8080}})
+
+	content, err := g.GenerateContent()
+	if err != nil {
+		t.Fatalf("GenerateContent: %v", err)
+	}
+	if strings.Contains(content, "acme-challenge") {
+		t.Errorf("well-known handler rendered without ACME_CHALLENGE_WEBROOT:\n%s", content)
+	}
+}
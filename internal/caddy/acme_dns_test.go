@@ -0,0 +1,66 @@
+package caddy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+)
+
+// TestGenerate_CustomDNSChallenge verifies ACME_DNS_PROVIDER, its args and
+// ACME_DNS_RESOLVERS render into every tls block that uses the DNS-01
+// challenge, replacing the Cloudflare default.
+func TestGenerate_CustomDNSChallenge(t *testing.T) {
+	cfg := &config.Config{
+		Domain:              "example.com",
+		AcmeEmail:           "admin@example.com",
+		LogLevel:            "info",
+		CloudflareProxy:     true,
+		CatchallSubdomain:   "zone451",
+		AcmeDNSProvider:     "duckdns",
+		AcmeDNSProviderArgs: "{env.DUCKDNS_TOKEN}",
+		AcmeDNSResolvers:    []string{"1.1.1.1", "8.8.8.8:53"},
+	}
+	g := newGeneratorWithDefaults(t, cfg)
+	g.UpdateDiscoveredServices([]discovery.Service{
+		{Subdomain: "app", Port: 8080},
+		{Subdomain: "direct", Port: 9090, Direct: true},
+	})
+
+	content, err := g.GenerateContent()
+	if err != nil {
+		t.Fatalf("GenerateContent: %v", err)
+	}
+	if strings.Contains(content, "dns cloudflare") {
+		t.Error("custom provider should replace the cloudflare DNS challenge")
+	}
+
+	for _, marker := range []string{"direct.example.com {", "zone451.example.com {", "*.example.com, example.com {"} {
+		tls := blockAfter(t, blockAfter(t, content, marker), "tls {")
+		if !strings.Contains(tls, "dns duckdns {env.DUCKDNS_TOKEN}") {
+			t.Errorf("%s tls block missing the custom provider:\n%s", marker, tls)
+		}
+		if !strings.Contains(tls, "resolvers 1.1.1.1 8.8.8.8:53") {
+			t.Errorf("%s tls block missing the resolvers:\n%s", marker, tls)
+		}
+	}
+}
+
+// TestGenerate_DefaultDNSChallenge verifies the Cloudflare challenge and no
+// resolvers line are rendered without ACME_DNS_* settings.
+func TestGenerate_DefaultDNSChallenge(t *testing.T) {
+	g := newGeneratorWithDefaults(t, &config.Config{Domain: "example.com", CloudflareProxy: true})
+	g.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "app", Port: 8080}})
+
+	content, err := g.GenerateContent()
+	if err != nil {
+		t.Fatalf("GenerateContent: %v", err)
+	}
+	if !strings.Contains(content, "dns cloudflare {env.CLOUDFLARE_API_TOKEN}\n") {
+		t.Error("default DNS challenge should use cloudflare with the API token")
+	}
+	if strings.Contains(content, "resolvers") {
+		t.Error("no resolvers line expected without ACME_DNS_RESOLVERS")
+	}
+}
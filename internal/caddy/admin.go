@@ -0,0 +1,108 @@
+package caddy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AdminStatus is the result of the most recent Caddy admin API probe.
+type AdminStatus struct {
+	Address   string    `json:"address"`
+	Reachable bool      `json:"reachable"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// AdminProbe checks that Caddy's admin API answers, so reload problems are
+// visible at startup rather than hours later.
+type AdminProbe struct {
+	addr       string
+	baseURL    string
+	httpClient *http.Client
+
+	mu     sync.RWMutex
+	status AdminStatus
+}
+
+// NewAdminProbe creates a probe for the admin endpoint at addr. A bare
+// "host:port" is treated as http://host:port.
+func NewAdminProbe(addr string) *AdminProbe {
+	base := strings.TrimSuffix(addr, "/")
+	if !strings.Contains(base, "://") {
+		base = "http://" + base
+	}
+	return &AdminProbe{
+		addr:       addr,
+		baseURL:    base,
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+		status:     AdminStatus{Address: addr},
+	}
+}
+
+// Probe performs a single GET /config/ against the admin API and records
+// the outcome.
+func (p *AdminProbe) Probe(ctx context.Context) AdminStatus {
+	err := p.check(ctx)
+	status := AdminStatus{
+		Address:   p.addr,
+		Reachable: err == nil,
+		CheckedAt: time.Now(),
+	}
+	if err != nil {
+		status.Error = err.Error()
+	}
+
+	p.mu.Lock()
+	p.status = status
+	p.mu.Unlock()
+	return status
+}
+
+// WaitReachable probes up to attempts times, pausing interval between
+// tries, and returns as soon as the admin API answers. Caddy is started
+// after dyndns writes the first Caddyfile, so early failures are expected.
+func (p *AdminProbe) WaitReachable(ctx context.Context, attempts int, interval time.Duration) AdminStatus {
+	var status AdminStatus
+	for i := 0; i < attempts; i++ {
+		status = p.Probe(ctx)
+		if status.Reachable || i == attempts-1 {
+			return status
+		}
+		select {
+		case <-ctx.Done():
+			return status
+		case <-time.After(interval):
+		}
+	}
+	return status
+}
+
+// Status returns the last recorded probe result.
+func (p *AdminProbe) Status() AdminStatus {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.status
+}
+
+func (p *AdminProbe) check(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"/config/", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach Caddy admin API: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from Caddy admin API", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package caddy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestAdminProbe_ReportsReachability verifies the probe reports a fake admin
+// server as reachable, and a closed one as unreachable.
+func TestAdminProbe_ReportsReachability(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/config/" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("{}"))
+	}))
+
+	addr := strings.TrimPrefix(srv.URL, "http://")
+	probe := NewAdminProbe(addr)
+
+	status := probe.Probe(context.Background())
+	if !status.Reachable {
+		t.Fatalf("Probe() reachable = false, error = %q", status.Error)
+	}
+	if status.Address != addr {
+		t.Errorf("Address = %q, want %q", status.Address, addr)
+	}
+	if got := probe.Status(); !got.Reachable || got.CheckedAt.IsZero() {
+		t.Errorf("Status() = %+v, want recorded reachable result", got)
+	}
+
+	srv.Close()
+	status = probe.Probe(context.Background())
+	if status.Reachable {
+		t.Fatal("Probe() against closed server reported reachable")
+	}
+	if status.Error == "" {
+		t.Error("Probe() failure should record an error")
+	}
+}
+
+// TestAdminProbe_WaitReachable verifies the startup wait retries until the
+// admin API comes up (Caddy starts after the first Caddyfile is written).
+func TestAdminProbe_WaitReachable(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+
+	probe := NewAdminProbe(srv.URL)
+	status := probe.WaitReachable(context.Background(), 5, time.Millisecond)
+	if !status.Reachable {
+		t.Fatalf("WaitReachable() reachable = false, error = %q", status.Error)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("admin calls = %d, want 3", got)
+	}
+
+	notFound := httptest.NewServer(http.NotFoundHandler())
+	defer notFound.Close()
+
+	status = NewAdminProbe(notFound.URL).WaitReachable(context.Background(), 2, time.Millisecond)
+	if status.Reachable {
+		t.Error("WaitReachable() against 404 endpoint reported reachable")
+	}
+}
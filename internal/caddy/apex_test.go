@@ -0,0 +1,132 @@
+package caddy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/mapping"
+)
+
+// newApexGenerator returns a generator whose YAML mappings route the apex
+// (subdomain "@") and "app".
+func newApexGenerator(t *testing.T, cfg *config.Config) *Generator {
+	t.Helper()
+	mappingsPath := filepath.Join(t.TempDir(), "mappings.yaml")
+	content := `
+mappings:
+  - subdomain: "@"
+    target: "homepage:8080"
+  - subdomain: app
+    target: "app:8080"
+`
+	if err := os.WriteFile(mappingsPath, []byte(content), 0644); err != nil {
+		t.Fatalf("write mappings: %v", err)
+	}
+	mgr := mapping.New(mappingsPath)
+	if err := mgr.Load(); err != nil {
+		t.Fatalf("load mappings: %v", err)
+	}
+	g := newGeneratorWithDefaults(t, cfg)
+	g.mappingMgr = mgr
+	return g
+}
+
+// TestGenerate_ApexMapping verifies an "@" mapping is routed on the bare
+// domain inside the combined site and listed as an active subdomain.
+func TestGenerate_ApexMapping(t *testing.T) {
+	g := newApexGenerator(t, &config.Config{
+		Domain:          "example.com",
+		AcmeEmail:       "admin@example.com",
+		LogLevel:        "info",
+		CloudflareProxy: true,
+	})
+
+	content, err := g.GenerateContent()
+	if err != nil {
+		t.Fatalf("GenerateContent: %v", err)
+	}
+	if err := validateContent(content); err != nil {
+		t.Fatalf("generated Caddyfile is invalid: %v\n%s", err, content)
+	}
+
+	site := blockAfter(t, content, "\n*.example.com, example.com {")
+	for _, want := range []string{
+		"@" + apexMatcher + " host example.com\n",
+		"handle @" + apexMatcher + " {",
+		"reverse_proxy homepage:8080",
+		"@app host app.example.com",
+	} {
+		if !strings.Contains(site, want) {
+			t.Errorf("combined site missing %q:\n%s", want, site)
+		}
+	}
+	if strings.Contains(content, "@@") {
+		t.Errorf("apex rendered an invalid matcher name:\n%s", content)
+	}
+
+	if !g.IsActiveHost("example.com") {
+		t.Error("apex host not reported active")
+	}
+}
+
+// TestGenerate_ApexMappingPerSite verifies CADDY_PER_SITE renders the apex
+// mapping as the only bare-domain site, replacing the placeholder site.
+func TestGenerate_ApexMappingPerSite(t *testing.T) {
+	g := newApexGenerator(t, &config.Config{
+		Domain:          "example.com",
+		AcmeEmail:       "admin@example.com",
+		LogLevel:        "info",
+		CloudflareProxy: true,
+		CaddyPerSite:    true,
+	})
+
+	content, err := g.GenerateContent()
+	if err != nil {
+		t.Fatalf("GenerateContent: %v", err)
+	}
+
+	if n := strings.Count(content, "\nexample.com {"); n != 1 {
+		t.Fatalf("bare domain site rendered %d times, want 1:\n%s", n, content)
+	}
+	site := blockAfter(t, content, "\nexample.com {")
+	if !strings.Contains(site, "reverse_proxy homepage:8080") {
+		t.Errorf("bare domain site does not proxy to the apex target:\n%s", site)
+	}
+	if !strings.Contains(site, "@"+apexMatcher+" host example.com\n") {
+		t.Errorf("bare domain site does not route the apex host:\n%s", site)
+	}
+}
+
+// TestGenerate_DirectApexService verifies a direct-mode discovered service
+// on "@" gets its own bare-domain site, which the combined site then omits.
+func TestGenerate_DirectApexService(t *testing.T) {
+	g := newGeneratorWithDefaults(t, &config.Config{
+		Domain:          "example.com",
+		AcmeEmail:       "admin@example.com",
+		LogLevel:        "info",
+		CloudflareProxy: true,
+	})
+	g.UpdateDiscoveredServices([]discovery.Service{
+		{Subdomain: "@", Port: 8080, Direct: true, Container: "homepage"},
+	})
+
+	content, err := g.GenerateContent()
+	if err != nil {
+		t.Fatalf("GenerateContent: %v", err)
+	}
+
+	if !strings.Contains(content, "\n*.example.com {") {
+		t.Errorf("combined site should leave the bare domain to the direct site:\n%s", content)
+	}
+	site := blockAfter(t, content, "\nexample.com {")
+	if strings.Contains(site, "client_auth") {
+		t.Errorf("direct apex site requires origin mTLS:\n%s", site)
+	}
+	if !strings.Contains(site, "reverse_proxy") {
+		t.Errorf("direct apex site does not proxy:\n%s", site)
+	}
+}
@@ -0,0 +1,92 @@
+package caddy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/mapping"
+)
+
+// TestGenerate_CanaryMapping verifies a canary_of mapping inherits the
+// referenced mapping's options, keeps its own target, and gets its own
+// route and DNS name; a canary of an unknown subdomain is dropped.
+func TestGenerate_CanaryMapping(t *testing.T) {
+	mappingsPath := filepath.Join(t.TempDir(), "mappings.yaml")
+	content := `
+mappings:
+  - subdomain: app
+    target: "app:8080"
+    options:
+      websocket: true
+      health_path: /healthz
+      lb_try_duration: 5s
+      strip_headers: [X-Internal]
+  - subdomain: app-canary
+    canary_of: app
+    target: "app-next:8080"
+    options:
+      lb_try_duration: 10s
+  - subdomain: orphan
+    canary_of: missing
+    target: "orphan:8080"
+`
+	if err := os.WriteFile(mappingsPath, []byte(content), 0644); err != nil {
+		t.Fatalf("write mappings: %v", err)
+	}
+	mgr := mapping.New(mappingsPath)
+	if err := mgr.Load(); err != nil {
+		t.Fatalf("load mappings: %v", err)
+	}
+
+	g := newGeneratorWithDefaults(t, &config.Config{
+		Domain:    "example.com",
+		AcmeEmail: "admin@example.com",
+		LogLevel:  "info",
+	})
+	g.mappingMgr = mgr
+
+	mappings, err := g.collectMappings()
+	if err != nil {
+		t.Fatalf("collectMappings: %v", err)
+	}
+	byName := make(map[string]MappingData)
+	for _, m := range mappings {
+		byName[m.Subdomain] = m
+	}
+	if _, ok := byName["orphan"]; ok {
+		t.Error("canary of a missing subdomain was kept")
+	}
+
+	canary, ok := byName["app-canary"]
+	if !ok {
+		t.Fatalf("canary mapping missing: %+v", mappings)
+	}
+	if canary.Target != "app-next:8080" {
+		t.Errorf("canary target = %q, want its own app-next:8080", canary.Target)
+	}
+	opts := canary.Options
+	if !opts.Websocket || opts.HealthPath != "/healthz" || strings.Join(opts.StripHeaders, ",") != "X-Internal" {
+		t.Errorf("canary did not inherit options: %+v", opts)
+	}
+	if opts.LBTryDuration != "10s" {
+		t.Errorf("canary lb_try_duration = %q, want its own 10s", opts.LBTryDuration)
+	}
+	if base := byName["app"].Options; base.LBTryDuration != "5s" {
+		t.Errorf("base lb_try_duration = %q, want 5s unchanged", base.LBTryDuration)
+	}
+
+	if got := strings.Join(g.GetActiveSubdomains(), ","); !strings.Contains(got, "app-canary") {
+		t.Errorf("active subdomains %q missing the canary DNS name", got)
+	}
+
+	rendered, err := g.GenerateContent()
+	if err != nil {
+		t.Fatalf("GenerateContent: %v", err)
+	}
+	if !strings.Contains(rendered, "@app-canary host app-canary.example.com") || !strings.Contains(rendered, "reverse_proxy app-next:8080") {
+		t.Errorf("canary route not rendered:\n%s", rendered)
+	}
+}
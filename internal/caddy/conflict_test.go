@@ -0,0 +1,204 @@
+package caddy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/mapping"
+)
+
+// newConflictGenerator builds a generator where discovery and the YAML
+// mappings file both claim "app" with different targets.
+func newConflictGenerator(t *testing.T, strategy string) *Generator {
+	t.Helper()
+	mappingsPath := filepath.Join(t.TempDir(), "mappings.yaml")
+	content := `
+mappings:
+  - subdomain: app
+    target: "10.0.0.1:8080"
+  - subdomain: other
+    target: "10.0.0.2:8080"
+`
+	if err := os.WriteFile(mappingsPath, []byte(content), 0644); err != nil {
+		t.Fatalf("write mappings: %v", err)
+	}
+	mgr := mapping.New(mappingsPath)
+	if err := mgr.Load(); err != nil {
+		t.Fatalf("load mappings: %v", err)
+	}
+
+	g := New(&config.Config{
+		Domain:                  "example.com",
+		MappingConflictStrategy: strategy,
+	}, mgr)
+	g.UpdateDiscoveredServices([]discovery.Service{
+		{Subdomain: "app", Port: 3000},
+	})
+	return g
+}
+
+func TestCollectMappings_ConflictStrategies(t *testing.T) {
+	tests := []struct {
+		strategy   string
+		wantTarget string
+	}{
+		{"", "127.0.0.1:3000"},
+		{config.ConflictFirst, "127.0.0.1:3000"},
+		{config.ConflictDiscoveryPriority, "127.0.0.1:3000"},
+		{config.ConflictMappingPriority, "10.0.0.1:8080"},
+	}
+
+	for _, tt := range tests {
+		t.Run("strategy="+tt.strategy, func(t *testing.T) {
+			g := newConflictGenerator(t, tt.strategy)
+			mappings, err := g.collectMappings()
+			if err != nil {
+				t.Fatalf("collectMappings: %v", err)
+			}
+			if len(mappings) != 2 {
+				t.Fatalf("got %d mappings, want 2: %+v", len(mappings), mappings)
+			}
+			var appTarget string
+			for _, m := range mappings {
+				if m.Subdomain == "app" {
+					appTarget = m.Target
+				}
+			}
+			if appTarget != tt.wantTarget {
+				t.Errorf("app target = %q, want %q", appTarget, tt.wantTarget)
+			}
+		})
+	}
+}
+
+func TestCollectMappings_ConflictError(t *testing.T) {
+	g := newConflictGenerator(t, config.ConflictError)
+	g.TemplateContent = "{{range .Mappings}}{{.Subdomain}}\n{{end}}"
+
+	if _, err := g.collectMappings(); err == nil || !strings.Contains(err.Error(), "app") {
+		t.Fatalf("collectMappings error = %v, want conflict on app", err)
+	}
+	if _, err := g.GenerateContent(); err == nil {
+		t.Fatal("GenerateContent should fail while a conflict exists")
+	}
+
+	// Duplicates within discovery are conflicts too.
+	g.UpdateDiscoveredServices([]discovery.Service{
+		{Subdomain: "svc", Port: 1},
+		{Subdomain: "svc", Port: 2},
+	})
+	g.mappingMgr = nil
+	if _, err := g.collectMappings(); err == nil {
+		t.Fatal("duplicate discovered services should be a conflict")
+	}
+
+	// No conflict renders normally.
+	g.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "svc", Port: 1}})
+	if _, err := g.GenerateContent(); err != nil {
+		t.Fatalf("GenerateContent without conflicts: %v", err)
+	}
+}
+
+// TestGetActiveSubdomains_ConflictError verifies DNS follows the Caddyfile
+// under MAPPING_CONFLICT_STRATEGY=error: while a conflict rejects the
+// mappings, the last accepted subdomains stay active and the conflicting
+// ones are not published.
+func TestGetActiveSubdomains_ConflictError(t *testing.T) {
+	g := New(&config.Config{Domain: "example.com", MappingConflictStrategy: config.ConflictError}, nil)
+
+	// Conflicting from the start: nothing was accepted yet.
+	g.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "app", Port: 1}, {Subdomain: "app", Port: 2}})
+	if got := g.GetActiveSubdomains(); len(got) != 0 {
+		t.Errorf("GetActiveSubdomains() = %v with only conflicting mappings, want none", got)
+	}
+
+	g.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "app", Port: 1}})
+	if got := g.GetActiveSubdomains(); len(got) != 1 || got[0] != "app" {
+		t.Fatalf("GetActiveSubdomains() = %v, want [app]", got)
+	}
+
+	g.UpdateDiscoveredServices([]discovery.Service{
+		{Subdomain: "app", Port: 1},
+		{Subdomain: "new", Port: 3},
+		{Subdomain: "new", Port: 4},
+	})
+	if _, err := g.GenerateContent(); err == nil {
+		t.Fatal("GenerateContent should fail while a conflict exists")
+	}
+	if got := g.GetActiveSubdomains(); len(got) != 1 || got[0] != "app" {
+		t.Errorf("GetActiveSubdomains() = %v during a conflict, want the accepted [app]", got)
+	}
+}
+
+// TestCollectMappings_FQDNCollision verifies that distinct subdomains
+// resolving to the same FQDN in prefix mode (a discovered FQDN-style
+// subdomain and the YAML label "app") are detected: the discovered
+// service wins by default, the YAML mapping with mapping-priority, and
+// ConflictError refuses to render.
+func TestCollectMappings_FQDNCollision(t *testing.T) {
+	mappingsPath := filepath.Join(t.TempDir(), "mappings.yaml")
+	content := `
+mappings:
+  - subdomain: app
+    target: "10.0.0.1:8080"
+`
+	if err := os.WriteFile(mappingsPath, []byte(content), 0644); err != nil {
+		t.Fatalf("write mappings: %v", err)
+	}
+	mgr := mapping.New(mappingsPath)
+	if err := mgr.Load(); err != nil {
+		t.Fatalf("load mappings: %v", err)
+	}
+
+	tests := []struct {
+		strategy   string
+		wantSub    string
+		wantTarget string
+	}{
+		{config.ConflictFirst, "app-home.example.com", "127.0.0.1:3000"},
+		{config.ConflictMappingPriority, "app", "10.0.0.1:8080"},
+	}
+	for _, tt := range tests {
+		t.Run("strategy="+tt.strategy, func(t *testing.T) {
+			g := New(&config.Config{
+				Domain:                  "home.example.com",
+				SubdomainPrefix:         true,
+				MappingConflictStrategy: tt.strategy,
+			}, mgr)
+			g.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "app-home.example.com", Port: 3000}})
+
+			mappings, err := g.collectMappings()
+			if err != nil {
+				t.Fatalf("collectMappings: %v", err)
+			}
+			if len(mappings) != 1 {
+				t.Fatalf("got %d mappings, want 1: %+v", len(mappings), mappings)
+			}
+			if m := mappings[0]; m.Subdomain != tt.wantSub || m.Target != tt.wantTarget {
+				t.Errorf("kept %s -> %s, want %s -> %s", m.Subdomain, m.Target, tt.wantSub, tt.wantTarget)
+			}
+			if m := mappings[0]; m.FQDN != "app-home.example.com" {
+				t.Errorf("FQDN = %q, want app-home.example.com", m.FQDN)
+			}
+
+			// DNS updates follow the same precedence: one owner per FQDN.
+			if got := g.GetActiveSubdomains(); len(got) != 1 || got[0] != tt.wantSub {
+				t.Errorf("GetActiveSubdomains() = %v, want [%s]", got, tt.wantSub)
+			}
+		})
+	}
+
+	g := New(&config.Config{
+		Domain:                  "home.example.com",
+		SubdomainPrefix:         true,
+		MappingConflictStrategy: config.ConflictError,
+	}, mgr)
+	g.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "app-home.example.com", Port: 3000}})
+	if _, err := g.collectMappings(); err == nil || !strings.Contains(err.Error(), "app") {
+		t.Fatalf("collectMappings error = %v, want FQDN collision", err)
+	}
+}
@@ -0,0 +1,147 @@
+package caddy
+
+import (
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+)
+
+// DiscoveryDiff describes what applying a new set of discovered services
+// would change, without applying it.
+type DiscoveryDiff struct {
+	Added   []string // subdomains that would start routing
+	Removed []string // subdomains that would stop routing
+	Changed []string // subdomains whose routing options would change
+	// CaddyfileDiff lists changed Caddyfile lines, prefixed "- " / "+ ".
+	CaddyfileDiff string
+}
+
+// Empty reports whether applying the services would change nothing.
+func (d DiscoveryDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0 && d.CaddyfileDiff == ""
+}
+
+// PreviewDiscoveredServices computes and logs the diff that applying
+// services would produce (DISCOVERY_DRY_RUN). The generator state, the
+// Caddyfile on disk and DNS are left untouched.
+func (g *Generator) PreviewDiscoveredServices(services []discovery.Service) (DiscoveryDiff, error) {
+	g.mu.RLock()
+	current := append([]discovery.Service(nil), g.discoveredServices...)
+	mappingMgr := g.mappingMgr
+	g.mu.RUnlock()
+
+	before, err := g.GenerateContent()
+	if err != nil {
+		return DiscoveryDiff{}, err
+	}
+
+	preview := &Generator{
+		cfg:                g.cfg,
+		mappingMgr:         mappingMgr,
+		discoveredServices: services,
+		TemplatePath:       g.TemplatePath,
+		TemplateContent:    g.TemplateContent,
+		targets:            g.targets.preview(),
+	}
+	after, err := preview.GenerateContent()
+	if err != nil {
+		return DiscoveryDiff{}, err
+	}
+
+	diff := diffServices(current, services)
+	diff.CaddyfileDiff = lineDiff(before, after)
+
+	if diff.Empty() {
+		slog.Info("Discovery dry run: no changes")
+	} else {
+		slog.Info("Discovery dry run: changes not applied",
+			"added", diff.Added,
+			"removed", diff.Removed,
+			"changed", diff.Changed,
+			"caddyfile_diff", diff.CaddyfileDiff,
+		)
+	}
+	return diff, nil
+}
+
+// diffServices compares two service lists by subdomain.
+func diffServices(before, after []discovery.Service) DiscoveryDiff {
+	old := make(map[string]discovery.Service, len(before))
+	for _, svc := range before {
+		old[svc.Subdomain] = svc
+	}
+	var diff DiscoveryDiff
+	seen := make(map[string]bool, len(after))
+	for _, svc := range after {
+		seen[svc.Subdomain] = true
+		prev, ok := old[svc.Subdomain]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, svc.Subdomain)
+		case !discovery.ServicesEqual([]discovery.Service{prev}, []discovery.Service{svc}) ||
+			prev.GetTarget() != svc.GetTarget():
+			diff.Changed = append(diff.Changed, svc.Subdomain)
+		}
+	}
+	for sub := range old {
+		if !seen[sub] {
+			diff.Removed = append(diff.Removed, sub)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Changed)
+	return diff
+}
+
+// lineDiff returns the lines removed from and added to before to produce
+// after, using a longest-common-subsequence walk. Blank lines are ignored
+// since the template emits many of them.
+func lineDiff(before, after string) string {
+	a := nonBlankLines(before)
+	b := nonBlankLines(after)
+
+	// lcs[i][j] is the LCS length of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			out.WriteString("+ " + b[j] + "\n")
+			j++
+		default:
+			out.WriteString("- " + a[i] + "\n")
+			i++
+		}
+	}
+	return out.String()
+}
+
+func nonBlankLines(s string) []string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,131 @@
+package caddy
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+)
+
+// TestPreviewDiscoveredServices_LogsDiffWithoutWriting verifies that a
+// dry-run preview reports added/removed/changed subdomains and the Caddyfile
+// diff, logs it, and neither writes the Caddyfile nor updates state.
+func TestPreviewDiscoveredServices_LogsDiffWithoutWriting(t *testing.T) {
+	caddyFile := filepath.Join(t.TempDir(), "Caddyfile")
+	cfg := &config.Config{
+		Domain:    "example.com",
+		AcmeEmail: "admin@example.com",
+		LogLevel:  "info",
+		CaddyFile: caddyFile,
+	}
+	g := newGeneratorWithDefaults(t, cfg)
+	initial := []discovery.Service{
+		{Subdomain: "app", Container: "app", Port: 8080},
+		{Subdomain: "old", Container: "old", Port: 8081},
+	}
+	g.UpdateDiscoveredServices(initial)
+	if err := g.Generate(); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	written, err := os.ReadFile(caddyFile)
+	if err != nil {
+		t.Fatalf("read Caddyfile: %v", err)
+	}
+
+	var logs bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	diff, err := g.PreviewDiscoveredServices([]discovery.Service{
+		{Subdomain: "app", Container: "app", Port: 9090, Websocket: true},
+		{Subdomain: "new", Container: "new", Port: 8082},
+	})
+	if err != nil {
+		t.Fatalf("PreviewDiscoveredServices: %v", err)
+	}
+
+	if !reflect.DeepEqual(diff.Added, []string{"new"}) {
+		t.Errorf("Added = %v, want [new]", diff.Added)
+	}
+	if !reflect.DeepEqual(diff.Removed, []string{"old"}) {
+		t.Errorf("Removed = %v, want [old]", diff.Removed)
+	}
+	if !reflect.DeepEqual(diff.Changed, []string{"app"}) {
+		t.Errorf("Changed = %v, want [app]", diff.Changed)
+	}
+	if !strings.Contains(diff.CaddyfileDiff, "+ ") || !strings.Contains(diff.CaddyfileDiff, "new.example.com") {
+		t.Errorf("CaddyfileDiff missing added site:\n%s", diff.CaddyfileDiff)
+	}
+	if !strings.Contains(diff.CaddyfileDiff, "- ") || !strings.Contains(diff.CaddyfileDiff, "old.example.com") {
+		t.Errorf("CaddyfileDiff missing removed site:\n%s", diff.CaddyfileDiff)
+	}
+
+	if !strings.Contains(logs.String(), "Discovery dry run: changes not applied") {
+		t.Errorf("dry-run diff was not logged:\n%s", logs.String())
+	}
+
+	after, err := os.ReadFile(caddyFile)
+	if err != nil {
+		t.Fatalf("read Caddyfile: %v", err)
+	}
+	if !bytes.Equal(after, written) {
+		t.Error("dry run modified the Caddyfile on disk")
+	}
+	if subs := g.GetActiveSubdomains(); !reflect.DeepEqual(subs, []string{"app", "old"}) {
+		t.Errorf("active subdomains = %v, want unchanged [app old]", subs)
+	}
+}
+
+// TestPreviewDiscoveredServices_ValidateTargets verifies the dry-run
+// preview applies VALIDATE_TARGETS like Generate: with
+// VALIDATE_TARGETS_DROP an unreachable target stays out of the diff.
+func TestPreviewDiscoveredServices_ValidateTargets(t *testing.T) {
+	g := newGeneratorWithDefaults(t, &config.Config{
+		Domain:                 "example.com",
+		AcmeEmail:              "admin@example.com",
+		LogLevel:               "info",
+		CloudflareProxy:        true,
+		ValidateTargets:        true,
+		ValidateTargetsTimeout: time.Second,
+		ValidateTargetsDrop:    true,
+	})
+	dialer := &targetDialer{up: map[string]bool{"127.0.0.1:8080": true}}
+	g.targets.dial = dialer.dial
+	g.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "app", Container: "app", Port: 8080}})
+
+	diff, err := g.PreviewDiscoveredServices([]discovery.Service{
+		{Subdomain: "app", Container: "app", Port: 8080},
+		{Subdomain: "typo", Container: "typo", Port: 808},
+	})
+	if err != nil {
+		t.Fatalf("PreviewDiscoveredServices: %v", err)
+	}
+	if !reflect.DeepEqual(diff.Added, []string{"typo"}) {
+		t.Errorf("Added = %v, want [typo]", diff.Added)
+	}
+	if strings.Contains(diff.CaddyfileDiff, "127.0.0.1:808\n") || strings.Contains(diff.CaddyfileDiff, "typo.example.com") {
+		t.Errorf("preview rendered the unreachable target:\n%s", diff.CaddyfileDiff)
+	}
+	if g.targets.failing["127.0.0.1:808"] {
+		t.Error("preview changed the generator's failing targets")
+	}
+}
+
+func TestLineDiff(t *testing.T) {
+	got := lineDiff("a\nb\n\nc\n", "a\nc\nd\n")
+	want := "- b\n+ d\n"
+	if got != want {
+		t.Errorf("lineDiff() = %q, want %q", got, want)
+	}
+	if got := lineDiff("x\n", "x\n\n"); got != "" {
+		t.Errorf("lineDiff() of equal content = %q, want empty", got)
+	}
+}
@@ -0,0 +1,64 @@
+package caddy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+)
+
+// TestGenerateContent_NoMappings verifies a fresh install without any
+// mapping or discovered service still renders a loadable Caddyfile: the
+// global options block, a catch-all site answering 451, and the health
+// site. Unset email and log level must not leave directives without an
+// argument.
+func TestGenerateContent_NoMappings(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *config.Config
+	}{
+		{name: "direct", cfg: &config.Config{Domain: "example.com", AcmeEmail: "admin@example.com", LogLevel: "info"}},
+		{name: "proxy", cfg: &config.Config{Domain: "example.com", CloudflareProxy: true}},
+		{name: "prefix", cfg: &config.Config{Domain: "home.example.com", SubdomainPrefix: true, CloudflareProxy: true}},
+		{name: "per-site", cfg: &config.Config{Domain: "example.com", CloudflareProxy: true, CaddyPerSite: true}},
+		{name: "map", cfg: &config.Config{Domain: "example.com", CloudflareProxy: true, CaddyMapMode: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newGeneratorWithDefaults(t, tt.cfg)
+			content, err := g.GenerateContent()
+			if err != nil {
+				t.Fatalf("GenerateContent: %v", err)
+			}
+			if err := validateContent(content); err != nil {
+				t.Fatalf("validateContent: %v\n%s", err, content)
+			}
+
+			// The first directive opens the global options block.
+			var first string
+			for _, line := range strings.Split(content, "\n") {
+				if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+					first = line
+					break
+				}
+			}
+			if first != "{" {
+				t.Errorf("first directive = %q, want the global options block", first)
+			}
+			global := blockAfter(t, content, "\n{")
+			for _, line := range strings.Split(global, "\n") {
+				if f := strings.Fields(line); len(f) == 1 && (f[0] == "email" || f[0] == "level") {
+					t.Errorf("global option %q without an argument", f[0])
+				}
+			}
+
+			if !strings.Contains(content, `respond "451 Unavailable For Legal Reasons" 451`) {
+				t.Error("catch-all 451 site missing")
+			}
+			health := blockAfter(t, content, "http://127.0.0.1:8080 {")
+			if !strings.Contains(health, "handle /health {") {
+				t.Errorf("health site = %q, want a /health handler", health)
+			}
+		})
+	}
+}
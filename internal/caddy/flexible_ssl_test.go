@@ -0,0 +1,69 @@
+package caddy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+)
+
+// TestGenerate_FlexibleSSLRendersPlainHTTP verifies that in Cloudflare's
+// flexible SSL mode the proxy-mode site listens on plain HTTP and never
+// emits tls or client_auth, since Cloudflare reaches the origin over HTTP.
+func TestGenerate_FlexibleSSLRendersPlainHTTP(t *testing.T) {
+	for _, prefix := range []bool{false, true} {
+		cfg := &config.Config{
+			Domain:            "zone.example.com",
+			AcmeEmail:         "admin@example.com",
+			LogLevel:          "info",
+			SubdomainPrefix:   prefix,
+			CloudflareProxy:   true,
+			CloudflareSSLMode: "flexible",
+		}
+		g := newGeneratorWithDefaults(t, cfg)
+		g.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "app", Port: 8080}})
+
+		content, err := g.GenerateContent()
+		if err != nil {
+			t.Fatalf("GenerateContent: %v", err)
+		}
+
+		wildcard := "http://*." + cfg.GetBaseDomain() + ", http://zone.example.com {"
+		if !strings.Contains(content, wildcard) {
+			t.Errorf("prefix=%v: expected plain-HTTP site %q:\n%s", prefix, wildcard, content)
+		}
+		if strings.Contains(content, "client_auth") {
+			t.Errorf("prefix=%v: flexible mode must never emit client_auth:\n%s", prefix, content)
+		}
+		block := blockAfter(t, content, wildcard)
+		if strings.Contains(block, "tls {") {
+			t.Errorf("prefix=%v: flexible site must not configure tls:\n%s", prefix, block)
+		}
+		if !strings.Contains(block, "@app host") {
+			t.Errorf("prefix=%v: service routing missing from flexible site:\n%s", prefix, block)
+		}
+	}
+}
+
+// TestGenerate_FullSSLKeepsMTLS guards the default: non-flexible proxy mode
+// still renders the TLS wildcard site with origin mTLS.
+func TestGenerate_FullSSLKeepsMTLS(t *testing.T) {
+	cfg := &config.Config{
+		Domain:            "example.com",
+		AcmeEmail:         "admin@example.com",
+		LogLevel:          "info",
+		CloudflareProxy:   true,
+		CloudflareSSLMode: "full",
+	}
+	content, err := newGeneratorWithDefaults(t, cfg).GenerateContent()
+	if err != nil {
+		t.Fatalf("GenerateContent: %v", err)
+	}
+	if strings.Contains(content, "http://*.") {
+		t.Errorf("full mode must not render plain-HTTP wildcard site:\n%s", content)
+	}
+	if !strings.Contains(content, "require_and_verify") {
+		t.Errorf("full mode must keep origin mTLS:\n%s", content)
+	}
+}
@@ -0,0 +1,53 @@
+package caddy
+
+import (
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// hostLabelPattern matches one DNS label of a host name.
+var hostLabelPattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?$`)
+
+// templateFuncs returns the functions available to Caddyfile templates.
+// Argument order follows the common template convention of putting the
+// piped value last, e.g. {{.Hosts | join ", "}}.
+func templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"default": func(def, val string) string {
+			if val == "" {
+				return def
+			}
+			return val
+		},
+		"quote":     caddyQuote,
+		"lower":     strings.ToLower,
+		"join":      func(sep string, elems []string) string { return strings.Join(elems, sep) },
+		"replace":   func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+		"validHost": validHost,
+	}
+}
+
+// caddyQuote renders s as a double-quoted Caddyfile token, escaping
+// backslashes and quotes so the value stays a single token.
+func caddyQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+// validHost reports whether host is a DNS host name that is safe to render
+// as a site address: dot-separated labels of letters, digits and hyphens,
+// optionally starting with a "*." wildcard label.
+func validHost(host string) bool {
+	host = strings.TrimPrefix(host, "*.")
+	if host == "" || len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if !hostLabelPattern.MatchString(label) {
+			return false
+		}
+	}
+	return true
+}
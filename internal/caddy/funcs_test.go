@@ -0,0 +1,48 @@
+package caddy
+
+import (
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+)
+
+// TestGenerateContent_TemplateFuncs verifies each template function when
+// used from a rendered template.
+func TestGenerateContent_TemplateFuncs(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{name: "default empty", template: `{{default "info" ""}}`, want: "info"},
+		{name: "default set", template: `{{.Domain | default "none"}}`, want: "Example.COM"},
+		{name: "quote", template: `{{quote "say \"hi\" C:\\x"}}`, want: `"say \"hi\" C:\\x"`},
+		{name: "lower", template: `{{.Domain | lower}}`, want: "example.com"},
+		{name: "join", template: `{{with index .Mappings 0}}{{.Options.StripHeaders | join ", "}}{{end}}`, want: "X-Debug, X-Internal"},
+		{name: "replace", template: `{{.Domain | lower | replace "." "-"}}`, want: "example-com"},
+		{name: "validHost ok", template: `{{validHost "*.app.example.com"}}`, want: "true"},
+		{name: "validHost bad", template: `{{validHost "app example.com {"}} {{validHost "-a.example.com"}} {{validHost ""}}`, want: "false false false"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := New(&config.Config{
+				Domain:       "Example.COM",
+				StripHeaders: []string{"X-Debug", "X-Internal"},
+			}, nil)
+			g.UpdateDiscoveredServices([]discovery.Service{
+				{Subdomain: "app", Port: 8080},
+			})
+			g.TemplateContent = tt.template
+
+			got, err := g.GenerateContent()
+			if err != nil {
+				t.Fatalf("GenerateContent: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("rendered %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -6,15 +6,26 @@ import (
 	"log/slog"
 	"net"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
 	"sync"
 	"text/template"
+	"time"
 
+	"github.com/jonnyzzz/stevedore-dyndns/internal/atomicfile"
 	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
 	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
 	"github.com/jonnyzzz/stevedore-dyndns/internal/mapping"
 )
 
+// OnDemandAskPath is the status server path Caddy's on_demand_tls ask
+// check calls with ?domain=<host>.
+const OnDemandAskPath = "/tls/ask"
+
+// onDemandAskURL is the ask endpoint on the loopback status server.
+const onDemandAskURL = "http://127.0.0.1:8081" + OnDemandAskPath
+
 // Generator generates Caddyfile configuration from templates and mappings
 type Generator struct {
 	cfg        *config.Config
@@ -28,6 +39,27 @@ type Generator struct {
 	TemplatePath string
 	// TemplateContent allows providing template content directly (for testing)
 	TemplateContent string
+
+	// reloadMu serializes the Caddyfile writes and reloads. With
+	// CADDY_RELOAD_MIN_INTERVAL a change within the interval of the last
+	// reload is deferred to a single pending regeneration, which renders
+	// the latest state when it runs.
+	reloadMu      sync.Mutex
+	lastReload    time.Time
+	reloadPending bool
+	// now and afterFunc are the clock; injectable for tests.
+	now       func() time.Time
+	afterFunc func(d time.Duration, f func())
+	// reload applies a written Caddyfile; reloadCaddy unless replaced in tests.
+	reload func() error
+	// targets validates the upstream targets (VALIDATE_TARGETS); nil
+	// when disabled.
+	targets *targetChecks
+
+	// collected is the last result of collectMappings that was not
+	// rejected by MAPPING_CONFLICT_STRATEGY=error.
+	collectedMu sync.Mutex
+	collected   []MappingData
 }
 
 // TemplateData contains data passed to the Caddyfile template
@@ -38,10 +70,18 @@ type TemplateData struct {
 	SubdomainPrefix bool   // Use prefix mode (subdomain-basedomain.parent)
 	BaseDomain      string // Parent domain in prefix mode (e.g., example.com)
 	CloudflareProxy bool   // Use Cloudflare proxy mode with mTLS
+	// FlexibleSSL renders the proxy-mode site as plain HTTP (no tls, no
+	// client_auth) because Cloudflare's flexible SSL mode connects to the
+	// origin over HTTP.
+	FlexibleSSL bool
 	// CatchallFQDN, when non-empty, enables the 451 catchall site block
 	// and is also used as default_sni in the global Caddy options.
 	CatchallFQDN  string
 	ProxyMappings []MappingData // Subdomains routed via the CF-proxy+mTLS block
+	// ProxySites groups ProxyMappings into the site blocks that serve them:
+	// a single combined *.domain site, or one site per subdomain plus the
+	// bare domain when CADDY_PER_SITE is set.
+	ProxySites     []ProxySite
 	DirectMappings []MappingData // Subdomains served directly (own LE cert, no mTLS)
 	// MTProtoSites lists the MTProto-bound site configs rendered by the
 	// Caddy template. Each site owns its own LE cert (direct-mode) and
@@ -56,11 +96,76 @@ type TemplateData struct {
 	// so the Caddy listener is not reachable externally. Paired with a
 	// non-zero HTTPSPort.
 	LoopbackOnly bool
+	// SharedSnippets defines the access log and proxy header directives
+	// once as snippets that every site imports, instead of repeating them.
+	SharedSnippets bool
+	// RequestIDHeader, when non-empty, is set on proxied requests to a
+	// per-request UUID unless the client already sent it.
+	RequestIDHeader string
+	// AccessLogSample, when set, samples the access logs: the first request
+	// of each second is logged, then every AccessLogSample-th.
+	// AccessLogSkipPaths are paths whose requests are not logged.
+	AccessLogSample    int
+	AccessLogSkipPaths []string
+	// AcmeChallengeWebroot, when non-empty, serves
+	// /.well-known/acme-challenge/ from this directory ahead of the proxies.
+	AcmeChallengeWebroot string
+	// OriginCert and OriginKey, when set, replace the ACME DNS challenge on
+	// the wildcard site with a static certificate (e.g. Cloudflare Origin CA).
+	OriginCert string
+	OriginKey  string
+	// DNSProvider and DNSProviderArgs render the ACME DNS-01 challenge as
+	// "dns <provider> <args>" in every tls block; DNSResolvers, when set,
+	// are the resolvers Caddy checks propagation against.
+	DNSProvider     string
+	DNSProviderArgs string
+	DNSResolvers    []string
+	// TLSProtocols, TLSCiphers and TLSCurves, when set, render as the
+	// protocols, ciphers and curves of every public site's tls block.
+	TLSProtocols []string
+	TLSCiphers   []string
+	TLSCurves    []string
+	// OnDemandAskURL, when non-empty, enables on-demand TLS: per-host sites
+	// obtain their certificate at the first handshake once this endpoint
+	// approves the host.
+	OnDemandAskURL string
+	// AdminAddress, when non-empty, is rendered as the global admin option
+	// so Caddy's admin API listens where dyndns probes it (CADDY_ADMIN).
+	AdminAddress string
+	// MetricsHost and MetricsPort, when MetricsPort is non-empty, enable
+	// Caddy's HTTP metrics and serve them on an internal site bound to
+	// this address (CADDY_METRICS_ADDR), apart from the public sites.
+	MetricsHost string
+	MetricsPort string
+	// StatusTLS proxies the internal site's status routes to the status
+	// server over TLS (STATUS_TLS_CERT). StatusClientCert and
+	// StatusClientKey, when set, are presented as Caddy's client
+	// certificate because STATUS_TLS_CLIENT_CA requires one.
+	StatusTLS        bool
+	StatusClientCert string
+	StatusClientKey  string
+	// RateLimited is set when a mapping has a rate_limit option, ordering
+	// Caddy's rate_limit handler in the globals.
+	RateLimited bool
 	// Mappings is kept for legacy template/test use: it is the concatenation of
 	// ProxyMappings followed by DirectMappings.
 	Mappings []MappingData
 }
 
+// ProxySite is one proxy-mode site block. Addresses is the rendered site
+// address list; Mappings are routed inside it by host matcher.
+type ProxySite struct {
+	Addresses string
+	Mappings  []MappingData
+	// OnDemand requests the site's certificate on demand. Only per-host
+	// sites qualify; the combined site uses a wildcard certificate.
+	OnDemand bool
+	// MapMappings are routed through a single map of host to upstream
+	// (CADDY_MAP_MODE), proxied with MapOptions.
+	MapMappings []MappingData
+	MapOptions  mapping.MappingOptions
+}
+
 // MTProtoSite describes one MTProto-bound subdomain's browser-facing site.
 // When HasBackend is true, Caddy reverse-proxies browser traffic to the
 // registered service. Otherwise it emits the fallback "OK, it's 451" body
@@ -84,12 +189,69 @@ type MappingData struct {
 	Direct bool
 }
 
+// apexMatcher names the host matcher of the apex mapping; the underscore
+// keeps it apart from every subdomain label.
+const apexMatcher = "dyndns_apex"
+
+// Matcher returns the name of the mapping's Caddy host matcher.
+func (m MappingData) Matcher() string {
+	if m.Subdomain == config.ApexSubdomain {
+		return apexMatcher
+	}
+	return m.Subdomain
+}
+
+// rateLimited reports whether one of mappings has a rate limit.
+func rateLimited(mappings []MappingData) bool {
+	for _, m := range mappings {
+		if m.Options.RateLimit != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// hasApex reports whether one of mappings serves the bare domain.
+func hasApex(mappings []MappingData) bool {
+	for _, m := range mappings {
+		if m.Subdomain == config.ApexSubdomain {
+			return true
+		}
+	}
+	return false
+}
+
 // New creates a new Caddy configuration generator
 func New(cfg *config.Config, mappingMgr *mapping.Manager) *Generator {
-	return &Generator{
+	g := &Generator{
 		cfg:        cfg,
 		mappingMgr: mappingMgr,
+		now:        time.Now,
+		afterFunc:  func(d time.Duration, f func()) { time.AfterFunc(d, f) },
+		targets:    newTargetChecks(cfg),
+	}
+	g.reload = g.reloadCaddy
+	return g
+}
+
+// SetMappingManager replaces the source of YAML mappings, e.g. to fall
+// back to the mappings file while discovery is unreachable. Nil drops the
+// YAML mappings.
+func (g *Generator) SetMappingManager(mgr *mapping.Manager) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.mappingMgr = mgr
+}
+
+// yamlMappings returns the mappings loaded from the YAML file, if any.
+func (g *Generator) yamlMappings() []mapping.Mapping {
+	g.mu.RLock()
+	mgr := g.mappingMgr
+	g.mu.RUnlock()
+	if mgr == nil {
+		return nil
 	}
+	return mgr.Get()
 }
 
 // UpdateDiscoveredServices updates the list of services from stevedore discovery
@@ -99,11 +261,34 @@ func (g *Generator) UpdateDiscoveredServices(services []discovery.Service) {
 	g.discoveredServices = services
 }
 
-// Generate creates the Caddyfile from template and current mappings/services
+// Generate creates the Caddyfile from template and current mappings/services.
+// The config is rendered and validated in memory first; a failed render
+// leaves the last-good Caddyfile (and the running Caddy) untouched.
 func (g *Generator) Generate() error {
 	content, err := g.GenerateContent()
 	if err != nil {
-		return err
+		return fmt.Errorf("keeping the previous Caddyfile: %w", err)
+	}
+	if err := validateContent(content); err != nil {
+		return fmt.Errorf("keeping the previous Caddyfile: %w", err)
+	}
+
+	g.reloadMu.Lock()
+	defer g.reloadMu.Unlock()
+
+	// Within CADDY_RELOAD_MIN_INTERVAL of the last reload, a change is
+	// left to the pending regeneration at the end of the interval.
+	interval := g.cfg.CaddyReloadMinInterval
+	if wait := g.lastReload.Add(interval).Sub(g.now()); interval > 0 && !g.lastReload.IsZero() && wait > 0 {
+		if sameFileContent(g.cfg.CaddyFile, []byte(content)) {
+			return nil
+		}
+		if !g.reloadPending {
+			g.reloadPending = true
+			slog.Info("Deferring Caddy reload", "path", g.cfg.CaddyFile, "wait", wait)
+			g.afterFunc(wait, g.generatePending)
+		}
+		return nil
 	}
 
 	// Write Caddyfile
@@ -111,21 +296,43 @@ func (g *Generator) Generate() error {
 	if err != nil {
 		return err
 	}
+	mappings, _ := g.collectMappings()
 	if !changed {
-		slog.Debug("Caddyfile unchanged, skipping reload", "path", g.cfg.CaddyFile, "mappings", len(g.collectMappings()))
+		slog.Debug("Caddyfile unchanged, skipping reload", "path", g.cfg.CaddyFile, "mappings", len(mappings))
 		return nil
 	}
 
-	slog.Info("Generated Caddyfile", "path", g.cfg.CaddyFile, "mappings", len(g.collectMappings()))
+	slog.Info("Generated Caddyfile", "path", g.cfg.CaddyFile, "mappings", len(mappings))
+	if len(mappings) == 0 {
+		slog.Info("No mappings yet: serving only the catch-all and health sites until services appear")
+	}
 
 	// Reload Caddy (if running)
-	if err := g.reloadCaddy(); err != nil {
+	g.lastReload = g.now()
+	if err := g.reloadWithHooks(); err != nil {
 		slog.Warn("Failed to reload Caddy", "error", err)
 	}
 
 	return nil
 }
 
+// generatePending runs the regeneration deferred by
+// CADDY_RELOAD_MIN_INTERVAL with the state current at that time.
+func (g *Generator) generatePending() {
+	g.reloadMu.Lock()
+	g.reloadPending = false
+	g.reloadMu.Unlock()
+	if err := g.Generate(); err != nil {
+		slog.Error("Failed to regenerate Caddy config", "error", err)
+	}
+}
+
+// sameFileContent reports whether the file at path holds exactly content.
+func sameFileContent(path string, content []byte) bool {
+	existing, err := os.ReadFile(path)
+	return err == nil && bytes.Equal(existing, content)
+}
+
 func writeFileIfChanged(path string, content []byte) (bool, error) {
 	existing, err := os.ReadFile(path)
 	if err == nil {
@@ -136,7 +343,7 @@ func writeFileIfChanged(path string, content []byte) (bool, error) {
 		return false, fmt.Errorf("failed to read Caddyfile: %w", err)
 	}
 
-	if err := os.WriteFile(path, content, 0644); err != nil {
+	if err := atomicfile.Write(path, content, 0644); err != nil {
 		return false, fmt.Errorf("failed to write Caddyfile: %w", err)
 	}
 
@@ -162,38 +369,15 @@ func (g *Generator) GenerateContent() (string, error) {
 		tmplContent = string(content)
 	}
 
-	funcMap := template.FuncMap{
-		"default": func(def, val string) string {
-			if val == "" {
-				return def
-			}
-			return val
-		},
-	}
-
-	tmpl, err := template.New("Caddyfile").Funcs(funcMap).Parse(tmplContent)
+	tmpl, err := template.New("Caddyfile").Funcs(templateFuncs()).Parse(tmplContent)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse template: %w", err)
 	}
 
 	// Prepare template data - combine mappings and discovered services
-	mappingData := g.collectMappings()
-	proxyMappings, directMappings := splitMappings(mappingData)
-
-	data := TemplateData{
-		Domain:          g.cfg.Domain,
-		AcmeEmail:       g.cfg.AcmeEmail,
-		LogLevel:        g.cfg.LogLevel,
-		SubdomainPrefix: g.cfg.SubdomainPrefix,
-		BaseDomain:      g.cfg.GetBaseDomain(),
-		CloudflareProxy: g.cfg.CloudflareProxy,
-		CatchallFQDN:    g.catchallFQDN(),
-		ProxyMappings:   proxyMappings,
-		DirectMappings:  directMappings,
-		MTProtoSites:    g.mtprotoSites(),
-		HTTPSPort:       g.httpsPort(),
-		LoopbackOnly:    g.cfg.MTProtoDispatcher,
-		Mappings:        mappingData,
+	data, err := g.templateData()
+	if err != nil {
+		return "", err
 	}
 
 	// Execute template
@@ -206,25 +390,80 @@ func (g *Generator) GenerateContent() (string, error) {
 }
 
 // GetTemplateData returns the template data that would be used for generation.
-// This is useful for testing template rendering.
+// This is useful for testing template rendering. Mapping conflicts rejected
+// by the configured strategy are logged and yield empty mappings.
 func (g *Generator) GetTemplateData() TemplateData {
-	mappings := g.collectMappings()
+	data, err := g.templateData()
+	if err != nil {
+		slog.Error("Failed to collect mappings", "error", err)
+	}
+	return data
+}
+
+// templateData assembles the TemplateData from config, mappings and
+// discovered services.
+func (g *Generator) templateData() (TemplateData, error) {
+	mappings, err := g.collectMappings()
+	mappings = g.targets.filter(mappings)
 	proxy, direct := splitMappings(mappings)
-	return TemplateData{
-		Domain:          g.cfg.Domain,
-		AcmeEmail:       g.cfg.AcmeEmail,
-		LogLevel:        g.cfg.LogLevel,
-		SubdomainPrefix: g.cfg.SubdomainPrefix,
-		BaseDomain:      g.cfg.GetBaseDomain(),
-		CloudflareProxy: g.cfg.CloudflareProxy,
-		CatchallFQDN:    g.catchallFQDN(),
-		ProxyMappings:   proxy,
-		DirectMappings:  direct,
-		MTProtoSites:    g.mtprotoSites(),
-		HTTPSPort:       g.httpsPort(),
-		LoopbackOnly:    g.cfg.MTProtoDispatcher,
-		Mappings:        mappings,
+	// CADDY_METRICS_ADDR is validated as host:port by config.Load.
+	metricsHost, metricsPort, _ := net.SplitHostPort(g.cfg.CaddyMetricsAddr)
+	// A Config not built by config.Load keeps the Cloudflare challenge.
+	dnsProvider, dnsProviderArgs := g.cfg.AcmeDNSProvider, g.cfg.AcmeDNSProviderArgs
+	if dnsProvider == "" {
+		dnsProvider, dnsProviderArgs = "cloudflare", "{env.CLOUDFLARE_API_TOKEN}"
 	}
+	// With STATUS_TLS_CLIENT_CA the status server requires a client
+	// certificate; Caddy presents the status certificate itself.
+	var statusClientCert, statusClientKey string
+	if g.cfg.StatusTLSClientCA != "" {
+		statusClientCert, statusClientKey = g.cfg.StatusTLSCert, g.cfg.StatusTLSKey
+	}
+	return TemplateData{
+		Domain:               g.cfg.Domain,
+		AcmeEmail:            g.cfg.AcmeEmail,
+		LogLevel:             g.cfg.LogLevel,
+		SubdomainPrefix:      g.cfg.SubdomainPrefix,
+		BaseDomain:           g.cfg.GetBaseDomain(),
+		CloudflareProxy:      g.cfg.CloudflareProxy,
+		FlexibleSSL:          g.cfg.FlexibleSSL(),
+		SharedSnippets:       g.cfg.CaddySharedSnippets,
+		RequestIDHeader:      g.cfg.RequestIDHeader,
+		AccessLogSample:      g.cfg.AccessLogSample,
+		AccessLogSkipPaths:   g.cfg.AccessLogSkipPaths,
+		AcmeChallengeWebroot: g.cfg.AcmeChallengeWebroot,
+		OriginCert:           g.cfg.OriginCert,
+		OriginKey:            g.cfg.OriginKey,
+		DNSProvider:          dnsProvider,
+		DNSProviderArgs:      dnsProviderArgs,
+		DNSResolvers:         g.cfg.AcmeDNSResolvers,
+		TLSProtocols:         g.cfg.TLSProtocols,
+		TLSCiphers:           g.cfg.TLSCiphers,
+		TLSCurves:            g.cfg.TLSCurves,
+		OnDemandAskURL:       g.onDemandAskURL(),
+		AdminAddress:         adminAddress(g.cfg.CaddyAdmin),
+		MetricsHost:          metricsHost,
+		MetricsPort:          metricsPort,
+		StatusTLS:            g.cfg.StatusTLSCert != "",
+		StatusClientCert:     statusClientCert,
+		StatusClientKey:      statusClientKey,
+		RateLimited:          rateLimited(mappings),
+		CatchallFQDN:         g.catchallFQDN(),
+		ProxyMappings:        proxy,
+		ProxySites:           g.proxySites(proxy, hasApex(direct)),
+		DirectMappings:       direct,
+		MTProtoSites:         g.mtprotoSites(),
+		HTTPSPort:            g.httpsPort(),
+		LoopbackOnly:         g.cfg.MTProtoDispatcher,
+		Mappings:             mappings,
+	}, err
+}
+
+// adminAddress returns the CADDY_ADMIN address in Caddy's admin option
+// syntax: the probe also accepts an http:// URL, Caddy does not.
+func adminAddress(addr string) string {
+	addr = strings.TrimPrefix(addr, "http://")
+	return strings.TrimSuffix(addr, "/")
 }
 
 // mtprotoSites resolves the configured MTProtoSubdomains into MTProtoSite
@@ -254,10 +493,11 @@ func (g *Generator) mtprotoSites() []MTProtoSite {
 			if svc.Subdomain == label || svc.Subdomain == fqdn {
 				site.HasBackend = true
 				site.Target = svc.GetTarget()
-				site.Options = mapping.MappingOptions{
-					Websocket:  svc.Websocket,
-					HealthPath: svc.GetHealthPath(),
-				}
+				site.Options = g.withProxyDefaults(mapping.MappingOptions{
+					Websocket:     svc.Websocket,
+					HealthPath:    svc.GetHealthPath(),
+					DisableHealth: svc.DisableHealth,
+				})
 				break
 			}
 		}
@@ -314,6 +554,105 @@ func splitMappings(all []MappingData) (proxy, direct []MappingData) {
 	return
 }
 
+// proxySites lays out the proxy-mode mappings as site blocks. By default a
+// single site covers the wildcard and the bare domain (in prefix mode the
+// wildcard is over the parent domain, e.g. app-zone.example.com). With
+// CaddyPerSite every mapping gets a site of its own, and the bare domain
+// keeps a site without mappings unless an apex mapping serves it. A direct
+// apex mapping has a site of its own, so the bare domain is left out here.
+// Flexible SSL serves the sites over HTTP.
+func (g *Generator) proxySites(proxy []MappingData, directApex bool) []ProxySite {
+	scheme := ""
+	if g.cfg.FlexibleSSL() {
+		scheme = "http://"
+	}
+
+	if !g.cfg.CaddyPerSite {
+		wildcard := "*." + g.cfg.Domain
+		if g.cfg.SubdomainPrefix {
+			wildcard = "*." + g.cfg.GetBaseDomain()
+		}
+		addresses := scheme + wildcard
+		if !directApex {
+			addresses += ", " + scheme + g.cfg.Domain
+		}
+		site := ProxySite{
+			Addresses: addresses,
+			Mappings:  proxy,
+		}
+		if g.cfg.CaddyMapMode {
+			site.MapOptions = g.withProxyDefaults(mapping.MappingOptions{})
+			site.Mappings, site.MapMappings = g.splitMapped(proxy, site.MapOptions)
+		}
+		return []ProxySite{site}
+	}
+
+	sites := make([]ProxySite, 0, len(proxy)+1)
+	for _, m := range proxy {
+		sites = append(sites, ProxySite{
+			Addresses: scheme + m.FQDN,
+			Mappings:  []MappingData{m},
+			OnDemand:  g.cfg.CaddyOnDemandTLS,
+		})
+	}
+	if directApex || hasApex(proxy) {
+		return sites
+	}
+	return append(sites, ProxySite{Addresses: scheme + g.cfg.Domain})
+}
+
+// splitMapped separates the mappings that can share the map's
+// reverse_proxy, i.e. those with the default proxy options and a plain
+// host:port upstream, from those that keep a handle block of their own.
+// Active health checks cannot follow a map's dynamic upstream, so a mapping
+// with its own health options (path, interval or timeout) keeps its handle
+// block and its checks; the mapped subdomains that would otherwise get the
+// default checks are logged.
+func (g *Generator) splitMapped(proxy []MappingData, defaults mapping.MappingOptions) (own, mapped []MappingData) {
+	var unchecked []string
+	for _, m := range proxy {
+		opts := m.Options
+		plain := !opts.Websocket && !opts.BufferRequests &&
+			opts.FailDuration == "" && opts.MaxFails == 0 &&
+			opts.WSHandshakeTimeout == "" && len(opts.WSHeaders) == 0 &&
+			opts.LBTryDuration == defaults.LBTryDuration && opts.LBTryInterval == defaults.LBTryInterval &&
+			slices.Equal(opts.StripHeaders, defaults.StripHeaders) && opts.RateLimit == nil && opts.Match == "" &&
+			!hasHealthOptions(opts) && !strings.Contains(m.Target, "://")
+		if !plain {
+			own = append(own, m)
+			continue
+		}
+		mapped = append(mapped, m)
+		if !opts.DisableHealth {
+			unchecked = append(unchecked, m.Subdomain)
+		}
+	}
+	if len(unchecked) > 0 {
+		slog.Warn("CADDY_MAP_MODE: mapped subdomains run without active health checks; set health options or disable_health to keep or silence them",
+			"subdomains", unchecked)
+	}
+	return own, mapped
+}
+
+// hasHealthOptions reports whether opts tune the active health checks
+// beyond the defaults.
+func hasHealthOptions(opts mapping.MappingOptions) bool {
+	if opts.DisableHealth {
+		return false
+	}
+	return (opts.HealthPath != "" && opts.HealthPath != "/health") ||
+		opts.HealthInterval != "" || opts.HealthTimeout != ""
+}
+
+// onDemandAskURL returns the on_demand_tls ask endpoint, or the empty
+// string when on-demand TLS is disabled.
+func (g *Generator) onDemandAskURL() string {
+	if !g.cfg.CaddyOnDemandTLS {
+		return ""
+	}
+	return onDemandAskURL
+}
+
 // catchallFQDN returns the fully-qualified domain name for the 451 catchall
 // site, or the empty string when the feature is disabled.
 func (g *Generator) catchallFQDN() string {
@@ -323,45 +662,65 @@ func (g *Generator) catchallFQDN() string {
 	return g.cfg.GetSubdomainFQDN(g.cfg.CatchallSubdomain)
 }
 
-// GetActiveSubdomains returns a list of all currently active subdomains
+// GetActiveSubdomains returns a list of all currently active subdomains:
+// the mappings the Caddyfile is rendered from (see collectMappings) and
+// the MTProto-bound subdomains, so each DNS record has a single owner.
+// While MAPPING_CONFLICT_STRATEGY=error rejects the mappings, the last
+// accepted ones are used, matching the Caddyfile that stays in place.
 func (g *Generator) GetActiveSubdomains() []string {
-	g.mu.RLock()
-	defer g.mu.RUnlock()
+	mappings, err := g.collectMappings()
+	if err != nil {
+		g.collectedMu.Lock()
+		mappings = g.collected
+		g.collectedMu.Unlock()
+	}
 
 	seen := make(map[string]bool)
 	var result []string
-
-	// From discovered services
-	for _, svc := range g.discoveredServices {
-		if !seen[svc.Subdomain] {
-			seen[svc.Subdomain] = true
-			result = append(result, svc.Subdomain)
+	add := func(sub string) {
+		key := g.fqdnKey(sub)
+		if seen[key] {
+			return
 		}
+		seen[key] = true
+		result = append(result, sub)
 	}
-
-	// From YAML mappings
-	if g.mappingMgr != nil {
-		for _, m := range g.mappingMgr.Get() {
-			if !seen[m.Subdomain] {
-				seen[m.Subdomain] = true
-				result = append(result, m.Subdomain)
-			}
-		}
+	for _, m := range mappings {
+		add(m.Subdomain)
 	}
 
 	// From MTProto-bound subdomains — these need grey-cloud DNS records so
 	// Caddy can issue LE certs via DNS-01 and the dispatcher can target them
 	// directly.
 	for _, sub := range g.cfg.MTProtoSubdomains {
-		if !seen[sub] {
-			seen[sub] = true
-			result = append(result, sub)
-		}
+		add(sub)
 	}
 
 	return result
 }
 
+// IsActiveHost reports whether host is the FQDN of a currently active
+// subdomain (see GetActiveSubdomains). It backs the on-demand TLS ask
+// endpoint, so certificates are only issued for hosts dyndns serves.
+func (g *Generator) IsActiveHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "" {
+		return false
+	}
+	for _, sub := range g.GetActiveSubdomains() {
+		if strings.ToLower(g.cfg.GetSubdomainFQDN(sub)) == host {
+			return true
+		}
+	}
+	// MTProto entries may be given as FQDNs rather than labels.
+	for _, entry := range g.cfg.MTProtoSubdomains {
+		if _, fqdn := g.cfg.ResolveMTProtoEntry(entry); strings.ToLower(fqdn) == host {
+			return true
+		}
+	}
+	return false
+}
+
 // IsSubdomainDirect returns true when the given subdomain was discovered with
 // the direct-mode flag set, or is an MTProto-bound subdomain (which is always
 // grey-cloud). Unknown subdomains (including YAML mappings) return false.
@@ -384,59 +743,210 @@ func (g *Generator) IsSubdomainDirect(subdomain string) bool {
 	return false
 }
 
+// IPOverride is the fixed addresses a subdomain's DNS records are pinned
+// to by its ip_override.
+type IPOverride struct {
+	IPv4, IPv6 string
+}
+
+// IPOverrides returns the ip_override of every active subdomain that has
+// one, keyed by subdomain. Subdomains without an entry use the detected IP.
+func (g *Generator) IPOverrides() map[string]IPOverride {
+	mappings, err := g.collectMappings()
+	if err != nil {
+		g.collectedMu.Lock()
+		mappings = g.collected
+		g.collectedMu.Unlock()
+	}
+	overrides := make(map[string]IPOverride)
+	for _, m := range mappings {
+		if ipv4, ipv6, _ := mapping.ParseIPOverride(m.Options.IPOverride); ipv4 != "" || ipv6 != "" {
+			overrides[m.Subdomain] = IPOverride{IPv4: ipv4, IPv6: ipv6}
+		}
+	}
+	return overrides
+}
+
+// EffectiveMappings returns the merged YAML and discovered mappings the
+// Caddyfile is rendered from, after deduplication and MTProto exclusion.
+func (g *Generator) EffectiveMappings() ([]MappingData, error) {
+	return g.collectMappings()
+}
+
 // collectMappings gathers all mappings from both YAML files and discovery.
 // Services whose subdomain is claimed by an MTProto binding are omitted:
 // those are rendered by the MTProto site block instead, so they'd otherwise
 // appear twice.
-func (g *Generator) collectMappings() []MappingData {
+//
+// Duplicate subdomains are resolved according to the configured
+// MappingConflictStrategy. Distinct subdomains that resolve to the same
+// FQDN (e.g. "app" and "app-home.example.com" in prefix mode) are
+// duplicates too, resolved the same way. With ConflictError any duplicate
+// is returned as an error so the caller keeps the previous Caddyfile.
+func (g *Generator) collectMappings() ([]MappingData, error) {
 	seen := make(map[string]bool)
+	seenFQDNs := make(map[string]string)
 	var result []MappingData
+	var conflicts []string
 
 	mtprotoClaimed := g.mtprotoBoundLabels()
+	strategy := g.cfg.MappingConflictStrategy
+
+	// YAML FQDNs are needed up front when mappings take priority, so
+	// discovered services can yield to them without losing their position.
+	yamlMappings := g.yamlMappings()
+	yamlFQDNs := make(map[string]bool, len(yamlMappings))
+	for _, m := range yamlMappings {
+		yamlFQDNs[g.fqdnKey(m.Subdomain)] = true
+	}
 
 	// First, add discovered services (higher priority)
 	g.mu.RLock()
 	for _, svc := range g.discoveredServices {
+		if mtprotoClaimed[svc.Subdomain] {
+			slog.Debug("Skipping discovered service: claimed by MTProto binding", "subdomain", svc.Subdomain)
+			continue
+		}
 		if seen[svc.Subdomain] {
 			slog.Warn("Duplicate subdomain in discovered services", "subdomain", svc.Subdomain)
+			conflicts = append(conflicts, svc.Subdomain)
 			continue
 		}
-		if mtprotoClaimed[svc.Subdomain] {
-			slog.Debug("Skipping discovered service: claimed by MTProto binding", "subdomain", svc.Subdomain)
+		key := g.fqdnKey(svc.Subdomain)
+		if strategy == config.ConflictMappingPriority && yamlFQDNs[key] {
+			slog.Debug("Skipping discovered service, subdomain overridden by YAML mapping", "subdomain", svc.Subdomain)
+			continue
+		}
+		if owner, ok := seenFQDNs[key]; ok {
+			slog.Warn("Subdomains resolve to the same FQDN, keeping the first",
+				"fqdn", key, "kept", owner, "skipped", svc.Subdomain)
+			conflicts = append(conflicts, svc.Subdomain)
 			continue
 		}
 		seen[svc.Subdomain] = true
+		seenFQDNs[key] = svc.Subdomain
+		ipOverride := svc.IPOverride
+		if _, _, err := mapping.ParseIPOverride(ipOverride); err != nil {
+			slog.Warn("Ignoring invalid IP override of discovered service", "subdomain", svc.Subdomain, "error", err)
+			ipOverride = ""
+		}
 		result = append(result, MappingData{
 			Subdomain: svc.Subdomain,
 			FQDN:      g.cfg.GetSubdomainFQDN(svc.Subdomain),
 			Target:    svc.GetTarget(),
-			Options: mapping.MappingOptions{
-				Websocket:  svc.Websocket,
-				HealthPath: svc.GetHealthPath(),
-			},
+			Options: g.withProxyDefaults(mapping.MappingOptions{
+				Websocket:     svc.Websocket,
+				HealthPath:    svc.GetHealthPath(),
+				DisableHealth: svc.DisableHealth,
+				IPOverride:    ipOverride,
+			}),
 			Direct: svc.Direct,
 		})
 	}
 	g.mu.RUnlock()
 
 	// Then, add YAML mappings (only if subdomain not already used)
-	if g.mappingMgr != nil {
-		for _, m := range g.mappingMgr.Get() {
-			if seen[m.Subdomain] {
-				slog.Debug("Skipping YAML mapping, subdomain used by discovered service", "subdomain", m.Subdomain)
-				continue
-			}
-			seen[m.Subdomain] = true
-			result = append(result, MappingData{
-				Subdomain: m.Subdomain,
-				FQDN:      g.cfg.GetSubdomainFQDN(m.Subdomain),
-				Target:    m.GetTarget(),
-				Options:   m.Options,
-			})
+	for _, m := range yamlMappings {
+		if seen[m.Subdomain] {
+			slog.Debug("Skipping YAML mapping, subdomain used by discovered service", "subdomain", m.Subdomain)
+			conflicts = append(conflicts, m.Subdomain)
+			continue
 		}
+		key := g.fqdnKey(m.Subdomain)
+		if owner, ok := seenFQDNs[key]; ok {
+			slog.Warn("Subdomains resolve to the same FQDN, keeping the first",
+				"fqdn", key, "kept", owner, "skipped", m.Subdomain)
+			conflicts = append(conflicts, m.Subdomain)
+			continue
+		}
+		seen[m.Subdomain] = true
+		seenFQDNs[key] = m.Subdomain
+		result = append(result, MappingData{
+			Subdomain: m.Subdomain,
+			FQDN:      g.cfg.GetSubdomainFQDN(m.Subdomain),
+			Target:    m.GetTarget(),
+			Options:   g.withProxyDefaults(m.Options),
+		})
 	}
 
-	return result
+	if strategy == config.ConflictError && len(conflicts) > 0 {
+		return nil, fmt.Errorf("conflicting mappings for subdomains %v (MAPPING_CONFLICT_STRATEGY=error)", conflicts)
+	}
+
+	g.collectedMu.Lock()
+	g.collected = result
+	g.collectedMu.Unlock()
+	return result, nil
+}
+
+// fqdnKey is the case-insensitive FQDN a subdomain resolves to, used to
+// detect distinct subdomains that collide on the same name.
+func (g *Generator) fqdnKey(subdomain string) string {
+	return strings.TrimSuffix(strings.ToLower(g.cfg.GetSubdomainFQDN(subdomain)), ".")
+}
+
+// withProxyDefaults fills the global reverse-proxy retry settings into opts
+// where the mapping does not set its own.
+func (g *Generator) withProxyDefaults(opts mapping.MappingOptions) mapping.MappingOptions {
+	if opts.LBTryDuration == "" {
+		opts.LBTryDuration = g.cfg.ProxyLBTryDuration
+	}
+	if opts.LBTryInterval == "" {
+		opts.LBTryInterval = g.cfg.ProxyLBTryInterval
+	}
+	opts.StripHeaders = g.stripHeaders(opts.StripHeaders)
+	return opts
+}
+
+// proxySetHeaders are set by the template on every proxied request. Caddy
+// applies header deletions after sets, so stripping one of them would
+// remove the value the template just set.
+var proxySetHeaders = []string{"X-Real-IP", "X-Forwarded-For", "X-Forwarded-Proto", "X-Forwarded-Host"}
+
+// stripHeaders merges the global STRIP_HEADERS with a mapping's own list,
+// dropping duplicates and entries that would remove a header the template
+// sets itself.
+func (g *Generator) stripHeaders(mappingHeaders []string) []string {
+	protected := proxySetHeaders
+	if g.cfg.RequestIDHeader != "" {
+		protected = append(append([]string(nil), proxySetHeaders...), g.cfg.RequestIDHeader)
+	}
+
+	var out []string
+	seen := make(map[string]bool)
+	for _, h := range append(append([]string(nil), g.cfg.StripHeaders...), mappingHeaders...) {
+		key := strings.ToLower(h)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if name, ok := stripsProtectedHeader(h, protected); ok {
+			slog.Warn("Ignoring strip header that would remove a proxy header set by dyndns",
+				"strip", h, "header", name)
+			continue
+		}
+		out = append(out, h)
+	}
+	return out
+}
+
+// stripsProtectedHeader reports whether the strip entry (optionally ending
+// in "*") matches one of the protected header names.
+func stripsProtectedHeader(strip string, protected []string) (string, bool) {
+	prefix, wildcard := strings.CutSuffix(strings.ToLower(strip), "*")
+	for _, name := range protected {
+		lower := strings.ToLower(name)
+		if lower == prefix || (wildcard && strings.HasPrefix(lower, prefix)) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// Reload asks Caddy to reload its configuration, e.g. after a file the
+// Caddyfile references has changed without the Caddyfile itself changing.
+func (g *Generator) Reload() error {
+	return g.reloadWithHooks()
 }
 
 func (g *Generator) reloadCaddy() error {
@@ -307,6 +307,60 @@ func TestTemplateWebsocketForcesHTTP1(t *testing.T) {
 	}
 }
 
+// TestTemplateWebsocketUpgradeHeaders verifies websocket services pass the
+// upgrade headers through explicitly and report https to the backend, also
+// when the proxy headers would otherwise come from the shared snippet, while
+// other services keep the regular headers.
+func TestTemplateWebsocketUpgradeHeaders(t *testing.T) {
+	wsHeaders := []string{
+		"header_up Connection {>Connection}",
+		"header_up Upgrade {>Upgrade}",
+		"header_up X-Forwarded-Proto https",
+	}
+	for _, shared := range []bool{false, true} {
+		cfg := &config.Config{
+			Domain:              "example.com",
+			AcmeEmail:           "admin@example.com",
+			LogLevel:            "info",
+			CloudflareProxy:     true,
+			CaddySharedSnippets: shared,
+		}
+		g := newGeneratorWithDefaults(t, cfg)
+		g.UpdateDiscoveredServices([]discovery.Service{
+			{Subdomain: "chat", Port: 8080, Websocket: true},
+			{Subdomain: "livedirect", Port: 8081, Websocket: true, Direct: true},
+			{Subdomain: "plain", Port: 9090},
+		})
+
+		content, err := g.GenerateContent()
+		if err != nil {
+			t.Fatalf("GenerateContent: %v", err)
+		}
+
+		for _, marker := range []string{"handle @chat {", "livedirect.example.com {"} {
+			block := blockAfter(t, content, marker)
+			for _, want := range wsHeaders {
+				if !strings.Contains(block, want) {
+					t.Errorf("shared=%v: %s block missing %q:\n%s", shared, marker, want, block)
+				}
+			}
+			if strings.Contains(block, "X-Forwarded-Proto {scheme}") || strings.Contains(block, "import dyndns_proxy_headers") {
+				t.Errorf("shared=%v: %s block still forwards the request scheme:\n%s", shared, marker, block)
+			}
+		}
+
+		plain := blockAfter(t, content, "handle @plain {")
+		for _, unwanted := range wsHeaders {
+			if strings.Contains(plain, unwanted) {
+				t.Errorf("shared=%v: non-websocket block has %q:\n%s", shared, unwanted, plain)
+			}
+		}
+		if shared != strings.Contains(plain, "import dyndns_proxy_headers") {
+			t.Errorf("shared=%v: unexpected proxy headers in non-websocket block:\n%s", shared, plain)
+		}
+	}
+}
+
 // Test file permissions
 func TestCaddyfile_Permissions(t *testing.T) {
 	tmpDir := t.TempDir()
@@ -362,3 +416,42 @@ handle @{{.Subdomain}} {
 		_ = strings.ReplaceAll(tmplContent, "{{.Domain}}", data.Domain)
 	}
 }
+
+// TestGenerateContent_DisableHealthOmitsHealthURI verifies that a mapping
+// with DisableHealth renders no health_uri, while others keep the default.
+func TestGenerateContent_DisableHealthOmitsHealthURI(t *testing.T) {
+	for _, direct := range []bool{false, true} {
+		cfg := &config.Config{
+			Domain:          "example.com",
+			AcmeEmail:       "admin@example.com",
+			LogLevel:        "info",
+			CloudflareProxy: true,
+		}
+		g := newGeneratorWithDefaults(t, cfg)
+		g.UpdateDiscoveredServices([]discovery.Service{
+			{Subdomain: "nohealth", Port: 8080, DisableHealth: true, Direct: direct},
+			{Subdomain: "checked", Port: 9090, HealthCheck: "/ready"},
+		})
+
+		content, err := g.GenerateContent()
+		if err != nil {
+			t.Fatalf("GenerateContent: %v", err)
+		}
+
+		var block string
+		if direct {
+			block = blockAfter(t, content, "nohealth.example.com {")
+		} else {
+			block = blockAfter(t, content, "handle @nohealth {")
+		}
+		if strings.Contains(block, "health_uri") {
+			t.Errorf("direct=%v: health-disabled mapping rendered health_uri:\n%s", direct, block)
+		}
+		if !strings.Contains(block, "reverse_proxy 127.0.0.1:8080") {
+			t.Errorf("direct=%v: health-disabled mapping lost its upstream:\n%s", direct, block)
+		}
+		if !strings.Contains(blockAfter(t, content, "handle @checked {"), "health_uri /ready") {
+			t.Errorf("direct=%v: default health check missing for other mapping:\n%s", direct, content)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package caddy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/mapping"
+)
+
+// TestGenerate_HealthCheckDirectives verifies a mapping's active and
+// passive health check options render in its reverse_proxy block, while
+// other mappings keep the default active checks and no passive ones.
+func TestGenerate_HealthCheckDirectives(t *testing.T) {
+	mappingsPath := filepath.Join(t.TempDir(), "mappings.yaml")
+	yaml := `mappings:
+  - subdomain: tuned
+    target: "tuned:8080"
+    options:
+      health_path: /ready
+      health_interval: 10s
+      health_timeout: 2s
+      fail_duration: 30s
+      max_fails: 3
+`
+	if err := os.WriteFile(mappingsPath, []byte(yaml), 0644); err != nil {
+		t.Fatalf("write mappings: %v", err)
+	}
+	mgr := mapping.New(mappingsPath)
+	if err := mgr.Load(); err != nil {
+		t.Fatalf("load mappings: %v", err)
+	}
+
+	for _, perSite := range []bool{false, true} {
+		g := newGeneratorWithDefaults(t, &config.Config{
+			Domain:          "example.com",
+			AcmeEmail:       "admin@example.com",
+			LogLevel:        "info",
+			CloudflareProxy: true,
+			CaddyPerSite:    perSite,
+		})
+		g.mappingMgr = mgr
+		g.UpdateDiscoveredServices([]discovery.Service{
+			{Subdomain: "app", Port: 8080},
+			{Subdomain: "direct", Port: 7070, Direct: true},
+		})
+
+		content, err := g.GenerateContent()
+		if err != nil {
+			t.Fatalf("GenerateContent: %v", err)
+		}
+
+		tuned := blockAfter(t, content, "handle @tuned {")
+		for _, want := range []string{
+			"health_uri /ready",
+			"health_interval 10s",
+			"health_timeout 2s",
+			"fail_duration 30s",
+			"max_fails 3",
+		} {
+			if !strings.Contains(tuned, want) {
+				t.Errorf("per_site=%v: tuned block missing %q:\n%s", perSite, want, tuned)
+			}
+		}
+
+		for _, marker := range []string{"handle @app {", "direct.example.com {"} {
+			block := blockAfter(t, content, marker)
+			for _, want := range []string{"health_interval 30s", "health_timeout 5s"} {
+				if !strings.Contains(block, want) {
+					t.Errorf("per_site=%v: %s block missing default %q:\n%s", perSite, marker, want, block)
+				}
+			}
+			for _, unwanted := range []string{"fail_duration", "max_fails"} {
+				if strings.Contains(block, unwanted) {
+					t.Errorf("per_site=%v: %s block renders %q without configuration:\n%s", perSite, marker, unwanted, block)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package caddy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/mapping"
+)
+
+// TestGenerate_LBTryDirectives verifies the global PROXY_LB_TRY_* defaults
+// render in every reverse_proxy block and that a mapping's own options
+// override them.
+func TestGenerate_LBTryDirectives(t *testing.T) {
+	dir := t.TempDir()
+	mappingsPath := filepath.Join(dir, "mappings.yaml")
+	yaml := `mappings:
+  - subdomain: flaky
+    target: "flaky:8080"
+    options:
+      lb_try_duration: 30s
+      lb_try_interval: 1s
+`
+	if err := os.WriteFile(mappingsPath, []byte(yaml), 0644); err != nil {
+		t.Fatalf("write mappings: %v", err)
+	}
+	mgr := mapping.New(mappingsPath)
+	if err := mgr.Load(); err != nil {
+		t.Fatalf("load mappings: %v", err)
+	}
+
+	cfg := &config.Config{
+		Domain:             "example.com",
+		AcmeEmail:          "admin@example.com",
+		LogLevel:           "info",
+		ProxyLBTryDuration: "5s",
+		ProxyLBTryInterval: "250ms",
+	}
+	g := newGeneratorWithDefaults(t, cfg)
+	g.mappingMgr = mgr
+	g.UpdateDiscoveredServices([]discovery.Service{
+		{Subdomain: "app", Port: 8080},
+		{Subdomain: "direct", Port: 7070, Direct: true},
+	})
+
+	content, err := g.GenerateContent()
+	if err != nil {
+		t.Fatalf("GenerateContent: %v", err)
+	}
+
+	for _, marker := range []string{"handle @app {", "direct.example.com {"} {
+		block := blockAfter(t, content, marker)
+		for _, want := range []string{"lb_try_duration 5s", "lb_try_interval 250ms"} {
+			if !strings.Contains(block, want) {
+				t.Errorf("%s block missing %q:\n%s", marker, want, block)
+			}
+		}
+	}
+
+	flaky := blockAfter(t, content, "handle @flaky {")
+	for _, want := range []string{"lb_try_duration 30s", "lb_try_interval 1s"} {
+		if !strings.Contains(flaky, want) {
+			t.Errorf("flaky block missing per-mapping %q:\n%s", want, flaky)
+		}
+	}
+	if strings.Contains(flaky, "lb_try_duration 5s") {
+		t.Errorf("flaky block should not use the global default:\n%s", flaky)
+	}
+}
+
+// TestGenerate_LBTryDisabledByDefault guards the default: no retry
+// directives unless configured.
+func TestGenerate_LBTryDisabledByDefault(t *testing.T) {
+	cfg := &config.Config{
+		Domain:    "example.com",
+		AcmeEmail: "admin@example.com",
+		LogLevel:  "info",
+	}
+	g := newGeneratorWithDefaults(t, cfg)
+	g.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "app", Port: 8080}})
+
+	content, err := g.GenerateContent()
+	if err != nil {
+		t.Fatalf("GenerateContent: %v", err)
+	}
+	if strings.Contains(content, "lb_try_") {
+		t.Errorf("lb_try directives rendered without configuration:\n%s", content)
+	}
+}
@@ -0,0 +1,134 @@
+package caddy
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+)
+
+// TestGenerate_MapMode verifies CADDY_MAP_MODE routes every plain
+// proxy-mode subdomain through the host map with its target, while a
+// websocket subdomain keeps its own handle block and direct subdomains
+// stay out of the combined site.
+func TestGenerate_MapMode(t *testing.T) {
+	g := newGeneratorWithDefaults(t, &config.Config{
+		Domain:          "example.com",
+		AcmeEmail:       "admin@example.com",
+		LogLevel:        "info",
+		CloudflareProxy: true,
+		CaddyMapMode:    true,
+	})
+	g.UpdateDiscoveredServices([]discovery.Service{
+		{Subdomain: "app", Port: 8080},
+		{Subdomain: "api", Port: 9090},
+		{Subdomain: "wiki", Port: 3000},
+		{Subdomain: "chat", Port: 7000, Websocket: true},
+		{Subdomain: "git", Port: 2222, Direct: true},
+	})
+
+	content, err := g.GenerateContent()
+	if err != nil {
+		t.Fatalf("GenerateContent: %v", err)
+	}
+	site := blockAfter(t, content, "*.example.com, example.com {")
+
+	table := blockAfter(t, site, "map {host} {dyndns_upstream} {")
+	var entries []string
+	for _, line := range strings.Split(table, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			entries = append(entries, line)
+		}
+	}
+	slices.Sort(entries)
+	want := []string{
+		"api.example.com 127.0.0.1:9090",
+		"app.example.com 127.0.0.1:8080",
+		"wiki.example.com 127.0.0.1:3000",
+	}
+	if strings.Join(entries, "\n") != strings.Join(want, "\n") {
+		t.Errorf("map entries = %q, want %q", entries, want)
+	}
+
+	proxy := blockAfter(t, site, "reverse_proxy {dyndns_upstream} {")
+	for _, directive := range []string{"flush_interval -1", "header_up X-Forwarded-Host {host}"} {
+		if !strings.Contains(proxy, directive) {
+			t.Errorf("map reverse_proxy missing %q:\n%s", directive, proxy)
+		}
+	}
+	if !strings.Contains(site, `@dyndns_mapped not vars {dyndns_upstream} ""`) {
+		t.Errorf("site missing the mapped-host matcher:\n%s", site)
+	}
+
+	for _, sub := range []string{"app", "api", "wiki"} {
+		if strings.Contains(site, "@"+sub+" host") {
+			t.Errorf("mapped subdomain %s still has a handle block", sub)
+		}
+	}
+	if !strings.Contains(site, "@chat host chat.example.com") {
+		t.Errorf("websocket subdomain lost its handle block:\n%s", site)
+	}
+	if strings.Contains(table, "git.example.com") || strings.Contains(table, "chat.example.com") {
+		t.Errorf("map includes a direct or websocket subdomain:\n%s", table)
+	}
+}
+
+// TestGenerate_MapModeHealthOptions verifies a subdomain with its own
+// health check path keeps its handle block and active health checks in
+// map mode, while one with health checks disabled is mapped.
+func TestGenerate_MapModeHealthOptions(t *testing.T) {
+	g := newGeneratorWithDefaults(t, &config.Config{
+		Domain:          "example.com",
+		AcmeEmail:       "admin@example.com",
+		LogLevel:        "info",
+		CloudflareProxy: true,
+		CaddyMapMode:    true,
+	})
+	g.UpdateDiscoveredServices([]discovery.Service{
+		{Subdomain: "app", Port: 8080},
+		{Subdomain: "db", Port: 5000, HealthCheck: "/ready"},
+		{Subdomain: "static", Port: 6000, DisableHealth: true},
+	})
+
+	content, err := g.GenerateContent()
+	if err != nil {
+		t.Fatalf("GenerateContent: %v", err)
+	}
+	site := blockAfter(t, content, "*.example.com, example.com {")
+	table := blockAfter(t, site, "map {host} {dyndns_upstream} {")
+
+	if strings.Contains(table, "db.example.com") {
+		t.Errorf("map includes the health-checked subdomain:\n%s", table)
+	}
+	for _, fqdn := range []string{"app.example.com", "static.example.com"} {
+		if !strings.Contains(table, fqdn) {
+			t.Errorf("map missing %s:\n%s", fqdn, table)
+		}
+	}
+
+	handle := blockAfter(t, site, "handle @db {")
+	if !strings.Contains(handle, "health_uri /ready") {
+		t.Errorf("health-checked subdomain lost its health checks:\n%s", handle)
+	}
+}
+
+// TestGenerate_MapModeOff verifies the default layout renders no map.
+func TestGenerate_MapModeOff(t *testing.T) {
+	g := newGeneratorWithDefaults(t, &config.Config{
+		Domain:          "example.com",
+		AcmeEmail:       "admin@example.com",
+		LogLevel:        "info",
+		CloudflareProxy: true,
+	})
+	g.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "app", Port: 8080}})
+
+	content, err := g.GenerateContent()
+	if err != nil {
+		t.Fatalf("GenerateContent: %v", err)
+	}
+	if strings.Contains(content, "map {host}") || !strings.Contains(content, "@app host app.example.com") {
+		t.Errorf("default layout changed:\n%s", content)
+	}
+}
@@ -0,0 +1,77 @@
+package caddy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/mapping"
+)
+
+// TestGenerate_MatchOption verifies a mapping's match option renders in the
+// same named matcher as its host, so both must hold, while other mappings
+// keep the plain host matcher.
+func TestGenerate_MatchOption(t *testing.T) {
+	mappingsPath := filepath.Join(t.TempDir(), "mappings.yaml")
+	content := `
+mappings:
+  - subdomain: app
+    target: "app:8080"
+    options:
+      match: header X-Env staging
+  - subdomain: api
+    target: "api:9090"
+    options:
+      match: not query debug=*
+  - subdomain: wiki
+    target: "wiki:3000"
+`
+	if err := os.WriteFile(mappingsPath, []byte(content), 0644); err != nil {
+		t.Fatalf("write mappings: %v", err)
+	}
+	mgr := mapping.New(mappingsPath)
+	if err := mgr.Load(); err != nil {
+		t.Fatalf("load mappings: %v", err)
+	}
+
+	g := newGeneratorWithDefaults(t, &config.Config{
+		Domain:          "example.com",
+		AcmeEmail:       "admin@example.com",
+		LogLevel:        "info",
+		CloudflareProxy: true,
+		CaddyMapMode:    true,
+	})
+	g.mappingMgr = mgr
+
+	content, err := g.GenerateContent()
+	if err != nil {
+		t.Fatalf("GenerateContent: %v", err)
+	}
+
+	for sub, want := range map[string][]string{
+		"app": {"host app.example.com", "header X-Env staging"},
+		"api": {"host api.example.com", "not query debug=*"},
+	} {
+		matcher := blockAfter(t, content, "@"+sub+" {")
+		var lines []string
+		for _, line := range strings.Split(matcher, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				lines = append(lines, line)
+			}
+		}
+		if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+			t.Errorf("@%s matcher = %q, want %q", sub, lines, want)
+		}
+		if !strings.Contains(content, "handle @"+sub+" {") {
+			t.Errorf("no handle block for @%s", sub)
+		}
+	}
+
+	// Without a match option the subdomain stays in the host map.
+	if table := blockAfter(t, content, "map {host} {dyndns_upstream} {"); !strings.Contains(table, "wiki.example.com") ||
+		strings.Contains(table, "app.example.com") || strings.Contains(table, "api.example.com") {
+		t.Errorf("map entries = %q, want only wiki", table)
+	}
+}
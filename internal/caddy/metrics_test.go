@@ -0,0 +1,55 @@
+package caddy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+)
+
+// TestGenerate_AdminAndMetrics verifies the admin address and the internal
+// metrics site render as configured, and neither renders when unset.
+func TestGenerate_AdminAndMetrics(t *testing.T) {
+	g := newGeneratorWithDefaults(t, &config.Config{
+		Domain:           "example.com",
+		AcmeEmail:        "admin@example.com",
+		LogLevel:         "info",
+		CloudflareProxy:  true,
+		CaddyAdmin:       "http://127.0.0.1:2020",
+		CaddyMetricsAddr: "10.8.0.1:9180",
+	})
+	content, err := g.GenerateContent()
+	if err != nil {
+		t.Fatalf("GenerateContent: %v", err)
+	}
+
+	globals := content[:strings.Index(content, "\n}\n")]
+	for _, want := range []string{"admin 127.0.0.1:2020", "\n    metrics\n"} {
+		if !strings.Contains(globals, want) {
+			t.Errorf("global options missing %q:\n%s", want, globals)
+		}
+	}
+
+	site := blockAfter(t, content, "\nhttp://:9180 {")
+	for _, want := range []string{"bind 10.8.0.1", "metrics /metrics"} {
+		if !strings.Contains(site, want) {
+			t.Errorf("metrics site missing %q:\n%s", want, site)
+		}
+	}
+	if strings.Contains(site, "reverse_proxy") {
+		t.Errorf("metrics site should not proxy:\n%s", site)
+	}
+
+	g = newGeneratorWithDefaults(t, &config.Config{
+		Domain:    "example.com",
+		AcmeEmail: "admin@example.com",
+		LogLevel:  "info",
+	})
+	content, err = g.GenerateContent()
+	if err != nil {
+		t.Fatalf("GenerateContent: %v", err)
+	}
+	if strings.Contains(content, "admin ") || strings.Contains(content, "metrics") {
+		t.Errorf("admin/metrics rendered without configuration:\n%s", content)
+	}
+}
@@ -0,0 +1,69 @@
+package caddy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+)
+
+// TestGenerate_OnDemandTLS verifies CADDY_ON_DEMAND_TLS renders the global
+// on_demand_tls ask endpoint and marks per-host sites on_demand, while the
+// combined wildcard site keeps its up-front certificate.
+func TestGenerate_OnDemandTLS(t *testing.T) {
+	for _, perSite := range []bool{false, true} {
+		g := newGeneratorWithDefaults(t, &config.Config{
+			Domain:           "example.com",
+			AcmeEmail:        "admin@example.com",
+			LogLevel:         "info",
+			CaddyOnDemandTLS: true,
+			CaddyPerSite:     perSite,
+		})
+		g.UpdateDiscoveredServices([]discovery.Service{
+			{Subdomain: "app", Port: 8080},
+			{Subdomain: "direct", Port: 7070, Direct: true},
+		})
+
+		content, err := g.GenerateContent()
+		if err != nil {
+			t.Fatalf("GenerateContent: %v", err)
+		}
+
+		globals := content[:strings.Index(content, "\n}")]
+		if !strings.Contains(globals, "on_demand_tls {\n        ask http://127.0.0.1:8081/tls/ask\n    }") {
+			t.Errorf("perSite=%v: globals missing on_demand_tls ask:\n%s", perSite, globals)
+		}
+
+		if direct := blockAfter(t, content, "direct.example.com {"); !strings.Contains(direct, "on_demand\n") {
+			t.Errorf("perSite=%v: direct site not on_demand:\n%s", perSite, direct)
+		}
+
+		if perSite {
+			if app := blockAfter(t, content, "\napp.example.com {"); !strings.Contains(app, "on_demand\n") {
+				t.Errorf("per-site proxy site not on_demand:\n%s", app)
+			}
+		} else if wildcard := blockAfter(t, content, "*.example.com, example.com {"); strings.Contains(wildcard, "on_demand\n") {
+			t.Errorf("wildcard site should not be on_demand:\n%s", wildcard)
+		}
+	}
+}
+
+// TestGenerate_OnDemandTLSDisabledByDefault guards the default: no
+// on-demand issuance unless configured.
+func TestGenerate_OnDemandTLSDisabledByDefault(t *testing.T) {
+	g := newGeneratorWithDefaults(t, &config.Config{
+		Domain:    "example.com",
+		AcmeEmail: "admin@example.com",
+		LogLevel:  "info",
+	})
+	g.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "direct", Port: 7070, Direct: true}})
+
+	content, err := g.GenerateContent()
+	if err != nil {
+		t.Fatalf("GenerateContent: %v", err)
+	}
+	if strings.Contains(content, "on_demand") {
+		t.Errorf("on_demand rendered without configuration:\n%s", content)
+	}
+}
@@ -0,0 +1,67 @@
+package caddy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+)
+
+// TestGenerate_OriginCertReplacesACME verifies that ORIGIN_CERT/ORIGIN_KEY
+// render a static tls directive on the wildcard site (keeping origin mTLS),
+// while direct-mode sites still use the ACME DNS challenge.
+func TestGenerate_OriginCertReplacesACME(t *testing.T) {
+	cfg := &config.Config{
+		Domain:            "example.com",
+		AcmeEmail:         "admin@example.com",
+		LogLevel:          "info",
+		CloudflareProxy:   true,
+		CloudflareSSLMode: "strict",
+		OriginCert:        "/etc/cloudflare/origin.pem",
+		OriginKey:         "/etc/cloudflare/origin-key.pem",
+	}
+	g := newGeneratorWithDefaults(t, cfg)
+	g.UpdateDiscoveredServices([]discovery.Service{
+		{Subdomain: "app", Port: 8080},
+		{Subdomain: "direct", Port: 7070, Direct: true},
+	})
+
+	content, err := g.GenerateContent()
+	if err != nil {
+		t.Fatalf("GenerateContent: %v", err)
+	}
+
+	wildcard := blockAfter(t, content, "*.example.com, example.com {")
+	if !strings.Contains(wildcard, "tls /etc/cloudflare/origin.pem /etc/cloudflare/origin-key.pem {") {
+		t.Errorf("wildcard site should serve the static origin cert:\n%s", wildcard)
+	}
+	if strings.Contains(wildcard, "dns cloudflare") {
+		t.Errorf("wildcard site should not use the ACME DNS challenge with an origin cert:\n%s", wildcard)
+	}
+	if !strings.Contains(wildcard, "client_auth") {
+		t.Errorf("origin mTLS must still apply in proxy mode:\n%s", wildcard)
+	}
+
+	direct := blockAfter(t, content, "direct.example.com {")
+	if !strings.Contains(direct, "dns cloudflare") {
+		t.Errorf("direct-mode site should keep its ACME certificate:\n%s", direct)
+	}
+}
+
+// TestGenerate_NoOriginCertUsesACME guards the default ACME wildcard cert.
+func TestGenerate_NoOriginCertUsesACME(t *testing.T) {
+	cfg := &config.Config{
+		Domain:    "example.com",
+		AcmeEmail: "admin@example.com",
+		LogLevel:  "info",
+	}
+	content, err := newGeneratorWithDefaults(t, cfg).GenerateContent()
+	if err != nil {
+		t.Fatalf("GenerateContent: %v", err)
+	}
+	wildcard := blockAfter(t, content, "*.example.com, example.com {")
+	if !strings.Contains(wildcard, "dns cloudflare") {
+		t.Errorf("wildcard site should use the ACME DNS challenge by default:\n%s", wildcard)
+	}
+}
@@ -0,0 +1,70 @@
+package caddy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+)
+
+// TestGenerate_PerSite verifies CADDY_PER_SITE renders one site block per
+// proxy-mode subdomain, each with the same TLS and proxy directives, plus a
+// site for the bare domain, and no combined wildcard site.
+func TestGenerate_PerSite(t *testing.T) {
+	g := newGeneratorWithDefaults(t, &config.Config{
+		Domain:          "example.com",
+		AcmeEmail:       "admin@example.com",
+		LogLevel:        "info",
+		CloudflareProxy: true,
+		CaddyPerSite:    true,
+	})
+	services := []discovery.Service{
+		{Subdomain: "app", Port: 8080},
+		{Subdomain: "api", Port: 9090},
+		{Subdomain: "wiki", Port: 3000},
+	}
+	g.UpdateDiscoveredServices(services)
+
+	content, err := g.GenerateContent()
+	if err != nil {
+		t.Fatalf("GenerateContent: %v", err)
+	}
+
+	if strings.Contains(content, "*.example.com") {
+		t.Errorf("per-site mode rendered the combined wildcard site:\n%s", content)
+	}
+
+	for _, svc := range services {
+		host := svc.Subdomain + ".example.com"
+		if n := strings.Count(content, "\n"+host+" {"); n != 1 {
+			t.Errorf("site block for %s rendered %d times, want 1", host, n)
+			continue
+		}
+		block := blockAfter(t, content, "\n"+host+" {")
+		for _, want := range []string{
+			"dns cloudflare {env.CLOUDFLARE_API_TOKEN}",
+			"trusted_ca_cert_file /etc/cloudflare/origin-pull-ca.pem",
+			"@" + svc.Subdomain + " host " + host,
+			"reverse_proxy " + svc.GetTarget(),
+			"header_up X-Forwarded-Host {host}",
+		} {
+			if !strings.Contains(block, want) {
+				t.Errorf("%s block missing %q:\n%s", host, want, block)
+			}
+		}
+		for _, other := range services {
+			if other.Subdomain != svc.Subdomain && strings.Contains(block, "@"+other.Subdomain+" ") {
+				t.Errorf("%s block routes %s:\n%s", host, other.Subdomain, block)
+			}
+		}
+	}
+
+	apex := blockAfter(t, content, "\nexample.com {")
+	if strings.Contains(apex, "reverse_proxy") {
+		t.Errorf("bare domain site should not proxy:\n%s", apex)
+	}
+	if !strings.Contains(apex, "451") {
+		t.Errorf("bare domain site should answer 451:\n%s", apex)
+	}
+}
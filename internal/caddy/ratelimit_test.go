@@ -0,0 +1,100 @@
+package caddy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/mapping"
+)
+
+// TestGenerate_RateLimit verifies a path-scoped rate_limit renders inside
+// the subdomain's handle block under the path matcher, a rate_limit
+// without a path covers the whole subdomain, and the handler is ordered
+// in the globals.
+func TestGenerate_RateLimit(t *testing.T) {
+	mappingsPath := filepath.Join(t.TempDir(), "mappings.yaml")
+	content := `
+mappings:
+  - subdomain: app
+    target: "app:8080"
+    options:
+      rate_limit:
+        events: 5
+        window: 1m
+        path: /login
+  - subdomain: api
+    target: "api:9090"
+    options:
+      rate_limit:
+        events: 100
+        window: 10s
+  - subdomain: wiki
+    target: "wiki:3000"
+`
+	if err := os.WriteFile(mappingsPath, []byte(content), 0644); err != nil {
+		t.Fatalf("write mappings: %v", err)
+	}
+	mgr := mapping.New(mappingsPath)
+	if err := mgr.Load(); err != nil {
+		t.Fatalf("load mappings: %v", err)
+	}
+
+	g := newGeneratorWithDefaults(t, &config.Config{
+		Domain:          "example.com",
+		AcmeEmail:       "admin@example.com",
+		LogLevel:        "info",
+		CloudflareProxy: true,
+	})
+	g.mappingMgr = mgr
+
+	content, err := g.GenerateContent()
+	if err != nil {
+		t.Fatalf("GenerateContent: %v", err)
+	}
+	if !strings.Contains(content, "order rate_limit before basicauth") {
+		t.Error("globals do not order rate_limit")
+	}
+
+	app := blockAfter(t, content, "handle @app {")
+	zone := blockAfter(t, app, "rate_limit /login {")
+	for _, directive := range []string{
+		"zone dyndns_app {",
+		"key {http.request.header.CF-Connecting-IP}",
+		"events 5",
+		"window 1m",
+	} {
+		if !strings.Contains(zone, directive) {
+			t.Errorf("app rate_limit missing %q:\n%s", directive, zone)
+		}
+	}
+
+	api := blockAfter(t, content, "handle @api {")
+	zone = blockAfter(t, api, "rate_limit {")
+	if !strings.Contains(zone, "zone dyndns_api {") || !strings.Contains(zone, "events 100") || !strings.Contains(zone, "window 10s") {
+		t.Errorf("api rate_limit does not cover the subdomain:\n%s", zone)
+	}
+
+	if wiki := blockAfter(t, content, "handle @wiki {"); strings.Contains(wiki, "rate_limit") {
+		t.Errorf("wiki has a rate_limit without the option:\n%s", wiki)
+	}
+}
+
+// TestGenerate_NoRateLimit verifies the globals leave rate_limit unordered
+// when no mapping uses it, so a Caddy without the plugin still loads.
+func TestGenerate_NoRateLimit(t *testing.T) {
+	g := newGeneratorWithDefaults(t, &config.Config{
+		Domain:    "example.com",
+		AcmeEmail: "admin@example.com",
+		LogLevel:  "info",
+	})
+	content, err := g.GenerateContent()
+	if err != nil {
+		t.Fatalf("GenerateContent: %v", err)
+	}
+	if strings.Contains(content, "rate_limit") {
+		t.Errorf("content mentions rate_limit without a rate-limited mapping:\n%s", content)
+	}
+}
@@ -0,0 +1,57 @@
+package caddy
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// reloadWithHooks reloads Caddy between PRE_RELOAD_CMD and POST_RELOAD_CMD.
+// The post command only runs after a successful reload.
+func (g *Generator) reloadWithHooks() error {
+	g.runReloadCmd("pre", g.cfg.PreReloadCmd)
+	if err := g.reload(); err != nil {
+		return err
+	}
+	g.runReloadCmd("post", g.cfg.PostReloadCmd)
+	return nil
+}
+
+// runReloadCmd runs a reload hook through the shell with RELOAD_CMD_TIMEOUT,
+// passing the Caddyfile path and the phase in the environment. A failure is
+// logged and otherwise ignored.
+func (g *Generator) runReloadCmd(phase, command string) {
+	if command == "" {
+		return
+	}
+	timeout := g.cfg.ReloadCmdTimeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	cmd.Env = append(os.Environ(),
+		"DYNDNS_CADDYFILE="+g.cfg.CaddyFile,
+		"DYNDNS_RELOAD_PHASE="+phase,
+	)
+	// A background child holding the output open must not block us past
+	// the timeout.
+	cmd.WaitDelay = time.Second
+
+	start := time.Now()
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = ctx.Err()
+		}
+		slog.Warn("Reload command failed", "phase", phase, "command", command,
+			"timeout", timeout, "error", err, "output", strings.TrimSpace(string(output)))
+		return
+	}
+	slog.Debug("Reload command finished", "phase", phase, "command", command, "duration", time.Since(start))
+}
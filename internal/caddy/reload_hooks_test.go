@@ -0,0 +1,96 @@
+package caddy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+)
+
+// TestGenerate_ReloadCommands verifies PRE_RELOAD_CMD runs with the new
+// Caddyfile in place before the reload and POST_RELOAD_CMD after it, both
+// with the Caddyfile path and phase in the environment.
+func TestGenerate_ReloadCommands(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "hooks.log")
+	hook := `echo "$DYNDNS_RELOAD_PHASE $DYNDNS_CADDYFILE $(cat "$DYNDNS_CADDYFILE")" >> ` + out
+	cfg := &config.Config{
+		Domain:           "example.com",
+		CaddyFile:        filepath.Join(dir, "Caddyfile"),
+		PreReloadCmd:     hook,
+		PostReloadCmd:    hook,
+		ReloadCmdTimeout: 10 * time.Second,
+	}
+	g := New(cfg, nil)
+	g.TemplateContent = "{{range .Mappings}}{{.FQDN}}{{end}}"
+	g.reload = func() error {
+		f, err := os.OpenFile(out, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = f.WriteString("reload\n")
+		return err
+	}
+
+	g.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "app", Port: 8080}})
+	if err := g.Generate(); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	// An unchanged Caddyfile is not reloaded, so the hooks don't run.
+	if err := g.Generate(); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("read hook log: %v", err)
+	}
+	want := "pre " + cfg.CaddyFile + " app.example.com\n" +
+		"reload\n" +
+		"post " + cfg.CaddyFile + " app.example.com\n"
+	if string(got) != want {
+		t.Errorf("hook log =\n%s\nwant\n%s", got, want)
+	}
+}
+
+// TestGenerate_ReloadCommandFailures verifies a failing or hanging hook is
+// logged without aborting, and POST_RELOAD_CMD is skipped when the reload
+// fails.
+func TestGenerate_ReloadCommandFailures(t *testing.T) {
+	dir := t.TempDir()
+	post := filepath.Join(dir, "post")
+	cfg := &config.Config{
+		Domain:           "example.com",
+		CaddyFile:        filepath.Join(dir, "Caddyfile"),
+		PreReloadCmd:     "sleep 5",
+		PostReloadCmd:    "touch " + post,
+		ReloadCmdTimeout: 100 * time.Millisecond,
+	}
+	g := New(cfg, nil)
+	g.TemplateContent = "{{range .Mappings}}{{.FQDN}}{{end}}"
+	reloads := 0
+	g.reload = func() error {
+		reloads++
+		return errors.New("caddy not running")
+	}
+
+	g.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "app", Port: 8080}})
+	start := time.Now()
+	if err := g.Generate(); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Generate took %v, the pre command should time out", elapsed)
+	}
+	if reloads != 1 {
+		t.Errorf("reloads = %d, want 1 after a failed pre command", reloads)
+	}
+	if _, err := os.Stat(post); !os.IsNotExist(err) {
+		t.Errorf("post command ran after a failed reload (stat err %v)", err)
+	}
+}
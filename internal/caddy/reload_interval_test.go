@@ -0,0 +1,82 @@
+package caddy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+)
+
+// TestGenerate_ReloadMinInterval verifies regenerations within
+// CADDY_RELOAD_MIN_INTERVAL of the last reload are coalesced into a single
+// reload at the end of the interval, rendering the latest services.
+func TestGenerate_ReloadMinInterval(t *testing.T) {
+	cfg := &config.Config{
+		Domain:                 "example.com",
+		CaddyFile:              filepath.Join(t.TempDir(), "Caddyfile"),
+		CaddyReloadMinInterval: time.Minute,
+	}
+	g := New(cfg, nil)
+	g.TemplateContent = "{{range .Mappings}}{{.FQDN}}\n{{end}}"
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	g.now = func() time.Time { return now }
+	var pending []func()
+	var waits []time.Duration
+	g.afterFunc = func(d time.Duration, f func()) {
+		waits = append(waits, d)
+		pending = append(pending, f)
+	}
+	reloads := 0
+	g.reload = func() error {
+		reloads++
+		return nil
+	}
+	caddyfile := func() string {
+		t.Helper()
+		content, err := os.ReadFile(cfg.CaddyFile)
+		if err != nil {
+			t.Fatalf("read Caddyfile: %v", err)
+		}
+		return string(content)
+	}
+
+	g.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "app", Port: 8080}})
+	if err := g.Generate(); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if reloads != 1 {
+		t.Fatalf("reloads = %d after the first generate, want 1", reloads)
+	}
+
+	// Two changes inside the interval: neither is written nor reloaded yet.
+	for _, services := range [][]discovery.Service{
+		{{Subdomain: "app", Port: 8080}, {Subdomain: "api", Port: 9090}},
+		{{Subdomain: "app", Port: 8080}, {Subdomain: "web", Port: 3000}},
+	} {
+		now = now.Add(10 * time.Second)
+		g.UpdateDiscoveredServices(services)
+		if err := g.Generate(); err != nil {
+			t.Fatalf("Generate: %v", err)
+		}
+	}
+	if reloads != 1 || caddyfile() != "app.example.com\n" {
+		t.Fatalf("reloads = %d, Caddyfile = %q; want the change deferred", reloads, caddyfile())
+	}
+	if len(pending) != 1 || waits[0] != 50*time.Second {
+		t.Fatalf("pending regenerations = %d (waits %v), want one after 50s", len(pending), waits)
+	}
+
+	// The pending regeneration applies the latest state in one reload.
+	now = now.Add(50 * time.Second)
+	pending[0]()
+	if reloads != 2 {
+		t.Errorf("reloads = %d, want 2", reloads)
+	}
+	if got := caddyfile(); got != "app.example.com\nweb.example.com\n" {
+		t.Errorf("Caddyfile = %q, want the latest services", got)
+	}
+}
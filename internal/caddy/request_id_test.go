@@ -0,0 +1,64 @@
+package caddy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+)
+
+// TestGenerate_RequestIDHeader verifies that REQUEST_ID_HEADER renders a
+// set-if-absent header_up with Caddy's request UUID on every proxied site,
+// inline or via the shared snippet.
+func TestGenerate_RequestIDHeader(t *testing.T) {
+	const directive = "header_up ?X-Correlation-ID {http.request.uuid}"
+
+	for _, shared := range []bool{false, true} {
+		cfg := &config.Config{
+			Domain:              "example.com",
+			AcmeEmail:           "admin@example.com",
+			LogLevel:            "info",
+			RequestIDHeader:     "X-Correlation-ID",
+			CaddySharedSnippets: shared,
+		}
+		g := newGeneratorWithDefaults(t, cfg)
+		g.UpdateDiscoveredServices([]discovery.Service{
+			{Subdomain: "app", Port: 8080},
+			{Subdomain: "direct", Port: 7070, Direct: true},
+		})
+
+		content, err := g.GenerateContent()
+		if err != nil {
+			t.Fatalf("GenerateContent: %v", err)
+		}
+
+		want := 2
+		if shared {
+			want = 1
+		}
+		if got := strings.Count(content, directive); got != want {
+			t.Errorf("shared=%v: %q rendered %d times, want %d:\n%s", shared, directive, got, want, content)
+		}
+	}
+}
+
+// TestGenerate_RequestIDHeaderDisabled guards the default: no request ID
+// directive unless configured.
+func TestGenerate_RequestIDHeaderDisabled(t *testing.T) {
+	cfg := &config.Config{
+		Domain:    "example.com",
+		AcmeEmail: "admin@example.com",
+		LogLevel:  "info",
+	}
+	g := newGeneratorWithDefaults(t, cfg)
+	g.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "app", Port: 8080}})
+
+	content, err := g.GenerateContent()
+	if err != nil {
+		t.Fatalf("GenerateContent: %v", err)
+	}
+	if strings.Contains(content, "{http.request.uuid}") {
+		t.Errorf("request ID directive rendered without REQUEST_ID_HEADER:\n%s", content)
+	}
+}
@@ -0,0 +1,77 @@
+package caddy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+)
+
+// TestGenerate_SharedSnippetsDefinedOnceAndImported verifies that with
+// CADDY_SHARED_SNIPPETS the common directives are defined once as snippets
+// and every site imports them instead of repeating the boilerplate.
+func TestGenerate_SharedSnippetsDefinedOnceAndImported(t *testing.T) {
+	cfg := &config.Config{
+		Domain:              "example.com",
+		AcmeEmail:           "admin@example.com",
+		LogLevel:            "info",
+		CatchallSubdomain:   "catchall",
+		CaddySharedSnippets: true,
+	}
+	g := newGeneratorWithDefaults(t, cfg)
+	g.UpdateDiscoveredServices([]discovery.Service{
+		{Subdomain: "app", Port: 8080},
+		{Subdomain: "api", Port: 9090},
+		{Subdomain: "direct", Port: 7070, Direct: true},
+	})
+
+	content, err := g.GenerateContent()
+	if err != nil {
+		t.Fatalf("GenerateContent: %v", err)
+	}
+
+	for _, def := range []string{"(dyndns_access_log) {", "(dyndns_proxy_headers) {"} {
+		if n := strings.Count(content, def); n != 1 {
+			t.Errorf("snippet %q defined %d times, want 1:\n%s", def, n, content)
+		}
+	}
+	if n := strings.Count(content, "header_up X-Real-IP"); n != 1 {
+		t.Errorf("header_up X-Real-IP appears %d times, want 1 (inside snippet only)", n)
+	}
+	if n := strings.Count(content, "format json"); n != 1 {
+		t.Errorf("access log block appears %d times, want 1 (inside snippet only)", n)
+	}
+
+	// One reverse_proxy per service, each importing the header snippet.
+	if got, want := strings.Count(content, "import dyndns_proxy_headers"), 3; got != want {
+		t.Errorf("import dyndns_proxy_headers count = %d, want %d", got, want)
+	}
+	// Direct site, catchall site and wildcard site each import the log.
+	if got, want := strings.Count(content, "import dyndns_access_log"), 3; got != want {
+		t.Errorf("import dyndns_access_log count = %d, want %d", got, want)
+	}
+}
+
+// TestGenerate_SharedSnippetsDisabledByDefault guards the default output:
+// no snippets, directives inlined per site.
+func TestGenerate_SharedSnippetsDisabledByDefault(t *testing.T) {
+	cfg := &config.Config{
+		Domain:    "example.com",
+		AcmeEmail: "admin@example.com",
+		LogLevel:  "info",
+	}
+	g := newGeneratorWithDefaults(t, cfg)
+	g.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "app", Port: 8080}})
+
+	content, err := g.GenerateContent()
+	if err != nil {
+		t.Fatalf("GenerateContent: %v", err)
+	}
+	if strings.Contains(content, "dyndns_proxy_headers") || strings.Contains(content, "import ") {
+		t.Errorf("snippets rendered without CaddySharedSnippets:\n%s", content)
+	}
+	if !strings.Contains(content, "header_up X-Real-IP {remote_host}") {
+		t.Errorf("inline proxy headers missing:\n%s", content)
+	}
+}
@@ -0,0 +1,72 @@
+package caddy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+)
+
+// TestGenerateContent_StatusTLS verifies the internal site proxies the
+// status routes over TLS once STATUS_TLS_CERT is set, presenting the status
+// certificate as client certificate when STATUS_TLS_CLIENT_CA requires one.
+func TestGenerateContent_StatusTLS(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      *config.Config
+		want     []string
+		unwanted []string
+	}{
+		{
+			name:     "plaintext",
+			cfg:      &config.Config{Domain: "example.com"},
+			want:     []string{"reverse_proxy 127.0.0.1:8081"},
+			unwanted: []string{"https://127.0.0.1:8081", "transport http"},
+		},
+		{
+			name: "tls",
+			cfg:  &config.Config{Domain: "example.com", StatusTLSCert: "/certs/status.pem", StatusTLSKey: "/certs/status.key"},
+			want: []string{
+				"reverse_proxy https://127.0.0.1:8081 {",
+				"transport http {",
+				"tls_insecure_skip_verify",
+			},
+			unwanted: []string{"reverse_proxy 127.0.0.1:8081", "tls_client_auth"},
+		},
+		{
+			name: "mtls",
+			cfg: &config.Config{Domain: "example.com", StatusTLSCert: "/certs/status.pem", StatusTLSKey: "/certs/status.key",
+				StatusTLSClientCA: "/certs/clients.pem"},
+			want: []string{
+				"reverse_proxy https://127.0.0.1:8081 {",
+				"tls_client_auth /certs/status.pem /certs/status.key",
+			},
+			unwanted: []string{"reverse_proxy 127.0.0.1:8081"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, err := newGeneratorWithDefaults(t, tt.cfg).GenerateContent()
+			if err != nil {
+				t.Fatalf("GenerateContent: %v", err)
+			}
+			if err := validateContent(content); err != nil {
+				t.Fatalf("validateContent: %v\n%s", err, content)
+			}
+			site := blockAfter(t, content, "http://127.0.0.1:8080 {")
+			for _, route := range []string{"handle /status {", "handle /health/deep {", "handle /version {"} {
+				handler := blockAfter(t, site, route)
+				for _, want := range tt.want {
+					if !strings.Contains(handler, want) {
+						t.Errorf("%s missing %q:\n%s", route, want, handler)
+					}
+				}
+				for _, unwanted := range tt.unwanted {
+					if strings.Contains(handler, unwanted) {
+						t.Errorf("%s contains %q:\n%s", route, unwanted, handler)
+					}
+				}
+			}
+		})
+	}
+}
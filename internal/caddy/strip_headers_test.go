@@ -0,0 +1,76 @@
+package caddy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/mapping"
+)
+
+// TestGenerate_StripHeaders verifies global STRIP_HEADERS render as
+// header_up deletions in every proxy block, that per-mapping strip_headers
+// are added on top, and that headers dyndns sets itself are never stripped.
+func TestGenerate_StripHeaders(t *testing.T) {
+	dir := t.TempDir()
+	mappingsPath := filepath.Join(dir, "mappings.yaml")
+	yaml := `mappings:
+  - subdomain: legacy
+    target: "legacy:8080"
+    options:
+      strip_headers:
+        - X-Legacy-Session
+        - x-internal-token
+`
+	if err := os.WriteFile(mappingsPath, []byte(yaml), 0644); err != nil {
+		t.Fatalf("write mappings: %v", err)
+	}
+	mgr := mapping.New(mappingsPath)
+	if err := mgr.Load(); err != nil {
+		t.Fatalf("load mappings: %v", err)
+	}
+
+	for _, shared := range []bool{false, true} {
+		g := newGeneratorWithDefaults(t, &config.Config{
+			Domain:              "example.com",
+			AcmeEmail:           "admin@example.com",
+			LogLevel:            "info",
+			CaddySharedSnippets: shared,
+			StripHeaders:        []string{"X-Internal-Token", "X-Debug-*", "X-Forwarded-*"},
+		})
+		g.mappingMgr = mgr
+		g.UpdateDiscoveredServices([]discovery.Service{
+			{Subdomain: "app", Port: 8080},
+			{Subdomain: "direct", Port: 7070, Direct: true},
+		})
+
+		content, err := g.GenerateContent()
+		if err != nil {
+			t.Fatalf("GenerateContent: %v", err)
+		}
+
+		for _, marker := range []string{"handle @app {", "direct.example.com {", "handle @legacy {"} {
+			block := blockAfter(t, content, marker)
+			for _, want := range []string{"header_up -X-Internal-Token", "header_up -X-Debug-*"} {
+				if !strings.Contains(block, want) {
+					t.Errorf("shared=%v: %s block missing %q:\n%s", shared, marker, want, block)
+				}
+			}
+		}
+
+		legacy := blockAfter(t, content, "handle @legacy {")
+		if !strings.Contains(legacy, "header_up -X-Legacy-Session") {
+			t.Errorf("shared=%v: per-mapping strip header missing:\n%s", shared, legacy)
+		}
+		if n := strings.Count(strings.ToLower(legacy), "header_up -x-internal-token"); n != 1 {
+			t.Errorf("shared=%v: X-Internal-Token stripped %d times, want 1 (deduplicated):\n%s", shared, n, legacy)
+		}
+
+		if strings.Contains(content, "header_up -X-Forwarded-") {
+			t.Errorf("shared=%v: X-Forwarded-* must not be stripped (set by dyndns):\n%s", shared, content)
+		}
+	}
+}
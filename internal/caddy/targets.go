@@ -0,0 +1,161 @@
+package caddy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+)
+
+// targetChecks validates the upstream targets of the mappings before the
+// Caddyfile is rendered (VALIDATE_TARGETS). A typo'd target renders and
+// reloads fine but answers 502 on every request; the check surfaces it
+// when it is written. A nil value disables the checks.
+type targetChecks struct {
+	timeout time.Duration
+	drop    bool
+	dial    func(ctx context.Context, network, address string) (net.Conn, error)
+
+	mu sync.Mutex
+	// failing holds the targets whose last check failed, so a failure is
+	// logged once and its recovery is reported.
+	failing map[string]bool
+}
+
+// newTargetChecks returns the checker when VALIDATE_TARGETS is enabled,
+// else nil.
+func newTargetChecks(cfg *config.Config) *targetChecks {
+	if !cfg.ValidateTargets {
+		return nil
+	}
+	return &targetChecks{
+		timeout: cfg.ValidateTargetsTimeout,
+		drop:    cfg.ValidateTargetsDrop,
+		dial:    (&net.Dialer{}).DialContext,
+		failing: make(map[string]bool),
+	}
+}
+
+// preview returns checks with the same settings and failure state for a
+// dry-run generator, so the preview drops and flags the targets a real
+// Generate would without changing what this checker has reported.
+func (t *targetChecks) preview() *targetChecks {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return &targetChecks{timeout: t.timeout, drop: t.drop, dial: t.dial, failing: maps.Clone(t.failing)}
+}
+
+// filter checks the distinct targets of mappings in parallel and warns
+// about each newly failing one. With VALIDATE_TARGETS_DROP the mappings
+// of failing targets are left out of the result.
+func (t *targetChecks) filter(mappings []MappingData) []MappingData {
+	if t == nil || len(mappings) == 0 {
+		return mappings
+	}
+
+	var targets []string
+	for _, m := range mappings {
+		if !slices.Contains(targets, m.Target) {
+			targets = append(targets, m.Target)
+		}
+	}
+	results := make([]error, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Go(func() { results[i] = t.check(target) })
+	}
+	wg.Wait()
+	errs := make(map[string]error, len(targets))
+	for i, target := range targets {
+		errs[target] = results[i]
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	kept := mappings[:0:0]
+	for _, m := range mappings {
+		err := errs[m.Target]
+		switch {
+		case err == nil && t.failing[m.Target]:
+			slog.Info("Upstream target is reachable again", "subdomain", m.Subdomain, "target", m.Target)
+		case err != nil && !t.failing[m.Target]:
+			if t.drop {
+				slog.Warn("UPSTREAM TARGET FAILED VALIDATION: leaving the mapping out of the Caddyfile until it connects",
+					"subdomain", m.Subdomain, "target", m.Target, "error", err)
+			} else {
+				slog.Warn("Upstream target failed validation - requests to it will fail with 502; check the mapping target or set VALIDATE_TARGETS_DROP=true",
+					"subdomain", m.Subdomain, "target", m.Target, "error", err)
+			}
+		}
+		if err != nil && t.drop {
+			continue
+		}
+		kept = append(kept, m)
+	}
+	clear(t.failing)
+	for target, err := range errs {
+		if err != nil {
+			t.failing[target] = true
+		}
+	}
+	return kept
+}
+
+// check verifies every upstream of target parses as host:port and that at
+// least one accepts a TCP connection within the timeout.
+func (t *targetChecks) check(target string) error {
+	upstreams := strings.Fields(target)
+	if len(upstreams) == 0 {
+		return errors.New("empty target")
+	}
+	addrs := make([]string, 0, len(upstreams))
+	for _, upstream := range upstreams {
+		addr, err := parseTarget(upstream)
+		if err != nil {
+			return err
+		}
+		addrs = append(addrs, addr)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+	defer cancel()
+	var dialErr error
+	for _, addr := range addrs {
+		conn, err := t.dial(ctx, "tcp", addr)
+		if err == nil {
+			_ = conn.Close()
+			return nil
+		}
+		dialErr = err
+	}
+	return fmt.Errorf("no upstream accepts connections: %w", dialErr)
+}
+
+// parseTarget returns the host:port dial address of an upstream, which
+// may carry a scheme (http://backend:8080).
+func parseTarget(upstream string) (string, error) {
+	hostPort := upstream
+	if _, rest, ok := strings.Cut(upstream, "://"); ok {
+		hostPort = rest
+	}
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil || host == "" {
+		return "", fmt.Errorf("upstream %q is not host:port", upstream)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("upstream %q has an invalid port %q", upstream, port)
+	}
+	return net.JoinHostPort(host, port), nil
+}
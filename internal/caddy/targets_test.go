@@ -0,0 +1,129 @@
+package caddy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/mapping"
+)
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		upstream string
+		want     string
+		wantErr  bool
+	}{
+		{upstream: "backend:8080", want: "backend:8080"},
+		{upstream: "http://backend:8080", want: "backend:8080"},
+		{upstream: "[::1]:8080", want: "[::1]:8080"},
+		{upstream: "backend", wantErr: true},
+		{upstream: ":8080", wantErr: true},
+		{upstream: "backend:http", wantErr: true},
+		{upstream: "backend:70000", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseTarget(tt.upstream)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseTarget(%q) = %q, %v; want %q, error %v", tt.upstream, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// targetDialer accepts connections to the listed addresses only.
+type targetDialer struct {
+	up map[string]bool
+
+	mu     sync.Mutex
+	dialed []string
+}
+
+func (d *targetDialer) dial(_ context.Context, _, address string) (net.Conn, error) {
+	d.mu.Lock()
+	d.dialed = append(d.dialed, address)
+	d.mu.Unlock()
+	if !d.up[address] {
+		return nil, errors.New("connection refused")
+	}
+	client, server := net.Pipe()
+	_ = server.Close()
+	return client, nil
+}
+
+// TestGenerate_ValidateTargets verifies that with VALIDATE_TARGETS a
+// typo'd target is flagged: kept in the Caddyfile by default, left out
+// with VALIDATE_TARGETS_DROP, and served again once it connects.
+func TestGenerate_ValidateTargets(t *testing.T) {
+	mappingsPath := filepath.Join(t.TempDir(), "mappings.yaml")
+	content := `
+mappings:
+  - subdomain: app
+    target: "backend:808"
+  - subdomain: wiki
+    target: "wiki:3000"
+`
+	if err := os.WriteFile(mappingsPath, []byte(content), 0644); err != nil {
+		t.Fatalf("write mappings: %v", err)
+	}
+	mgr := mapping.New(mappingsPath)
+	if err := mgr.Load(); err != nil {
+		t.Fatalf("load mappings: %v", err)
+	}
+
+	for _, drop := range []bool{false, true} {
+		g := newGeneratorWithDefaults(t, &config.Config{
+			Domain:                 "example.com",
+			AcmeEmail:              "admin@example.com",
+			LogLevel:               "info",
+			CloudflareProxy:        true,
+			ValidateTargets:        true,
+			ValidateTargetsTimeout: time.Second,
+			ValidateTargetsDrop:    drop,
+		})
+		g.mappingMgr = mgr
+		dialer := &targetDialer{up: map[string]bool{"wiki:3000": true}}
+		g.targets.dial = dialer.dial
+
+		content, err := g.GenerateContent()
+		if err != nil {
+			t.Fatalf("drop=%v: GenerateContent: %v", drop, err)
+		}
+		if len(dialer.dialed) != 2 {
+			t.Errorf("drop=%v: dialed %v, want both targets", drop, dialer.dialed)
+		}
+		if !g.targets.failing["backend:808"] || g.targets.failing["wiki:3000"] {
+			t.Errorf("drop=%v: failing targets = %v, want only backend:808", drop, g.targets.failing)
+		}
+		if !strings.Contains(content, "reverse_proxy wiki:3000") {
+			t.Errorf("drop=%v: reachable target missing from the Caddyfile", drop)
+		}
+		if got := strings.Contains(content, "reverse_proxy backend:808"); got == drop {
+			t.Errorf("drop=%v: unreachable target rendered = %v, want %v", drop, got, !drop)
+		}
+		if !drop {
+			continue
+		}
+
+		// Once the target connects, the mapping is rendered again.
+		dialer.up["backend:808"] = true
+		content, err = g.GenerateContent()
+		if err != nil {
+			t.Fatalf("GenerateContent: %v", err)
+		}
+		if !strings.Contains(content, "reverse_proxy backend:808") || len(g.targets.failing) != 0 {
+			t.Errorf("recovered target not rendered (failing %v)", g.targets.failing)
+		}
+	}
+
+	// Without VALIDATE_TARGETS nothing is checked.
+	if g := New(&config.Config{Domain: "example.com"}, mgr); g.targets != nil {
+		t.Errorf("targets = %+v without VALIDATE_TARGETS, want nil", g.targets)
+	}
+}
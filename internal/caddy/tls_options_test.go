@@ -0,0 +1,74 @@
+package caddy
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+)
+
+// TestGenerate_TLSOptions verifies TLS_PROTOCOLS, TLS_CIPHERS and
+// TLS_CURVES render into the tls block of every public site, including
+// the wildcard site serving a static origin certificate.
+func TestGenerate_TLSOptions(t *testing.T) {
+	for _, originCert := range []bool{false, true} {
+		t.Run(fmt.Sprintf("origin_cert=%t", originCert), func(t *testing.T) {
+			cfg := &config.Config{
+				Domain:            "example.com",
+				AcmeEmail:         "admin@example.com",
+				LogLevel:          "info",
+				CloudflareProxy:   true,
+				CatchallSubdomain: "zone451",
+				TLSProtocols:      []string{"tls1.2", "tls1.3"},
+				TLSCiphers:        []string{"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384", "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"},
+				TLSCurves:         []string{"x25519", "secp384r1"},
+			}
+			if originCert {
+				cfg.CloudflareSSLMode = "strict"
+				cfg.OriginCert = "/etc/cloudflare/origin.pem"
+				cfg.OriginKey = "/etc/cloudflare/origin-key.pem"
+			}
+			g := newGeneratorWithDefaults(t, cfg)
+			g.UpdateDiscoveredServices([]discovery.Service{
+				{Subdomain: "app", Port: 8080},
+				{Subdomain: "direct", Port: 9090, Direct: true},
+			})
+
+			content, err := g.GenerateContent()
+			if err != nil {
+				t.Fatalf("GenerateContent: %v", err)
+			}
+			for _, marker := range []string{"direct.example.com {", "zone451.example.com {", "*.example.com, example.com {"} {
+				site := blockAfter(t, content, marker)
+				for _, want := range []string{
+					"\n        protocols tls1.2 tls1.3\n",
+					"\n        ciphers TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384 TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384\n",
+					"\n        curves x25519 secp384r1\n",
+				} {
+					if !strings.Contains(site, want) {
+						t.Errorf("%s site missing %q:\n%s", marker, strings.TrimSpace(want), site)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestGenerate_TLSOptionsDefault verifies no protocols, ciphers or curves
+// lines are rendered without the TLS_* settings.
+func TestGenerate_TLSOptionsDefault(t *testing.T) {
+	g := newGeneratorWithDefaults(t, &config.Config{Domain: "example.com", CloudflareProxy: true})
+	g.UpdateDiscoveredServices([]discovery.Service{{Subdomain: "app", Port: 8080}})
+
+	content, err := g.GenerateContent()
+	if err != nil {
+		t.Fatalf("GenerateContent: %v", err)
+	}
+	for _, directive := range []string{"protocols", "ciphers", "curves"} {
+		if strings.Contains(content, "        "+directive+" ") {
+			t.Errorf("no %s line expected without TLS settings", directive)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package caddy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// validateContent is a structural sanity check of a rendered Caddyfile,
+// run before it replaces the file on disk: it must not be empty, must not
+// contain unresolved template values, and its braces must balance (outside
+// comments and quoted strings). It does not replace caddy validate; it
+// catches renders that would certainly fail to load.
+func validateContent(content string) error {
+	if strings.TrimSpace(content) == "" {
+		return fmt.Errorf("rendered Caddyfile is empty")
+	}
+	if strings.Contains(content, "<no value>") {
+		return fmt.Errorf("rendered Caddyfile contains an unresolved template value (<no value>)")
+	}
+
+	depth := 0
+	for i, line := range strings.Split(content, "\n") {
+		inQuote := false
+		for j := 0; j < len(line); j++ {
+			c := line[j]
+			switch {
+			case inQuote && c == '\\':
+				j++ // skip the escaped character
+			case c == '"':
+				inQuote = !inQuote
+			case inQuote:
+			case c == '#' && (j == 0 || line[j-1] == ' ' || line[j-1] == '\t'):
+				j = len(line) // comment runs to the end of the line
+			case c == '{':
+				depth++
+			case c == '}':
+				depth--
+				if depth < 0 {
+					return fmt.Errorf("rendered Caddyfile has an unmatched '}' on line %d", i+1)
+				}
+			}
+		}
+	}
+	if depth != 0 {
+		return fmt.Errorf("rendered Caddyfile has %d unclosed '{'", depth)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package caddy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/discovery"
+)
+
+func TestValidateContent(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "valid", content: "example.com {\n\treverse_proxy {http.request.host}:80 # comment {\n\trespond \"{ not a block\"\n}\n"},
+		{name: "empty", content: "  \n", wantErr: "empty"},
+		{name: "no value", content: "example.com {\n\treverse_proxy <no value>\n}\n", wantErr: "<no value>"},
+		{name: "unclosed", content: "example.com {\n\thandle {\n}\n", wantErr: "unclosed"},
+		{name: "unmatched", content: "example.com {\n}\n}\n", wantErr: "line 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateContent(tt.content)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateContent() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateContent() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestValidateContent_Template verifies the shipped template renders valid
+// content in the main configurations.
+func TestValidateContent_Template(t *testing.T) {
+	services := []discovery.Service{
+		{Subdomain: "app", Port: 8080, Websocket: true},
+		{Subdomain: "direct", Port: 9090, Direct: true},
+	}
+	for name, cfg := range map[string]*config.Config{
+		"direct":   {Domain: "example.com", AcmeEmail: "admin@example.com", LogLevel: "info"},
+		"proxy":    {Domain: "example.com", AcmeEmail: "admin@example.com", LogLevel: "info", CloudflareProxy: true},
+		"per site": {Domain: "example.com", AcmeEmail: "admin@example.com", LogLevel: "info", CloudflareProxy: true, CaddyPerSite: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			g := newGeneratorWithDefaults(t, cfg)
+			g.UpdateDiscoveredServices(services)
+			content, err := g.GenerateContent()
+			if err != nil {
+				t.Fatalf("GenerateContent: %v", err)
+			}
+			if err := validateContent(content); err != nil {
+				t.Errorf("validateContent() = %v", err)
+			}
+		})
+	}
+}
+
+// TestGenerate_KeepsLastGoodCaddyfile verifies a failing render leaves the
+// previously written Caddyfile intact and leaves no temporary files behind.
+func TestGenerate_KeepsLastGoodCaddyfile(t *testing.T) {
+	dir := t.TempDir()
+	caddyFile := filepath.Join(dir, "Caddyfile")
+	g := New(&config.Config{Domain: "example.com", CaddyFile: caddyFile}, nil)
+
+	g.TemplateContent = "{{.Domain}} {\n\trespond \"ok\"\n}\n"
+	if err := g.Generate(); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	good, err := os.ReadFile(caddyFile)
+	if err != nil {
+		t.Fatalf("read Caddyfile: %v", err)
+	}
+
+	for name, tmpl := range map[string]string{
+		"parse error":     "{{.Domain} {\n}\n",
+		"execute error":   "{{.Domain}} {\n\t{{.NoSuchField}}\n}\n",
+		"invalid content": "{{.Domain}} {\n\trespond \"ok\"\n",
+	} {
+		g.TemplateContent = tmpl
+		if err := g.Generate(); err == nil {
+			t.Errorf("%s: Generate() expected error", name)
+		}
+		got, err := os.ReadFile(caddyFile)
+		if err != nil {
+			t.Fatalf("%s: read Caddyfile: %v", name, err)
+		}
+		if string(got) != string(good) {
+			t.Errorf("%s: Caddyfile = %q, want last-good %q", name, got, good)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("read dir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("dir has %d entries, want only the Caddyfile", len(entries))
+	}
+}
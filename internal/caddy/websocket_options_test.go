@@ -0,0 +1,71 @@
+package caddy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+	"github.com/jonnyzzz/stevedore-dyndns/internal/mapping"
+)
+
+// TestGenerate_WebsocketTuning verifies ws_handshake_timeout and ws_headers
+// render into the proxy block of websocket mappings only.
+func TestGenerate_WebsocketTuning(t *testing.T) {
+	dir := t.TempDir()
+	mappingsPath := filepath.Join(dir, "mappings.yaml")
+	yaml := `mappings:
+  - subdomain: chat
+    target: "chat:8080"
+    options:
+      websocket: true
+      ws_handshake_timeout: 30s
+      ws_headers:
+        - Sec-WebSocket-Protocol
+  - subdomain: plain
+    target: "plain:8080"
+    options:
+      ws_handshake_timeout: 30s
+      ws_headers:
+        - Sec-WebSocket-Protocol
+`
+	if err := os.WriteFile(mappingsPath, []byte(yaml), 0644); err != nil {
+		t.Fatalf("write mappings: %v", err)
+	}
+	mgr := mapping.New(mappingsPath)
+	if err := mgr.Load(); err != nil {
+		t.Fatalf("load mappings: %v", err)
+	}
+
+	g := newGeneratorWithDefaults(t, &config.Config{
+		Domain:    "example.com",
+		AcmeEmail: "admin@example.com",
+		LogLevel:  "info",
+	})
+	g.mappingMgr = mgr
+
+	content, err := g.GenerateContent()
+	if err != nil {
+		t.Fatalf("GenerateContent: %v", err)
+	}
+
+	wantDirectives := []string{
+		"response_header_timeout 30s",
+		"header_up Sec-WebSocket-Protocol {http.request.header.Sec-WebSocket-Protocol}",
+	}
+
+	chat := blockAfter(t, content, "handle @chat {")
+	for _, want := range wantDirectives {
+		if !strings.Contains(chat, want) {
+			t.Errorf("websocket block missing %q:\n%s", want, chat)
+		}
+	}
+
+	plain := blockAfter(t, content, "handle @plain {")
+	for _, unwanted := range wantDirectives {
+		if strings.Contains(plain, unwanted) {
+			t.Errorf("non-websocket block should not render %q:\n%s", unwanted, plain)
+		}
+	}
+}
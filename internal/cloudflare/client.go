@@ -2,8 +2,12 @@ package cloudflare
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
+	"regexp"
+	"sort"
 	"strings"
 	"sync"
 
@@ -17,35 +21,211 @@ type Client struct {
 	zoneID     string
 	domain     string
 	baseDomain string // Parent domain in prefix mode
+	prefixMode bool   // SUBDOMAIN_PREFIX
+	zoneName   string // Zone apex, set by CheckZone
+	legacyBase string // Prefix-mode base domain replaced by the zone, if any
 	proxied    bool   // Cloudflare proxy mode (orange cloud)
+	sslMode    string // Zone SSL mode applied by ConfigureForProxyMode
 	ttl        int    // DNS record TTL in seconds
 
+	// ttlJitter is the DNS_TTL_JITTER percentage, and randIntN returns a
+	// value in [0, n) (rand.IntN when nil; injectable for tests).
+	ttlJitter int
+	randIntN  func(n int) int
+
+	// labelPattern matches managed labels under baseDomain when
+	// SUBDOMAIN_NAME_TEMPLATE is set (capture group 1 is the subdomain).
+	// Nil selects the built-in normal/prefix mode naming.
+	labelPattern *regexp.Regexp
+
+	// managedTypes are the record types enumerated as managed
+	// (MANAGED_RECORD_TYPES).
+	managedTypes []string
+
+	// allowAnyName downgrades the record-name scope assertion to a
+	// warning (UNSAFE_ALLOW_ANY_RECORD_NAME).
+	allowAnyName bool
+
 	// Cache of record IDs to avoid lookups
 	recordCache map[string]string
-	cacheMu     sync.RWMutex
+	// Proxied flag last seen or written per cached record, to detect a
+	// subdomain switching between proxied and direct.
+	proxiedCache map[string]bool
+	cacheMu      sync.RWMutex
+
+	// Record families ("name:type") whose last update failed. They are
+	// retried on the next UpdateNameRecords call for the same name.
+	failedFamilies map[string]error
+	failedMu       sync.Mutex
+
+	// Last API token permission diagnostics, for the status endpoint.
+	tokenDiag tokenDiagStore
 }
 
 // New creates a new Cloudflare client
 func New(cfg *config.Config) (*Client, error) {
-	api, err := cloudflare.NewWithAPIToken(cfg.CloudflareAPIToken)
+	// Honor HTTP_PROXY/HTTPS_PROXY/NO_PROXY for API calls in locked-down
+	// networks where egress must go through a proxy.
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	opts := []cloudflare.Option{cloudflare.HTTPClient(&http.Client{Transport: transport})}
+	if cfg.UserAgent != "" {
+		opts = append(opts, cloudflare.UserAgent(cfg.UserAgent))
+	}
+	if cfg.CloudflareAPIBaseURL != "" {
+		opts = append(opts, cloudflare.BaseURL(cfg.CloudflareAPIBaseURL))
+	}
+	api, err := cloudflare.NewWithAPIToken(cfg.CloudflareAPIToken, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Cloudflare client: %w", err)
 	}
 
+	managedTypes := cfg.ManagedRecordTypes
+	if len(managedTypes) == 0 {
+		managedTypes = []string{"A", "AAAA"}
+	}
+
 	return &Client{
 		api:         api,
 		zoneID:      cfg.CloudflareZoneID,
 		domain:      cfg.Domain,
 		baseDomain:  cfg.GetBaseDomain(),
+		prefixMode:  cfg.SubdomainPrefix,
 		proxied:     cfg.CloudflareProxy,
+		sslMode:     cfg.CloudflareSSLMode,
 		ttl:         cfg.DNSTTL,
+		ttlJitter:   cfg.DNSTTLJitter,
 		recordCache: make(map[string]string),
+
+		labelPattern: cfg.SubdomainLabelPattern(),
+		managedTypes: managedTypes,
+		allowAnyName: cfg.UnsafeAllowAnyRecordName,
 	}, nil
 }
 
+// RecordUpdate describes one record family (A or AAAA) to publish for a name.
+type RecordUpdate struct {
+	Type    string
+	Content string
+	Proxied bool
+	// TTL overrides the client's DNS_TTL for this record; zero keeps it.
+	TTL int
+}
+
+// NameUpdateResult reports the grouped outcome of UpdateNameRecords so a
+// half-applied A+AAAA update is visible as one event rather than two
+// unrelated log lines.
+type NameUpdateResult struct {
+	Name string
+	// Updated lists the record types that were published successfully.
+	Updated []string
+	// Failed maps a record type to the error that prevented its update.
+	Failed map[string]error
+	// Retried lists the record types that had failed on the previous call
+	// for this name and were attempted again.
+	Retried []string
+}
+
+// Partial reports whether some, but not all, families were updated.
+func (r *NameUpdateResult) Partial() bool {
+	return len(r.Updated) > 0 && len(r.Failed) > 0
+}
+
+// FailedTypes returns the failed record types in sorted order.
+func (r *NameUpdateResult) FailedTypes() []string {
+	out := make([]string, 0, len(r.Failed))
+	for t := range r.Failed {
+		out = append(out, t)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Err joins the per-family failures, or returns nil when every family succeeded.
+func (r *NameUpdateResult) Err() error {
+	if len(r.Failed) == 0 {
+		return nil
+	}
+	errs := make([]error, 0, len(r.Failed))
+	for _, t := range r.FailedTypes() {
+		errs = append(errs, fmt.Errorf("%s: %w", t, r.Failed[t]))
+	}
+	return errors.Join(errs...)
+}
+
+// UpdateNameRecords publishes several record families for the same name and
+// reports them together. A family that fails has its cached record ID
+// dropped and is remembered, so the next call re-resolves it from the API
+// and reports it as a retry instead of silently carrying on.
+func (c *Client) UpdateNameRecords(ctx context.Context, name string, updates []RecordUpdate) *NameUpdateResult {
+	result := &NameUpdateResult{Name: name}
+
+	for _, u := range updates {
+		key := fmt.Sprintf("%s:%s", name, u.Type)
+
+		c.failedMu.Lock()
+		if _, wasFailed := c.failedFamilies[key]; wasFailed {
+			result.Retried = append(result.Retried, u.Type)
+		}
+		c.failedMu.Unlock()
+
+		ttl := u.TTL
+		if ttl == 0 {
+			ttl = c.ttl
+		}
+		err := c.updateRecord(ctx, name, u.Type, u.Content, u.Proxied, c.jitterTTL(ttl))
+
+		c.failedMu.Lock()
+		if err != nil {
+			if c.failedFamilies == nil {
+				c.failedFamilies = make(map[string]error)
+			}
+			c.failedFamilies[key] = err
+		} else {
+			delete(c.failedFamilies, key)
+		}
+		c.failedMu.Unlock()
+
+		if err != nil {
+			// The cached ID may be stale (record removed out-of-band);
+			// force a fresh lookup on the retry.
+			c.forgetRecord(key)
+
+			if result.Failed == nil {
+				result.Failed = make(map[string]error)
+			}
+			result.Failed[u.Type] = err
+			continue
+		}
+		result.Updated = append(result.Updated, u.Type)
+	}
+
+	return result
+}
+
+// ErrOutOfScope reports an attempt to modify a record outside the configured
+// domain scope. Callers can detect it with errors.As (to inspect the
+// offending name) or errors.Is(err, &ErrOutOfScope{}).
+type ErrOutOfScope struct {
+	Name       string
+	Domain     string
+	BaseDomain string
+}
+
+func (e *ErrOutOfScope) Error() string {
+	return fmt.Sprintf("SECURITY: record name %q is outside configured domain %q (baseDomain: %q) - refusing to modify", e.Name, e.Domain, e.BaseDomain)
+}
+
+// Is matches any *ErrOutOfScope so errors.Is works without comparing fields.
+func (e *ErrOutOfScope) Is(target error) bool {
+	_, ok := target.(*ErrOutOfScope)
+	return ok
+}
+
 // validateRecordName ensures the record name is within the configured domain scope.
 // This is a safety assertion to prevent accidental modifications to records outside the domain.
 // In prefix mode, records may be subdomains of baseDomain (e.g., app-zone.example.com when domain is zone.example.com)
+// UNSAFE_ALLOW_ANY_RECORD_NAME turns an out-of-scope name into a warning.
 func (c *Client) validateRecordName(name string) error {
 	// Normalize to lowercase for comparison
 	normalizedName := strings.ToLower(strings.TrimSuffix(name, "."))
@@ -58,15 +238,26 @@ func (c *Client) validateRecordName(name string) error {
 		return nil
 	}
 
-	// Check against base domain (prefix mode - allows app-zone.example.com when domain is zone.example.com)
+	// Check against base domain (prefix mode - allows app-zone.example.com when domain is zone.example.com).
+	// With a name template only labels the template produces are in scope.
 	if normalizedBaseDomain != "" && normalizedBaseDomain != normalizedDomain {
-		if normalizedName == normalizedBaseDomain || strings.HasSuffix(normalizedName, "."+normalizedBaseDomain) {
+		if c.labelPattern != nil {
+			if _, ok := c.templateSubdomain(normalizedName); ok {
+				slog.Debug("Record name validation passed (name template match)", "name", name, "baseDomain", c.baseDomain)
+				return nil
+			}
+		} else if normalizedName == normalizedBaseDomain || strings.HasSuffix(normalizedName, "."+normalizedBaseDomain) {
 			slog.Debug("Record name validation passed (baseDomain match)", "name", name, "baseDomain", c.baseDomain)
 			return nil
 		}
 	}
 
-	return fmt.Errorf("SECURITY: record name %q is outside configured domain %q (baseDomain: %q) - refusing to modify", name, c.domain, c.baseDomain)
+	err := &ErrOutOfScope{Name: name, Domain: c.domain, BaseDomain: c.baseDomain}
+	if c.allowAnyName {
+		slog.Warn("UNSAFE_ALLOW_ANY_RECORD_NAME: modifying a record outside the configured domain", "name", name, "error", err)
+		return nil
+	}
+	return err
 }
 
 // UpdateRecord creates or updates a DNS record using the client's default
@@ -78,17 +269,28 @@ func (c *Client) UpdateRecord(ctx context.Context, name string, recordType strin
 // UpdateRecordProxied creates or updates a DNS record with an explicit proxied
 // flag. This supports mixed-mode deployments where some subdomains go through
 // Cloudflare proxy (orange cloud) while others terminate TLS directly (grey cloud).
+// The flag is ignored for record types Cloudflare cannot proxy (see
+// proxiableType), which are always written unproxied.
 func (c *Client) UpdateRecordProxied(ctx context.Context, name string, recordType string, content string, proxied bool) error {
+	return c.updateRecord(ctx, name, recordType, content, proxied, c.jitterTTL(c.ttl))
+}
+
+// updateRecord creates or updates a DNS record with ttl, or automatic TTL
+// when the record ends up proxied.
+func (c *Client) updateRecord(ctx context.Context, name string, recordType string, content string, proxied bool, ttl int) error {
 	// SECURITY ASSERTION: Ensure we only modify records within our domain
 	if err := c.validateRecordName(name); err != nil {
-		return err
+		return fmt.Errorf("failed to update %s record: %w", recordType, err)
 	}
 
+	proxied = proxied && proxiableType(recordType)
+
 	cacheKey := fmt.Sprintf("%s:%s", name, recordType)
 
 	// Check cache for existing record ID
 	c.cacheMu.RLock()
 	recordID, cached := c.recordCache[cacheKey]
+	wasProxied, knownProxied := c.proxiedCache[cacheKey]
 	c.cacheMu.RUnlock()
 
 	rc := cloudflare.ZoneIdentifier(c.zoneID)
@@ -108,18 +310,22 @@ func (c *Client) UpdateRecordProxied(ctx context.Context, name string, recordTyp
 
 		if len(records) > 0 {
 			recordID = records[0].ID
-			c.cacheMu.Lock()
-			c.recordCache[cacheKey] = recordID
-			c.cacheMu.Unlock()
+			wasProxied = records[0].Proxied != nil && *records[0].Proxied
+			knownProxied = true
+			c.rememberRecord(cacheKey, recordID, wasProxied)
 		}
 	}
 
 	// Cloudflare uses TTL=1 for "automatic" when proxied
-	ttl := c.ttl
 	if proxied {
 		ttl = 1 // Automatic TTL when proxied
 	}
 
+	if recordID != "" && knownProxied && wasProxied != proxied {
+		slog.Info("DNS record proxy preference changed, updating record",
+			"name", name, "type", recordType, "proxied", proxied, "ttl", ttl)
+	}
+
 	if recordID != "" {
 		// Update existing record
 		_, err := withRetry(ctx, "update_dns_record", func() (cloudflare.DNSRecord, error) {
@@ -133,8 +339,17 @@ func (c *Client) UpdateRecordProxied(ctx context.Context, name string, recordTyp
 			})
 		})
 		if err != nil {
+			// A stale cached ID (record deleted or recreated outside dyndns)
+			// fails the update; look the record up again before giving up.
+			c.forgetRecord(cacheKey)
+			if cached {
+				slog.Debug("Update with cached record ID failed, looking record up again",
+					"name", name, "type", recordType, "error", err)
+				return c.updateRecord(ctx, name, recordType, content, proxied, ttl)
+			}
 			return fmt.Errorf("failed to update DNS record: %w", err)
 		}
+		c.rememberRecord(cacheKey, recordID, proxied)
 		slog.Debug("Updated DNS record", "name", name, "type", recordType, "content", content, "ttl", ttl, "proxied", proxied)
 	} else {
 		// Create new record
@@ -150,20 +365,98 @@ func (c *Client) UpdateRecordProxied(ctx context.Context, name string, recordTyp
 		if err != nil {
 			return fmt.Errorf("failed to create DNS record: %w", err)
 		}
-		c.cacheMu.Lock()
-		c.recordCache[cacheKey] = record.ID
-		c.cacheMu.Unlock()
+		c.rememberRecord(cacheKey, record.ID, proxied)
 		slog.Debug("Created DNS record", "name", name, "type", recordType, "content", content, "id", record.ID, "ttl", ttl, "proxied", proxied)
 	}
 
 	return nil
 }
 
+// proxiableType reports whether records of this type can be proxied by
+// Cloudflare. Only address records and CNAMEs can; TXT (ACME challenges),
+// CAA, MX, NS and the rest must stay unproxied.
+func proxiableType(recordType string) bool {
+	switch strings.ToUpper(recordType) {
+	case "A", "AAAA", "CNAME":
+		return true
+	}
+	return false
+}
+
 // DeleteRecord removes a DNS record
 func (c *Client) DeleteRecord(ctx context.Context, name string, recordType string) error {
+	_, err := c.deleteRecord(ctx, name, recordType)
+	return err
+}
+
+// RemoveWildcardRecords deletes the *.domain A and AAAA records that direct
+// mode publishes. In proxy mode per-subdomain records replace the wildcard,
+// and a leftover one would keep resolving every name to an old IP. Only the
+// managed domain's own wildcard is touched. Returns the deleted types.
+func (c *Client) RemoveWildcardRecords(ctx context.Context) ([]string, error) {
+	name := "*." + c.domain
+	var removed []string
+	var errs []error
+	for _, recordType := range []string{"A", "AAAA"} {
+		deleted, err := c.deleteRecord(ctx, name, recordType)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if deleted {
+			removed = append(removed, recordType)
+		}
+	}
+	return removed, errors.Join(errs...)
+}
+
+// RemoveAlias deletes the CNAME record at name when it points to target,
+// e.g. a www alias of the apex that is no longer managed. A CNAME to any
+// other target was not created by dyndns and is left alone. Reports
+// whether a record was deleted.
+func (c *Client) RemoveAlias(ctx context.Context, name, target string) (bool, error) {
 	// SECURITY ASSERTION: Ensure we only delete records within our domain
 	if err := c.validateRecordName(name); err != nil {
-		return err
+		return false, fmt.Errorf("failed to delete CNAME record: %w", err)
+	}
+
+	rc := cloudflare.ZoneIdentifier(c.zoneID)
+	records, err := withRetry(ctx, "list_dns_records", func() ([]cloudflare.DNSRecord, error) {
+		records, _, err := c.api.ListDNSRecords(ctx, rc, cloudflare.ListDNSRecordsParams{
+			Name: name,
+			Type: "CNAME",
+		})
+		return records, err
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to list DNS records: %w", err)
+	}
+
+	normalizedTarget := strings.ToLower(strings.TrimSuffix(target, "."))
+	deleted := false
+	for _, r := range records {
+		if strings.ToLower(strings.TrimSuffix(r.Content, ".")) != normalizedTarget {
+			continue
+		}
+		if _, err := withRetry(ctx, "delete_dns_record", func() (struct{}, error) {
+			return struct{}{}, c.api.DeleteDNSRecord(ctx, rc, r.ID)
+		}); err != nil {
+			return deleted, fmt.Errorf("failed to delete DNS record: %w", err)
+		}
+		deleted = true
+	}
+	if deleted {
+		c.forgetRecord(fmt.Sprintf("%s:%s", name, "CNAME"))
+		slog.Debug("Deleted DNS record", "name", name, "type", "CNAME", "content", target)
+	}
+	return deleted, nil
+}
+
+// deleteRecord deletes a record and reports whether one existed.
+func (c *Client) deleteRecord(ctx context.Context, name string, recordType string) (bool, error) {
+	// SECURITY ASSERTION: Ensure we only delete records within our domain
+	if err := c.validateRecordName(name); err != nil {
+		return false, fmt.Errorf("failed to delete %s record: %w", recordType, err)
 	}
 
 	cacheKey := fmt.Sprintf("%s:%s", name, recordType)
@@ -184,10 +477,10 @@ func (c *Client) DeleteRecord(ctx context.Context, name string, recordType strin
 			return records, err
 		})
 		if err != nil {
-			return fmt.Errorf("failed to list DNS records: %w", err)
+			return false, fmt.Errorf("failed to list DNS records: %w", err)
 		}
 		if len(records) == 0 {
-			return nil // Record doesn't exist
+			return false, nil // Record doesn't exist
 		}
 		recordID = records[0].ID
 	}
@@ -195,15 +488,35 @@ func (c *Client) DeleteRecord(ctx context.Context, name string, recordType strin
 	if _, err := withRetry(ctx, "delete_dns_record", func() (struct{}, error) {
 		return struct{}{}, c.api.DeleteDNSRecord(ctx, rc, recordID)
 	}); err != nil {
-		return fmt.Errorf("failed to delete DNS record: %w", err)
+		return false, fmt.Errorf("failed to delete DNS record: %w", err)
 	}
 
-	c.cacheMu.Lock()
-	delete(c.recordCache, cacheKey)
-	c.cacheMu.Unlock()
+	c.forgetRecord(cacheKey)
 
 	slog.Debug("Deleted DNS record", "name", name, "type", recordType)
-	return nil
+	return true, nil
+}
+
+// rememberRecord caches a record's ID and proxied flag.
+func (c *Client) rememberRecord(cacheKey, recordID string, proxied bool) {
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+	if c.recordCache == nil {
+		c.recordCache = make(map[string]string)
+	}
+	if c.proxiedCache == nil {
+		c.proxiedCache = make(map[string]bool)
+	}
+	c.recordCache[cacheKey] = recordID
+	c.proxiedCache[cacheKey] = proxied
+}
+
+// forgetRecord drops a record from the cache.
+func (c *Client) forgetRecord(cacheKey string) {
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+	delete(c.recordCache, cacheKey)
+	delete(c.proxiedCache, cacheKey)
 }
 
 // GetZoneInfo returns information about the configured zone
@@ -217,6 +530,65 @@ func (c *Client) GetZoneInfo(ctx context.Context) (*cloudflare.Zone, error) {
 	return &zone, nil
 }
 
+// ErrZoneMismatch reports that the configured domain is not within the
+// zone identified by CLOUDFLARE_ZONE_ID, so every record write would fail.
+type ErrZoneMismatch struct {
+	Zone   string
+	Domain string
+}
+
+func (e *ErrZoneMismatch) Error() string {
+	return fmt.Sprintf("domain %q is not within Cloudflare zone %q - check DOMAIN and CLOUDFLARE_ZONE_ID", e.Domain, e.Zone)
+}
+
+// CheckZone verifies the configured domain (the parent domain in prefix
+// mode, where records live) is the zone apex or a name within the zone.
+// It returns *ErrZoneMismatch when it is not. On success it remembers the
+// zone name and, in prefix mode, adopts it as the base domain, so records
+// are created directly under the zone however deep DOMAIN is. Call it
+// before any record is written.
+//
+// Names under the replaced base domain (app-a.b.example.com rather than
+// app-a-b.example.com for a.b.example.com) stay managed, so the stale
+// record cleanup removes what earlier versions published there.
+func (c *Client) CheckZone(ctx context.Context) error {
+	zone, err := c.GetZoneInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	zoneName := strings.ToLower(strings.TrimSuffix(zone.Name, "."))
+	domain := strings.ToLower(strings.TrimSuffix(c.baseDomain, "."))
+	if domain == "" {
+		domain = strings.ToLower(strings.TrimSuffix(c.domain, "."))
+	}
+	if domain != zoneName && !strings.HasSuffix(domain, "."+zoneName) {
+		return &ErrZoneMismatch{Zone: zone.Name, Domain: domain}
+	}
+
+	c.zoneName = zoneName
+	if c.prefixMode && domain != zoneName {
+		slog.Info("Using the Cloudflare zone as the prefix-mode base domain; records under the derived one are removed as stale",
+			"zone", zoneName, "derived", c.baseDomain)
+		c.legacyBase = domain
+		c.baseDomain = zoneName
+	}
+	return nil
+}
+
+// ZoneName returns the zone apex learned by CheckZone, or "" before a
+// successful check.
+func (c *Client) ZoneName() string {
+	return c.zoneName
+}
+
+// prefixLabel returns the part of domain below baseDomain with dots
+// replaced by dashes: "home" for home.example.com, "a-b" for
+// a.b.example.com in zone example.com.
+func prefixLabel(domain, baseDomain string) string {
+	return strings.ReplaceAll(strings.TrimSuffix(domain, "."+baseDomain), ".", "-")
+}
+
 // IsProxied returns whether Cloudflare proxy mode is enabled
 func (c *Client) IsProxied() bool {
 	return c.proxied
@@ -295,14 +667,25 @@ func (c *Client) IsAuthenticatedOriginPullEnabled(ctx context.Context) (bool, er
 }
 
 // ConfigureForProxyMode ensures Cloudflare is properly configured for proxy mode.
-// It sets SSL mode to "full" and enables Authenticated Origin Pull.
+// It sets the configured SSL mode (default "full") and enables Authenticated
+// Origin Pull. In "flexible" mode Cloudflare talks plain HTTP to the origin,
+// so there is no TLS handshake to authenticate and Origin Pull is left alone.
 func (c *Client) ConfigureForProxyMode(ctx context.Context) error {
-	// Set SSL mode to "full" (connects to origin on port 443)
+	// Default to "full" (connects to origin on port 443)
 	// Using "full" instead of "strict" because origin may use self-signed or Cloudflare Origin CA certs
-	if err := c.SetSSLMode(ctx, "full"); err != nil {
+	mode := c.sslMode
+	if mode == "" {
+		mode = "full"
+	}
+	if err := c.SetSSLMode(ctx, mode); err != nil {
 		return fmt.Errorf("failed to set SSL mode: %w", err)
 	}
 
+	if mode == "flexible" || mode == "off" {
+		slog.Warn("Cloudflare SSL mode does not use TLS to the origin, skipping Authenticated Origin Pull", "mode", mode)
+		return nil
+	}
+
 	// Enable Authenticated Origin Pull (mTLS)
 	if err := c.SetAuthenticatedOriginPull(ctx, true); err != nil {
 		return fmt.Errorf("failed to enable Authenticated Origin Pull: %w", err)
@@ -311,59 +694,149 @@ func (c *Client) ConfigureForProxyMode(ctx context.Context) error {
 	return nil
 }
 
+// ManagedRecord is a record of a managed type under a managed subdomain.
+type ManagedRecord struct {
+	Name    string
+	Type    string
+	Content string
+	Proxied bool
+	// TTL is the record's TTL in seconds; 1 is automatic (proxied) and 0
+	// unknown.
+	TTL int
+}
+
 // GetManagedRecordFQDNs returns all DNS record FQDNs managed by this service.
-// It looks for A and AAAA records that belong to this deployment based on:
+// It looks for records of the managed types (MANAGED_RECORD_TYPES, by
+// default A and AAAA) that belong to this deployment based on:
 // - Normal mode: subdomains of configured domain (e.g., app.zone.example.com)
 // - Prefix mode: records matching pattern {subdomain}-{zone}.{parent} (e.g., app-zone.example.com)
 func (c *Client) GetManagedRecordFQDNs(ctx context.Context) ([]string, error) {
-	rc := cloudflare.ZoneIdentifier(c.zoneID)
-
-	// Get all A records
-	aRecords, err := withRetry(ctx, "list_dns_records_a", func() ([]cloudflare.DNSRecord, error) {
-		records, _, err := c.api.ListDNSRecords(ctx, rc, cloudflare.ListDNSRecordsParams{
-			Type: "A",
-		})
-		return records, err
-	})
+	records, err := c.ListManagedRecords(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list A records: %w", err)
+		return nil, err
 	}
 
-	// Get all AAAA records
-	aaaaRecords, err := withRetry(ctx, "list_dns_records_aaaa", func() ([]cloudflare.DNSRecord, error) {
-		records, _, err := c.api.ListDNSRecords(ctx, rc, cloudflare.ListDNSRecordsParams{
-			Type: "AAAA",
+	seen := make(map[string]bool)
+	var fqdns []string
+	for _, r := range records {
+		if !seen[r.Name] {
+			seen[r.Name] = true
+			fqdns = append(fqdns, r.Name)
+		}
+	}
+
+	return fqdns, nil
+}
+
+// ListManagedRecords returns the records of the managed types under the
+// subdomains managed by this service (see GetManagedRecordFQDNs), with
+// lowercase names and without wildcards. Records of other types are never
+// returned, even when their name matches.
+func (c *Client) ListManagedRecords(ctx context.Context) ([]ManagedRecord, error) {
+	rc := cloudflare.ZoneIdentifier(c.zoneID)
+
+	var all []cloudflare.DNSRecord
+	for _, recordType := range c.managedTypes {
+		records, err := withRetry(ctx, "list_dns_records_"+strings.ToLower(recordType), func() ([]cloudflare.DNSRecord, error) {
+			records, _, err := c.api.ListDNSRecords(ctx, rc, cloudflare.ListDNSRecordsParams{
+				Type: recordType,
+			})
+			return records, err
 		})
-		return records, err
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to list AAAA records: %w", err)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s records: %w", recordType, err)
+		}
+		all = append(all, records...)
 	}
 
-	// Collect FQDNs that belong to this deployment
-	seen := make(map[string]bool)
-	var fqdns []string
+	// Collect records that belong to this deployment
+	var managed []ManagedRecord
 
-	for _, r := range append(aRecords, aaaaRecords...) {
+	for _, r := range all {
 		name := strings.ToLower(strings.TrimSuffix(r.Name, "."))
 
-		// Skip wildcards
-		if strings.HasPrefix(name, "*.") {
+		// Skip wildcards, and underscore names such as the
+		// _acme-challenge TXT records Caddy creates during DNS-01.
+		if strings.HasPrefix(name, "*.") || strings.HasPrefix(name, "_") {
 			continue
 		}
 
-		if c.IsManagedRecord(name) && !seen[name] {
-			seen[name] = true
-			fqdns = append(fqdns, name)
+		if c.IsManagedRecord(name) {
+			managed = append(managed, ManagedRecord{
+				Name:    name,
+				Type:    r.Type,
+				Content: r.Content,
+				Proxied: r.Proxied != nil && *r.Proxied,
+				TTL:     r.TTL,
+			})
 		}
 	}
 
-	return fqdns, nil
+	return managed, nil
+}
+
+// ListZoneRecords returns every record in the zone, of any type and
+// whoever created it, with lowercase names. The reconcile checks its plan
+// against them for names a CNAME would share with another record.
+func (c *Client) ListZoneRecords(ctx context.Context) ([]ManagedRecord, error) {
+	records, err := withRetry(ctx, "list_dns_records", func() ([]cloudflare.DNSRecord, error) {
+		records, _, err := c.api.ListDNSRecords(ctx, cloudflare.ZoneIdentifier(c.zoneID), cloudflare.ListDNSRecordsParams{})
+		return records, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list zone records: %w", err)
+	}
+
+	zone := make([]ManagedRecord, 0, len(records))
+	for _, r := range records {
+		zone = append(zone, ManagedRecord{
+			Name:    strings.ToLower(strings.TrimSuffix(r.Name, ".")),
+			Type:    r.Type,
+			Content: r.Content,
+			Proxied: r.Proxied != nil && *r.Proxied,
+			TTL:     r.TTL,
+		})
+	}
+	return zone, nil
+}
+
+// templateSubdomain reports whether fqdn is a label rendered by
+// SUBDOMAIN_NAME_TEMPLATE directly under baseDomain (or the base domain
+// CheckZone replaced), returning the subdomain it was rendered from.
+func (c *Client) templateSubdomain(fqdn string) (string, bool) {
+	if c.labelPattern == nil {
+		return "", false
+	}
+	fqdn = strings.ToLower(strings.TrimSuffix(fqdn, "."))
+	if sub, ok := c.templateSubdomainUnder(fqdn, c.baseDomain); ok {
+		return sub, true
+	}
+	if c.legacyBase != "" {
+		return c.templateSubdomainUnder(fqdn, c.legacyBase)
+	}
+	return "", false
+}
+
+// templateSubdomainUnder matches the lowercase fqdn against the template
+// directly under baseDomain.
+func (c *Client) templateSubdomainUnder(fqdn, baseDomain string) (string, bool) {
+	baseDomain = strings.ToLower(strings.TrimSuffix(baseDomain, "."))
+	label, ok := strings.CutSuffix(fqdn, "."+baseDomain)
+	if !ok || strings.Contains(label, ".") {
+		return "", false
+	}
+	m := c.labelPattern.FindStringSubmatch(label)
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
 }
 
 // IsManagedRecord checks if a DNS record FQDN belongs to this dyndns deployment.
 // In normal mode: checks if record is a subdomain of c.domain (e.g., app.zone.example.com)
-// In prefix mode: checks if record matches pattern {x}-{zone}.{parent} where domain is zone.parent
+// In prefix mode: checks if record matches pattern {x}-{zone}.{parent} where domain is zone.parent,
+// under the base domain or the one CheckZone replaced
+// With SUBDOMAIN_NAME_TEMPLATE: checks the label under baseDomain against the template
 func (c *Client) IsManagedRecord(fqdn string) bool {
 	fqdn = strings.ToLower(strings.TrimSuffix(fqdn, "."))
 	domain := strings.ToLower(strings.TrimSuffix(c.domain, "."))
@@ -374,6 +847,12 @@ func (c *Client) IsManagedRecord(fqdn string) bool {
 		return false
 	}
 
+	// Name template: ownership follows the template exactly
+	if c.labelPattern != nil {
+		_, ok := c.templateSubdomain(fqdn)
+		return ok
+	}
+
 	// Normal mode: record is subdomain of domain (e.g., app.zone.example.com when domain is zone.example.com)
 	if strings.HasSuffix(fqdn, "."+domain) {
 		return true
@@ -381,26 +860,31 @@ func (c *Client) IsManagedRecord(fqdn string) bool {
 
 	// Prefix mode: record matches pattern {subdomain}-{zone}.{parent}
 	// e.g., app-home.example.com when domain is home.example.com
-	if baseDomain != "" && baseDomain != domain {
-		// Extract zone part from domain (first part before the dot)
-		parts := strings.SplitN(domain, ".", 2)
-		if len(parts) >= 1 {
-			zonePart := parts[0] // e.g., "home" from "home.example.com"
-			// Check if record ends with -{zone}.{baseDomain}
-			suffix := "-" + zonePart + "." + baseDomain // e.g., "-home.example.com"
-			if strings.HasSuffix(fqdn, suffix) {
-				// Ensure there's a subdomain part before the suffix
-				prefix := strings.TrimSuffix(fqdn, suffix)
-				if prefix != "" && !strings.Contains(prefix, ".") {
-					return true
-				}
-			}
-		}
+	if baseDomain != "" && baseDomain != domain && prefixManaged(fqdn, domain, baseDomain) {
+		return true
+	}
+	if c.legacyBase != "" && fqdn != c.legacyBase {
+		return prefixManaged(fqdn, domain, c.legacyBase)
 	}
 
 	return false
 }
 
+// prefixManaged reports whether fqdn is {x}-{zone}.{baseDomain} with a
+// single-label x, where zone is domain below baseDomain.
+func prefixManaged(fqdn, domain, baseDomain string) bool {
+	// Zone part is domain below baseDomain, e.g. "home" from "home.example.com"
+	zonePart := prefixLabel(domain, baseDomain)
+	// Check if record ends with -{zone}.{baseDomain}
+	suffix := "-" + zonePart + "." + baseDomain // e.g., "-home.example.com"
+	if !strings.HasSuffix(fqdn, suffix) {
+		return false
+	}
+	// Ensure there's a subdomain part before the suffix
+	prefix := strings.TrimSuffix(fqdn, suffix)
+	return prefix != "" && !strings.Contains(prefix, ".")
+}
+
 // GetManagedSubdomainRecords returns all subdomain DNS records managed by this service.
 // Deprecated: Use GetManagedRecordFQDNs for better prefix mode support.
 // This method is kept for backwards compatibility.
@@ -420,18 +904,17 @@ func (c *Client) GetManagedSubdomainRecords(ctx context.Context) ([]string, erro
 	for _, fqdn := range fqdns {
 		var subdomain string
 
-		// Try normal mode extraction
-		if strings.HasSuffix(fqdn, "."+domain) {
+		if c.labelPattern != nil {
+			// Name template extraction: app-dev.zone.example.com -> app
+			subdomain, _ = c.templateSubdomain(fqdn)
+		} else if strings.HasSuffix(fqdn, "."+domain) {
+			// Normal mode extraction
 			subdomain = strings.TrimSuffix(fqdn, "."+domain)
 		} else if baseDomain != "" && baseDomain != domain {
 			// Try prefix mode extraction: app-home.example.com -> app
-			parts := strings.SplitN(domain, ".", 2)
-			if len(parts) >= 1 {
-				zonePart := parts[0]
-				suffix := "-" + zonePart + "." + baseDomain
-				if strings.HasSuffix(fqdn, suffix) {
-					subdomain = strings.TrimSuffix(fqdn, suffix)
-				}
+			suffix := "-" + prefixLabel(domain, baseDomain) + "." + baseDomain
+			if strings.HasSuffix(fqdn, suffix) {
+				subdomain = strings.TrimSuffix(fqdn, suffix)
 			}
 		}
 
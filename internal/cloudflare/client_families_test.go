@@ -0,0 +1,122 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+// TestUpdateNameRecords_PartialFailure verifies that when AAAA fails but A
+// succeeds for the same name, the outcome is reported as one grouped partial
+// result and the failed family is retried on the next call.
+func TestUpdateNameRecords_PartialFailure(t *testing.T) {
+	var mu sync.Mutex
+	creates := map[string]int{}
+	failAAAA := true
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/dns_records"):
+			writeJSON(w, map[string]any{
+				"result":  []any{},
+				"success": true,
+				"errors":  []any{},
+			})
+		case r.Method == http.MethodPost && strings.Contains(r.URL.Path, "/dns_records"):
+			var body struct {
+				Type string `json:"type"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			mu.Lock()
+			creates[body.Type]++
+			fail := body.Type == "AAAA" && failAAAA
+			mu.Unlock()
+			if fail {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				_ = json.NewEncoder(w).Encode(map[string]any{
+					"result":  nil,
+					"success": false,
+					"errors":  []any{map[string]any{"code": 9005, "message": "invalid content"}},
+				})
+				return
+			}
+			writeJSON(w, map[string]any{
+				"result":  map[string]any{"id": "rec_" + body.Type},
+				"success": true,
+				"errors":  []any{},
+			})
+		case r.Method == http.MethodPatch && strings.Contains(r.URL.Path, "/dns_records/"):
+			writeJSON(w, map[string]any{
+				"result":  map[string]any{"id": r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]},
+				"success": true,
+				"errors":  []any{},
+			})
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	api, err := cloudflare.NewWithAPIToken("test-token", cloudflare.BaseURL(srv.URL+"/client/v4"))
+	if err != nil {
+		t.Fatalf("cloudflare client: %v", err)
+	}
+	c := &Client{
+		api:         api,
+		zoneID:      "zone123",
+		domain:      "example.com",
+		baseDomain:  "example.com",
+		ttl:         60,
+		recordCache: map[string]string{},
+	}
+
+	updates := []RecordUpdate{
+		{Type: "A", Content: "1.2.3.4"},
+		{Type: "AAAA", Content: "2001:db8::1"},
+	}
+
+	res := c.UpdateNameRecords(context.Background(), "app.example.com", updates)
+	if !res.Partial() {
+		t.Fatalf("Partial() = false, want true (updated=%v failed=%v)", res.Updated, res.Failed)
+	}
+	if len(res.Updated) != 1 || res.Updated[0] != "A" {
+		t.Errorf("Updated = %v, want [A]", res.Updated)
+	}
+	if got := res.FailedTypes(); len(got) != 1 || got[0] != "AAAA" {
+		t.Errorf("FailedTypes() = %v, want [AAAA]", got)
+	}
+	if res.Err() == nil || !strings.Contains(res.Err().Error(), "AAAA") {
+		t.Errorf("Err() = %v, want an error mentioning AAAA", res.Err())
+	}
+	if len(res.Retried) != 0 {
+		t.Errorf("Retried = %v, want none on first attempt", res.Retried)
+	}
+
+	// Next cycle: AAAA recovers and is reported as a retry.
+	mu.Lock()
+	failAAAA = false
+	mu.Unlock()
+
+	res = c.UpdateNameRecords(context.Background(), "app.example.com", updates)
+	if res.Err() != nil {
+		t.Fatalf("second cycle Err() = %v, want nil", res.Err())
+	}
+	if len(res.Retried) != 1 || res.Retried[0] != "AAAA" {
+		t.Errorf("Retried = %v, want [AAAA]", res.Retried)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if creates["AAAA"] != 2 {
+		t.Errorf("AAAA create attempts = %d, want 2", creates["AAAA"])
+	}
+}
@@ -0,0 +1,71 @@
+package cloudflare
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+)
+
+// TestListManagedRecords_Types verifies that only the configured record
+// types are enumerated: CNAMEs are included with A,AAAA,CNAME while a TXT
+// of a managed name, and ACME challenge names, are left out.
+func TestListManagedRecords_Types(t *testing.T) {
+	srv := MockCloudflareServer(t)
+	defer srv.Close()
+
+	cfg := &config.Config{
+		Domain:               "zone.example.com",
+		CloudflareAPIToken:   "test-token",
+		CloudflareZoneID:     "test-zone-id",
+		CloudflareAPIBaseURL: srv.URL + "/client/v4",
+		DNSTTL:               60,
+		ManagedRecordTypes:   []string{"A", "AAAA", "CNAME"},
+	}
+	client, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() unexpected error: %v", err)
+	}
+	ctx := context.Background()
+
+	for _, rec := range []struct{ name, recordType, content string }{
+		{"app.zone.example.com", "A", "203.0.113.1"},
+		{"app.zone.example.com", "TXT", "owner=someone-else"},
+		{"alias.zone.example.com", "CNAME", "app.zone.example.com"},
+		{"_acme-challenge.app.zone.example.com", "CNAME", "challenges.example.net"},
+	} {
+		if err := client.UpdateRecord(ctx, rec.name, rec.recordType, rec.content); err != nil {
+			t.Fatalf("UpdateRecord(%s %s): %v", rec.name, rec.recordType, err)
+		}
+	}
+
+	records, err := client.ListManagedRecords(ctx)
+	if err != nil {
+		t.Fatalf("ListManagedRecords(): %v", err)
+	}
+	var got []string
+	for _, r := range records {
+		got = append(got, fmt.Sprintf("%s %s", r.Type, r.Name))
+	}
+	sort.Strings(got)
+	want := []string{"A app.zone.example.com", "CNAME alias.zone.example.com"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("ListManagedRecords() = %v, want %v", got, want)
+	}
+
+	// The default set ignores the CNAME.
+	cfg.ManagedRecordTypes = nil
+	client, err = New(cfg)
+	if err != nil {
+		t.Fatalf("New() unexpected error: %v", err)
+	}
+	fqdns, err := client.GetManagedRecordFQDNs(ctx)
+	if err != nil {
+		t.Fatalf("GetManagedRecordFQDNs(): %v", err)
+	}
+	if want := []string{"app.zone.example.com"}; fmt.Sprint(fqdns) != fmt.Sprint(want) {
+		t.Errorf("GetManagedRecordFQDNs() = %v, want %v", fqdns, want)
+	}
+}
@@ -0,0 +1,105 @@
+package cloudflare
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+)
+
+func newTemplateClient(t *testing.T, cfg *config.Config) *Client {
+	t.Helper()
+	cfg.CloudflareAPIToken = "test-token"
+	cfg.CloudflareZoneID = "test-zone-id"
+	client, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() unexpected error: %v", err)
+	}
+	return client
+}
+
+// TestNameTemplate_ValidationAndOwnership verifies that with
+// SUBDOMAIN_NAME_TEMPLATE the names built by GetSubdomainFQDN pass
+// validation and are recognized as managed, while other names under the
+// parent are not.
+func TestNameTemplate_ValidationAndOwnership(t *testing.T) {
+	cfg := &config.Config{
+		Domain:                "zone.example.com",
+		SubdomainPrefix:       true,
+		SubdomainNameTemplate: "{sub}-{env}-{zone}",
+		SubdomainNameEnv:      "dev",
+	}
+	client := newTemplateClient(t, cfg)
+
+	name := cfg.GetSubdomainFQDN("app")
+	if name != "app-dev-zone.example.com" {
+		t.Fatalf("GetSubdomainFQDN(app) = %q", name)
+	}
+	if err := client.validateRecordName(name); err != nil {
+		t.Errorf("validateRecordName(%q) = %v, want nil", name, err)
+	}
+	if !client.IsManagedRecord(name) || !client.IsManagedRecord("APP-DEV-ZONE.example.com.") {
+		t.Errorf("IsManagedRecord(%q) = false, want true", name)
+	}
+
+	// Still in scope: the zone itself and anything under it.
+	for _, ok := range []string{"zone.example.com", "*.zone.example.com", "x.zone.example.com"} {
+		if err := client.validateRecordName(ok); err != nil {
+			t.Errorf("validateRecordName(%q) = %v, want nil", ok, err)
+		}
+	}
+
+	// Under the parent but not produced by the template: out of scope and
+	// not owned (e.g. another environment, legacy prefix names, the parent).
+	for _, foreign := range []string{
+		"app-prod-zone.example.com",
+		"app-zone.example.com",
+		"www.example.com",
+		"example.com",
+		"a.app-dev-zone.example.com",
+	} {
+		if err := client.validateRecordName(foreign); err == nil {
+			t.Errorf("validateRecordName(%q) = nil, want out of scope", foreign)
+		}
+		if client.IsManagedRecord(foreign) {
+			t.Errorf("IsManagedRecord(%q) = true, want false", foreign)
+		}
+	}
+}
+
+// TestNameTemplate_ManagedSubdomainExtraction verifies that reconciliation
+// maps templated record names back to their subdomains.
+func TestNameTemplate_ManagedSubdomainExtraction(t *testing.T) {
+	srv := MockCloudflareServer(t)
+	defer srv.Close()
+
+	cfg := &config.Config{
+		Domain:                "zone.example.com",
+		SubdomainNameTemplate: "dev-{sub}",
+		CloudflareAPIBaseURL:  srv.URL + "/client/v4",
+		DNSTTL:                60,
+	}
+	client := newTemplateClient(t, cfg)
+	ctx := context.Background()
+
+	for _, name := range []string{
+		cfg.GetSubdomainFQDN("app"),
+		cfg.GetSubdomainFQDN("api"),
+		"prod-app.zone.example.com", // same zone, different environment
+	} {
+		if err := client.UpdateRecord(ctx, name, "A", "203.0.113.1"); err != nil {
+			t.Fatalf("UpdateRecord(%s): %v", name, err)
+		}
+	}
+
+	subs, err := client.GetManagedSubdomainRecords(ctx)
+	if err != nil {
+		t.Fatalf("GetManagedSubdomainRecords(): %v", err)
+	}
+	sort.Strings(subs)
+	if want := []string{"api", "app"}; !reflect.DeepEqual(subs, want) {
+		t.Errorf("GetManagedSubdomainRecords() = %v, want %v", subs, want)
+	}
+}
@@ -3,11 +3,15 @@ package cloudflare
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 
+	"github.com/cloudflare/cloudflare-go"
 	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
 )
 
@@ -51,10 +55,14 @@ func TestNew_EmptyToken(t *testing.T) {
 
 // MockCloudflareServer creates a test server that simulates Cloudflare API
 func MockCloudflareServer(t *testing.T) *httptest.Server {
-	records := make(map[string]map[string]interface{})
+	var mu sync.Mutex
+	records := make(map[string]map[string]interface{}) // keyed by record ID
 	nextID := 1
 
 	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
 		w.Header().Set("Content-Type", "application/json")
 
 		// Check authorization
@@ -69,13 +77,17 @@ func MockCloudflareServer(t *testing.T) *httptest.Server {
 		}
 
 		path := r.URL.Path
+		recordID := ""
+		if i := strings.Index(path, "/dns_records/"); i >= 0 {
+			recordID = path[i+len("/dns_records/"):]
+		}
 
 		// List DNS records
 		if strings.Contains(path, "/dns_records") && r.Method == "GET" {
 			name := r.URL.Query().Get("name")
 			recordType := r.URL.Query().Get("type")
 
-			var result []map[string]interface{}
+			result := []map[string]interface{}{}
 			for _, rec := range records {
 				if (name == "" || rec["name"] == name) && (recordType == "" || rec["type"] == recordType) {
 					result = append(result, rec)
@@ -85,6 +97,9 @@ func MockCloudflareServer(t *testing.T) *httptest.Server {
 			_ = json.NewEncoder(w).Encode(map[string]interface{}{
 				"success": true,
 				"result":  result,
+				"result_info": map[string]interface{}{
+					"page": 1, "per_page": 100, "count": len(result), "total_count": len(result), "total_pages": 1,
+				},
 			})
 			return
 		}
@@ -94,7 +109,7 @@ func MockCloudflareServer(t *testing.T) *httptest.Server {
 			var body map[string]interface{}
 			_ = json.NewDecoder(r.Body).Decode(&body)
 
-			id := nextID
+			id := fmt.Sprintf("rec%d", nextID)
 			nextID++
 			record := map[string]interface{}{
 				"id":      id,
@@ -104,7 +119,7 @@ func MockCloudflareServer(t *testing.T) *httptest.Server {
 				"ttl":     body["ttl"],
 				"proxied": body["proxied"],
 			}
-			records[body["name"].(string)+":"+body["type"].(string)] = record
+			records[id] = record
 
 			_ = json.NewEncoder(w).Encode(map[string]interface{}{
 				"success": true,
@@ -114,13 +129,16 @@ func MockCloudflareServer(t *testing.T) *httptest.Server {
 		}
 
 		// Update DNS record
-		if strings.Contains(path, "/dns_records/") && r.Method == "PATCH" {
+		if recordID != "" && r.Method == "PATCH" {
 			var body map[string]interface{}
 			_ = json.NewDecoder(r.Body).Decode(&body)
 
-			key := body["name"].(string) + ":" + body["type"].(string)
-			if record, ok := records[key]; ok {
-				record["content"] = body["content"]
+			if record, ok := records[recordID]; ok {
+				for _, field := range []string{"content", "ttl", "proxied"} {
+					if v, ok := body[field]; ok {
+						record[field] = v
+					}
+				}
 				_ = json.NewEncoder(w).Encode(map[string]interface{}{
 					"success": true,
 					"result":  record,
@@ -137,10 +155,11 @@ func MockCloudflareServer(t *testing.T) *httptest.Server {
 		}
 
 		// Delete DNS record
-		if strings.Contains(path, "/dns_records/") && r.Method == "DELETE" {
+		if recordID != "" && r.Method == "DELETE" {
+			delete(records, recordID)
 			_ = json.NewEncoder(w).Encode(map[string]interface{}{
 				"success": true,
-				"result":  map[string]interface{}{"id": "deleted"},
+				"result":  map[string]interface{}{"id": recordID},
 			})
 			return
 		}
@@ -162,6 +181,240 @@ func MockCloudflareServer(t *testing.T) *httptest.Server {
 	}))
 }
 
+// TestClient_MockServerRecordLifecycle wires New to MockCloudflareServer via
+// CloudflareAPIBaseURL and exercises create, update and delete.
+func TestClient_MockServerRecordLifecycle(t *testing.T) {
+	srv := MockCloudflareServer(t)
+	defer srv.Close()
+
+	client, err := New(&config.Config{
+		CloudflareAPIToken:   "test-token",
+		CloudflareZoneID:     "test-zone-id",
+		CloudflareAPIBaseURL: srv.URL + "/client/v4",
+		Domain:               "example.com",
+		DNSTTL:               60,
+	})
+	if err != nil {
+		t.Fatalf("New() unexpected error: %v", err)
+	}
+	ctx := context.Background()
+
+	lookup := func() []cloudflare.DNSRecord {
+		t.Helper()
+		records, _, err := client.api.ListDNSRecords(ctx, cloudflare.ZoneIdentifier("test-zone-id"),
+			cloudflare.ListDNSRecordsParams{Name: "app.example.com", Type: "A"})
+		if err != nil {
+			t.Fatalf("ListDNSRecords: %v", err)
+		}
+		return records
+	}
+
+	if err := client.Ping(ctx); err != nil {
+		t.Fatalf("Ping() against mock: %v", err)
+	}
+
+	if err := client.UpdateRecord(ctx, "app.example.com", "A", "203.0.113.1"); err != nil {
+		t.Fatalf("UpdateRecord() create: %v", err)
+	}
+	if records := lookup(); len(records) != 1 || records[0].Content != "203.0.113.1" {
+		t.Fatalf("after create: records = %+v, want one A with 203.0.113.1", records)
+	}
+
+	if err := client.UpdateRecord(ctx, "app.example.com", "A", "203.0.113.2"); err != nil {
+		t.Fatalf("UpdateRecord() update: %v", err)
+	}
+	if records := lookup(); len(records) != 1 || records[0].Content != "203.0.113.2" {
+		t.Fatalf("after update: records = %+v, want one A with 203.0.113.2", records)
+	}
+
+	if err := client.DeleteRecord(ctx, "app.example.com", "A"); err != nil {
+		t.Fatalf("DeleteRecord(): %v", err)
+	}
+	if records := lookup(); len(records) != 0 {
+		t.Fatalf("after delete: records = %+v, want none", records)
+	}
+}
+
+// TestClient_ProxiedFlipUpdatesRecord verifies that switching a subdomain
+// between proxied and direct updates the existing record's proxied flag and
+// TTL, including when the cached record ID has gone stale.
+func TestClient_ProxiedFlipUpdatesRecord(t *testing.T) {
+	srv := MockCloudflareServer(t)
+	defer srv.Close()
+
+	client, err := New(&config.Config{
+		CloudflareAPIToken:   "test-token",
+		CloudflareZoneID:     "test-zone-id",
+		CloudflareAPIBaseURL: srv.URL + "/client/v4",
+		Domain:               "example.com",
+		DNSTTL:               300,
+	})
+	if err != nil {
+		t.Fatalf("New() unexpected error: %v", err)
+	}
+	ctx := context.Background()
+	rc := cloudflare.ZoneIdentifier("test-zone-id")
+
+	lookup := func() cloudflare.DNSRecord {
+		t.Helper()
+		records, _, err := client.api.ListDNSRecords(ctx, rc,
+			cloudflare.ListDNSRecordsParams{Name: "app.example.com", Type: "A"})
+		if err != nil {
+			t.Fatalf("ListDNSRecords: %v", err)
+		}
+		if len(records) != 1 {
+			t.Fatalf("records = %+v, want exactly one", records)
+		}
+		return records[0]
+	}
+	check := func(step string, wantProxied bool, wantTTL int) {
+		t.Helper()
+		rec := lookup()
+		if rec.Proxied == nil || *rec.Proxied != wantProxied || rec.TTL != wantTTL {
+			t.Errorf("%s: proxied=%v ttl=%d, want proxied=%v ttl=%d", step, rec.Proxied, rec.TTL, wantProxied, wantTTL)
+		}
+	}
+
+	if err := client.UpdateRecordProxied(ctx, "app.example.com", "A", "203.0.113.1", false); err != nil {
+		t.Fatalf("create direct: %v", err)
+	}
+	check("direct", false, 300)
+	firstID := lookup().ID
+
+	if err := client.UpdateRecordProxied(ctx, "app.example.com", "A", "203.0.113.1", true); err != nil {
+		t.Fatalf("flip to proxied: %v", err)
+	}
+	check("proxied", true, 1)
+	if id := lookup().ID; id != firstID {
+		t.Errorf("record ID changed from %s to %s, want an in-place update", firstID, id)
+	}
+
+	// Recreate the record out-of-band so the cached ID is stale, then flip
+	// back: the update must land on the current record.
+	if err := client.api.DeleteDNSRecord(ctx, rc, firstID); err != nil {
+		t.Fatalf("DeleteDNSRecord: %v", err)
+	}
+	if _, err := client.api.CreateDNSRecord(ctx, rc, cloudflare.CreateDNSRecordParams{
+		Type: "A", Name: "app.example.com", Content: "203.0.113.1", TTL: 1, Proxied: cloudflare.BoolPtr(true),
+	}); err != nil {
+		t.Fatalf("CreateDNSRecord: %v", err)
+	}
+
+	if err := client.UpdateRecordProxied(ctx, "app.example.com", "A", "203.0.113.1", false); err != nil {
+		t.Fatalf("flip to direct with stale ID: %v", err)
+	}
+	check("direct again", false, 300)
+}
+
+// TestClient_UpdateRecord_NonProxiableTypes verifies that in proxy mode only
+// A/AAAA/CNAME records are proxied; TXT, CAA, MX and NS are sent with
+// proxied=false.
+func TestClient_UpdateRecord_NonProxiableTypes(t *testing.T) {
+	srv := MockCloudflareServer(t)
+	defer srv.Close()
+
+	client, err := New(&config.Config{
+		CloudflareAPIToken:   "test-token",
+		CloudflareZoneID:     "test-zone-id",
+		CloudflareAPIBaseURL: srv.URL + "/client/v4",
+		Domain:               "example.com",
+		CloudflareProxy:      true,
+		DNSTTL:               300,
+	})
+	if err != nil {
+		t.Fatalf("New() unexpected error: %v", err)
+	}
+	ctx := context.Background()
+
+	tests := []struct {
+		recordType  string
+		content     string
+		wantProxied bool
+		wantTTL     int
+	}{
+		{"A", "203.0.113.1", true, 1},
+		{"CNAME", "target.example.com", true, 1},
+		{"TXT", "acme-challenge-token", false, 300},
+		{"CAA", `0 issue "letsencrypt.org"`, false, 300},
+		{"MX", "mail.example.com", false, 300},
+		{"NS", "ns1.example.com", false, 300},
+	}
+	for _, tt := range tests {
+		name := strings.ToLower(tt.recordType) + ".example.com"
+		if err := client.UpdateRecord(ctx, name, tt.recordType, tt.content); err != nil {
+			t.Fatalf("UpdateRecord(%s): %v", tt.recordType, err)
+		}
+		records, _, err := client.api.ListDNSRecords(ctx, cloudflare.ZoneIdentifier("test-zone-id"),
+			cloudflare.ListDNSRecordsParams{Name: name, Type: tt.recordType})
+		if err != nil || len(records) != 1 {
+			t.Fatalf("%s: records = %+v, err = %v; want exactly one", tt.recordType, records, err)
+		}
+		rec := records[0]
+		if rec.Proxied == nil || *rec.Proxied != tt.wantProxied || rec.TTL != tt.wantTTL {
+			t.Errorf("%s: proxied=%v ttl=%d, want proxied=%v ttl=%d", tt.recordType, rec.Proxied, rec.TTL, tt.wantProxied, tt.wantTTL)
+		}
+	}
+}
+
+// TestRemoveWildcardRecords verifies that switching to proxy mode deletes the
+// wildcard records left over from direct mode and nothing else.
+func TestRemoveWildcardRecords(t *testing.T) {
+	srv := MockCloudflareServer(t)
+	defer srv.Close()
+	ctx := context.Background()
+
+	newClient := func(proxied bool) *Client {
+		t.Helper()
+		client, err := New(&config.Config{
+			CloudflareAPIToken:   "test-token",
+			CloudflareZoneID:     "test-zone-id",
+			CloudflareAPIBaseURL: srv.URL + "/client/v4",
+			CloudflareProxy:      proxied,
+			Domain:               "example.com",
+			DNSTTL:               60,
+		})
+		if err != nil {
+			t.Fatalf("New() unexpected error: %v", err)
+		}
+		return client
+	}
+
+	// Direct mode publishes the wildcard plus a regular record.
+	direct := newClient(false)
+	for _, rec := range []struct{ name, typ, content string }{
+		{"*.example.com", "A", "203.0.113.1"},
+		{"*.example.com", "AAAA", "2001:db8::1"},
+		{"app.example.com", "A", "203.0.113.1"},
+	} {
+		if err := direct.UpdateRecord(ctx, rec.name, rec.typ, rec.content); err != nil {
+			t.Fatalf("UpdateRecord(%s %s): %v", rec.name, rec.typ, err)
+		}
+	}
+
+	// A fresh process in proxy mode has an empty cache and must look up.
+	proxy := newClient(true)
+	removed, err := proxy.RemoveWildcardRecords(ctx)
+	if err != nil {
+		t.Fatalf("RemoveWildcardRecords(): %v", err)
+	}
+	if strings.Join(removed, ",") != "A,AAAA" {
+		t.Errorf("removed = %v, want [A AAAA]", removed)
+	}
+
+	records, _, err := proxy.api.ListDNSRecords(ctx, cloudflare.ZoneIdentifier("test-zone-id"), cloudflare.ListDNSRecordsParams{})
+	if err != nil {
+		t.Fatalf("ListDNSRecords: %v", err)
+	}
+	if len(records) != 1 || records[0].Name != "app.example.com" {
+		t.Errorf("remaining records = %+v, want only app.example.com", records)
+	}
+
+	// Idempotent once the wildcard is gone.
+	if removed, err := proxy.RemoveWildcardRecords(ctx); err != nil || len(removed) != 0 {
+		t.Errorf("second RemoveWildcardRecords() = %v, %v; want nothing removed", removed, err)
+	}
+}
+
 func TestClient_RecordCache(t *testing.T) {
 	cfg := &config.Config{
 		CloudflareAPIToken: "test-token",
@@ -276,20 +529,34 @@ func TestClient_UpdateRecord_Integration(t *testing.T) {
 
 // Test error handling
 func TestClient_UpdateRecord_Errors(t *testing.T) {
-	// Create a server that returns errors
+	// Create a server that returns errors (400: not retried, keeps the test fast)
 	errorServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(http.StatusBadRequest)
 		_ = json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
-			"errors":  []map[string]interface{}{{"message": "Internal error"}},
+			"errors":  []map[string]interface{}{{"code": 1004, "message": "Internal error"}},
 		})
 	}))
 	defer errorServer.Close()
 
-	// Note: We can't easily test this without modifying the client to allow
-	// custom API endpoints. This is here as documentation of the test structure.
-	t.Log("Error handling test requires custom API endpoint support")
+	client, err := New(&config.Config{
+		CloudflareAPIToken:   "test-token",
+		CloudflareZoneID:     "test-zone-id",
+		CloudflareAPIBaseURL: errorServer.URL,
+		Domain:               "example.com",
+	})
+	if err != nil {
+		t.Fatalf("New() unexpected error: %v", err)
+	}
+
+	err = client.UpdateRecord(context.Background(), "app.example.com", "A", "203.0.113.1")
+	if err == nil {
+		t.Fatal("UpdateRecord() expected error from failing API")
+	}
+	if !strings.Contains(err.Error(), "failed to list DNS records") {
+		t.Errorf("UpdateRecord() error = %v, want list failure", err)
+	}
 }
 
 // Benchmark cache operations
@@ -374,6 +641,10 @@ func TestValidateRecordName(t *testing.T) {
 			if !tt.wantError && err != nil {
 				t.Errorf("validateRecordName(%q) unexpected error: %v", tt.record, err)
 			}
+			var scopeErr *ErrOutOfScope
+			if tt.wantError && err != nil && !errors.As(err, &scopeErr) {
+				t.Errorf("validateRecordName(%q) error should be *ErrOutOfScope: %v", tt.record, err)
+			}
 			if tt.wantError && err != nil && !strings.Contains(err.Error(), "SECURITY") {
 				t.Errorf("validateRecordName(%q) error should contain 'SECURITY': %v", tt.record, err)
 			}
@@ -381,6 +652,172 @@ func TestValidateRecordName(t *testing.T) {
 	}
 }
 
+// TestCheckZone verifies the configured domain is checked against the name
+// of the zone the mock serves (example.com).
+func TestCheckZone(t *testing.T) {
+	srv := MockCloudflareServer(t)
+	defer srv.Close()
+
+	tests := []struct {
+		domain       string
+		prefix       bool
+		wantMismatch bool
+	}{
+		{domain: "example.com"},
+		{domain: "home.example.com"},
+		{domain: "zone.example.com", prefix: true},
+		{domain: "example.org", wantMismatch: true},
+		{domain: "notexample.com", wantMismatch: true},
+		{domain: "zone.example.net", prefix: true, wantMismatch: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.domain, func(t *testing.T) {
+			client, err := New(&config.Config{
+				CloudflareAPIToken:   "test-token",
+				CloudflareZoneID:     "test-zone-id",
+				CloudflareAPIBaseURL: srv.URL + "/client/v4",
+				Domain:               tt.domain,
+				SubdomainPrefix:      tt.prefix,
+			})
+			if err != nil {
+				t.Fatalf("New() unexpected error: %v", err)
+			}
+
+			err = client.CheckZone(context.Background())
+			var mismatch *ErrZoneMismatch
+			if got := errors.As(err, &mismatch); got != tt.wantMismatch {
+				t.Fatalf("CheckZone() = %v, want mismatch %v", err, tt.wantMismatch)
+			}
+			if !tt.wantMismatch && err != nil {
+				t.Fatalf("CheckZone() unexpected error: %v", err)
+			}
+			if mismatch != nil && (mismatch.Zone != "example.com" || !strings.Contains(err.Error(), "CLOUDFLARE_ZONE_ID")) {
+				t.Errorf("mismatch = %+v (%v), want zone example.com and a hint", mismatch, err)
+			}
+		})
+	}
+}
+
+// TestCheckZone_BaseDomainFromZone verifies that in prefix mode the zone
+// name (example.com in the mock) becomes the base domain, so names for a
+// deep DOMAIN are managed directly under the zone.
+func TestCheckZone_BaseDomainFromZone(t *testing.T) {
+	srv := MockCloudflareServer(t)
+	defer srv.Close()
+
+	cfg := &config.Config{
+		CloudflareAPIToken:   "test-token",
+		CloudflareZoneID:     "test-zone-id",
+		CloudflareAPIBaseURL: srv.URL + "/client/v4",
+		Domain:               "a.b.c.example.com",
+		SubdomainPrefix:      true,
+	}
+	client, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() unexpected error: %v", err)
+	}
+	if client.baseDomain != "b.c.example.com" {
+		t.Fatalf("baseDomain before CheckZone = %q, want b.c.example.com", client.baseDomain)
+	}
+
+	if err := client.CheckZone(context.Background()); err != nil {
+		t.Fatalf("CheckZone() unexpected error: %v", err)
+	}
+	if client.baseDomain != "example.com" || client.ZoneName() != "example.com" {
+		t.Fatalf("after CheckZone baseDomain = %q, ZoneName() = %q, want example.com", client.baseDomain, client.ZoneName())
+	}
+
+	cfg.ZoneName = client.ZoneName()
+	name := cfg.GetSubdomainFQDN("app")
+	if name != "app-a-b-c.example.com" {
+		t.Fatalf("GetSubdomainFQDN(app) = %q, want app-a-b-c.example.com", name)
+	}
+	if err := client.validateRecordName(name); err != nil {
+		t.Errorf("validateRecordName(%q) = %v, want nil", name, err)
+	}
+	if !client.IsManagedRecord(name) {
+		t.Errorf("IsManagedRecord(%q) = false, want true", name)
+	}
+	// Names under the derived base domain stay managed so they are cleaned up.
+	legacy := "app-a.b.c.example.com"
+	if !client.IsManagedRecord(legacy) {
+		t.Errorf("IsManagedRecord(%q) = false, want true (pre-zone name)", legacy)
+	}
+	if err := client.validateRecordName(legacy); err != nil {
+		t.Errorf("validateRecordName(%q) = %v, want nil", legacy, err)
+	}
+	for _, other := range []string{"app-b-c.example.com", "www.example.com"} {
+		if client.IsManagedRecord(other) {
+			t.Errorf("IsManagedRecord(%q) = true, want false", other)
+		}
+	}
+
+	// Normal mode keeps DOMAIN as the base domain.
+	normal, err := New(&config.Config{
+		CloudflareAPIToken:   "test-token",
+		CloudflareZoneID:     "test-zone-id",
+		CloudflareAPIBaseURL: srv.URL + "/client/v4",
+		Domain:               "a.b.c.example.com",
+	})
+	if err != nil {
+		t.Fatalf("New() unexpected error: %v", err)
+	}
+	if err := normal.CheckZone(context.Background()); err != nil {
+		t.Fatalf("CheckZone() unexpected error: %v", err)
+	}
+	if normal.baseDomain != "a.b.c.example.com" {
+		t.Errorf("normal mode baseDomain = %q, want a.b.c.example.com", normal.baseDomain)
+	}
+}
+
+// TestErrOutOfScope verifies scope violations surface as a typed error
+// through the public mutators, detectable with errors.As and errors.Is.
+func TestErrOutOfScope(t *testing.T) {
+	client, err := New(&config.Config{
+		CloudflareAPIToken: "test-token",
+		CloudflareZoneID:   "test-zone-id",
+		Domain:             "home.example.com",
+	})
+	if err != nil {
+		t.Fatalf("New() unexpected error: %v", err)
+	}
+
+	ops := map[string]func() error{
+		"UpdateRecord": func() error {
+			return client.UpdateRecord(context.Background(), "evil.org", "A", "1.2.3.4")
+		},
+		"UpdateRecordProxied": func() error {
+			return client.UpdateRecordProxied(context.Background(), "work.example.com", "A", "1.2.3.4", true)
+		},
+		"DeleteRecord": func() error {
+			return client.DeleteRecord(context.Background(), "evil.org", "AAAA")
+		},
+	}
+
+	for name, op := range ops {
+		t.Run(name, func(t *testing.T) {
+			err := op()
+			var scopeErr *ErrOutOfScope
+			if !errors.As(err, &scopeErr) {
+				t.Fatalf("error %v is not *ErrOutOfScope", err)
+			}
+			if scopeErr.Domain != "home.example.com" {
+				t.Errorf("Domain = %q, want %q", scopeErr.Domain, "home.example.com")
+			}
+			if !errors.Is(err, &ErrOutOfScope{}) {
+				t.Errorf("errors.Is(%v, &ErrOutOfScope{}) = false", err)
+			}
+			if !strings.Contains(err.Error(), "SECURITY") || !strings.Contains(err.Error(), scopeErr.Name) {
+				t.Errorf("error message lost detail: %v", err)
+			}
+		})
+	}
+
+	if err := client.validateRecordName("app.home.example.com"); errors.Is(err, &ErrOutOfScope{}) {
+		t.Errorf("in-scope name reported as out of scope: %v", err)
+	}
+}
+
 // TestValidateRecordName_DifferentDomains tests validation with various domain configurations
 func TestValidateRecordName_DifferentDomains(t *testing.T) {
 	testCases := []struct {
@@ -0,0 +1,58 @@
+package cloudflare
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+)
+
+// TestUnsafeAllowAnyRecordName verifies an out-of-scope write is refused
+// by default and proceeds against the API with
+// UNSAFE_ALLOW_ANY_RECORD_NAME.
+func TestUnsafeAllowAnyRecordName(t *testing.T) {
+	for _, allow := range []bool{false, true} {
+		t.Run(fmt.Sprintf("allow=%t", allow), func(t *testing.T) {
+			srv := MockCloudflareServer(t)
+			defer srv.Close()
+			client, err := New(&config.Config{
+				CloudflareAPIToken:       "test-token",
+				CloudflareZoneID:         "test-zone-id",
+				CloudflareAPIBaseURL:     srv.URL + "/client/v4",
+				Domain:                   "home.example.com",
+				UnsafeAllowAnyRecordName: allow,
+			})
+			if err != nil {
+				t.Fatalf("New() unexpected error: %v", err)
+			}
+			ctx := context.Background()
+
+			err = client.UpdateRecord(ctx, "app.delegated.example.org", "A", "203.0.113.10")
+			if !allow {
+				if !errors.Is(err, &ErrOutOfScope{}) {
+					t.Fatalf("UpdateRecord() = %v, want ErrOutOfScope", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UpdateRecord() unexpected error: %v", err)
+			}
+			// A fresh client finds the record in the mock and deletes it.
+			fresh, err := New(&config.Config{
+				CloudflareAPIToken:       "test-token",
+				CloudflareZoneID:         "test-zone-id",
+				CloudflareAPIBaseURL:     srv.URL + "/client/v4",
+				Domain:                   "home.example.com",
+				UnsafeAllowAnyRecordName: true,
+			})
+			if err != nil {
+				t.Fatalf("New() unexpected error: %v", err)
+			}
+			if deleted, err := fresh.deleteRecord(ctx, "app.delegated.example.org", "A"); err != nil || !deleted {
+				t.Errorf("deleteRecord() = %v, %v; want the created record deleted", deleted, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package cloudflare
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// HealthStatus is a snapshot of recent Cloudflare API reachability.
+type HealthStatus struct {
+	Healthy             bool      `json:"healthy"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	LastError           string    `json:"last_error,omitempty"`
+	LastSuccess         time.Time `json:"last_success"`
+	LastCheck           time.Time `json:"last_check"`
+}
+
+// HealthChecker caches the result of a Cloudflare API probe so health
+// endpoints can report reachability without calling the API per request.
+// It reports unhealthy once `threshold` consecutive probes have failed.
+type HealthChecker struct {
+	probe     func(context.Context) error
+	cacheTTL  time.Duration
+	threshold int
+	now       func() time.Time
+
+	mu                  sync.Mutex
+	lastCheck           time.Time
+	lastSuccess         time.Time
+	lastErr             error
+	consecutiveFailures int
+}
+
+// NewHealthChecker creates a checker around probe. Probe results are reused
+// for cacheTTL; threshold is the number of consecutive failures after which
+// the API is considered unreachable (minimum 1).
+func NewHealthChecker(probe func(context.Context) error, cacheTTL time.Duration, threshold int) *HealthChecker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &HealthChecker{
+		probe:     probe,
+		cacheTTL:  cacheTTL,
+		threshold: threshold,
+		now:       time.Now,
+	}
+}
+
+// Check returns the current reachability status, running the probe only when
+// the cached result is older than the cache TTL.
+func (h *HealthChecker) Check(ctx context.Context) HealthStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.lastCheck.IsZero() || h.now().Sub(h.lastCheck) >= h.cacheTTL {
+		err := h.probe(ctx)
+		h.lastCheck = h.now()
+		h.lastErr = err
+		if err != nil {
+			h.consecutiveFailures++
+		} else {
+			h.consecutiveFailures = 0
+			h.lastSuccess = h.lastCheck
+		}
+	}
+
+	status := HealthStatus{
+		Healthy:             h.consecutiveFailures < h.threshold,
+		ConsecutiveFailures: h.consecutiveFailures,
+		LastSuccess:         h.lastSuccess,
+		LastCheck:           h.lastCheck,
+	}
+	if h.lastErr != nil {
+		status.LastError = h.lastErr.Error()
+	}
+	return status
+}
+
+// Ping performs a lightweight authenticated API call (zone details) to
+// confirm Cloudflare is reachable with the configured token.
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.GetZoneInfo(ctx)
+	return err
+}
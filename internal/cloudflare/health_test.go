@@ -0,0 +1,82 @@
+package cloudflare
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestHealthChecker_FlipsAfterConsecutiveFailures verifies simulated API
+// failures turn the deep health unhealthy once the threshold is reached, and
+// that a single success restores it.
+func TestHealthChecker_FlipsAfterConsecutiveFailures(t *testing.T) {
+	var probeErr error
+	calls := 0
+	h := NewHealthChecker(func(context.Context) error {
+		calls++
+		return probeErr
+	}, time.Minute, 3)
+
+	now := time.Unix(1700000000, 0)
+	h.now = func() time.Time { return now }
+	advance := func() { now = now.Add(time.Minute) }
+
+	if st := h.Check(context.Background()); !st.Healthy {
+		t.Fatalf("initial status unhealthy: %+v", st)
+	}
+
+	probeErr = errors.New("api unreachable")
+	for i := 1; i <= 2; i++ {
+		advance()
+		st := h.Check(context.Background())
+		if !st.Healthy {
+			t.Fatalf("after %d failures: unhealthy before threshold: %+v", i, st)
+		}
+		if st.ConsecutiveFailures != i {
+			t.Errorf("ConsecutiveFailures = %d, want %d", st.ConsecutiveFailures, i)
+		}
+	}
+
+	advance()
+	st := h.Check(context.Background())
+	if st.Healthy {
+		t.Fatalf("after 3 failures: still healthy: %+v", st)
+	}
+	if st.LastError != "api unreachable" {
+		t.Errorf("LastError = %q, want %q", st.LastError, "api unreachable")
+	}
+
+	probeErr = nil
+	advance()
+	if st := h.Check(context.Background()); !st.Healthy || st.ConsecutiveFailures != 0 {
+		t.Errorf("after recovery: %+v, want healthy with 0 failures", st)
+	}
+
+	if calls != 5 {
+		t.Errorf("probe calls = %d, want 5", calls)
+	}
+}
+
+// TestHealthChecker_CachesProbe verifies repeated checks within the cache TTL
+// do not hit the API again.
+func TestHealthChecker_CachesProbe(t *testing.T) {
+	calls := 0
+	h := NewHealthChecker(func(context.Context) error {
+		calls++
+		return errors.New("down")
+	}, time.Minute, 1)
+
+	now := time.Unix(1700000000, 0)
+	h.now = func() time.Time { return now }
+
+	for i := 0; i < 5; i++ {
+		if st := h.Check(context.Background()); st.Healthy {
+			t.Fatalf("threshold=1 failure should be unhealthy: %+v", st)
+		}
+		now = now.Add(10 * time.Second)
+	}
+	if calls != 1 {
+		t.Errorf("probe calls = %d, want 1 (cached)", calls)
+	}
+}
@@ -5,7 +5,10 @@ import (
 	"errors"
 	"log/slog"
 	"net"
+	"net/http"
 	"time"
+
+	"github.com/cloudflare/cloudflare-go"
 )
 
 type retryConfig struct {
@@ -22,6 +25,25 @@ var cfRetryConfig = retryConfig{
 
 var cfRetrySleep = sleepWithContext
 
+// rateLimitBackoff multiplies the retry delay after a 429, giving the API
+// rate limit time to recover (still capped at maxDelay).
+const rateLimitBackoff = 4
+
+// retryableErrorCodes are Cloudflare API error codes reported on a 4xx
+// response that nevertheless denote a transient failure.
+var retryableErrorCodes = []int{
+	10000, // internal error
+}
+
+// retryClass is how a failed call is retried.
+type retryClass int
+
+const (
+	noRetry retryClass = iota
+	retryTransient
+	retryRateLimited
+)
+
 func withRetry[T any](ctx context.Context, operation string, fn func() (T, error)) (T, error) {
 	var zero T
 	var err error
@@ -32,11 +54,15 @@ func withRetry[T any](ctx context.Context, operation string, fn func() (T, error
 		if err == nil {
 			return result, nil
 		}
-		if !isRetryableError(err) || attempt == cfRetryConfig.maxRetries {
+		class := classifyError(err)
+		if class == noRetry || attempt == cfRetryConfig.maxRetries {
 			return zero, err
 		}
 
 		delay := retryDelay(attempt, cfRetryConfig.minDelay, cfRetryConfig.maxDelay)
+		if class == retryRateLimited {
+			delay = min(delay*rateLimitBackoff, cfRetryConfig.maxDelay)
+		}
 		slog.Warn("Cloudflare API call failed, retrying",
 			"operation", operation,
 			"attempt", attempt+1,
@@ -52,20 +78,57 @@ func withRetry[T any](ctx context.Context, operation string, fn func() (T, error
 	return zero, err
 }
 
-func isRetryableError(err error) bool {
+// classifyError decides whether a failed call is worth retrying: network
+// timeouts, 5xx responses and retryableErrorCodes are transient, a 429 is
+// retried after a longer delay, and any other 4xx (bad request, validation,
+// authentication, not found) is permanent.
+func classifyError(err error) retryClass {
 	if err == nil {
-		return false
+		return noRetry
 	}
 	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
-		return false
+		return noRetry
 	}
 
 	var netErr net.Error
 	if errors.As(err, &netErr) {
-		return netErr.Timeout()
+		if netErr.Timeout() {
+			return retryTransient
+		}
+		return noRetry
 	}
 
-	return false
+	var (
+		serviceErr   *cloudflare.ServiceError
+		rateLimitErr *cloudflare.RatelimitError
+		requestErr   *cloudflare.RequestError
+		apiErr       *cloudflare.Error
+	)
+	switch {
+	case errors.As(err, &serviceErr):
+		return retryTransient
+	case errors.As(err, &rateLimitErr):
+		return retryRateLimited
+	case errors.As(err, &requestErr):
+		for _, code := range retryableErrorCodes {
+			if requestErr.InternalErrorCodeIs(code) {
+				return retryTransient
+			}
+		}
+	case errors.As(err, &apiErr):
+		switch {
+		case apiErr.StatusCode == http.StatusTooManyRequests:
+			return retryRateLimited
+		case apiErr.StatusCode >= http.StatusInternalServerError:
+			return retryTransient
+		}
+		for _, code := range retryableErrorCodes {
+			if apiErr.InternalErrorCodeIs(code) {
+				return retryTransient
+			}
+		}
+	}
+	return noRetry
 }
 
 func retryDelay(attempt int, minDelay, maxDelay time.Duration) time.Duration {
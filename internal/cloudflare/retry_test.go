@@ -3,8 +3,12 @@ package cloudflare
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/http"
 	"testing"
 	"time"
+
+	"github.com/cloudflare/cloudflare-go"
 )
 
 type timeoutError struct{}
@@ -100,3 +104,76 @@ func TestWithRetryHonorsContextCancel(t *testing.T) {
 		t.Fatalf("expected 1 attempt, got %d", attempts)
 	}
 }
+
+// cloudflareAPIError builds the error the SDK returns for an API response
+// with the given status and error codes.
+func cloudflareAPIError(status int, codes ...int) error {
+	cfErr := &cloudflare.Error{StatusCode: status, ErrorCodes: codes}
+	for _, code := range codes {
+		cfErr.Errors = append(cfErr.Errors, cloudflare.ResponseInfo{Code: code, Message: "simulated"})
+	}
+	switch {
+	case status >= http.StatusInternalServerError:
+		e := cloudflare.NewServiceError(cfErr)
+		return &e
+	case status == http.StatusTooManyRequests:
+		e := cloudflare.NewRatelimitError(cfErr)
+		return &e
+	case status == http.StatusForbidden:
+		e := cloudflare.NewAuthenticationError(cfErr)
+		return &e
+	default:
+		e := cloudflare.NewRequestError(cfErr)
+		return &e
+	}
+}
+
+func TestWithRetryClassifiesCloudflareErrors(t *testing.T) {
+	origCfg := cfRetryConfig
+	origSleep := cfRetrySleep
+	defer func() {
+		cfRetryConfig = origCfg
+		cfRetrySleep = origSleep
+	}()
+
+	cfRetryConfig = retryConfig{maxRetries: 1, minDelay: 100 * time.Millisecond, maxDelay: time.Second}
+
+	tests := []struct {
+		name      string
+		err       error
+		wantTries int
+		wantDelay time.Duration
+	}{
+		{name: "500 is retried", err: cloudflareAPIError(http.StatusInternalServerError), wantTries: 2, wantDelay: 100 * time.Millisecond},
+		{name: "429 is retried with a longer backoff", err: cloudflareAPIError(http.StatusTooManyRequests), wantTries: 2, wantDelay: 400 * time.Millisecond},
+		{name: "400 is not retried", err: cloudflareAPIError(http.StatusBadRequest, 9005), wantTries: 1},
+		{name: "403 is not retried", err: cloudflareAPIError(http.StatusForbidden, 10000), wantTries: 1},
+		{name: "internal error code is retried", err: cloudflareAPIError(http.StatusBadRequest, 10000), wantTries: 2, wantDelay: 100 * time.Millisecond},
+		{name: "wrapped 500 is retried", err: fmt.Errorf("failed to update: %w", cloudflareAPIError(http.StatusBadGateway)), wantTries: 2, wantDelay: 100 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var delays []time.Duration
+			cfRetrySleep = func(ctx context.Context, delay time.Duration) error {
+				delays = append(delays, delay)
+				return nil
+			}
+
+			attempts := 0
+			_, err := withRetry(context.Background(), "test-classify", func() (string, error) {
+				attempts++
+				return "", tt.err
+			})
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if attempts != tt.wantTries {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantTries)
+			}
+			if tt.wantTries > 1 && (len(delays) != 1 || delays[0] != tt.wantDelay) {
+				t.Errorf("delays = %v, want [%v]", delays, tt.wantDelay)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package cloudflare
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+// Permission groups dyndns relies on, by their Cloudflare API names.
+const (
+	// PermDNSWrite is required to create, update and delete DNS records.
+	PermDNSWrite = "DNS Write"
+	// PermZoneSettingsWrite is required in proxy mode to set the SSL mode
+	// and Authenticated Origin Pulls.
+	PermZoneSettingsWrite = "Zone Settings Write"
+)
+
+// Token diagnostic sources.
+const (
+	// TokenSourcePolicies means permissions were read from the token's own
+	// policies (the token can read its details).
+	TokenSourcePolicies = "policies"
+	// TokenSourceProbe means the token cannot read its policies, so read
+	// access was probed instead; write access stays unverified.
+	TokenSourceProbe = "probe"
+)
+
+// TokenDiagnostics reports the API token status and which permissions
+// dyndns needs are present, missing, or could not be verified.
+type TokenDiagnostics struct {
+	Status     string    `json:"status,omitempty"`
+	Source     string    `json:"source,omitempty"`
+	Present    []string  `json:"present,omitempty"`
+	Missing    []string  `json:"missing,omitempty"`
+	Unverified []string  `json:"unverified,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+// tokenDiagStore holds the last diagnostics for the status endpoint.
+type tokenDiagStore struct {
+	mu   sync.RWMutex
+	last *TokenDiagnostics
+}
+
+// requiredPermissions lists the permission groups this client needs.
+func (c *Client) requiredPermissions() []string {
+	perms := []string{PermDNSWrite}
+	if c.proxied {
+		perms = append(perms, PermZoneSettingsWrite)
+	}
+	return perms
+}
+
+// DiagnoseToken verifies the API token and checks the permissions dyndns
+// needs, logging what is present or missing. The result is kept for
+// LastTokenDiagnostics. It never fails startup; problems are reported.
+func (c *Client) DiagnoseToken(ctx context.Context) TokenDiagnostics {
+	diag := c.diagnoseToken(ctx)
+	diag.CheckedAt = time.Now()
+
+	c.tokenDiag.mu.Lock()
+	c.tokenDiag.last = &diag
+	c.tokenDiag.mu.Unlock()
+
+	logTokenDiagnostics(diag, c.proxied)
+	return diag
+}
+
+// LastTokenDiagnostics returns the result of the last DiagnoseToken call,
+// or nil if it has not run.
+func (c *Client) LastTokenDiagnostics() *TokenDiagnostics {
+	c.tokenDiag.mu.RLock()
+	defer c.tokenDiag.mu.RUnlock()
+	return c.tokenDiag.last
+}
+
+func (c *Client) diagnoseToken(ctx context.Context) TokenDiagnostics {
+	var diag TokenDiagnostics
+
+	verified, err := c.api.VerifyAPIToken(ctx)
+	if err != nil {
+		diag.Error = fmt.Sprintf("failed to verify token: %v", err)
+		diag.Unverified = c.requiredPermissions()
+		return diag
+	}
+	diag.Status = verified.Status
+
+	// Reading its own policies needs "API Tokens Read", which most DNS
+	// tokens lack; fall back to probing read access.
+	token, err := c.api.GetAPIToken(ctx, verified.ID)
+	if err == nil {
+		diag.Source = TokenSourcePolicies
+		granted := grantedPermissions(token.Policies)
+		for _, perm := range c.requiredPermissions() {
+			if granted[strings.ToLower(perm)] {
+				diag.Present = append(diag.Present, perm)
+			} else {
+				diag.Missing = append(diag.Missing, perm)
+			}
+		}
+		return diag
+	}
+	slog.Debug("Cannot read Cloudflare token policies, probing access instead", "error", err)
+
+	diag.Source = TokenSourceProbe
+	for _, perm := range c.requiredPermissions() {
+		if err := c.probePermission(ctx, perm); err != nil {
+			if isPermissionError(err) {
+				diag.Missing = append(diag.Missing, perm)
+				continue
+			}
+			slog.Debug("Cloudflare permission probe failed", "permission", perm, "error", err)
+		}
+		// Read access works (or the probe was inconclusive); write access
+		// can't be confirmed without modifying the zone.
+		diag.Unverified = append(diag.Unverified, perm)
+	}
+	return diag
+}
+
+// grantedPermissions returns the lower-cased permission group names allowed
+// by the token's policies. "Edit" names (as shown in the dashboard) are
+// normalized to the API's "Write".
+func grantedPermissions(policies []cloudflare.APITokenPolicies) map[string]bool {
+	granted := make(map[string]bool)
+	for _, p := range policies {
+		if !strings.EqualFold(p.Effect, "allow") {
+			continue
+		}
+		for _, g := range p.PermissionGroups {
+			name := strings.ToLower(g.Name)
+			if base, ok := strings.CutSuffix(name, " edit"); ok {
+				name = base + " write"
+			}
+			granted[name] = true
+		}
+	}
+	return granted
+}
+
+// probePermission performs the read call that corresponds to perm.
+func (c *Client) probePermission(ctx context.Context, perm string) error {
+	rc := cloudflare.ZoneIdentifier(c.zoneID)
+	switch perm {
+	case PermDNSWrite:
+		_, _, err := c.api.ListDNSRecords(ctx, rc, cloudflare.ListDNSRecordsParams{
+			ResultInfo: cloudflare.ResultInfo{PerPage: 1},
+		})
+		return err
+	case PermZoneSettingsWrite:
+		_, err := c.api.GetZoneSetting(ctx, rc, cloudflare.GetZoneSettingParams{Name: "ssl"})
+		return err
+	}
+	return nil
+}
+
+// isPermissionError reports whether err is an authorization failure.
+func isPermissionError(err error) bool {
+	var authErr *cloudflare.AuthorizationError
+	var authnErr *cloudflare.AuthenticationError
+	return errors.As(err, &authErr) || errors.As(err, &authnErr)
+}
+
+func logTokenDiagnostics(diag TokenDiagnostics, proxied bool) {
+	if diag.Error != "" {
+		slog.Warn("Could not verify Cloudflare API token", "error", diag.Error)
+		return
+	}
+	slog.Info("Cloudflare API token checked",
+		"status", diag.Status,
+		"source", diag.Source,
+		"present", diag.Present,
+		"missing", diag.Missing,
+		"unverified", diag.Unverified,
+	)
+	if diag.Status != "" && diag.Status != "active" {
+		slog.Warn("Cloudflare API token is not active", "status", diag.Status)
+	}
+	for _, perm := range diag.Missing {
+		if perm == PermZoneSettingsWrite && proxied {
+			slog.Warn("CLOUDFLARE TOKEN LACKS Zone Settings:Edit - proxy mode cannot set the SSL mode or Authenticated Origin Pulls",
+				"permission", perm)
+			continue
+		}
+		slog.Warn("Cloudflare API token is missing a required permission", "permission", perm)
+	}
+}
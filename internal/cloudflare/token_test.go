@@ -0,0 +1,136 @@
+package cloudflare
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+)
+
+// mockTokenServer serves the token verify/details endpoints. Permission
+// groups are returned as the token's policies; a nil list makes the details
+// endpoint answer 403, as for tokens without "API Tokens Read". Zone
+// settings reads are refused when zoneSettings is false.
+func mockTokenServer(t *testing.T, groups []string, zoneSettings bool) *httptest.Server {
+	t.Helper()
+	forbidden := `{"success":false,"errors":[{"code":9109,"message":"Unauthorized to access requested resource"}]}`
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch path := r.URL.Path; {
+		case path == "/client/v4/user/tokens/verify":
+			fmt.Fprint(w, `{"success":true,"errors":[],"messages":[],"result":{"id":"tok1","status":"active"}}`)
+		case path == "/client/v4/user/tokens/tok1":
+			if groups == nil {
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(w, forbidden)
+				return
+			}
+			var items []string
+			for i, g := range groups {
+				items = append(items, fmt.Sprintf(`{"id":"g%d","name":%q}`, i, g))
+			}
+			fmt.Fprintf(w, `{"success":true,"errors":[],"messages":[],"result":{"id":"tok1","status":"active","policies":[{"id":"p1","effect":"allow","resources":{},"permission_groups":[%s]}]}}`,
+				strings.Join(items, ","))
+		case strings.HasSuffix(path, "/dns_records"):
+			fmt.Fprint(w, `{"success":true,"errors":[],"messages":[],"result":[],"result_info":{"page":1,"per_page":1,"count":0,"total_count":0,"total_pages":1}}`)
+		case strings.HasSuffix(path, "/settings/ssl"):
+			if !zoneSettings {
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(w, forbidden)
+				return
+			}
+			fmt.Fprint(w, `{"success":true,"errors":[],"messages":[],"result":{"id":"ssl","value":"full","editable":true}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTokenTestClient(t *testing.T, srv *httptest.Server) *Client {
+	t.Helper()
+	client, err := New(&config.Config{
+		CloudflareAPIToken:   "test-token",
+		CloudflareZoneID:     "test-zone",
+		CloudflareAPIBaseURL: srv.URL + "/client/v4",
+		CloudflareProxy:      true,
+		Domain:               "example.com",
+	})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	return client
+}
+
+// TestDiagnoseToken_Policies verifies permissions are read from the token's
+// policies, with dashboard "Edit" names matching the API "Write" names.
+func TestDiagnoseToken_Policies(t *testing.T) {
+	tests := []struct {
+		name        string
+		groups      []string
+		wantPresent []string
+		wantMissing []string
+	}{
+		{
+			name:        "all scopes",
+			groups:      []string{"DNS Write", "Zone Settings Edit"},
+			wantPresent: []string{PermDNSWrite, PermZoneSettingsWrite},
+		},
+		{
+			name:        "dns only",
+			groups:      []string{"DNS Write", "Zone Read"},
+			wantPresent: []string{PermDNSWrite},
+			wantMissing: []string{PermZoneSettingsWrite},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTokenTestClient(t, mockTokenServer(t, tt.groups, true))
+
+			diag := client.DiagnoseToken(context.Background())
+			if diag.Error != "" {
+				t.Fatalf("unexpected error: %s", diag.Error)
+			}
+			if diag.Status != "active" || diag.Source != TokenSourcePolicies {
+				t.Errorf("status/source = %q/%q, want active/%s", diag.Status, diag.Source, TokenSourcePolicies)
+			}
+			if got, want := strings.Join(diag.Present, ","), strings.Join(tt.wantPresent, ","); got != want {
+				t.Errorf("Present = %q, want %q", got, want)
+			}
+			if got, want := strings.Join(diag.Missing, ","), strings.Join(tt.wantMissing, ","); got != want {
+				t.Errorf("Missing = %q, want %q", got, want)
+			}
+			if last := client.LastTokenDiagnostics(); last == nil || last.CheckedAt.IsZero() {
+				t.Errorf("LastTokenDiagnostics() = %+v, want stored result", last)
+			}
+		})
+	}
+}
+
+// TestDiagnoseToken_ProbeFallback verifies a token that cannot read its own
+// policies is probed instead: a refused zone settings read is reported as
+// missing, while write access that can't be checked stays unverified.
+func TestDiagnoseToken_ProbeFallback(t *testing.T) {
+	client := newTokenTestClient(t, mockTokenServer(t, nil, false))
+
+	diag := client.DiagnoseToken(context.Background())
+	if diag.Source != TokenSourceProbe {
+		t.Errorf("Source = %q, want %q", diag.Source, TokenSourceProbe)
+	}
+	if got := strings.Join(diag.Missing, ","); got != PermZoneSettingsWrite {
+		t.Errorf("Missing = %q, want %q", got, PermZoneSettingsWrite)
+	}
+	if got := strings.Join(diag.Unverified, ","); got != PermDNSWrite {
+		t.Errorf("Unverified = %q, want %q", got, PermDNSWrite)
+	}
+	if len(diag.Present) != 0 {
+		t.Errorf("Present = %v, want none", diag.Present)
+	}
+}
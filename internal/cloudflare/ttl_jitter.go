@@ -0,0 +1,36 @@
+package cloudflare
+
+import "math/rand/v2"
+
+const (
+	// minTTL and maxTTL bound the TTL of non-proxied records at Cloudflare.
+	minTTL = 60
+	maxTTL = 86400
+)
+
+// jitterTTL varies ttl by up to DNS_TTL_JITTER percent in either
+// direction, clamped to Cloudflare's TTL range, so records written in the
+// same cycle do not all expire at once. Proxied records still get the
+// automatic TTL from updateRecord.
+func (c *Client) jitterTTL(ttl int) int {
+	spread := ttl * c.ttlJitter / 100
+	if spread <= 0 {
+		return ttl
+	}
+	randIntN := c.randIntN
+	if randIntN == nil {
+		randIntN = rand.IntN
+	}
+	return min(max(ttl-spread+randIntN(2*spread+1), minTTL), maxTTL)
+}
+
+// TTLRange returns the bounds of the TTL written for a non-proxied record
+// with DNS_TTL ttl and DNS_TTL_JITTER percentage jitter, so a listed TTL
+// outside them is known to have drifted.
+func TTLRange(ttl, jitter int) (lo, hi int) {
+	spread := ttl * jitter / 100
+	if spread <= 0 {
+		return ttl, ttl
+	}
+	return min(max(ttl-spread, minTTL), maxTTL), min(max(ttl+spread, minTTL), maxTTL)
+}
@@ -0,0 +1,117 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+func TestJitterTTL_Bounds(t *testing.T) {
+	tests := []struct {
+		name   string
+		ttl    int
+		jitter int
+		rng    func(n int) int
+		want   int
+	}{
+		{name: "disabled", ttl: 300, jitter: 0, want: 300},
+		{name: "lowest", ttl: 300, jitter: 10, rng: func(int) int { return 0 }, want: 270},
+		{name: "highest", ttl: 300, jitter: 10, rng: func(n int) int { return n - 1 }, want: 330},
+		{name: "middle", ttl: 300, jitter: 10, rng: func(n int) int { return n / 2 }, want: 300},
+		{name: "clamped to minimum", ttl: 60, jitter: 50, rng: func(int) int { return 0 }, want: 60},
+		{name: "clamped to maximum", ttl: 86400, jitter: 50, rng: func(n int) int { return n - 1 }, want: 86400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{ttlJitter: tt.jitter, randIntN: tt.rng}
+			got := c.jitterTTL(tt.ttl)
+			if got != tt.want {
+				t.Errorf("jitterTTL(%d) = %d, want %d", tt.ttl, got, tt.want)
+			}
+			if lo, hi := TTLRange(tt.ttl, tt.jitter); got < lo || got > hi {
+				t.Errorf("jitterTTL(%d) = %d, outside TTLRange [%d, %d]", tt.ttl, got, lo, hi)
+			}
+		})
+	}
+
+	// The default RNG stays within the bounds too.
+	c := &Client{ttlJitter: 20}
+	for range 1000 {
+		if got := c.jitterTTL(600); got < 480 || got > 720 {
+			t.Fatalf("jitterTTL(600) = %d, want within [480, 720]", got)
+		}
+	}
+}
+
+// TestUpdateNameRecords_TTLJitter verifies that grey-cloud records are
+// written with the jittered TTL while proxied records keep TTL=1.
+func TestUpdateNameRecords_TTLJitter(t *testing.T) {
+	var mu sync.Mutex
+	ttls := map[string]int{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/dns_records"):
+			writeJSON(w, map[string]any{"result": []any{}, "success": true, "errors": []any{}})
+		case r.Method == http.MethodPost && strings.Contains(r.URL.Path, "/dns_records"):
+			var body struct {
+				Name string `json:"name"`
+				Type string `json:"type"`
+				TTL  int    `json:"ttl"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Errorf("decode: %v", err)
+			}
+			mu.Lock()
+			ttls[body.Name+":"+body.Type] = body.TTL
+			mu.Unlock()
+			writeJSON(w, map[string]any{"result": map[string]any{"id": "rec_" + body.Name + body.Type}, "success": true, "errors": []any{}})
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	api, err := cloudflare.NewWithAPIToken("test-token", cloudflare.BaseURL(srv.URL+"/client/v4"))
+	if err != nil {
+		t.Fatalf("cloudflare client: %v", err)
+	}
+	c := &Client{
+		api:         api,
+		zoneID:      "zone123",
+		domain:      "example.com",
+		baseDomain:  "example.com",
+		ttl:         300,
+		ttlJitter:   10,
+		randIntN:    func(n int) int { return n - 1 },
+		recordCache: map[string]string{},
+	}
+
+	ctx := context.Background()
+	c.UpdateNameRecords(ctx, "git.example.com", []RecordUpdate{
+		{Type: "A", Content: "203.0.113.10"},
+		{Type: "AAAA", Content: "2001:db8::10", TTL: 600},
+	})
+	c.UpdateNameRecords(ctx, "app.example.com", []RecordUpdate{
+		{Type: "A", Content: "203.0.113.10", Proxied: true},
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := map[string]int{
+		"git.example.com:A":    330,
+		"git.example.com:AAAA": 660,
+		"app.example.com:A":    1,
+	}
+	for key, ttl := range want {
+		if ttls[key] != ttl {
+			t.Errorf("TTL of %s = %d, want %d", key, ttls[key], ttl)
+		}
+	}
+}
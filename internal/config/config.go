@@ -1,13 +1,104 @@
 package config
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 )
 
+// Mapping conflict strategies decide which source wins when discovery and
+// the YAML mappings file (or two discovered services) claim the same
+// subdomain.
+const (
+	// ConflictFirst keeps the first entry in collection order (discovered
+	// services, then YAML mappings). This is the legacy behavior.
+	ConflictFirst = "first"
+	// ConflictDiscoveryPriority lets discovered services override YAML mappings.
+	ConflictDiscoveryPriority = "discovery-priority"
+	// ConflictMappingPriority lets YAML mappings override discovered services.
+	ConflictMappingPriority = "mapping-priority"
+	// ConflictError refuses to generate a config while any conflict exists.
+	ConflictError = "error"
+)
+
+// Policies for when every IP detection method fails (ON_DETECTION_FAILURE).
+const (
+	// DetectionFailureKeep leaves the published records untouched.
+	DetectionFailureKeep = "keep"
+	// DetectionFailureRemove deletes the managed records after
+	// OnDetectionFailureThreshold consecutive failures (fail closed).
+	DetectionFailureRemove = "remove"
+)
+
+// Policies for a mappings file that fails to load at startup
+// (ON_INVALID_MAPPINGS).
+const (
+	// InvalidMappingsWarn starts without YAML mappings and logs a loud
+	// warning; the next valid edit of the file loads them.
+	InvalidMappingsWarn = "warn"
+	// InvalidMappingsExit refuses to start.
+	InvalidMappingsExit = "exit"
+)
+
+// Scopes of the record cleanup on shutdown (SHUTDOWN_CLEANUP).
+const (
+	// ShutdownCleanupNone leaves every record in place.
+	ShutdownCleanupNone = "none"
+	// ShutdownCleanupSubdomains deletes the subdomain records and keeps
+	// the apex, wildcard and www records, so DOMAIN still resolves.
+	ShutdownCleanupSubdomains = "subdomains"
+	// ShutdownCleanupAll deletes the apex, wildcard and www records too.
+	ShutdownCleanupAll = "all"
+)
+
+// Policies for unrecognized keys in the mappings file
+// (MAPPINGS_UNKNOWN_FIELDS).
+const (
+	// UnknownFieldsWarn logs each unknown key and loads the mappings.
+	UnknownFieldsWarn = "warn"
+	// UnknownFieldsError fails the load like invalid YAML.
+	UnknownFieldsError = "error"
+)
+
+// managedRecordTypes are the record types MANAGED_RECORD_TYPES accepts.
+// NS is deliberately absent: deleting delegations is never a cleanup.
+var managedRecordTypes = map[string]bool{
+	"A": true, "AAAA": true, "CNAME": true, "TXT": true, "CAA": true,
+	"MX": true, "SRV": true, "HTTPS": true, "SVCB": true,
+}
+
+// tlsProtocols are the TLS_PROTOCOLS versions Caddy accepts, in order.
+var tlsProtocols = map[string]int{"tls1.2": 0, "tls1.3": 1}
+
+// tlsCurves are the curve names Caddy's tls curves option accepts.
+var tlsCurves = map[string]bool{
+	"x25519": true, "x25519mlkem768": true, "secp256r1": true, "secp384r1": true, "secp521r1": true,
+}
+
+// isTLSCipher reports whether name is a cipher suite Caddy's tls ciphers
+// option accepts: the secure suites of crypto/tls.
+func isTLSCipher(name string) bool {
+	for _, c := range tls.CipherSuites() {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// headerNamePattern matches HTTP header field names (RFC 9110 tokens,
+// restricted to the characters used in practice).
+var headerNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]*$`)
+
 // Config holds all configuration for the dyndns service
 type Config struct {
 	// Cloudflare settings
@@ -15,14 +106,58 @@ type Config struct {
 	CloudflareZoneID   string
 	CloudflareProxy    bool // Enable Cloudflare proxy (orange cloud)
 
+	// ApexProxied publishes the direct-mode apex (DOMAIN) A/AAAA records
+	// proxied while the wildcard stays grey-cloud. Proxy mode publishes no
+	// apex records, so it has no effect there.
+	ApexProxied bool
+
+	// ManageWWW publishes www.DOMAIN as a CNAME to the apex, proxied like
+	// the apex. When unset, a www CNAME to the apex left by an earlier run
+	// is removed at startup.
+	ManageWWW bool
+
+	// CloudflareSSLMode is the zone SSL mode applied in proxy mode: "off",
+	// "flexible", "full" (default) or "strict". In flexible mode Cloudflare
+	// reaches the origin over plain HTTP, so the proxy-mode site is rendered
+	// without TLS or origin mTLS.
+	CloudflareSSLMode string
+
+	// CloudflareAPIBaseURL overrides the Cloudflare API endpoint (e.g. an
+	// egress proxy or a mock server in tests). Empty uses the default
+	// https://api.cloudflare.com/client/v4.
+	CloudflareAPIBaseURL string
+
 	// DNS settings
 	DNSTTL int // TTL for DNS records in seconds
+	// ApexTTL is the TTL of the direct-mode apex and wildcard records,
+	// which rarely change. Defaults to DNSTTL.
+	ApexTTL int
+	// DNSTTLJitter is the percentage by which each grey-cloud record's TTL
+	// is randomly varied on every write, so records created together do
+	// not expire together. Zero disables the jitter.
+	DNSTTLJitter int
+
+	// IPHistorySize is how many detected address changes the detector
+	// keeps for /status/history. Zero disables the history.
+	IPHistorySize int
 
 	// Domain settings
 	Domain          string
 	AcmeEmail       string
 	SubdomainPrefix bool // Use prefix mode (app-zone.example.com instead of app.zone.example.com)
 
+	// ZoneName is the apex of the Cloudflare zone, learned from the API at
+	// startup rather than from the environment. In prefix mode it is the
+	// base domain when DOMAIN lies below it (see GetBaseDomain).
+	ZoneName string
+
+	// SubdomainNameTemplate, when set, builds the managed DNS label for a
+	// subdomain, e.g. "{sub}-{env}" or "dev-{sub}". Placeholders: {sub}
+	// (required), {zone} (first label of Domain) and {env}
+	// (SubdomainNameEnv). The label is placed under GetBaseDomain().
+	SubdomainNameTemplate string
+	SubdomainNameEnv      string
+
 	// CatchallSubdomain, when non-empty, enables a dedicated 451 site block.
 	// Any TLS handshake whose SNI does not match a configured site lands on
 	// this site's Let's Encrypt cert (via default_sni) and receives a 451.
@@ -84,17 +219,68 @@ type Config struct {
 	// origin). IPv4 records are unaffected.
 	DisableIPv6 bool
 
+	// IPv6Suffix, when set, is the host's interface identifier: the
+	// published AAAA is the delegated IPv6 prefix with these low bits, for
+	// routers that only delegate a prefix. The prefix is the Fritzbox's
+	// delegated LAN prefix, or else the first IPv6PrefixLength bits of the
+	// detected IPv6 address.
+	IPv6Suffix       netip.Addr
+	IPv6PrefixLength int
+
 	// Fritzbox settings for TR-064/UPnP
 	FritzboxHost     string
 	FritzboxUser     string
 	FritzboxPassword string
+	// FritzboxAutodiscover locates the router's IGD control URL via SSDP
+	// at startup, falling back to FritzboxHost when nothing answers.
+	FritzboxAutodiscover bool
+	// FritzboxReconnectWatch polls the router's connection uptime and
+	// triggers an immediate update when it resets (a PPPoE reconnect).
+	FritzboxReconnectWatch bool
+	// FritzboxReconnectPoll is the interval between uptime polls.
+	FritzboxReconnectPoll time.Duration
 
 	// Manual IP override
 	ManualIPv4 string
 	ManualIPv6 string
+	// IPFile is a file an external updater writes the public IPv4/IPv6
+	// to; it is read before the Fritzbox on every detection cycle.
+	IPFile string
+	// IPPreferCIDRs and IPReachabilityProbe choose among several candidate
+	// addresses (the Fritzbox and every external service) on a multi-WAN
+	// connection: the first candidate inside the first matching prefix
+	// wins, else the first one the probe URL ({ip} replaced) reports
+	// reachable with a 2xx, else the first candidate.
+	IPPreferCIDRs       []netip.Prefix
+	IPReachabilityProbe string
 
 	// Timing
 	IPCheckInterval time.Duration
+	// IPCheckJitter is the upper bound of a random delay before the first
+	// IP check, so instances started together don't hit Cloudflare at once.
+	IPCheckJitter time.Duration
+	// IPCheckAlign schedules IP checks on wall-clock multiples of
+	// IPCheckInterval (plus this instance's jitter offset).
+	IPCheckAlign bool
+	// ReconcileInterval, when non-zero, runs a full DNS reconcile on its
+	// own ticker, regardless of IP changes and quiet hours, so records
+	// changed out-of-band in Cloudflare are corrected.
+	ReconcileInterval time.Duration
+
+	// QuietHours enables a daily local-time window [QuietHoursStart,
+	// QuietHoursEnd) (offsets from midnight; the window may wrap past
+	// midnight) in which unchanged reconciles are skipped and a new IP is
+	// applied only once consecutive checks confirm it.
+	QuietHours      bool
+	QuietHoursStart time.Duration
+	QuietHoursEnd   time.Duration
+
+	// OnDetectionFailure is the policy applied when IP detection fails;
+	// one of the DetectionFailure* constants.
+	OnDetectionFailure string
+	// OnDetectionFailureThreshold is the number of consecutive detection
+	// failures after which DetectionFailureRemove deletes the records.
+	OnDetectionFailureThreshold int
 
 	// Logging
 	LogLevel string
@@ -106,9 +292,277 @@ type Config struct {
 	MappingsFile string
 	CaddyFile    string
 
+	// OnInvalidMappings is the policy applied when the mappings file
+	// cannot be loaded at startup; one of the InvalidMappings* constants.
+	OnInvalidMappings string
+	// MappingsUnknownFields is the policy for keys in the mappings file
+	// that no mapping field matches (e.g. a typo'd option); one of the
+	// UnknownFields* constants.
+	MappingsUnknownFields string
+
+	// CaddyAdmin is the address of Caddy's admin API, probed at startup
+	// to confirm config reloads can reach it. Defaults to "localhost:2019".
+	CaddyAdmin string
+
+	// CaddyMetricsAddr, when set, enables Caddy's metrics and serves them
+	// on an internal host:port, kept apart from the public sites.
+	CaddyMetricsAddr string
+
+	// CaddySharedSnippets renders the per-site access log and proxy header
+	// directives once as Caddy snippets and imports them in each site.
+	CaddySharedSnippets bool
+
+	// CaddyPerSite renders one site block per proxy-mode subdomain instead
+	// of a single combined *.domain site.
+	CaddyPerSite bool
+
+	// CaddyMapMode routes the proxy-mode subdomains of the combined site
+	// through one map of host to upstream and a single reverse_proxy,
+	// instead of a handle block per subdomain.
+	CaddyMapMode bool
+
+	// CaddyReloadMinInterval is the minimum time between Caddy reloads:
+	// changes within it are coalesced into one reload at its end. Zero
+	// reloads on every change.
+	CaddyReloadMinInterval time.Duration
+
+	// PreReloadCmd and PostReloadCmd are shell commands run around every
+	// Caddy reload: after the new Caddyfile is written and before Caddy
+	// reloads it, and after a successful reload. Each runs with ReloadCmdTimeout;
+	// a failure is logged and does not stop the reload.
+	PreReloadCmd     string
+	PostReloadCmd    string
+	ReloadCmdTimeout time.Duration
+
+	// CaddyOnDemandTLS issues per-host certificates lazily at the first TLS
+	// handshake. Caddy asks the status server's /tls/ask endpoint whether
+	// the host is an active subdomain before issuing.
+	CaddyOnDemandTLS bool
+
+	// RequestIDHeader is the header Caddy sets to {http.request.uuid} on
+	// proxied requests when absent (e.g. "X-Request-ID"). Empty disables.
+	RequestIDHeader string
+	// AccessLogSample, when above 1, samples each site's access log:
+	// of the requests in a second, the first is logged, then every
+	// AccessLogSample-th. AccessLogSkipPaths are request paths (e.g. a
+	// health check) never written to the access log.
+	AccessLogSample    int
+	AccessLogSkipPaths []string
+
+	// StripHeaders are inbound request headers removed before proxying to
+	// any upstream (header_up -Name). A trailing "*" removes every header
+	// with that prefix. Per-mapping strip_headers are added to these.
+	StripHeaders []string
+
+	// AcmeChallengeWebroot is the webroot of an external ACME client
+	// (certbot --webroot). When set, /.well-known/acme-challenge/ is served
+	// from it on the origin sites. Must be an absolute path.
+	AcmeChallengeWebroot string
+
+	// AcmeDNSProvider is the Caddy DNS module used for the ACME DNS-01
+	// challenge (default cloudflare), rendered as "dns <provider> <args>"
+	// with AcmeDNSProviderArgs. AcmeDNSResolvers, when set, are the
+	// resolvers Caddy uses to check challenge propagation.
+	AcmeDNSProvider     string
+	AcmeDNSProviderArgs string
+	AcmeDNSResolvers    []string
+
+	// TLSProtocols (min and optional max version), TLSCiphers and
+	// TLSCurves restrict what the public sites negotiate, rendered as
+	// protocols, ciphers and curves in their tls blocks. Empty keeps
+	// Caddy's defaults.
+	TLSProtocols []string
+	TLSCiphers   []string
+	TLSCurves    []string
+
+	// OriginCert and OriginKey are a static certificate/key pair (e.g. a
+	// Cloudflare Origin CA cert for strict SSL mode) served on the
+	// Cloudflare-facing wildcard site instead of an ACME certificate.
+	OriginCert string
+	OriginKey  string
+
+	// ProxyLBTryDuration and ProxyLBTryInterval are the default
+	// reverse_proxy lb_try_duration / lb_try_interval for every upstream,
+	// so Caddy retries briefly while a container restarts. Per-mapping
+	// options override them. Empty disables retries (Caddy default).
+	ProxyLBTryDuration string
+	ProxyLBTryInterval string
+
+	// ValidateTargets checks every upstream before the Caddyfile is
+	// rendered: the target must parse as host:port and accept a TCP
+	// connection within ValidateTargetsTimeout. A failing target is
+	// logged, and with ValidateTargetsDrop its mapping is left out of the
+	// Caddyfile until it connects.
+	ValidateTargets        bool
+	ValidateTargetsTimeout time.Duration
+	ValidateTargetsDrop    bool
+
+	// StatusTLSCert and StatusTLSKey serve the status server over TLS when
+	// both are set. StatusTLSClientCA additionally requires clients to
+	// present a certificate signed by that CA (mTLS). Plaintext by default.
+	StatusTLSCert     string
+	StatusTLSKey      string
+	StatusTLSClientCA string
+
+	// StatusSocket, when set, also serves the status endpoints on a unix
+	// socket at this path, for local tooling.
+	StatusSocket string
+
+	// StatusToken is the bearer token required by protected status server
+	// endpoints (currently /debug/pprof/).
+	StatusToken string
+	// EnablePprof mounts net/http/pprof on the status server behind
+	// StatusToken. Off by default.
+	EnablePprof bool
+	// StatusRateLimit is the minimum interval between calls to each
+	// mutating status server endpoint; further calls get 429. Zero
+	// disables the limit.
+	StatusRateLimit time.Duration
+
+	// ReadyRequirePropagation makes /ready additionally wait until
+	// ReadyPropagationName resolves to the detected IPs through
+	// ReadyResolver (host:port), each lookup bounded by
+	// ReadyPropagationTimeout. ReadyPropagationName defaults to DOMAIN and
+	// must be a grey-cloud record: proxied records resolve to Cloudflare.
+	ReadyRequirePropagation bool
+	ReadyPropagationName    string
+	ReadyResolver           string
+	ReadyPropagationTimeout time.Duration
+
+	// SnapshotFile, when set, receives a snapshot of the managed records
+	// after each successful reconcile. The extension selects the format:
+	// .json, or .yaml/.yml.
+	SnapshotFile string
+	// SkipStartupPush skips the first reconcile's DNS writes when
+	// SnapshotFile, written before the restart, already holds the records
+	// it would publish for the detected IPs.
+	SkipStartupPush bool
+
+	// RefreshOriginPullCA downloads the current Cloudflare origin-pull CA
+	// at startup and every OriginPullCARefreshInterval, reloading Caddy
+	// when it changed.
+	RefreshOriginPullCA         bool
+	OriginPullCARefreshInterval time.Duration
+
+	// ProxyProbe requests each newly proxied subdomain through Cloudflare
+	// ProxyProbeDelay after the reconcile and warns when Cloudflare cannot
+	// reach the origin.
+	ProxyProbe      bool
+	ProxyProbeDelay time.Duration
+
+	// FamilyProbe dials the published IPv4 and IPv6 addresses on
+	// FamilyProbePort after each reconcile that published grey-cloud
+	// records and reports which families are reachable. With
+	// FamilyProbeWithdraw, an unreachable IPv6 is withheld from the
+	// grey-cloud AAAA records while IPv4 is reachable.
+	FamilyProbe         bool
+	FamilyProbePort     int
+	FamilyProbeTimeout  time.Duration
+	FamilyProbeWithdraw bool
+
+	// ManagedRecordTypes are the record types dyndns owns under its
+	// managed names: only these are enumerated and removed by the stale
+	// record cleanup. Defaults to A and AAAA.
+	ManagedRecordTypes []string
+
+	// StaleCleanupConcurrency bounds the parallel deletes of the stale
+	// record cleanup, and StaleCleanupTimeout bounds the whole cleanup so
+	// a big zone cannot stall the cycle.
+	StaleCleanupConcurrency int
+	StaleCleanupTimeout     time.Duration
+	// RemovalGrace is how long a record must stay stale before the
+	// cleanup deletes it, so a subdomain that drops out of discovery
+	// during a restart and comes back is left in place. Zero deletes on
+	// the first cycle that finds it stale.
+	RemovalGrace time.Duration
+	// UnsafeAllowAnyRecordName downgrades the Cloudflare client's
+	// record-name scope assertion to a warning, for cross-zone setups
+	// such as a delegated subdomain whose zone differs from Domain.
+	UnsafeAllowAnyRecordName bool
+	// AllowEmptyReconcile lets the stale record cleanup remove every
+	// managed subdomain record when no subdomain is active. Off by
+	// default, so an empty discovery result cannot wipe DNS.
+	AllowEmptyReconcile bool
+	// MaxManagedSubdomains caps the active subdomains a proxy-mode
+	// reconcile publishes records for; a cycle over the cap is refused so
+	// a runaway discovery source cannot mass-create records. Zero means
+	// no cap.
+	MaxManagedSubdomains int
+	// ShutdownCleanup is the scope of the A/AAAA records deleted when
+	// dyndns stops; one of the ShutdownCleanup* constants.
+	ShutdownCleanup string
+
+	// DirectRemoveSubdomainRecords, in direct mode, deletes the managed
+	// per-subdomain records the wildcard already covers with the same
+	// address, e.g. those left from an earlier run in proxy mode.
+	DirectRemoveSubdomainRecords bool
+
+	// DNSPlan lists the managed records before each subdomain reconcile,
+	// logs the diff against the desired records as a plan, and applies
+	// only the creates, updates and deletes in it.
+	DNSPlan bool
+
+	// UserAgent identifies dyndns on outbound HTTP requests. It is not read
+	// from the environment; main sets it from the build metadata.
+	UserAgent string
+
 	// Stevedore discovery settings
 	StevedoreSocket string
 	StevedoreToken  string
+
+	// DiscoveryPollTimeout is the long-poll timeout requested from the
+	// stevedore /poll endpoint. The discovery HTTP client deadline is
+	// derived from it. Defaults to 60s.
+	DiscoveryPollTimeout time.Duration
+
+	// DiscoveryDebounce coalesces discovery changes: the Caddyfile is
+	// regenerated once no further change arrived for this long, using the
+	// latest services. Zero applies every change immediately.
+	DiscoveryDebounce time.Duration
+
+	// DiscoveryDryRun logs what discovery changes would do (subdomain and
+	// Caddyfile diff) without regenerating the Caddyfile or touching DNS.
+	DiscoveryDryRun bool
+
+	// DiscoveryIncludeStopped keeps routing services whose container
+	// stevedore reports as not running. By default they are treated as
+	// inactive, so a stopped container loses its route and DNS record.
+	DiscoveryIncludeStopped bool
+
+	// DiscoveryFallbackAfter loads the YAML mappings file once discovery
+	// has been unreachable this long, and drops it again when discovery
+	// recovers. Zero disables the fallback.
+	DiscoveryFallbackAfter time.Duration
+
+	// MappingConflictStrategy selects how duplicate subdomains across
+	// discovery and YAML mappings are resolved. One of the Conflict*
+	// constants; empty means ConflictFirst.
+	MappingConflictStrategy string
+}
+
+// parseQuietHours parses a QUIET_HOURS window "HH:MM-HH:MM" into offsets
+// from midnight.
+func parseQuietHours(value string) (start, end time.Duration, err error) {
+	from, to, ok := strings.Cut(value, "-")
+	if ok {
+		start, err = parseClock(from)
+	}
+	if ok && err == nil {
+		end, err = parseClock(to)
+	}
+	if !ok || err != nil || start == end {
+		return 0, 0, fmt.Errorf("invalid QUIET_HOURS: %q (want HH:MM-HH:MM, e.g. 01:00-06:00)", value)
+	}
+	return start, end, nil
+}
+
+// parseClock parses "HH:MM" into the offset from midnight.
+func parseClock(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
 }
 
 // Load reads configuration from environment variables
@@ -123,6 +577,7 @@ func Load() (*Config, error) {
 		FritzboxPassword:   os.Getenv("FRITZBOX_PASSWORD"),
 		ManualIPv4:         os.Getenv("MANUAL_IPV4"),
 		ManualIPv6:         os.Getenv("MANUAL_IPV6"),
+		IPFile:             os.Getenv("IP_FILE"),
 		LogLevel:           getEnvDefault("LOG_LEVEL", "info"),
 		DataDir:            getEnvDefault("DYNDNS_DATA", "/data"),
 		LogsDir:            getEnvDefault("DYNDNS_LOGS", "/var/log/dyndns"),
@@ -139,12 +594,121 @@ func Load() (*Config, error) {
 	}
 	cfg.IPCheckInterval = interval
 
+	jitter, err := time.ParseDuration(getEnvDefault("IP_CHECK_JITTER", "0s"))
+	if err != nil || jitter < 0 || jitter >= interval {
+		return nil, fmt.Errorf("invalid IP_CHECK_JITTER: %q (want a duration between 0 and IP_CHECK_INTERVAL)", os.Getenv("IP_CHECK_JITTER"))
+	}
+	cfg.IPCheckJitter = jitter
+	cfg.IPCheckAlign = parseBool(os.Getenv("IP_CHECK_ALIGN"))
+	reconcileInterval, err := time.ParseDuration(getEnvDefault("RECONCILE_INTERVAL", "0s"))
+	if err != nil || (reconcileInterval != 0 && reconcileInterval < time.Minute) {
+		return nil, fmt.Errorf("invalid RECONCILE_INTERVAL: %q (want 0 or a duration of at least 1m)", os.Getenv("RECONCILE_INTERVAL"))
+	}
+	cfg.ReconcileInterval = reconcileInterval
+
+	if v := os.Getenv("QUIET_HOURS"); v != "" {
+		start, end, err := parseQuietHours(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.QuietHours, cfg.QuietHoursStart, cfg.QuietHoursEnd = true, start, end
+	}
+
+	cfg.OnDetectionFailure = strings.ToLower(getEnvDefault("ON_DETECTION_FAILURE", DetectionFailureKeep))
+	switch cfg.OnDetectionFailure {
+	case DetectionFailureKeep, DetectionFailureRemove:
+	default:
+		return nil, fmt.Errorf("invalid ON_DETECTION_FAILURE: %q (want %s or %s)",
+			cfg.OnDetectionFailure, DetectionFailureKeep, DetectionFailureRemove)
+	}
+	threshold, err := strconv.Atoi(getEnvDefault("ON_DETECTION_FAILURE_THRESHOLD", "3"))
+	if err != nil || threshold < 1 {
+		return nil, fmt.Errorf("invalid ON_DETECTION_FAILURE_THRESHOLD: %q (want a positive integer)", os.Getenv("ON_DETECTION_FAILURE_THRESHOLD"))
+	}
+	cfg.OnDetectionFailureThreshold = threshold
+
+	// Parse discovery long-poll timeout
+	pollTimeout, err := time.ParseDuration(getEnvDefault("DISCOVERY_POLL_TIMEOUT", "60s"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid DISCOVERY_POLL_TIMEOUT: %w", err)
+	}
+	if pollTimeout < time.Second {
+		return nil, fmt.Errorf("invalid DISCOVERY_POLL_TIMEOUT: must be at least 1s, got %s", pollTimeout)
+	}
+	cfg.DiscoveryPollTimeout = pollTimeout
+
+	debounce, err := time.ParseDuration(getEnvDefault("DISCOVERY_DEBOUNCE", "2s"))
+	if err != nil || debounce < 0 {
+		return nil, fmt.Errorf("invalid DISCOVERY_DEBOUNCE: %q (want a non-negative duration)", os.Getenv("DISCOVERY_DEBOUNCE"))
+	}
+	cfg.DiscoveryDebounce = debounce
+
+	fallbackAfter, err := time.ParseDuration(getEnvDefault("DISCOVERY_FALLBACK_AFTER", "0s"))
+	if err != nil || fallbackAfter < 0 {
+		return nil, fmt.Errorf("invalid DISCOVERY_FALLBACK_AFTER: %q (want a non-negative duration)", os.Getenv("DISCOVERY_FALLBACK_AFTER"))
+	}
+	cfg.DiscoveryFallbackAfter = fallbackAfter
+
+	// STEVEDORE_SOCKET is a unix socket path, or the base URL of the same
+	// API served over TCP.
+	if strings.Contains(cfg.StevedoreSocket, "://") {
+		cfg.StevedoreSocket = strings.TrimSuffix(cfg.StevedoreSocket, "/")
+		u, err := url.Parse(cfg.StevedoreSocket)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" || u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+			return nil, fmt.Errorf("invalid STEVEDORE_SOCKET: %q (want an absolute unix socket path or an http(s)://host:port URL)", cfg.StevedoreSocket)
+		}
+		// url.Parse lowercases the scheme; keep the rest as written.
+		cfg.StevedoreSocket = u.Scheme + cfg.StevedoreSocket[len(u.Scheme):]
+	} else if !filepath.IsAbs(cfg.StevedoreSocket) {
+		return nil, fmt.Errorf("invalid STEVEDORE_SOCKET: %q (want an absolute unix socket path or an http(s)://host:port URL)", cfg.StevedoreSocket)
+	}
+
 	// Parse Cloudflare proxy mode
 	cfg.CloudflareProxy = parseBool(os.Getenv("CLOUDFLARE_PROXY"))
+	cfg.ApexProxied = parseBool(os.Getenv("APEX_PROXIED"))
+	cfg.ManageWWW = parseBool(os.Getenv("MANAGE_WWW"))
+
+	// Parse Cloudflare SSL mode (applied to the zone in proxy mode)
+	cfg.CloudflareAPIBaseURL = strings.TrimSuffix(os.Getenv("CLOUDFLARE_API_BASE_URL"), "/")
+	if cfg.CloudflareAPIBaseURL != "" {
+		u, err := url.Parse(cfg.CloudflareAPIBaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid CLOUDFLARE_API_BASE_URL: %q (want an http(s) URL)", cfg.CloudflareAPIBaseURL)
+		}
+	}
+
+	for _, p := range parseCommaList(os.Getenv("IP_PREFER_CIDRS")) {
+		prefix, err := netip.ParsePrefix(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP_PREFER_CIDRS entry: %q (want a CIDR such as 203.0.113.0/24)", p)
+		}
+		cfg.IPPreferCIDRs = append(cfg.IPPreferCIDRs, prefix.Masked())
+	}
+	cfg.IPReachabilityProbe = strings.TrimSpace(os.Getenv("IP_REACHABILITY_PROBE"))
+	if cfg.IPReachabilityProbe != "" {
+		u, err := url.Parse(strings.ReplaceAll(cfg.IPReachabilityProbe, "{ip}", "ip"))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || !strings.Contains(cfg.IPReachabilityProbe, "{ip}") {
+			return nil, fmt.Errorf("invalid IP_REACHABILITY_PROBE: %q (want an http(s) URL containing {ip})", cfg.IPReachabilityProbe)
+		}
+	}
+
+	cfg.CloudflareSSLMode = strings.ToLower(getEnvDefault("CLOUDFLARE_SSL_MODE", "full"))
+	switch cfg.CloudflareSSLMode {
+	case "off", "flexible", "full", "strict":
+	default:
+		return nil, fmt.Errorf("invalid CLOUDFLARE_SSL_MODE: %q (want off, flexible, full or strict)", cfg.CloudflareSSLMode)
+	}
 
 	// Parse subdomain prefix mode (for Cloudflare Universal SSL compatibility)
 	cfg.SubdomainPrefix = parseBool(os.Getenv("SUBDOMAIN_PREFIX"))
 
+	// Parse subdomain name template
+	cfg.SubdomainNameTemplate = strings.ToLower(strings.TrimSpace(os.Getenv("SUBDOMAIN_NAME_TEMPLATE")))
+	cfg.SubdomainNameEnv = strings.ToLower(strings.TrimSpace(os.Getenv("SUBDOMAIN_NAME_ENV")))
+	if err := cfg.validateNameTemplate(); err != nil {
+		return nil, err
+	}
+
 	// Parse catchall subdomain (optional; enables the 451 catchall site).
 	cfg.CatchallSubdomain = os.Getenv("CATCHALL_SUBDOMAIN")
 
@@ -178,6 +742,303 @@ func Load() (*Config, error) {
 	}
 
 	cfg.DisableIPv6 = parseBool(os.Getenv("DISABLE_IPV6"))
+	ipv6PrefixLength, err := strconv.Atoi(getEnvDefault("IPV6_PREFIX_LENGTH", "64"))
+	if err != nil || ipv6PrefixLength < 1 || ipv6PrefixLength > 127 {
+		return nil, fmt.Errorf("invalid IPV6_PREFIX_LENGTH: %q (want 1-127)", os.Getenv("IPV6_PREFIX_LENGTH"))
+	}
+	cfg.IPv6PrefixLength = ipv6PrefixLength
+	if raw := strings.TrimSpace(os.Getenv("IPV6_SUFFIX")); raw != "" {
+		suffix, err := netip.ParseAddr(raw)
+		if err != nil || !suffix.Is6() || suffix.Is4In6() || suffix.Zone() != "" || suffix.IsUnspecified() ||
+			!netip.PrefixFrom(suffix, ipv6PrefixLength).Masked().Addr().IsUnspecified() {
+			return nil, fmt.Errorf("invalid IPV6_SUFFIX: %q (want an interface identifier such as ::1234:5678:9abc:def0, zero in the first IPV6_PREFIX_LENGTH bits)", raw)
+		}
+		cfg.IPv6Suffix = suffix
+	}
+	cfg.FritzboxAutodiscover = parseBool(os.Getenv("FRITZBOX_AUTODISCOVER"))
+	cfg.FritzboxReconnectWatch = parseBool(os.Getenv("FRITZBOX_RECONNECT_WATCH"))
+	reconnectPoll, err := time.ParseDuration(getEnvDefault("FRITZBOX_RECONNECT_POLL", "30s"))
+	if err != nil || reconnectPoll < time.Second {
+		return nil, fmt.Errorf("invalid FRITZBOX_RECONNECT_POLL: %q (want a duration of at least 1s)", os.Getenv("FRITZBOX_RECONNECT_POLL"))
+	}
+	cfg.FritzboxReconnectPoll = reconnectPoll
+	cfg.CaddySharedSnippets = parseBool(os.Getenv("CADDY_SHARED_SNIPPETS"))
+	cfg.CaddyPerSite = parseBool(os.Getenv("CADDY_PER_SITE"))
+	cfg.CaddyMapMode = parseBool(os.Getenv("CADDY_MAP_MODE"))
+	if cfg.CaddyMapMode && cfg.CaddyPerSite {
+		return nil, fmt.Errorf("CADDY_MAP_MODE requires the combined proxy site (unset CADDY_PER_SITE)")
+	}
+	reloadInterval, err := time.ParseDuration(getEnvDefault("CADDY_RELOAD_MIN_INTERVAL", "0s"))
+	if err != nil || reloadInterval < 0 {
+		return nil, fmt.Errorf("invalid CADDY_RELOAD_MIN_INTERVAL: %q (want a non-negative duration)", os.Getenv("CADDY_RELOAD_MIN_INTERVAL"))
+	}
+	cfg.CaddyReloadMinInterval = reloadInterval
+	cfg.PreReloadCmd = strings.TrimSpace(os.Getenv("PRE_RELOAD_CMD"))
+	cfg.PostReloadCmd = strings.TrimSpace(os.Getenv("POST_RELOAD_CMD"))
+	reloadCmdTimeout, err := time.ParseDuration(getEnvDefault("RELOAD_CMD_TIMEOUT", "30s"))
+	if err != nil || reloadCmdTimeout <= 0 {
+		return nil, fmt.Errorf("invalid RELOAD_CMD_TIMEOUT: %q (want a positive duration)", os.Getenv("RELOAD_CMD_TIMEOUT"))
+	}
+	cfg.ReloadCmdTimeout = reloadCmdTimeout
+	cfg.CaddyOnDemandTLS = parseBool(os.Getenv("CADDY_ON_DEMAND_TLS"))
+	cfg.DiscoveryDryRun = parseBool(os.Getenv("DISCOVERY_DRY_RUN"))
+	cfg.DiscoveryIncludeStopped = parseBool(os.Getenv("DISCOVERY_INCLUDE_STOPPED"))
+
+	cfg.AcmeChallengeWebroot = strings.TrimSpace(os.Getenv("ACME_CHALLENGE_WEBROOT"))
+	if cfg.AcmeChallengeWebroot != "" && (!strings.HasPrefix(cfg.AcmeChallengeWebroot, "/") || strings.ContainsAny(cfg.AcmeChallengeWebroot, " \t{}\"")) {
+		return nil, fmt.Errorf("invalid ACME_CHALLENGE_WEBROOT: %q (want an absolute path without spaces or braces)", cfg.AcmeChallengeWebroot)
+	}
+
+	cfg.AcmeDNSProvider = strings.ToLower(strings.TrimSpace(getEnvDefault("ACME_DNS_PROVIDER", "cloudflare")))
+	if !dnsProviderPattern.MatchString(cfg.AcmeDNSProvider) {
+		return nil, fmt.Errorf("invalid ACME_DNS_PROVIDER: %q (want a Caddy DNS module name, e.g. cloudflare or route53)", cfg.AcmeDNSProvider)
+	}
+	defaultArgs := ""
+	if cfg.AcmeDNSProvider == "cloudflare" {
+		defaultArgs = "{env.CLOUDFLARE_API_TOKEN}"
+	}
+	cfg.AcmeDNSProviderArgs = strings.TrimSpace(getEnvDefault("ACME_DNS_PROVIDER_ARGS", defaultArgs))
+	if strings.ContainsAny(cfg.AcmeDNSProviderArgs, "\n\r") {
+		return nil, fmt.Errorf("invalid ACME_DNS_PROVIDER_ARGS: %q (want a single line)", cfg.AcmeDNSProviderArgs)
+	}
+	for _, r := range parseCommaList(os.Getenv("ACME_DNS_RESOLVERS")) {
+		if strings.ContainsAny(r, " \t{}\"") {
+			return nil, fmt.Errorf("invalid ACME_DNS_RESOLVERS entry: %q (want host or host:port)", r)
+		}
+		cfg.AcmeDNSResolvers = append(cfg.AcmeDNSResolvers, r)
+	}
+
+	for _, p := range parseCommaList(os.Getenv("TLS_PROTOCOLS")) {
+		p = strings.ToLower(p)
+		if _, ok := tlsProtocols[p]; !ok {
+			return nil, fmt.Errorf("invalid TLS_PROTOCOLS entry: %q (want tls1.2 or tls1.3)", p)
+		}
+		cfg.TLSProtocols = append(cfg.TLSProtocols, p)
+	}
+	if len(cfg.TLSProtocols) > 2 || len(cfg.TLSProtocols) == 2 && tlsProtocols[cfg.TLSProtocols[0]] > tlsProtocols[cfg.TLSProtocols[1]] {
+		return nil, fmt.Errorf("invalid TLS_PROTOCOLS: %q (want a minimum and optional maximum version)", os.Getenv("TLS_PROTOCOLS"))
+	}
+	for _, c := range parseCommaList(os.Getenv("TLS_CIPHERS")) {
+		c = strings.ToUpper(c)
+		if !isTLSCipher(c) {
+			return nil, fmt.Errorf("invalid TLS_CIPHERS entry: %q (want a Caddy cipher suite name such as TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384)", c)
+		}
+		cfg.TLSCiphers = append(cfg.TLSCiphers, c)
+	}
+	for _, c := range parseCommaList(os.Getenv("TLS_CURVES")) {
+		c = strings.ToLower(c)
+		if !tlsCurves[c] {
+			return nil, fmt.Errorf("invalid TLS_CURVES entry: %q (want x25519, x25519mlkem768, secp256r1, secp384r1 or secp521r1)", c)
+		}
+		cfg.TLSCurves = append(cfg.TLSCurves, c)
+	}
+
+	cfg.ProxyLBTryDuration = strings.TrimSpace(os.Getenv("PROXY_LB_TRY_DURATION"))
+	cfg.ProxyLBTryInterval = strings.TrimSpace(os.Getenv("PROXY_LB_TRY_INTERVAL"))
+	for name, value := range map[string]string{
+		"PROXY_LB_TRY_DURATION": cfg.ProxyLBTryDuration,
+		"PROXY_LB_TRY_INTERVAL": cfg.ProxyLBTryInterval,
+	} {
+		if value == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid %s: %q (want a positive duration such as 5s)", name, value)
+		}
+	}
+
+	cfg.ValidateTargets = parseBool(os.Getenv("VALIDATE_TARGETS"))
+	validateTimeout, err := time.ParseDuration(getEnvDefault("VALIDATE_TARGETS_TIMEOUT", "1s"))
+	if err != nil || validateTimeout <= 0 {
+		return nil, fmt.Errorf("invalid VALIDATE_TARGETS_TIMEOUT: %q (want a positive duration)", os.Getenv("VALIDATE_TARGETS_TIMEOUT"))
+	}
+	cfg.ValidateTargetsTimeout = validateTimeout
+	cfg.ValidateTargetsDrop = parseBool(os.Getenv("VALIDATE_TARGETS_DROP"))
+	if cfg.ValidateTargetsDrop && !cfg.ValidateTargets {
+		return nil, fmt.Errorf("VALIDATE_TARGETS_DROP requires VALIDATE_TARGETS")
+	}
+
+	cfg.OriginCert = strings.TrimSpace(os.Getenv("ORIGIN_CERT"))
+	cfg.OriginKey = strings.TrimSpace(os.Getenv("ORIGIN_KEY"))
+	if (cfg.OriginCert == "") != (cfg.OriginKey == "") {
+		return nil, fmt.Errorf("ORIGIN_CERT and ORIGIN_KEY must be set together")
+	}
+	for name, path := range map[string]string{"ORIGIN_CERT": cfg.OriginCert, "ORIGIN_KEY": cfg.OriginKey} {
+		if path != "" && (!strings.HasPrefix(path, "/") || strings.ContainsAny(path, " \t{}\"")) {
+			return nil, fmt.Errorf("invalid %s: %q (want an absolute path without spaces or braces)", name, path)
+		}
+	}
+
+	cfg.SnapshotFile = strings.TrimSpace(os.Getenv("SNAPSHOT_FILE"))
+	if cfg.SnapshotFile != "" {
+		switch strings.ToLower(filepath.Ext(cfg.SnapshotFile)) {
+		case ".json", ".yaml", ".yml":
+		default:
+			return nil, fmt.Errorf("invalid SNAPSHOT_FILE: %q (want a .json, .yaml or .yml path)", cfg.SnapshotFile)
+		}
+	}
+	cfg.SkipStartupPush = parseBool(os.Getenv("SKIP_STARTUP_PUSH"))
+	if cfg.SkipStartupPush && cfg.SnapshotFile == "" {
+		return nil, fmt.Errorf("SKIP_STARTUP_PUSH requires SNAPSHOT_FILE")
+	}
+
+	cfg.StatusTLSCert = strings.TrimSpace(os.Getenv("STATUS_TLS_CERT"))
+	cfg.StatusTLSKey = strings.TrimSpace(os.Getenv("STATUS_TLS_KEY"))
+	cfg.StatusTLSClientCA = strings.TrimSpace(os.Getenv("STATUS_TLS_CLIENT_CA"))
+	cfg.StatusSocket = strings.TrimSpace(os.Getenv("STATUS_SOCKET"))
+	if (cfg.StatusTLSCert == "") != (cfg.StatusTLSKey == "") {
+		return nil, fmt.Errorf("STATUS_TLS_CERT and STATUS_TLS_KEY must be set together")
+	}
+	if cfg.StatusTLSClientCA != "" && cfg.StatusTLSCert == "" {
+		return nil, fmt.Errorf("STATUS_TLS_CLIENT_CA requires STATUS_TLS_CERT and STATUS_TLS_KEY")
+	}
+	if cfg.CaddyOnDemandTLS && cfg.StatusTLSCert != "" {
+		// Caddy's ask request is plain HTTP to the status server.
+		return nil, fmt.Errorf("CADDY_ON_DEMAND_TLS requires the plaintext status server (unset STATUS_TLS_CERT)")
+	}
+
+	cfg.StatusToken = os.Getenv("STATUS_TOKEN")
+	cfg.EnablePprof = parseBool(os.Getenv("ENABLE_PPROF"))
+	rateLimit, err := time.ParseDuration(getEnvDefault("STATUS_RATE_LIMIT", "30s"))
+	if err != nil || rateLimit < 0 {
+		return nil, fmt.Errorf("invalid STATUS_RATE_LIMIT: %q (want a non-negative duration)", os.Getenv("STATUS_RATE_LIMIT"))
+	}
+	cfg.StatusRateLimit = rateLimit
+
+	cfg.ReadyRequirePropagation = parseBool(os.Getenv("READY_REQUIRE_PROPAGATION"))
+	cfg.ReadyPropagationName = strings.TrimSuffix(strings.TrimSpace(os.Getenv("READY_PROPAGATION_NAME")), ".")
+	if cfg.ReadyRequirePropagation && cfg.ReadyPropagationName == "" {
+		if cfg.CloudflareProxy || cfg.ApexProxied {
+			return nil, fmt.Errorf("READY_REQUIRE_PROPAGATION requires READY_PROPAGATION_NAME (a grey-cloud record) when the apex is proxied or not published")
+		}
+		cfg.ReadyPropagationName = cfg.Domain
+	}
+	cfg.ReadyResolver = getEnvDefault("READY_RESOLVER", "1.1.1.1:53")
+	if _, port, err := net.SplitHostPort(cfg.ReadyResolver); err != nil || port == "" {
+		return nil, fmt.Errorf("invalid READY_RESOLVER: %q (want host:port, e.g. 1.1.1.1:53)", cfg.ReadyResolver)
+	}
+	readyTimeout, err := time.ParseDuration(getEnvDefault("READY_PROPAGATION_TIMEOUT", "5s"))
+	if err != nil || readyTimeout <= 0 {
+		return nil, fmt.Errorf("invalid READY_PROPAGATION_TIMEOUT: %q (want a positive duration)", os.Getenv("READY_PROPAGATION_TIMEOUT"))
+	}
+	cfg.ReadyPropagationTimeout = readyTimeout
+
+	cfg.RefreshOriginPullCA = parseBool(os.Getenv("REFRESH_ORIGIN_PULL_CA"))
+	caRefresh, err := time.ParseDuration(getEnvDefault("ORIGIN_PULL_CA_REFRESH_INTERVAL", "24h"))
+	if err != nil || caRefresh < time.Minute {
+		return nil, fmt.Errorf("invalid ORIGIN_PULL_CA_REFRESH_INTERVAL: %q (want a duration of at least 1m)", os.Getenv("ORIGIN_PULL_CA_REFRESH_INTERVAL"))
+	}
+	cfg.OriginPullCARefreshInterval = caRefresh
+
+	cfg.ProxyProbe = parseBool(os.Getenv("PROXY_PROBE"))
+	probeDelay, err := time.ParseDuration(getEnvDefault("PROXY_PROBE_DELAY", "30s"))
+	if err != nil || probeDelay < 0 {
+		return nil, fmt.Errorf("invalid PROXY_PROBE_DELAY: %q (want a non-negative duration)", os.Getenv("PROXY_PROBE_DELAY"))
+	}
+	cfg.ProxyProbeDelay = probeDelay
+
+	cfg.FamilyProbe = parseBool(os.Getenv("FAMILY_PROBE"))
+	familyProbePort, err := strconv.Atoi(getEnvDefault("FAMILY_PROBE_PORT", "443"))
+	if err != nil || familyProbePort < 1 || familyProbePort > 65535 {
+		return nil, fmt.Errorf("invalid FAMILY_PROBE_PORT: %q (want a port between 1 and 65535)", os.Getenv("FAMILY_PROBE_PORT"))
+	}
+	cfg.FamilyProbePort = familyProbePort
+	familyProbeTimeout, err := time.ParseDuration(getEnvDefault("FAMILY_PROBE_TIMEOUT", "5s"))
+	if err != nil || familyProbeTimeout <= 0 {
+		return nil, fmt.Errorf("invalid FAMILY_PROBE_TIMEOUT: %q (want a positive duration)", os.Getenv("FAMILY_PROBE_TIMEOUT"))
+	}
+	cfg.FamilyProbeTimeout = familyProbeTimeout
+	cfg.FamilyProbeWithdraw = parseBool(os.Getenv("FAMILY_PROBE_WITHDRAW"))
+	if cfg.FamilyProbeWithdraw && !cfg.FamilyProbe {
+		return nil, fmt.Errorf("FAMILY_PROBE_WITHDRAW requires FAMILY_PROBE")
+	}
+
+	cfg.DNSPlan = parseBool(os.Getenv("DNS_PLAN"))
+
+	seenTypes := make(map[string]bool)
+	for _, t := range parseCommaList(getEnvDefault("MANAGED_RECORD_TYPES", "A,AAAA")) {
+		t = strings.ToUpper(t)
+		if !managedRecordTypes[t] {
+			return nil, fmt.Errorf("invalid MANAGED_RECORD_TYPES entry: %q (want A, AAAA, CNAME, TXT, CAA, MX, SRV, HTTPS or SVCB)", t)
+		}
+		if !seenTypes[t] {
+			seenTypes[t] = true
+			cfg.ManagedRecordTypes = append(cfg.ManagedRecordTypes, t)
+		}
+	}
+	if len(cfg.ManagedRecordTypes) == 0 {
+		return nil, fmt.Errorf("invalid MANAGED_RECORD_TYPES: %q (want a comma-separated list of record types)", os.Getenv("MANAGED_RECORD_TYPES"))
+	}
+
+	cleanupConcurrency, err := strconv.Atoi(getEnvDefault("STALE_CLEANUP_CONCURRENCY", "4"))
+	if err != nil || cleanupConcurrency < 1 {
+		return nil, fmt.Errorf("invalid STALE_CLEANUP_CONCURRENCY: %q (want a positive integer)", os.Getenv("STALE_CLEANUP_CONCURRENCY"))
+	}
+	cfg.StaleCleanupConcurrency = cleanupConcurrency
+	cleanupTimeout, err := time.ParseDuration(getEnvDefault("STALE_CLEANUP_TIMEOUT", "2m"))
+	if err != nil || cleanupTimeout <= 0 {
+		return nil, fmt.Errorf("invalid STALE_CLEANUP_TIMEOUT: %q (want a positive duration)", os.Getenv("STALE_CLEANUP_TIMEOUT"))
+	}
+	cfg.StaleCleanupTimeout = cleanupTimeout
+	removalGrace, err := time.ParseDuration(getEnvDefault("REMOVAL_GRACE", "2m"))
+	if err != nil || removalGrace < 0 {
+		return nil, fmt.Errorf("invalid REMOVAL_GRACE: %q (want a non-negative duration)", os.Getenv("REMOVAL_GRACE"))
+	}
+	cfg.RemovalGrace = removalGrace
+	cfg.AllowEmptyReconcile = parseBool(os.Getenv("ALLOW_EMPTY_RECONCILE"))
+	maxSubdomains, err := strconv.Atoi(getEnvDefault("MAX_MANAGED_SUBDOMAINS", "0"))
+	if err != nil || maxSubdomains < 0 {
+		return nil, fmt.Errorf("invalid MAX_MANAGED_SUBDOMAINS: %q (want a non-negative integer, 0 for no cap)", os.Getenv("MAX_MANAGED_SUBDOMAINS"))
+	}
+	cfg.MaxManagedSubdomains = maxSubdomains
+	cfg.ShutdownCleanup = strings.ToLower(getEnvDefault("SHUTDOWN_CLEANUP", ShutdownCleanupNone))
+	switch cfg.ShutdownCleanup {
+	case ShutdownCleanupNone, ShutdownCleanupSubdomains, ShutdownCleanupAll:
+	default:
+		return nil, fmt.Errorf("invalid SHUTDOWN_CLEANUP: %q (want %s, %s or %s)",
+			cfg.ShutdownCleanup, ShutdownCleanupNone, ShutdownCleanupSubdomains, ShutdownCleanupAll)
+	}
+	cfg.DirectRemoveSubdomainRecords = parseBool(os.Getenv("DIRECT_REMOVE_SUBDOMAIN_RECORDS"))
+	cfg.UnsafeAllowAnyRecordName = parseBool(os.Getenv("UNSAFE_ALLOW_ANY_RECORD_NAME"))
+	if cfg.EnablePprof && cfg.StatusToken == "" {
+		return nil, fmt.Errorf("ENABLE_PPROF requires STATUS_TOKEN")
+	}
+
+	cfg.StripHeaders = parseCommaList(os.Getenv("STRIP_HEADERS"))
+	for _, h := range cfg.StripHeaders {
+		if !headerNamePattern.MatchString(strings.TrimSuffix(h, "*")) {
+			return nil, fmt.Errorf("invalid STRIP_HEADERS entry: %q (want a header name, optionally ending in *)", h)
+		}
+	}
+
+	// Parse request ID header (rendered verbatim into the Caddyfile)
+	sample, err := strconv.Atoi(getEnvDefault("ACCESS_LOG_SAMPLE", "1"))
+	if err != nil || sample < 1 {
+		return nil, fmt.Errorf("invalid ACCESS_LOG_SAMPLE: %q (want a positive integer N to log 1 in N requests)", os.Getenv("ACCESS_LOG_SAMPLE"))
+	}
+	if sample > 1 {
+		cfg.AccessLogSample = sample
+	}
+	for _, p := range parseCommaList(os.Getenv("ACCESS_LOG_SKIP_PATHS")) {
+		if !strings.HasPrefix(p, "/") || strings.ContainsAny(p, " \t{}\"") {
+			return nil, fmt.Errorf("invalid ACCESS_LOG_SKIP_PATHS entry: %q (want a path such as /health)", p)
+		}
+		cfg.AccessLogSkipPaths = append(cfg.AccessLogSkipPaths, p)
+	}
+
+	cfg.RequestIDHeader = strings.TrimSpace(os.Getenv("REQUEST_ID_HEADER"))
+	if cfg.RequestIDHeader != "" && !headerNamePattern.MatchString(cfg.RequestIDHeader) {
+		return nil, fmt.Errorf("invalid REQUEST_ID_HEADER: %q (want an HTTP header name such as X-Request-ID)", cfg.RequestIDHeader)
+	}
+
+	// Parse mapping conflict strategy
+	cfg.MappingConflictStrategy = strings.ToLower(getEnvDefault("MAPPING_CONFLICT_STRATEGY", ConflictFirst))
+	switch cfg.MappingConflictStrategy {
+	case ConflictFirst, ConflictDiscoveryPriority, ConflictMappingPriority, ConflictError:
+	default:
+		return nil, fmt.Errorf("invalid MAPPING_CONFLICT_STRATEGY: %q (want %s, %s, %s or %s)",
+			cfg.MappingConflictStrategy, ConflictFirst, ConflictDiscoveryPriority, ConflictMappingPriority, ConflictError)
+	}
 
 	// Parse DNS TTL (default to IP check interval in seconds, minimum 60)
 	if ttlStr := os.Getenv("DNS_TTL"); ttlStr != "" {
@@ -198,6 +1059,31 @@ func Load() (*Config, error) {
 		cfg.DNSTTL = ttl
 	}
 
+	// Parse apex TTL (default DNS_TTL, minimum 60)
+	cfg.ApexTTL = cfg.DNSTTL
+	if ttlStr := os.Getenv("APEX_TTL"); ttlStr != "" {
+		ttl, err := strconv.Atoi(ttlStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid APEX_TTL: %w", err)
+		}
+		if ttl < 60 {
+			ttl = 60 // Cloudflare minimum for non-proxied records
+		}
+		cfg.ApexTTL = ttl
+	}
+
+	ttlJitter, err := strconv.Atoi(getEnvDefault("DNS_TTL_JITTER", "0"))
+	if err != nil || ttlJitter < 0 || ttlJitter > 50 {
+		return nil, fmt.Errorf("invalid DNS_TTL_JITTER: %q (want a percentage between 0 and 50)", os.Getenv("DNS_TTL_JITTER"))
+	}
+	cfg.DNSTTLJitter = ttlJitter
+
+	historySize, err := strconv.Atoi(getEnvDefault("IP_HISTORY_SIZE", "20"))
+	if err != nil || historySize < 0 || historySize > 1000 {
+		return nil, fmt.Errorf("invalid IP_HISTORY_SIZE: %q (want an integer between 0 and 1000)", os.Getenv("IP_HISTORY_SIZE"))
+	}
+	cfg.IPHistorySize = historySize
+
 	// Set derived paths - prefer shared directory for cross-deployment communication
 	// Check shared dir first (Stevedore standard), fallback to data dir
 	sharedMappings := cfg.SharedDir + "/dyndns-mappings.yaml"
@@ -215,7 +1101,33 @@ func Load() (*Config, error) {
 		cfg.MappingsFile = sharedMappings
 	}
 
+	cfg.OnInvalidMappings = strings.ToLower(getEnvDefault("ON_INVALID_MAPPINGS", InvalidMappingsWarn))
+	switch cfg.OnInvalidMappings {
+	case InvalidMappingsWarn, InvalidMappingsExit:
+	default:
+		return nil, fmt.Errorf("invalid ON_INVALID_MAPPINGS: %q (want %s or %s)",
+			cfg.OnInvalidMappings, InvalidMappingsWarn, InvalidMappingsExit)
+	}
+	cfg.MappingsUnknownFields = strings.ToLower(getEnvDefault("MAPPINGS_UNKNOWN_FIELDS", UnknownFieldsWarn))
+	switch cfg.MappingsUnknownFields {
+	case UnknownFieldsWarn, UnknownFieldsError:
+	default:
+		return nil, fmt.Errorf("invalid MAPPINGS_UNKNOWN_FIELDS: %q (want %s or %s)",
+			cfg.MappingsUnknownFields, UnknownFieldsWarn, UnknownFieldsError)
+	}
+
 	cfg.CaddyFile = "/etc/caddy/Caddyfile"
+	cfg.CaddyAdmin = getEnvDefault("CADDY_ADMIN", "localhost:2019")
+	if strings.ContainsAny(cfg.CaddyAdmin, " \t{}\"") {
+		return nil, fmt.Errorf("invalid CADDY_ADMIN: %q (want host:port without spaces or braces)", cfg.CaddyAdmin)
+	}
+	cfg.CaddyMetricsAddr = strings.TrimSpace(os.Getenv("CADDY_METRICS_ADDR"))
+	if cfg.CaddyMetricsAddr != "" {
+		host, port, err := net.SplitHostPort(cfg.CaddyMetricsAddr)
+		if n, perr := strconv.Atoi(port); err != nil || host == "" || perr != nil || n < 1 || n > 65535 || strings.ContainsAny(host, " \t{}\"") {
+			return nil, fmt.Errorf("invalid CADDY_METRICS_ADDR: %q (want host:port, e.g. 127.0.0.1:9180)", cfg.CaddyMetricsAddr)
+		}
+	}
 
 	// Derive MTProto data dir now that DataDir is known.
 	if cfg.MTProtoDataDir == "" {
@@ -252,23 +1164,48 @@ func (c *Config) UseManualIP() bool {
 	return c.ManualIPv4 != "" || c.ManualIPv6 != ""
 }
 
+// FlexibleSSL returns true when Cloudflare proxies to the origin over plain
+// HTTP (proxy mode with SSL mode "flexible").
+func (c *Config) FlexibleSSL() bool {
+	return c.CloudflareProxy && c.CloudflareSSLMode == "flexible"
+}
+
 // UseDiscovery returns true if stevedore discovery is configured
 func (c *Config) UseDiscovery() bool {
 	return c.StevedoreToken != ""
 }
 
+// ApexSubdomain is the subdomain of a mapping served on the bare DOMAIN.
+const ApexSubdomain = "@"
+
 // GetSubdomainFQDN returns the full domain name for a subdomain label.
 // If the argument already contains a dot it is treated as a fully qualified
 // hostname and returned verbatim — this lets MTProto bindings declare
 // sibling zones like zone451.example.com without being mangled by
 // prefix-mode substitution.
-// In prefix mode: subdomain-basedomain.parent.com (e.g., app-zone.example.com)
+// With SubdomainNameTemplate: label.GetBaseDomain() (e.g., app-dev.zone.example.com)
+// In prefix mode: subdomain-basedomain.parent.com (e.g., app-zone.example.com);
+// with a known ZoneName every label below the zone is kept, joined by dashes
+// (app-a-b.example.com for a.b.example.com).
 // In normal mode: subdomain.domain (e.g., app.zone.example.com)
+// ApexSubdomain resolves to Domain itself in every mode.
 func (c *Config) GetSubdomainFQDN(subdomain string) string {
+	if subdomain == ApexSubdomain {
+		return c.Domain
+	}
 	if strings.Contains(subdomain, ".") {
 		return subdomain
 	}
+	if c.SubdomainNameTemplate != "" {
+		return c.SubdomainLabel(subdomain) + "." + c.GetBaseDomain()
+	}
 	if c.SubdomainPrefix {
+		if zone := c.prefixZone(); zone != "" {
+			// Flatten the labels below the zone: app.a.b.example.com ->
+			// app-a-b.example.com
+			label := strings.TrimSuffix(strings.ToLower(c.Domain), "."+zone)
+			return subdomain + "-" + strings.ReplaceAll(label, ".", "-") + "." + zone
+		}
 		// Extract the parent domain (everything after first dot)
 		parts := strings.SplitN(c.Domain, ".", 2)
 		if len(parts) == 2 {
@@ -281,6 +1218,65 @@ func (c *Config) GetSubdomainFQDN(subdomain string) string {
 	return subdomain + "." + c.Domain
 }
 
+// dnsProviderPattern is what ACME_DNS_PROVIDER must look like: the name of
+// a Caddy dns.providers module.
+var dnsProviderPattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// nameLabelPattern is what a rendered SUBDOMAIN_NAME_TEMPLATE label (and
+// each placeholder value) must look like: a single lowercase DNS label.
+var nameLabelPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// zoneLabel returns the first label of Domain ("home" for home.example.com).
+func (c *Config) zoneLabel() string {
+	zone, _, _ := strings.Cut(c.Domain, ".")
+	return zone
+}
+
+// SubdomainLabel renders SubdomainNameTemplate for subdomain. Without a
+// template the subdomain is returned unchanged.
+func (c *Config) SubdomainLabel(subdomain string) string {
+	if c.SubdomainNameTemplate == "" {
+		return subdomain
+	}
+	return strings.NewReplacer(
+		"{sub}", subdomain,
+		"{zone}", c.zoneLabel(),
+		"{env}", c.SubdomainNameEnv,
+	).Replace(c.SubdomainNameTemplate)
+}
+
+// SubdomainLabelPattern returns a regexp matching labels produced by
+// SubdomainNameTemplate, with the subdomain as the first capture group.
+// It returns nil when no template is configured.
+func (c *Config) SubdomainLabelPattern() *regexp.Regexp {
+	if c.SubdomainNameTemplate == "" {
+		return nil
+	}
+	fixed := strings.NewReplacer(
+		"{zone}", c.zoneLabel(),
+		"{env}", c.SubdomainNameEnv,
+	).Replace(c.SubdomainNameTemplate)
+	before, after, _ := strings.Cut(fixed, "{sub}")
+	return regexp.MustCompile("^" + regexp.QuoteMeta(before) + "([a-z0-9](?:[a-z0-9-]*[a-z0-9])?)" + regexp.QuoteMeta(after) + "$")
+}
+
+func (c *Config) validateNameTemplate() error {
+	tpl := c.SubdomainNameTemplate
+	if tpl == "" {
+		return nil
+	}
+	if strings.Count(tpl, "{sub}") != 1 {
+		return fmt.Errorf("invalid SUBDOMAIN_NAME_TEMPLATE: %q (must contain {sub} exactly once)", tpl)
+	}
+	if strings.Contains(tpl, "{env}") && !nameLabelPattern.MatchString(c.SubdomainNameEnv) {
+		return fmt.Errorf("SUBDOMAIN_NAME_ENV must be a DNS label when SUBDOMAIN_NAME_TEMPLATE uses {env} (got %q)", c.SubdomainNameEnv)
+	}
+	if sample := c.SubdomainLabel("app"); !nameLabelPattern.MatchString(sample) {
+		return fmt.Errorf("invalid SUBDOMAIN_NAME_TEMPLATE: %q renders %q, which is not a single DNS label", tpl, sample)
+	}
+	return nil
+}
+
 // ResolveMTProtoEntry interprets a single MTPROTO_SUBDOMAINS entry and
 // returns the (label, fqdn) pair used throughout the MTProto subsystem.
 //
@@ -308,10 +1304,15 @@ func (c *Config) ResolveMTProtoEntry(entry string) (label, fqdn string) {
 
 // GetBaseDomain returns the parent domain for DNS record creation in prefix mode.
 // In prefix mode, subdomains like app-zone.example.com are direct children of example.com.
+// When the Cloudflare zone is known (ZoneName) it is the parent, however deep
+// DOMAIN is; otherwise the parent is DOMAIN without its first label.
 // In normal mode, returns the configured domain.
 // For single-level domains (like example.com), returns the domain as-is since there's no valid parent.
 func (c *Config) GetBaseDomain() string {
 	if c.SubdomainPrefix {
+		if zone := c.prefixZone(); zone != "" {
+			return zone
+		}
 		parts := strings.SplitN(c.Domain, ".", 2)
 		// Only use parent if it has at least 2 parts (e.g., example.com, not just "com")
 		if len(parts) == 2 && strings.Contains(parts[1], ".") {
@@ -321,6 +1322,50 @@ func (c *Config) GetBaseDomain() string {
 	return c.Domain
 }
 
+// prefixZone returns ZoneName, normalized, when DOMAIN is a name below it,
+// and "" otherwise (zone unknown, or DOMAIN is the zone apex).
+func (c *Config) prefixZone() string {
+	zone := strings.ToLower(strings.TrimSuffix(c.ZoneName, "."))
+	domain := strings.ToLower(strings.TrimSuffix(c.Domain, "."))
+	if zone == "" || !strings.HasSuffix(domain, "."+zone) {
+		return ""
+	}
+	return zone
+}
+
+// StatusTLSConfig builds the TLS config for the status server. It returns
+// nil when no status certificate is configured (plaintext). When a client
+// CA is configured, clients must present a certificate it signed.
+func (c *Config) StatusTLSConfig() (*tls.Config, error) {
+	if c.StatusTLSCert == "" {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.StatusTLSCert, c.StatusTLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load status TLS key pair: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if c.StatusTLSClientCA != "" {
+		caPEM, err := os.ReadFile(c.StatusTLSClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read status TLS client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in status TLS client CA %s", c.StatusTLSClientCA)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
+
 func getEnvDefault(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -248,81 +249,1628 @@ func TestLoad_DiscoverySettings(t *testing.T) {
 	if cfg.StevedoreToken != "my-token" {
 		t.Errorf("StevedoreToken = %q, want %q", cfg.StevedoreToken, "my-token")
 	}
+
+	// The same API over TCP
+	for socket, want := range map[string]string{
+		"http://stevedore.lan:42107": "http://stevedore.lan:42107",
+		"https://10.0.0.5:8443/api/": "https://10.0.0.5:8443/api",
+		"http://[2001:db8::5]:42107": "http://[2001:db8::5]:42107",
+		"HTTPS://Stevedore.lan:8443": "https://Stevedore.lan:8443",
+	} {
+		os.Setenv("STEVEDORE_SOCKET", socket)
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("STEVEDORE_SOCKET=%s: unexpected error: %v", socket, err)
+		}
+		if cfg.StevedoreSocket != want {
+			t.Errorf("STEVEDORE_SOCKET=%s: StevedoreSocket = %q, want %q", socket, cfg.StevedoreSocket, want)
+		}
+	}
+	for _, socket := range []string{"query.sock", "tcp://stevedore:42107", "http://", "http://stevedore:42107/?token=x"} {
+		os.Setenv("STEVEDORE_SOCKET", socket)
+		if _, err := Load(); err == nil {
+			t.Errorf("STEVEDORE_SOCKET=%s: expected error", socket)
+		}
+	}
+}
+
+func TestLoad_CaddyAdmin(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.CaddyAdmin != "localhost:2019" {
+		t.Errorf("CaddyAdmin = %q, want %q", cfg.CaddyAdmin, "localhost:2019")
+	}
+
+	os.Setenv("CADDY_ADMIN", "http://127.0.0.1:2020")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.CaddyAdmin != "http://127.0.0.1:2020" {
+		t.Errorf("CaddyAdmin = %q, want %q", cfg.CaddyAdmin, "http://127.0.0.1:2020")
+	}
+
+	os.Setenv("CADDY_ADMIN", "localhost:2019 {")
+	if _, err := Load(); err == nil {
+		t.Error("Load() with CADDY_ADMIN containing a brace expected error")
+	}
+}
+
+func TestLoad_CaddyMetricsAddr(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	os.Setenv("CADDY_METRICS_ADDR", "127.0.0.1:9180")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.CaddyMetricsAddr != "127.0.0.1:9180" {
+		t.Errorf("CaddyMetricsAddr = %q, want %q", cfg.CaddyMetricsAddr, "127.0.0.1:9180")
+	}
+
+	for _, bad := range []string{":9180", "127.0.0.1", "127.0.0.1:http", "127.0.0.1:70000"} {
+		os.Setenv("CADDY_METRICS_ADDR", bad)
+		if _, err := Load(); err == nil {
+			t.Errorf("Load() with CADDY_METRICS_ADDR=%q expected error", bad)
+		}
+	}
+}
+
+func TestLoad_RequestIDHeader(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	os.Setenv("REQUEST_ID_HEADER", "X-Correlation-ID")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.RequestIDHeader != "X-Correlation-ID" {
+		t.Errorf("RequestIDHeader = %q, want %q", cfg.RequestIDHeader, "X-Correlation-ID")
+	}
+
+	for _, bad := range []string{"X Request", "X-Id}", "-X"} {
+		clearEnv()
+		setRequiredEnv()
+		os.Setenv("REQUEST_ID_HEADER", bad)
+		if _, err := Load(); err == nil {
+			t.Errorf("Load() with REQUEST_ID_HEADER=%q expected error", bad)
+		}
+	}
+}
+
+func TestLoad_CloudflareAPIBaseURL(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.CloudflareAPIBaseURL != "" {
+		t.Errorf("CloudflareAPIBaseURL = %q, want empty default", cfg.CloudflareAPIBaseURL)
+	}
+
+	os.Setenv("CLOUDFLARE_API_BASE_URL", "http://egress.internal:8080/client/v4/")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.CloudflareAPIBaseURL != "http://egress.internal:8080/client/v4" {
+		t.Errorf("CloudflareAPIBaseURL = %q, want trailing slash trimmed", cfg.CloudflareAPIBaseURL)
+	}
+
+	for _, bad := range []string{"egress.internal", "ftp://egress.internal", "http://"} {
+		clearEnv()
+		setRequiredEnv()
+		os.Setenv("CLOUDFLARE_API_BASE_URL", bad)
+		if _, err := Load(); err == nil {
+			t.Errorf("Load() with CLOUDFLARE_API_BASE_URL=%q expected error", bad)
+		}
+	}
+}
+
+func TestLoad_AcmeChallengeWebroot(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	os.Setenv("ACME_CHALLENGE_WEBROOT", "/var/www/acme")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.AcmeChallengeWebroot != "/var/www/acme" {
+		t.Errorf("AcmeChallengeWebroot = %q, want %q", cfg.AcmeChallengeWebroot, "/var/www/acme")
+	}
+
+	for _, bad := range []string{"relative/dir", "/var/www/my acme", "/var/{x}"} {
+		clearEnv()
+		setRequiredEnv()
+		os.Setenv("ACME_CHALLENGE_WEBROOT", bad)
+		if _, err := Load(); err == nil {
+			t.Errorf("Load() with ACME_CHALLENGE_WEBROOT=%q expected error", bad)
+		}
+	}
+}
+
+func TestLoad_ProxyLBTry(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	os.Setenv("PROXY_LB_TRY_DURATION", "5s")
+	os.Setenv("PROXY_LB_TRY_INTERVAL", "250ms")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.ProxyLBTryDuration != "5s" || cfg.ProxyLBTryInterval != "250ms" {
+		t.Errorf("ProxyLBTry = %q/%q, want 5s/250ms", cfg.ProxyLBTryDuration, cfg.ProxyLBTryInterval)
+	}
+
+	for _, bad := range []string{"5", "soon", "0s", "-1s"} {
+		clearEnv()
+		setRequiredEnv()
+		os.Setenv("PROXY_LB_TRY_DURATION", bad)
+		if _, err := Load(); err == nil {
+			t.Errorf("Load() with PROXY_LB_TRY_DURATION=%q expected error", bad)
+		}
+	}
+}
+
+func TestLoad_EnablePprof(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	os.Setenv("ENABLE_PPROF", "true")
+	if _, err := Load(); err == nil {
+		t.Error("Load() with ENABLE_PPROF but no STATUS_TOKEN expected error")
+	}
+
+	os.Setenv("STATUS_TOKEN", "s3cret")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if !cfg.EnablePprof || cfg.StatusToken != "s3cret" {
+		t.Errorf("EnablePprof = %v, StatusToken = %q", cfg.EnablePprof, cfg.StatusToken)
+	}
+}
+
+func TestLoad_CaddyOnDemandTLS(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	os.Setenv("CADDY_ON_DEMAND_TLS", "true")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if !cfg.CaddyOnDemandTLS {
+		t.Error("CaddyOnDemandTLS = false, want true")
+	}
+
+	os.Setenv("STATUS_TLS_CERT", "/certs/status.pem")
+	os.Setenv("STATUS_TLS_KEY", "/certs/status-key.pem")
+	if _, err := Load(); err == nil {
+		t.Error("Load() with CADDY_ON_DEMAND_TLS and STATUS_TLS_CERT expected error")
+	}
+}
+
+func TestLoad_SnapshotFile(t *testing.T) {
+	for _, path := range []string{"/data/snapshot.json", "/data/snapshot.yaml", "/data/snapshot.YML"} {
+		clearEnv()
+		setRequiredEnv()
+		os.Setenv("SNAPSHOT_FILE", path)
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("Load() with SNAPSHOT_FILE=%q unexpected error: %v", path, err)
+		}
+		if cfg.SnapshotFile != path {
+			t.Errorf("SnapshotFile = %q, want %q", cfg.SnapshotFile, path)
+		}
+	}
+
+	clearEnv()
+	setRequiredEnv()
+	os.Setenv("SNAPSHOT_FILE", "/data/snapshot.txt")
+	if _, err := Load(); err == nil {
+		t.Error("Load() with SNAPSHOT_FILE=/data/snapshot.txt expected error")
+	}
+}
+
+func TestLoad_OnDetectionFailure(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.OnDetectionFailure != DetectionFailureKeep || cfg.OnDetectionFailureThreshold != 3 {
+		t.Errorf("defaults = %q/%d, want %q/3", cfg.OnDetectionFailure, cfg.OnDetectionFailureThreshold, DetectionFailureKeep)
+	}
+
+	os.Setenv("ON_DETECTION_FAILURE", "Remove")
+	os.Setenv("ON_DETECTION_FAILURE_THRESHOLD", "5")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.OnDetectionFailure != DetectionFailureRemove || cfg.OnDetectionFailureThreshold != 5 {
+		t.Errorf("policy = %q/%d, want %q/5", cfg.OnDetectionFailure, cfg.OnDetectionFailureThreshold, DetectionFailureRemove)
+	}
+
+	for name, value := range map[string]string{
+		"ON_DETECTION_FAILURE":           "delete",
+		"ON_DETECTION_FAILURE_THRESHOLD": "0",
+	} {
+		clearEnv()
+		setRequiredEnv()
+		os.Setenv(name, value)
+		if _, err := Load(); err == nil {
+			t.Errorf("Load() with %s=%q expected error", name, value)
+		}
+	}
+}
+
+func TestLoad_OnInvalidMappings(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.OnInvalidMappings != InvalidMappingsWarn {
+		t.Errorf("default = %q, want %q", cfg.OnInvalidMappings, InvalidMappingsWarn)
+	}
+
+	os.Setenv("ON_INVALID_MAPPINGS", "Exit")
+	if cfg, err = Load(); err != nil || cfg.OnInvalidMappings != InvalidMappingsExit {
+		t.Errorf("Load() = %+v, %v; want %q", cfg, err, InvalidMappingsExit)
+	}
+
+	os.Setenv("ON_INVALID_MAPPINGS", "ignore")
+	if _, err := Load(); err == nil {
+		t.Error("Load() with invalid ON_INVALID_MAPPINGS expected error")
+	}
+}
+
+func TestLoad_ReadyPropagation(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.ReadyRequirePropagation || cfg.ReadyResolver != "1.1.1.1:53" || cfg.ReadyPropagationTimeout != 5*time.Second {
+		t.Errorf("defaults = %v/%q/%v, want false/1.1.1.1:53/5s",
+			cfg.ReadyRequirePropagation, cfg.ReadyResolver, cfg.ReadyPropagationTimeout)
+	}
+
+	os.Setenv("READY_REQUIRE_PROPAGATION", "true")
+	if cfg, err = Load(); err != nil || cfg.ReadyPropagationName != cfg.Domain {
+		t.Errorf("Load() = %+v, %v; want the apex as propagation name", cfg, err)
+	}
+
+	// A proxied apex resolves to Cloudflare, so a name is required.
+	os.Setenv("CLOUDFLARE_PROXY", "true")
+	if _, err := Load(); err == nil {
+		t.Error("Load() in proxy mode without READY_PROPAGATION_NAME expected error")
+	}
+	os.Setenv("READY_PROPAGATION_NAME", "canary.example.com.")
+	if cfg, err = Load(); err != nil || cfg.ReadyPropagationName != "canary.example.com" {
+		t.Errorf("Load() = %+v, %v; want canary.example.com", cfg, err)
+	}
+
+	for name, value := range map[string]string{
+		"READY_RESOLVER":            "1.1.1.1",
+		"READY_PROPAGATION_TIMEOUT": "0s",
+	} {
+		clearEnv()
+		setRequiredEnv()
+		os.Setenv(name, value)
+		if _, err := Load(); err == nil {
+			t.Errorf("Load() with %s=%q expected error", name, value)
+		}
+	}
+}
+
+func TestLoad_StatusRateLimit(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.StatusRateLimit != 30*time.Second {
+		t.Errorf("StatusRateLimit default = %v, want 30s", cfg.StatusRateLimit)
+	}
+
+	os.Setenv("STATUS_RATE_LIMIT", "0s")
+	if cfg, err = Load(); err != nil || cfg.StatusRateLimit != 0 {
+		t.Errorf("STATUS_RATE_LIMIT=0s: %v, %v; want disabled", cfg, err)
+	}
+
+	os.Setenv("STATUS_RATE_LIMIT", "-1s")
+	if _, err := Load(); err == nil {
+		t.Error("Load() with negative STATUS_RATE_LIMIT expected error")
+	}
+}
+
+func TestLoad_DiscoveryDebounce(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.DiscoveryDebounce != 2*time.Second {
+		t.Errorf("DiscoveryDebounce default = %v, want 2s", cfg.DiscoveryDebounce)
+	}
+
+	os.Setenv("DISCOVERY_DEBOUNCE", "0s")
+	if cfg, err = Load(); err != nil || cfg.DiscoveryDebounce != 0 {
+		t.Errorf("DISCOVERY_DEBOUNCE=0s: %v, %v; want disabled", cfg, err)
+	}
+
+	os.Setenv("DISCOVERY_DEBOUNCE", "-1s")
+	if _, err := Load(); err == nil {
+		t.Error("Load() with negative DISCOVERY_DEBOUNCE expected error")
+	}
+}
+
+func TestLoad_ProxyProbe(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.ProxyProbe || cfg.ProxyProbeDelay != 30*time.Second {
+		t.Errorf("defaults = %v/%v, want false/30s", cfg.ProxyProbe, cfg.ProxyProbeDelay)
+	}
+
+	os.Setenv("PROXY_PROBE", "true")
+	os.Setenv("PROXY_PROBE_DELAY", "2m")
+	if cfg, err = Load(); err != nil || !cfg.ProxyProbe || cfg.ProxyProbeDelay != 2*time.Minute {
+		t.Errorf("Load() = %+v, %v; want probing after 2m", cfg, err)
+	}
+
+	os.Setenv("PROXY_PROBE_DELAY", "soon")
+	if _, err := Load(); err == nil {
+		t.Error("Load() with invalid PROXY_PROBE_DELAY expected error")
+	}
+}
+
+func TestLoad_ManagedRecordTypes(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if strings.Join(cfg.ManagedRecordTypes, ",") != "A,AAAA" {
+		t.Errorf("default = %v, want [A AAAA]", cfg.ManagedRecordTypes)
+	}
+
+	os.Setenv("MANAGED_RECORD_TYPES", "a, AAAA,cname,A")
+	if cfg, err = Load(); err != nil || strings.Join(cfg.ManagedRecordTypes, ",") != "A,AAAA,CNAME" {
+		t.Errorf("Load() = %v, %v; want [A AAAA CNAME]", cfg.ManagedRecordTypes, err)
+	}
+
+	for _, bad := range []string{"NS", "A,BOGUS", ","} {
+		os.Setenv("MANAGED_RECORD_TYPES", bad)
+		if _, err := Load(); err == nil {
+			t.Errorf("Load() with MANAGED_RECORD_TYPES=%q expected error", bad)
+		}
+	}
+}
+
+func TestLoad_DNSPlan(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.DNSPlan {
+		t.Error("DNSPlan should default to false")
+	}
+
+	os.Setenv("DNS_PLAN", "true")
+	if cfg, err = Load(); err != nil || !cfg.DNSPlan {
+		t.Errorf("Load() = %+v, %v; want DNSPlan enabled", cfg, err)
+	}
+}
+
+func TestLoad_RefreshOriginPullCA(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.RefreshOriginPullCA || cfg.OriginPullCARefreshInterval != 24*time.Hour {
+		t.Errorf("defaults = %v/%v, want false/24h", cfg.RefreshOriginPullCA, cfg.OriginPullCARefreshInterval)
+	}
+
+	os.Setenv("REFRESH_ORIGIN_PULL_CA", "true")
+	os.Setenv("ORIGIN_PULL_CA_REFRESH_INTERVAL", "6h")
+	if cfg, err = Load(); err != nil || !cfg.RefreshOriginPullCA || cfg.OriginPullCARefreshInterval != 6*time.Hour {
+		t.Errorf("Load() = %+v, %v; want refresh enabled every 6h", cfg, err)
+	}
+
+	os.Setenv("ORIGIN_PULL_CA_REFRESH_INTERVAL", "10s")
+	if _, err := Load(); err == nil {
+		t.Error("Load() with ORIGIN_PULL_CA_REFRESH_INTERVAL below 1m expected error")
+	}
+}
+
+func TestLoad_FritzboxReconnectWatch(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.FritzboxReconnectWatch || cfg.FritzboxReconnectPoll != 30*time.Second {
+		t.Errorf("defaults = %v/%v, want false/30s", cfg.FritzboxReconnectWatch, cfg.FritzboxReconnectPoll)
+	}
+
+	os.Setenv("FRITZBOX_RECONNECT_WATCH", "true")
+	os.Setenv("FRITZBOX_RECONNECT_POLL", "1m")
+	if cfg, err = Load(); err != nil || !cfg.FritzboxReconnectWatch || cfg.FritzboxReconnectPoll != time.Minute {
+		t.Errorf("Load() = %+v, %v; want watch enabled every 1m", cfg, err)
+	}
+
+	os.Setenv("FRITZBOX_RECONNECT_POLL", "100ms")
+	if _, err := Load(); err == nil {
+		t.Error("Load() with FRITZBOX_RECONNECT_POLL below 1s expected error")
+	}
+}
+
+func TestLoad_StripHeaders(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	os.Setenv("STRIP_HEADERS", "X-Internal-Token, X-Debug-*")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if got := strings.Join(cfg.StripHeaders, ","); got != "X-Internal-Token,X-Debug-*" {
+		t.Errorf("StripHeaders = %v, want [X-Internal-Token X-Debug-*]", cfg.StripHeaders)
+	}
+
+	for _, bad := range []string{"X Bad", "X-{a}", "*"} {
+		clearEnv()
+		setRequiredEnv()
+		os.Setenv("STRIP_HEADERS", bad)
+		if _, err := Load(); err == nil {
+			t.Errorf("Load() with STRIP_HEADERS=%q expected error", bad)
+		}
+	}
+}
+
+func TestLoad_OriginCert(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	os.Setenv("ORIGIN_CERT", "/etc/cloudflare/origin.pem")
+	os.Setenv("ORIGIN_KEY", "/etc/cloudflare/origin-key.pem")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.OriginCert != "/etc/cloudflare/origin.pem" || cfg.OriginKey != "/etc/cloudflare/origin-key.pem" {
+		t.Errorf("origin cert = %q/%q, want the configured paths", cfg.OriginCert, cfg.OriginKey)
+	}
+
+	for _, env := range []map[string]string{
+		{"ORIGIN_CERT": "/etc/cloudflare/origin.pem"},
+		{"ORIGIN_CERT": "origin.pem", "ORIGIN_KEY": "/etc/cloudflare/origin-key.pem"},
+		{"ORIGIN_CERT": "/etc/cloudflare/origin.pem", "ORIGIN_KEY": "/etc/{key}.pem"},
+	} {
+		clearEnv()
+		setRequiredEnv()
+		for k, v := range env {
+			os.Setenv(k, v)
+		}
+		if _, err := Load(); err == nil {
+			t.Errorf("Load() with %v expected error", env)
+		}
+	}
+}
+
+func TestLoad_IPCheckJitter(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	os.Setenv("IP_CHECK_JITTER", "30s")
+	os.Setenv("IP_CHECK_ALIGN", "true")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.IPCheckJitter != 30*time.Second || !cfg.IPCheckAlign {
+		t.Errorf("IPCheckJitter = %v, IPCheckAlign = %v, want 30s, true", cfg.IPCheckJitter, cfg.IPCheckAlign)
+	}
+
+	for _, bad := range []string{"soon", "-1s", "5m", "10m"} {
+		clearEnv()
+		setRequiredEnv()
+		os.Setenv("IP_CHECK_JITTER", bad)
+		if _, err := Load(); err == nil {
+			t.Errorf("Load() with IP_CHECK_JITTER=%q expected error (interval 5m)", bad)
+		}
+	}
+}
+
+func TestConfig_SubdomainNameTemplate(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		sub  string
+		want string
+	}{
+		{
+			name: "suffix env",
+			cfg:  Config{Domain: "zone.example.com", SubdomainNameTemplate: "{sub}-{env}", SubdomainNameEnv: "dev"},
+			sub:  "app",
+			want: "app-dev.zone.example.com",
+		},
+		{
+			name: "literal prefix",
+			cfg:  Config{Domain: "zone.example.com", SubdomainNameTemplate: "dev-{sub}"},
+			sub:  "app",
+			want: "dev-app.zone.example.com",
+		},
+		{
+			name: "prefix mode places label under parent",
+			cfg:  Config{Domain: "zone.example.com", SubdomainPrefix: true, SubdomainNameTemplate: "{sub}-internal-{zone}"},
+			sub:  "app",
+			want: "app-internal-zone.example.com",
+		},
+		{
+			name: "FQDN passes through",
+			cfg:  Config{Domain: "zone.example.com", SubdomainNameTemplate: "dev-{sub}"},
+			sub:  "other.example.org",
+			want: "other.example.org",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.GetSubdomainFQDN(tt.sub); got != tt.want {
+				t.Errorf("GetSubdomainFQDN(%q) = %q, want %q", tt.sub, got, tt.want)
+			}
+			if strings.Contains(tt.sub, ".") {
+				return
+			}
+			m := tt.cfg.SubdomainLabelPattern().FindStringSubmatch(tt.cfg.SubdomainLabel(tt.sub))
+			if m == nil || m[1] != tt.sub {
+				t.Errorf("SubdomainLabelPattern() match = %v, want subdomain %q", m, tt.sub)
+			}
+		})
+	}
+
+	if p := (&Config{Domain: "example.com"}).SubdomainLabelPattern(); p != nil {
+		t.Errorf("SubdomainLabelPattern() without template = %v, want nil", p)
+	}
+}
+
+// TestGetBaseDomain_ZoneName verifies that in prefix mode a known zone
+// name, not the parent of DOMAIN, is the base domain records go under.
+func TestGetBaseDomain_ZoneName(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      Config
+		wantBase string
+		wantFQDN string
+	}{
+		{
+			name:     "zone unknown splits DOMAIN",
+			cfg:      Config{Domain: "a.b.c.example.com", SubdomainPrefix: true},
+			wantBase: "b.c.example.com",
+			wantFQDN: "app-a.b.c.example.com",
+		},
+		{
+			name:     "deep DOMAIN under the zone",
+			cfg:      Config{Domain: "a.b.c.example.com", SubdomainPrefix: true, ZoneName: "example.com"},
+			wantBase: "example.com",
+			wantFQDN: "app-a-b-c.example.com",
+		},
+		{
+			name:     "zone is the naive parent",
+			cfg:      Config{Domain: "home.example.com", SubdomainPrefix: true, ZoneName: "Example.com."},
+			wantBase: "example.com",
+			wantFQDN: "app-home.example.com",
+		},
+		{
+			name:     "DOMAIN is the zone apex",
+			cfg:      Config{Domain: "home.example.com", SubdomainPrefix: true, ZoneName: "home.example.com"},
+			wantBase: "example.com",
+			wantFQDN: "app-home.example.com",
+		},
+		{
+			name:     "normal mode ignores the zone",
+			cfg:      Config{Domain: "a.b.example.com", ZoneName: "example.com"},
+			wantBase: "a.b.example.com",
+			wantFQDN: "app.a.b.example.com",
+		},
+		{
+			name:     "name template goes under the zone",
+			cfg:      Config{Domain: "a.b.example.com", SubdomainPrefix: true, ZoneName: "example.com", SubdomainNameTemplate: "{sub}-dev"},
+			wantBase: "example.com",
+			wantFQDN: "app-dev.example.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.GetBaseDomain(); got != tt.wantBase {
+				t.Errorf("GetBaseDomain() = %q, want %q", got, tt.wantBase)
+			}
+			if got := tt.cfg.GetSubdomainFQDN("app"); got != tt.wantFQDN {
+				t.Errorf("GetSubdomainFQDN(app) = %q, want %q", got, tt.wantFQDN)
+			}
+		})
+	}
+}
+
+func TestLoad_SubdomainNameTemplate(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	os.Setenv("SUBDOMAIN_NAME_TEMPLATE", "{SUB}-{env}")
+	os.Setenv("SUBDOMAIN_NAME_ENV", "Dev")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.SubdomainNameTemplate != "{sub}-{env}" || cfg.SubdomainNameEnv != "dev" {
+		t.Errorf("template = %q env = %q, want lowercased", cfg.SubdomainNameTemplate, cfg.SubdomainNameEnv)
+	}
+
+	bad := []map[string]string{
+		{"SUBDOMAIN_NAME_TEMPLATE": "static"},
+		{"SUBDOMAIN_NAME_TEMPLATE": "{sub}-{sub}"},
+		{"SUBDOMAIN_NAME_TEMPLATE": "{sub}.internal"},
+		{"SUBDOMAIN_NAME_TEMPLATE": "{sub}-{env}"},
+		{"SUBDOMAIN_NAME_TEMPLATE": "{sub}-{env}", "SUBDOMAIN_NAME_ENV": "a.b"},
+		{"SUBDOMAIN_NAME_TEMPLATE": "{sub}-"},
+	}
+	for _, env := range bad {
+		clearEnv()
+		setRequiredEnv()
+		for k, v := range env {
+			os.Setenv(k, v)
+		}
+		if _, err := Load(); err == nil {
+			t.Errorf("Load() with %v expected error", env)
+		}
+	}
+}
+
+func TestLoad_DiscoveryPollTimeout(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.DiscoveryPollTimeout != 60*time.Second {
+		t.Errorf("DiscoveryPollTimeout = %v, want %v", cfg.DiscoveryPollTimeout, 60*time.Second)
+	}
+
+	clearEnv()
+	setRequiredEnv()
+	os.Setenv("DISCOVERY_POLL_TIMEOUT", "2m")
+
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.DiscoveryPollTimeout != 2*time.Minute {
+		t.Errorf("DiscoveryPollTimeout = %v, want %v", cfg.DiscoveryPollTimeout, 2*time.Minute)
+	}
+
+	for _, bad := range []string{"forever", "500ms", "-1s"} {
+		clearEnv()
+		setRequiredEnv()
+		os.Setenv("DISCOVERY_POLL_TIMEOUT", bad)
+		if _, err := Load(); err == nil {
+			t.Errorf("Load() with DISCOVERY_POLL_TIMEOUT=%q expected error", bad)
+		}
+	}
+}
+
+func TestLoad_MappingConflictStrategy(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.MappingConflictStrategy != ConflictFirst {
+		t.Errorf("MappingConflictStrategy = %q, want %q", cfg.MappingConflictStrategy, ConflictFirst)
+	}
+
+	for _, v := range []string{ConflictDiscoveryPriority, ConflictMappingPriority, ConflictError, "ERROR"} {
+		clearEnv()
+		setRequiredEnv()
+		os.Setenv("MAPPING_CONFLICT_STRATEGY", v)
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("Load() with %q unexpected error: %v", v, err)
+		}
+		if want := strings.ToLower(v); cfg.MappingConflictStrategy != want {
+			t.Errorf("MappingConflictStrategy = %q, want %q", cfg.MappingConflictStrategy, want)
+		}
+	}
+
+	clearEnv()
+	setRequiredEnv()
+	os.Setenv("MAPPING_CONFLICT_STRATEGY", "last")
+	if _, err := Load(); err == nil {
+		t.Error("Load() with unknown strategy expected error")
+	}
+}
+
+func TestLoad_DNSTTLSettings(t *testing.T) {
+	t.Run("default TTL matches IP check interval", func(t *testing.T) {
+		clearEnv()
+		setRequiredEnv()
+		os.Setenv("IP_CHECK_INTERVAL", "5m")
+
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("Load() unexpected error: %v", err)
+		}
+
+		// 5 minutes = 300 seconds
+		if cfg.DNSTTL != 300 {
+			t.Errorf("DNSTTL = %d, want %d", cfg.DNSTTL, 300)
+		}
+	})
+
+	t.Run("minimum TTL is 60 seconds", func(t *testing.T) {
+		clearEnv()
+		setRequiredEnv()
+		os.Setenv("IP_CHECK_INTERVAL", "30s")
+
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("Load() unexpected error: %v", err)
+		}
+
+		// Should be clamped to minimum 60
+		if cfg.DNSTTL != 60 {
+			t.Errorf("DNSTTL = %d, want %d (minimum)", cfg.DNSTTL, 60)
+		}
+	})
+
+	t.Run("custom TTL from env", func(t *testing.T) {
+		clearEnv()
+		setRequiredEnv()
+		os.Setenv("DNS_TTL", "120")
+
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("Load() unexpected error: %v", err)
+		}
+
+		if cfg.DNSTTL != 120 {
+			t.Errorf("DNSTTL = %d, want %d", cfg.DNSTTL, 120)
+		}
+	})
+
+	t.Run("custom TTL clamped to minimum", func(t *testing.T) {
+		clearEnv()
+		setRequiredEnv()
+		os.Setenv("DNS_TTL", "30")
+
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("Load() unexpected error: %v", err)
+		}
+
+		if cfg.DNSTTL != 60 {
+			t.Errorf("DNSTTL = %d, want %d (minimum)", cfg.DNSTTL, 60)
+		}
+	})
+
+	t.Run("invalid TTL returns error", func(t *testing.T) {
+		clearEnv()
+		setRequiredEnv()
+		os.Setenv("DNS_TTL", "not-a-number")
+
+		_, err := Load()
+		if err == nil {
+			t.Error("Load() expected error for invalid DNS_TTL, got nil")
+		}
+	})
+}
+
+func TestLoad_ApexTTL(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	os.Setenv("DNS_TTL", "120")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.ApexTTL != 120 {
+		t.Errorf("default ApexTTL = %d, want DNS_TTL (120)", cfg.ApexTTL)
+	}
+
+	os.Setenv("APEX_TTL", "3600")
+	if cfg, err = Load(); err != nil || cfg.ApexTTL != 3600 || cfg.DNSTTL != 120 {
+		t.Errorf("Load() = %d/%d, %v; want APEX_TTL 3600 and DNS_TTL 120", cfg.ApexTTL, cfg.DNSTTL, err)
+	}
+
+	os.Setenv("APEX_TTL", "30")
+	if cfg, err = Load(); err != nil || cfg.ApexTTL != 60 {
+		t.Errorf("Load() = %d, %v; want APEX_TTL clamped to 60", cfg.ApexTTL, err)
+	}
+
+	os.Setenv("APEX_TTL", "long")
+	if _, err := Load(); err == nil {
+		t.Error("Load() with invalid APEX_TTL expected error")
+	}
+}
+
+func TestLoad_IPFile(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	os.Setenv("IP_FILE", "/data/public-ip")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.IPFile != "/data/public-ip" {
+		t.Errorf("IPFile = %q, want /data/public-ip", cfg.IPFile)
+	}
+}
+
+func TestLoad_StaleCleanup(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.StaleCleanupConcurrency != 4 || cfg.StaleCleanupTimeout != 2*time.Minute {
+		t.Errorf("defaults = %d/%v, want 4/2m", cfg.StaleCleanupConcurrency, cfg.StaleCleanupTimeout)
+	}
+
+	os.Setenv("STALE_CLEANUP_CONCURRENCY", "16")
+	os.Setenv("STALE_CLEANUP_TIMEOUT", "30s")
+	if cfg, err = Load(); err != nil || cfg.StaleCleanupConcurrency != 16 || cfg.StaleCleanupTimeout != 30*time.Second {
+		t.Errorf("Load() = %d/%v, %v; want 16/30s", cfg.StaleCleanupConcurrency, cfg.StaleCleanupTimeout, err)
+	}
+
+	for env, value := range map[string]string{"STALE_CLEANUP_CONCURRENCY": "0", "STALE_CLEANUP_TIMEOUT": "0s"} {
+		clearEnv()
+		setRequiredEnv()
+		os.Setenv(env, value)
+		if _, err := Load(); err == nil {
+			t.Errorf("Load() with %s=%s expected error", env, value)
+		}
+	}
+}
+
+func TestLoad_QuietHours(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.QuietHours {
+		t.Error("QuietHours should be off by default")
+	}
+
+	os.Setenv("QUIET_HOURS", "23:30-06:00")
+	if cfg, err = Load(); err != nil || !cfg.QuietHours ||
+		cfg.QuietHoursStart != 23*time.Hour+30*time.Minute || cfg.QuietHoursEnd != 6*time.Hour {
+		t.Errorf("Load() = %v %v-%v, %v; want 23:30-06:00", cfg.QuietHours, cfg.QuietHoursStart, cfg.QuietHoursEnd, err)
+	}
+
+	for _, value := range []string{"23:30", "25:00-06:00", "01:00-01:00", "night"} {
+		os.Setenv("QUIET_HOURS", value)
+		if _, err := Load(); err == nil {
+			t.Errorf("Load() with QUIET_HOURS=%q expected error", value)
+		}
+	}
+}
+
+func TestLoad_AcmeDNSProvider(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.AcmeDNSProvider != "cloudflare" || cfg.AcmeDNSProviderArgs != "{env.CLOUDFLARE_API_TOKEN}" || cfg.AcmeDNSResolvers != nil {
+		t.Errorf("defaults = %q %q %v, want cloudflare with the API token", cfg.AcmeDNSProvider, cfg.AcmeDNSProviderArgs, cfg.AcmeDNSResolvers)
+	}
+
+	os.Setenv("ACME_DNS_PROVIDER", "route53")
+	os.Setenv("ACME_DNS_RESOLVERS", "1.1.1.1, 8.8.8.8:53")
+	if cfg, err = Load(); err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.AcmeDNSProvider != "route53" || cfg.AcmeDNSProviderArgs != "" {
+		t.Errorf("provider = %q %q, want route53 without args", cfg.AcmeDNSProvider, cfg.AcmeDNSProviderArgs)
+	}
+	if got := strings.Join(cfg.AcmeDNSResolvers, " "); got != "1.1.1.1 8.8.8.8:53" {
+		t.Errorf("AcmeDNSResolvers = %q, want 1.1.1.1 8.8.8.8:53", got)
+	}
+
+	for env, value := range map[string]string{
+		"ACME_DNS_PROVIDER":      "cloud flare",
+		"ACME_DNS_PROVIDER_ARGS": "a\nb",
+		"ACME_DNS_RESOLVERS":     "1.1.1.1 }",
+	} {
+		clearEnv()
+		setRequiredEnv()
+		os.Setenv(env, value)
+		if _, err := Load(); err == nil {
+			t.Errorf("Load() with %s=%q expected error", env, value)
+		}
+	}
+}
+
+func TestLoad_ReconcileInterval(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.ReconcileInterval != 0 {
+		t.Errorf("default ReconcileInterval = %v, want 0 (disabled)", cfg.ReconcileInterval)
+	}
+
+	os.Setenv("RECONCILE_INTERVAL", "1h")
+	if cfg, err = Load(); err != nil || cfg.ReconcileInterval != time.Hour {
+		t.Errorf("Load() = %v, %v; want 1h", cfg.ReconcileInterval, err)
+	}
+
+	for _, value := range []string{"30s", "-1h", "often"} {
+		os.Setenv("RECONCILE_INTERVAL", value)
+		if _, err := Load(); err == nil {
+			t.Errorf("Load() with RECONCILE_INTERVAL=%q expected error", value)
+		}
+	}
+}
+
+func TestLoad_AllowEmptyReconcile(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.AllowEmptyReconcile {
+		t.Error("AllowEmptyReconcile should be off by default")
+	}
+
+	os.Setenv("ALLOW_EMPTY_RECONCILE", "true")
+	if cfg, err = Load(); err != nil || !cfg.AllowEmptyReconcile {
+		t.Errorf("Load() = %v, %v; want AllowEmptyReconcile", cfg.AllowEmptyReconcile, err)
+	}
+}
+
+func TestLoad_StatusSocket(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	os.Setenv("STATUS_SOCKET", "/run/dyndns/status.sock")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.StatusSocket != "/run/dyndns/status.sock" {
+		t.Errorf("StatusSocket = %q, want /run/dyndns/status.sock", cfg.StatusSocket)
+	}
+}
+
+func TestLoad_ManageWWW(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.ManageWWW {
+		t.Error("ManageWWW should default to false")
+	}
+
+	os.Setenv("MANAGE_WWW", "true")
+	if cfg, err = Load(); err != nil || !cfg.ManageWWW {
+		t.Errorf("Load() = %v, %v; want ManageWWW", cfg.ManageWWW, err)
+	}
+}
+
+func TestLoad_DiscoveryFallbackAfter(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.DiscoveryFallbackAfter != 0 {
+		t.Errorf("DiscoveryFallbackAfter = %v, want disabled by default", cfg.DiscoveryFallbackAfter)
+	}
+
+	os.Setenv("DISCOVERY_FALLBACK_AFTER", "10m")
+	if cfg, err = Load(); err != nil || cfg.DiscoveryFallbackAfter != 10*time.Minute {
+		t.Errorf("Load() = %v, %v; want 10m", cfg.DiscoveryFallbackAfter, err)
+	}
+
+	for _, bad := range []string{"-1m", "soon"} {
+		os.Setenv("DISCOVERY_FALLBACK_AFTER", bad)
+		if _, err := Load(); err == nil {
+			t.Errorf("Load() with DISCOVERY_FALLBACK_AFTER=%q expected error", bad)
+		}
+	}
+}
+
+func TestLoad_RemovalGrace(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.RemovalGrace != 2*time.Minute {
+		t.Errorf("RemovalGrace = %v, want 2m by default", cfg.RemovalGrace)
+	}
+
+	os.Setenv("REMOVAL_GRACE", "0s")
+	if cfg, err = Load(); err != nil || cfg.RemovalGrace != 0 {
+		t.Errorf("Load() = %v, %v; want 0s", cfg.RemovalGrace, err)
+	}
+
+	for _, bad := range []string{"-1m", "later"} {
+		os.Setenv("REMOVAL_GRACE", bad)
+		if _, err := Load(); err == nil {
+			t.Errorf("Load() with REMOVAL_GRACE=%q expected error", bad)
+		}
+	}
+}
+
+func TestLoad_TLSOptions(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.TLSProtocols != nil || cfg.TLSCiphers != nil || cfg.TLSCurves != nil {
+		t.Errorf("TLS options = %v %v %v, want Caddy defaults", cfg.TLSProtocols, cfg.TLSCiphers, cfg.TLSCurves)
+	}
+
+	os.Setenv("TLS_PROTOCOLS", "tls1.2, TLS1.3")
+	os.Setenv("TLS_CIPHERS", "tls_ecdhe_ecdsa_with_aes_256_gcm_sha384,TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384")
+	os.Setenv("TLS_CURVES", "x25519,secp384r1")
+	if cfg, err = Load(); err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if got := strings.Join(cfg.TLSProtocols, " "); got != "tls1.2 tls1.3" {
+		t.Errorf("TLSProtocols = %q, want tls1.2 tls1.3", got)
+	}
+	if got := strings.Join(cfg.TLSCiphers, " "); got != "TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384 TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384" {
+		t.Errorf("TLSCiphers = %q", got)
+	}
+	if got := strings.Join(cfg.TLSCurves, " "); got != "x25519 secp384r1" {
+		t.Errorf("TLSCurves = %q, want x25519 secp384r1", got)
+	}
+
+	for env, value := range map[string]string{
+		"TLS_PROTOCOLS": "tls1.3,tls1.2",
+		"TLS_CIPHERS":   "TLS_RSA_WITH_RC4_128_SHA",
+		"TLS_CURVES":    "p256",
+	} {
+		clearEnv()
+		setRequiredEnv()
+		os.Setenv(env, value)
+		if _, err := Load(); err == nil {
+			t.Errorf("Load() with %s=%q expected error", env, value)
+		}
+	}
+	clearEnv()
+	setRequiredEnv()
+	os.Setenv("TLS_PROTOCOLS", "tls1.0")
+	if _, err := Load(); err == nil {
+		t.Error("Load() with TLS_PROTOCOLS=tls1.0 expected error")
+	}
+}
+
+func TestLoad_AccessLogSampling(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.AccessLogSample != 0 || cfg.AccessLogSkipPaths != nil {
+		t.Errorf("defaults = %d %v, want every request logged", cfg.AccessLogSample, cfg.AccessLogSkipPaths)
+	}
+
+	os.Setenv("ACCESS_LOG_SAMPLE", "10")
+	os.Setenv("ACCESS_LOG_SKIP_PATHS", "/health, /status/*")
+	if cfg, err = Load(); err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.AccessLogSample != 10 {
+		t.Errorf("AccessLogSample = %d, want 10", cfg.AccessLogSample)
+	}
+	if got := strings.Join(cfg.AccessLogSkipPaths, " "); got != "/health /status/*" {
+		t.Errorf("AccessLogSkipPaths = %q, want /health /status/*", got)
+	}
+
+	for env, value := range map[string]string{
+		"ACCESS_LOG_SAMPLE":     "0",
+		"ACCESS_LOG_SKIP_PATHS": "health",
+	} {
+		clearEnv()
+		setRequiredEnv()
+		os.Setenv(env, value)
+		if _, err := Load(); err == nil {
+			t.Errorf("Load() with %s=%q expected error", env, value)
+		}
+	}
+}
+
+func TestLoad_CaddyReloadMinInterval(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.CaddyReloadMinInterval != 0 {
+		t.Errorf("CaddyReloadMinInterval = %v, want disabled by default", cfg.CaddyReloadMinInterval)
+	}
+
+	os.Setenv("CADDY_RELOAD_MIN_INTERVAL", "5s")
+	if cfg, err = Load(); err != nil || cfg.CaddyReloadMinInterval != 5*time.Second {
+		t.Errorf("Load() = %v, %v; want 5s", cfg.CaddyReloadMinInterval, err)
+	}
+
+	for _, bad := range []string{"-1s", "often"} {
+		os.Setenv("CADDY_RELOAD_MIN_INTERVAL", bad)
+		if _, err := Load(); err == nil {
+			t.Errorf("Load() with CADDY_RELOAD_MIN_INTERVAL=%q expected error", bad)
+		}
+	}
+}
+
+func TestLoad_IPCandidatePreference(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.IPPreferCIDRs != nil || cfg.IPReachabilityProbe != "" {
+		t.Errorf("defaults = %v %q, want no candidate preference", cfg.IPPreferCIDRs, cfg.IPReachabilityProbe)
+	}
+
+	os.Setenv("IP_PREFER_CIDRS", "198.51.100.7/24, 2001:db8::/32")
+	os.Setenv("IP_REACHABILITY_PROBE", "https://probe.example.net/check?ip={ip}&port=443")
+	if cfg, err = Load(); err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if len(cfg.IPPreferCIDRs) != 2 || cfg.IPPreferCIDRs[0].String() != "198.51.100.0/24" || cfg.IPPreferCIDRs[1].String() != "2001:db8::/32" {
+		t.Errorf("IPPreferCIDRs = %v, want the masked prefixes", cfg.IPPreferCIDRs)
+	}
+	if cfg.IPReachabilityProbe != "https://probe.example.net/check?ip={ip}&port=443" {
+		t.Errorf("IPReachabilityProbe = %q", cfg.IPReachabilityProbe)
+	}
+
+	for env, value := range map[string]string{
+		"IP_PREFER_CIDRS":       "198.51.100.7",
+		"IP_REACHABILITY_PROBE": "https://probe.example.net/check",
+	} {
+		clearEnv()
+		setRequiredEnv()
+		os.Setenv(env, value)
+		if _, err := Load(); err == nil {
+			t.Errorf("Load() with %s=%q expected error", env, value)
+		}
+	}
+}
+
+func TestLoad_UnsafeAllowAnyRecordName(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.UnsafeAllowAnyRecordName {
+		t.Error("UnsafeAllowAnyRecordName should default to false")
+	}
+
+	os.Setenv("UNSAFE_ALLOW_ANY_RECORD_NAME", "true")
+	if cfg, err = Load(); err != nil || !cfg.UnsafeAllowAnyRecordName {
+		t.Errorf("Load() = %v, %v; want UnsafeAllowAnyRecordName", cfg.UnsafeAllowAnyRecordName, err)
+	}
 }
 
-func TestLoad_DNSTTLSettings(t *testing.T) {
-	t.Run("default TTL matches IP check interval", func(t *testing.T) {
-		clearEnv()
-		setRequiredEnv()
-		os.Setenv("IP_CHECK_INTERVAL", "5m")
+func TestLoad_IPv6Suffix(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.IPv6Suffix.IsValid() || cfg.IPv6PrefixLength != 64 {
+		t.Errorf("IPv6Suffix = %v, IPv6PrefixLength = %d; want unset and 64", cfg.IPv6Suffix, cfg.IPv6PrefixLength)
+	}
+
+	os.Setenv("IPV6_SUFFIX", "::1234:5678:9abc:def0")
+	os.Setenv("IPV6_PREFIX_LENGTH", "56")
+	if cfg, err = Load(); err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.IPv6Suffix.String() != "::1234:5678:9abc:def0" || cfg.IPv6PrefixLength != 56 {
+		t.Errorf("IPv6Suffix = %v, IPv6PrefixLength = %d; want ::1234:5678:9abc:def0 and 56", cfg.IPv6Suffix, cfg.IPv6PrefixLength)
+	}
 
-		cfg, err := Load()
-		if err != nil {
-			t.Fatalf("Load() unexpected error: %v", err)
+	for _, tt := range []struct{ suffix, length string }{
+		{"192.0.2.1", "64"},
+		{"::", "64"},
+		{"not-an-address", "64"},
+		{"2001:db8::1", "64"},
+		{"::1:0:0:0:1", "64"},
+		{"::1", "0"},
+		{"::1", "128"},
+	} {
+		os.Setenv("IPV6_SUFFIX", tt.suffix)
+		os.Setenv("IPV6_PREFIX_LENGTH", tt.length)
+		if _, err := Load(); err == nil {
+			t.Errorf("IPV6_SUFFIX=%q IPV6_PREFIX_LENGTH=%q: expected error", tt.suffix, tt.length)
 		}
+	}
+}
 
-		// 5 minutes = 300 seconds
-		if cfg.DNSTTL != 300 {
-			t.Errorf("DNSTTL = %d, want %d", cfg.DNSTTL, 300)
+func TestLoad_ReloadCmds(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.PreReloadCmd != "" || cfg.PostReloadCmd != "" || cfg.ReloadCmdTimeout != 30*time.Second {
+		t.Errorf("reload commands = %q, %q, %v; want none and 30s", cfg.PreReloadCmd, cfg.PostReloadCmd, cfg.ReloadCmdTimeout)
+	}
+
+	os.Setenv("PRE_RELOAD_CMD", "/scripts/sync-certs.sh")
+	os.Setenv("POST_RELOAD_CMD", "curl -fsS http://sidecar/notify")
+	os.Setenv("RELOAD_CMD_TIMEOUT", "5s")
+	if cfg, err = Load(); err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.PreReloadCmd != "/scripts/sync-certs.sh" || cfg.PostReloadCmd != "curl -fsS http://sidecar/notify" || cfg.ReloadCmdTimeout != 5*time.Second {
+		t.Errorf("reload commands = %q, %q, %v", cfg.PreReloadCmd, cfg.PostReloadCmd, cfg.ReloadCmdTimeout)
+	}
+
+	for _, v := range []string{"0s", "-1s", "soon"} {
+		os.Setenv("RELOAD_CMD_TIMEOUT", v)
+		if _, err := Load(); err == nil {
+			t.Errorf("RELOAD_CMD_TIMEOUT=%q: expected error", v)
 		}
-	})
+	}
+}
 
-	t.Run("minimum TTL is 60 seconds", func(t *testing.T) {
-		clearEnv()
-		setRequiredEnv()
-		os.Setenv("IP_CHECK_INTERVAL", "30s")
+func TestLoad_CaddyMapMode(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.CaddyMapMode {
+		t.Error("CaddyMapMode should default to false")
+	}
 
-		cfg, err := Load()
-		if err != nil {
-			t.Fatalf("Load() unexpected error: %v", err)
+	os.Setenv("CADDY_MAP_MODE", "true")
+	if cfg, err = Load(); err != nil || !cfg.CaddyMapMode {
+		t.Errorf("Load() = %v, %v; want CaddyMapMode", cfg.CaddyMapMode, err)
+	}
+
+	os.Setenv("CADDY_PER_SITE", "true")
+	if _, err := Load(); err == nil {
+		t.Error("CADDY_MAP_MODE with CADDY_PER_SITE: expected error")
+	}
+}
+
+func TestLoad_DirectRemoveSubdomainRecords(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.DirectRemoveSubdomainRecords {
+		t.Error("DirectRemoveSubdomainRecords should default to false")
+	}
+
+	os.Setenv("DIRECT_REMOVE_SUBDOMAIN_RECORDS", "true")
+	if cfg, err = Load(); err != nil || !cfg.DirectRemoveSubdomainRecords {
+		t.Errorf("Load() = %v, %v; want DirectRemoveSubdomainRecords", cfg.DirectRemoveSubdomainRecords, err)
+	}
+}
+
+func TestLoad_MappingsUnknownFields(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.MappingsUnknownFields != UnknownFieldsWarn {
+		t.Errorf("MappingsUnknownFields = %q, want %q", cfg.MappingsUnknownFields, UnknownFieldsWarn)
+	}
+
+	os.Setenv("MAPPINGS_UNKNOWN_FIELDS", "ERROR")
+	if cfg, err = Load(); err != nil || cfg.MappingsUnknownFields != UnknownFieldsError {
+		t.Errorf("Load() = %q, %v; want %q", cfg.MappingsUnknownFields, err, UnknownFieldsError)
+	}
+
+	os.Setenv("MAPPINGS_UNKNOWN_FIELDS", "ignore")
+	if _, err := Load(); err == nil {
+		t.Error("MAPPINGS_UNKNOWN_FIELDS=ignore: expected error")
+	}
+}
+
+func TestLoad_FamilyProbe(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.FamilyProbe || cfg.FamilyProbeWithdraw {
+		t.Error("FamilyProbe and FamilyProbeWithdraw should default to false")
+	}
+	if cfg.FamilyProbePort != 443 || cfg.FamilyProbeTimeout != 5*time.Second {
+		t.Errorf("FamilyProbePort, FamilyProbeTimeout = %d, %v; want 443, 5s", cfg.FamilyProbePort, cfg.FamilyProbeTimeout)
+	}
+
+	os.Setenv("FAMILY_PROBE_WITHDRAW", "true")
+	if _, err := Load(); err == nil {
+		t.Error("FAMILY_PROBE_WITHDRAW without FAMILY_PROBE: expected error")
+	}
+
+	os.Setenv("FAMILY_PROBE", "true")
+	os.Setenv("FAMILY_PROBE_PORT", "8443")
+	os.Setenv("FAMILY_PROBE_TIMEOUT", "2s")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if !cfg.FamilyProbe || !cfg.FamilyProbeWithdraw || cfg.FamilyProbePort != 8443 || cfg.FamilyProbeTimeout != 2*time.Second {
+		t.Errorf("Load() = %v, %v, %d, %v; want probe with withdraw on 8443 within 2s",
+			cfg.FamilyProbe, cfg.FamilyProbeWithdraw, cfg.FamilyProbePort, cfg.FamilyProbeTimeout)
+	}
+
+	for _, bad := range []struct{ key, value string }{
+		{"FAMILY_PROBE_PORT", "0"},
+		{"FAMILY_PROBE_PORT", "https"},
+		{"FAMILY_PROBE_TIMEOUT", "0s"},
+	} {
+		os.Setenv("FAMILY_PROBE_PORT", "443")
+		os.Setenv("FAMILY_PROBE_TIMEOUT", "5s")
+		os.Setenv(bad.key, bad.value)
+		if _, err := Load(); err == nil {
+			t.Errorf("%s=%s: expected error", bad.key, bad.value)
 		}
+	}
+}
 
-		// Should be clamped to minimum 60
-		if cfg.DNSTTL != 60 {
-			t.Errorf("DNSTTL = %d, want %d (minimum)", cfg.DNSTTL, 60)
+func TestLoad_DNSTTLJitter(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.DNSTTLJitter != 0 {
+		t.Errorf("DNSTTLJitter = %d, want 0 by default", cfg.DNSTTLJitter)
+	}
+
+	os.Setenv("DNS_TTL_JITTER", "10")
+	if cfg, err = Load(); err != nil || cfg.DNSTTLJitter != 10 {
+		t.Errorf("Load() = %d, %v; want DNSTTLJitter 10", cfg.DNSTTLJitter, err)
+	}
+
+	for _, bad := range []string{"-1", "51", "10%"} {
+		os.Setenv("DNS_TTL_JITTER", bad)
+		if _, err := Load(); err == nil {
+			t.Errorf("DNS_TTL_JITTER=%s: expected error", bad)
 		}
-	})
+	}
+}
 
-	t.Run("custom TTL from env", func(t *testing.T) {
-		clearEnv()
-		setRequiredEnv()
-		os.Setenv("DNS_TTL", "120")
+func TestLoad_DiscoveryIncludeStopped(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.DiscoveryIncludeStopped {
+		t.Error("DiscoveryIncludeStopped should default to false")
+	}
 
-		cfg, err := Load()
-		if err != nil {
-			t.Fatalf("Load() unexpected error: %v", err)
+	os.Setenv("DISCOVERY_INCLUDE_STOPPED", "true")
+	if cfg, err = Load(); err != nil || !cfg.DiscoveryIncludeStopped {
+		t.Errorf("Load() = %v, %v; want DiscoveryIncludeStopped", cfg.DiscoveryIncludeStopped, err)
+	}
+}
+
+func TestLoad_IPHistorySize(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.IPHistorySize != 20 {
+		t.Errorf("IPHistorySize = %d, want 20 by default", cfg.IPHistorySize)
+	}
+
+	os.Setenv("IP_HISTORY_SIZE", "0")
+	if cfg, err = Load(); err != nil || cfg.IPHistorySize != 0 {
+		t.Errorf("Load() = %d, %v; want IPHistorySize 0", cfg.IPHistorySize, err)
+	}
+
+	for _, bad := range []string{"-1", "1001", "ten"} {
+		os.Setenv("IP_HISTORY_SIZE", bad)
+		if _, err := Load(); err == nil {
+			t.Errorf("IP_HISTORY_SIZE=%s: expected error", bad)
 		}
+	}
+}
 
-		if cfg.DNSTTL != 120 {
-			t.Errorf("DNSTTL = %d, want %d", cfg.DNSTTL, 120)
+func TestLoad_ValidateTargets(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.ValidateTargets || cfg.ValidateTargetsDrop || cfg.ValidateTargetsTimeout != time.Second {
+		t.Errorf("Load() = %v, %v, %v; want validation off with a 1s timeout",
+			cfg.ValidateTargets, cfg.ValidateTargetsDrop, cfg.ValidateTargetsTimeout)
+	}
+
+	os.Setenv("VALIDATE_TARGETS_DROP", "true")
+	if _, err := Load(); err == nil {
+		t.Error("VALIDATE_TARGETS_DROP without VALIDATE_TARGETS: expected error")
+	}
+
+	os.Setenv("VALIDATE_TARGETS", "true")
+	os.Setenv("VALIDATE_TARGETS_TIMEOUT", "500ms")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if !cfg.ValidateTargets || !cfg.ValidateTargetsDrop || cfg.ValidateTargetsTimeout != 500*time.Millisecond {
+		t.Errorf("Load() = %v, %v, %v; want validation with drop within 500ms",
+			cfg.ValidateTargets, cfg.ValidateTargetsDrop, cfg.ValidateTargetsTimeout)
+	}
+
+	for _, bad := range []string{"0s", "soon"} {
+		os.Setenv("VALIDATE_TARGETS_TIMEOUT", bad)
+		if _, err := Load(); err == nil {
+			t.Errorf("VALIDATE_TARGETS_TIMEOUT=%s: expected error", bad)
 		}
-	})
+	}
+}
 
-	t.Run("custom TTL clamped to minimum", func(t *testing.T) {
-		clearEnv()
-		setRequiredEnv()
-		os.Setenv("DNS_TTL", "30")
+func TestLoad_ShutdownCleanup(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.ShutdownCleanup != ShutdownCleanupNone {
+		t.Errorf("ShutdownCleanup = %q, want %q", cfg.ShutdownCleanup, ShutdownCleanupNone)
+	}
 
+	for _, scope := range []string{"subdomains", "ALL", "none"} {
+		os.Setenv("SHUTDOWN_CLEANUP", scope)
 		cfg, err := Load()
 		if err != nil {
-			t.Fatalf("Load() unexpected error: %v", err)
+			t.Fatalf("SHUTDOWN_CLEANUP=%s: unexpected error: %v", scope, err)
 		}
-
-		if cfg.DNSTTL != 60 {
-			t.Errorf("DNSTTL = %d, want %d (minimum)", cfg.DNSTTL, 60)
+		if cfg.ShutdownCleanup != strings.ToLower(scope) {
+			t.Errorf("SHUTDOWN_CLEANUP=%s: ShutdownCleanup = %q", scope, cfg.ShutdownCleanup)
 		}
-	})
+	}
 
-	t.Run("invalid TTL returns error", func(t *testing.T) {
-		clearEnv()
-		setRequiredEnv()
-		os.Setenv("DNS_TTL", "not-a-number")
+	os.Setenv("SHUTDOWN_CLEANUP", "apex")
+	if _, err := Load(); err == nil {
+		t.Error("SHUTDOWN_CLEANUP=apex: expected error")
+	}
+}
 
-		_, err := Load()
-		if err == nil {
-			t.Error("Load() expected error for invalid DNS_TTL, got nil")
+func TestLoad_MaxManagedSubdomains(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.MaxManagedSubdomains != 0 {
+		t.Errorf("MaxManagedSubdomains = %d, want 0 (no cap)", cfg.MaxManagedSubdomains)
+	}
+
+	os.Setenv("MAX_MANAGED_SUBDOMAINS", "50")
+	if cfg, err = Load(); err != nil || cfg.MaxManagedSubdomains != 50 {
+		t.Errorf("MAX_MANAGED_SUBDOMAINS=50: got %+v, %v", cfg, err)
+	}
+
+	for _, v := range []string{"-1", "many"} {
+		os.Setenv("MAX_MANAGED_SUBDOMAINS", v)
+		if _, err := Load(); err == nil {
+			t.Errorf("MAX_MANAGED_SUBDOMAINS=%s: expected error", v)
 		}
-	})
+	}
+}
+
+func TestLoad_SkipStartupPush(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.SkipStartupPush {
+		t.Error("SkipStartupPush should default to false")
+	}
+
+	os.Setenv("SKIP_STARTUP_PUSH", "true")
+	if _, err := Load(); err == nil {
+		t.Error("SKIP_STARTUP_PUSH without SNAPSHOT_FILE: expected error")
+	}
+
+	os.Setenv("SNAPSHOT_FILE", "/data/snapshot.json")
+	if cfg, err = Load(); err != nil || !cfg.SkipStartupPush {
+		t.Errorf("SKIP_STARTUP_PUSH with SNAPSHOT_FILE: got %+v, %v", cfg, err)
+	}
+}
+
+func TestLoad_ApexProxied(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.ApexProxied {
+		t.Error("ApexProxied should default to false")
+	}
+
+	os.Setenv("APEX_PROXIED", "true")
+	if cfg, err = Load(); err != nil || !cfg.ApexProxied || cfg.CloudflareProxy {
+		t.Errorf("Load() = %+v, %v; want ApexProxied without proxy mode", cfg, err)
+	}
 }
 
 func TestLoad_CloudflareProxySettings(t *testing.T) {
@@ -384,6 +1932,50 @@ func TestLoad_CloudflareProxySettings(t *testing.T) {
 			t.Error("CloudflareProxy = false, want true (for 'yes')")
 		}
 	})
+
+	t.Run("SSL mode defaults to full", func(t *testing.T) {
+		clearEnv()
+		setRequiredEnv()
+		os.Setenv("CLOUDFLARE_PROXY", "true")
+
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("Load() unexpected error: %v", err)
+		}
+
+		if cfg.CloudflareSSLMode != "full" {
+			t.Errorf("CloudflareSSLMode = %q, want %q", cfg.CloudflareSSLMode, "full")
+		}
+		if cfg.FlexibleSSL() {
+			t.Error("FlexibleSSL() = true, want false")
+		}
+	})
+
+	t.Run("flexible SSL mode", func(t *testing.T) {
+		clearEnv()
+		setRequiredEnv()
+		os.Setenv("CLOUDFLARE_PROXY", "true")
+		os.Setenv("CLOUDFLARE_SSL_MODE", "Flexible")
+
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("Load() unexpected error: %v", err)
+		}
+
+		if !cfg.FlexibleSSL() {
+			t.Error("FlexibleSSL() = false, want true")
+		}
+	})
+
+	t.Run("invalid SSL mode returns error", func(t *testing.T) {
+		clearEnv()
+		setRequiredEnv()
+		os.Setenv("CLOUDFLARE_SSL_MODE", "loose")
+
+		if _, err := Load(); err == nil {
+			t.Error("Load() expected error for invalid CLOUDFLARE_SSL_MODE, got nil")
+		}
+	})
 }
 
 func TestConfig_Validate(t *testing.T) {
@@ -587,6 +2179,7 @@ func clearEnv() {
 		"CLOUDFLARE_API_TOKEN",
 		"CLOUDFLARE_ZONE_ID",
 		"CLOUDFLARE_PROXY",
+		"CLOUDFLARE_SSL_MODE",
 		"DOMAIN",
 		"ACME_EMAIL",
 		"FRITZBOX_HOST",
@@ -603,6 +2196,93 @@ func clearEnv() {
 		"MAPPINGS_FILE",
 		"STEVEDORE_SOCKET",
 		"STEVEDORE_TOKEN",
+		"DISCOVERY_POLL_TIMEOUT",
+		"CADDY_ADMIN",
+		"CADDY_SHARED_SNIPPETS",
+		"CADDY_PER_SITE",
+		"CADDY_ON_DEMAND_TLS",
+		"SNAPSHOT_FILE",
+		"ON_DETECTION_FAILURE",
+		"ON_DETECTION_FAILURE_THRESHOLD",
+		"STATUS_RATE_LIMIT",
+		"FRITZBOX_RECONNECT_WATCH",
+		"FRITZBOX_RECONNECT_POLL",
+		"REFRESH_ORIGIN_PULL_CA",
+		"ORIGIN_PULL_CA_REFRESH_INTERVAL",
+		"PROXY_PROBE",
+		"PROXY_PROBE_DELAY",
+		"DISCOVERY_DEBOUNCE",
+		"CADDY_METRICS_ADDR",
+		"DNS_PLAN",
+		"ON_INVALID_MAPPINGS",
+		"APEX_PROXIED",
+		"MANAGED_RECORD_TYPES",
+		"READY_REQUIRE_PROPAGATION",
+		"READY_PROPAGATION_NAME",
+		"READY_RESOLVER",
+		"READY_PROPAGATION_TIMEOUT",
+		"APEX_TTL",
+		"IP_FILE",
+		"STALE_CLEANUP_CONCURRENCY",
+		"STALE_CLEANUP_TIMEOUT",
+		"QUIET_HOURS",
+		"ACME_DNS_PROVIDER",
+		"ACME_DNS_PROVIDER_ARGS",
+		"ACME_DNS_RESOLVERS",
+		"RECONCILE_INTERVAL",
+		"ALLOW_EMPTY_RECONCILE",
+		"STATUS_SOCKET",
+		"MANAGE_WWW",
+		"DISCOVERY_FALLBACK_AFTER",
+		"REMOVAL_GRACE",
+		"TLS_PROTOCOLS",
+		"TLS_CIPHERS",
+		"TLS_CURVES",
+		"ACCESS_LOG_SAMPLE",
+		"ACCESS_LOG_SKIP_PATHS",
+		"CADDY_RELOAD_MIN_INTERVAL",
+		"IP_PREFER_CIDRS",
+		"IP_REACHABILITY_PROBE",
+		"UNSAFE_ALLOW_ANY_RECORD_NAME",
+		"IPV6_SUFFIX",
+		"IPV6_PREFIX_LENGTH",
+		"PRE_RELOAD_CMD",
+		"POST_RELOAD_CMD",
+		"RELOAD_CMD_TIMEOUT",
+		"CADDY_MAP_MODE",
+		"DIRECT_REMOVE_SUBDOMAIN_RECORDS",
+		"MAPPINGS_UNKNOWN_FIELDS",
+		"FAMILY_PROBE",
+		"FAMILY_PROBE_PORT",
+		"FAMILY_PROBE_TIMEOUT",
+		"FAMILY_PROBE_WITHDRAW",
+		"DNS_TTL_JITTER",
+		"DISCOVERY_INCLUDE_STOPPED",
+		"IP_HISTORY_SIZE",
+		"VALIDATE_TARGETS", "VALIDATE_TARGETS_TIMEOUT", "VALIDATE_TARGETS_DROP",
+		"SHUTDOWN_CLEANUP",
+		"MAX_MANAGED_SUBDOMAINS",
+		"SKIP_STARTUP_PUSH",
+		"REQUEST_ID_HEADER",
+		"DISCOVERY_DRY_RUN",
+		"CLOUDFLARE_API_BASE_URL",
+		"ACME_CHALLENGE_WEBROOT",
+		"SUBDOMAIN_NAME_TEMPLATE",
+		"SUBDOMAIN_NAME_ENV",
+		"STATUS_TLS_CERT",
+		"STATUS_TLS_KEY",
+		"STATUS_TLS_CLIENT_CA",
+		"FRITZBOX_AUTODISCOVER",
+		"PROXY_LB_TRY_DURATION",
+		"PROXY_LB_TRY_INTERVAL",
+		"STATUS_TOKEN",
+		"ENABLE_PPROF",
+		"STRIP_HEADERS",
+		"ORIGIN_CERT",
+		"ORIGIN_KEY",
+		"IP_CHECK_JITTER",
+		"IP_CHECK_ALIGN",
+		"MAPPING_CONFLICT_STRATEGY",
 	}
 	for _, v := range envVars {
 		os.Unsetenv(v)
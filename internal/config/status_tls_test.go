@@ -0,0 +1,190 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeStatusTLSFixtures creates a CA, a server certificate for 127.0.0.1
+// and a client certificate, writing the PEM files needed by the status
+// server config into dir.
+func writeStatusTLSFixtures(t *testing.T, dir string) (caFile, certFile, keyFile string, clientCert tls.Certificate, caPool *x509.CertPool) {
+	t.Helper()
+
+	newKey := func() *ecdsa.PrivateKey {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("Failed to generate key: %v", err)
+		}
+		return key
+	}
+	writePEM := func(name, blockType string, der []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		return path
+	}
+
+	caKey := newKey()
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "status test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("Failed to create CA cert: %v", err)
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatalf("Failed to parse CA cert: %v", err)
+	}
+	caFile = writePEM("ca.pem", "CERTIFICATE", caDER)
+	caPool = x509.NewCertPool()
+	caPool.AddCert(caCert)
+
+	serverKey := newKey()
+	serverTmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	serverDER, err := x509.CreateCertificate(rand.Reader, serverTmpl, caCert, &serverKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("Failed to create server cert: %v", err)
+	}
+	serverKeyDER, err := x509.MarshalECPrivateKey(serverKey)
+	if err != nil {
+		t.Fatalf("Failed to marshal server key: %v", err)
+	}
+	certFile = writePEM("status.pem", "CERTIFICATE", serverDER)
+	keyFile = writePEM("status-key.pem", "EC PRIVATE KEY", serverKeyDER)
+
+	clientKey := newKey()
+	clientTmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "status client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	clientDER, err := x509.CreateCertificate(rand.Reader, clientTmpl, caCert, &clientKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("Failed to create client cert: %v", err)
+	}
+	clientCert = tls.Certificate{Certificate: [][]byte{clientDER}, PrivateKey: clientKey}
+
+	return caFile, certFile, keyFile, clientCert, caPool
+}
+
+func TestStatusTLSConfig_Disabled(t *testing.T) {
+	cfg := &Config{}
+	tlsConfig, err := cfg.StatusTLSConfig()
+	if err != nil {
+		t.Fatalf("StatusTLSConfig() unexpected error: %v", err)
+	}
+	if tlsConfig != nil {
+		t.Errorf("StatusTLSConfig() = %+v, want nil (plaintext)", tlsConfig)
+	}
+}
+
+// TestStatusTLSConfig_ClientCARejectsMissingCert verifies that with a client
+// CA configured, a request without a client certificate is rejected while
+// one presenting a CA-signed certificate succeeds.
+func TestStatusTLSConfig_ClientCARejectsMissingCert(t *testing.T) {
+	caFile, certFile, keyFile, clientCert, caPool := writeStatusTLSFixtures(t, t.TempDir())
+
+	cfg := &Config{
+		StatusTLSCert:     certFile,
+		StatusTLSKey:      keyFile,
+		StatusTLSClientCA: caFile,
+	}
+	tlsConfig, err := cfg.StatusTLSConfig()
+	if err != nil {
+		t.Fatalf("StatusTLSConfig() unexpected error: %v", err)
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("OK"))
+	}))
+	srv.TLS = tlsConfig
+	srv.StartTLS()
+	defer srv.Close()
+
+	newClient := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{
+			Timeout: 5 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{
+				RootCAs:      caPool,
+				Certificates: certs,
+			}},
+		}
+	}
+
+	if resp, err := newClient().Get(srv.URL + "/status"); err == nil {
+		resp.Body.Close()
+		t.Fatalf("request without client cert succeeded with status %d, want TLS rejection", resp.StatusCode)
+	}
+
+	resp, err := newClient(clientCert).Get(srv.URL + "/status")
+	if err != nil {
+		t.Fatalf("request with client cert failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestLoad_StatusTLS(t *testing.T) {
+	clearEnv()
+	setRequiredEnv()
+	os.Setenv("STATUS_TLS_CERT", "/certs/status.pem")
+	os.Setenv("STATUS_TLS_KEY", "/certs/status-key.pem")
+	os.Setenv("STATUS_TLS_CLIENT_CA", "/certs/ca.pem")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.StatusTLSCert != "/certs/status.pem" || cfg.StatusTLSKey != "/certs/status-key.pem" || cfg.StatusTLSClientCA != "/certs/ca.pem" {
+		t.Errorf("status TLS = %q/%q/%q, want the configured paths", cfg.StatusTLSCert, cfg.StatusTLSKey, cfg.StatusTLSClientCA)
+	}
+
+	clearEnv()
+	setRequiredEnv()
+	os.Setenv("STATUS_TLS_CERT", "/certs/status.pem")
+	if _, err := Load(); err == nil {
+		t.Error("Load() with STATUS_TLS_CERT but no STATUS_TLS_KEY expected error")
+	}
+
+	clearEnv()
+	setRequiredEnv()
+	os.Setenv("STATUS_TLS_CLIENT_CA", "/certs/ca.pem")
+	if _, err := Load(); err == nil {
+		t.Error("Load() with STATUS_TLS_CLIENT_CA but no server cert expected error")
+	}
+}
@@ -8,7 +8,11 @@ import (
 	"log/slog"
 	"net"
 	"net/http"
+	"net/url"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -26,69 +30,140 @@ type Service struct {
 	Websocket bool `json:"websocket"`
 	// HealthCheck is the health check path (optional)
 	HealthCheck string `json:"healthCheck"`
+	// DisableHealth turns off active health checks for this upstream.
+	DisableHealth bool `json:"disableHealth,omitempty"`
 	// Direct selects direct-mode routing for this subdomain:
 	// grey-cloud DNS (no Cloudflare proxy), Caddy obtains its own
 	// Let's Encrypt cert via DNS-01, no origin mTLS required.
 	// Defaults to false, preserving legacy CF-proxy+mTLS behavior.
 	Direct bool `json:"direct,omitempty"`
+	// IPOverride pins the subdomain's DNS records to fixed public
+	// addresses instead of the detected IP (see mapping.ParseIPOverride).
+	IPOverride string `json:"ipOverride,omitempty"`
 }
 
+// DefaultPollTimeout is the server-side long-poll timeout requested from
+// stevedore when Config.PollTimeout is zero.
+const DefaultPollTimeout = 60 * time.Second
+
+// pollTimeoutGrace is added on top of the poll timeout for the HTTP client
+// deadline, so the server gets to answer "unchanged" before we give up.
+const pollTimeoutGrace = 10 * time.Second
+
+// socketBaseURL is the request base when dialing the unix socket; the
+// host is ignored by the socket dialer.
+const socketBaseURL = "http://stevedore"
+
 // Client queries the stevedore socket API for service discovery.
 type Client struct {
 	socketPath string
-	token      string
-	httpClient *http.Client
+	// baseURL prefixes every request path: socketBaseURL for the unix
+	// socket, or the configured URL when the API is served over TCP.
+	baseURL     string
+	token       string
+	pollTimeout time.Duration
+	httpClient  *http.Client
+	// includeStopped keeps services whose container is not running.
+	includeStopped bool
+
+	// enabled holds services whose ingress was enabled in the last parsed
+	// response, keyed by deployment/container, to classify removals.
+	enabledMu sync.Mutex
+	enabled   map[string]Service
+	changes   []IngressChange
 }
 
 // Config holds configuration for the discovery client.
 type Config struct {
+	// SocketPath is the stevedore unix socket, or an http(s):// base URL
+	// to reach the same API over TCP.
 	SocketPath string
 	Token      string
+	// PollTimeout is the long-poll timeout passed to /poll as ?timeout=.
+	// The HTTP client deadline is derived from it. Defaults to
+	// DefaultPollTimeout when zero.
+	PollTimeout time.Duration
+	// IncludeStopped keeps routing services stevedore reports as not
+	// running; by default they are skipped like disabled ones.
+	IncludeStopped bool
+}
+
+// isURL reports whether a STEVEDORE_SOCKET value is an http(s) URL
+// rather than a unix socket path. The scheme is case-insensitive.
+func isURL(socket string) bool {
+	u, err := url.Parse(socket)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https")
 }
 
+// proxyFunc selects the proxy for a STEVEDORE_SOCKET URL from HTTP_PROXY,
+// HTTPS_PROXY and NO_PROXY. A variable so tests can substitute it.
+var proxyFunc = http.ProxyFromEnvironment
+
 // New creates a new discovery client.
 func New(cfg Config) *Client {
-	// Create HTTP client that uses Unix socket
-	transport := &http.Transport{
-		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-			return net.Dial("unix", cfg.SocketPath)
-		},
+	baseURL := socketBaseURL
+	var transport *http.Transport
+	if isURL(cfg.SocketPath) {
+		// Dial TCP like any outbound client, honoring HTTP_PROXY; list
+		// the stevedore host in NO_PROXY to reach it directly.
+		baseURL = strings.TrimSuffix(cfg.SocketPath, "/")
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = proxyFunc
+	} else {
+		// Create HTTP client that uses Unix socket (local, so never proxied)
+		transport = &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return net.Dial("unix", cfg.SocketPath)
+			},
+		}
+	}
+
+	pollTimeout := cfg.PollTimeout
+	if pollTimeout <= 0 {
+		pollTimeout = DefaultPollTimeout
 	}
 
 	return &Client{
-		socketPath: cfg.SocketPath,
-		token:      cfg.Token,
+		socketPath:  cfg.SocketPath,
+		baseURL:     baseURL,
+		token:       cfg.Token,
+		pollTimeout: pollTimeout,
 		httpClient: &http.Client{
 			Transport: transport,
-			Timeout:   70 * time.Second, // Slightly longer than poll timeout
+			Timeout:   pollTimeout + pollTimeoutGrace, // Slightly longer than poll timeout
 		},
+		includeStopped: cfg.IncludeStopped,
+		enabled:        make(map[string]Service),
 	}
 }
 
 // ingressConfig represents the structured ingress configuration from stevedore API.
 type ingressConfig struct {
-	Enabled     bool   `json:"enabled"`
-	Subdomain   string `json:"subdomain"`
-	Port        int    `json:"port"`
-	Websocket   bool   `json:"websocket,omitempty"`
-	Healthcheck string `json:"healthcheck,omitempty"`
-	Direct      bool   `json:"direct,omitempty"`
+	Enabled       bool   `json:"enabled"`
+	Subdomain     string `json:"subdomain"`
+	Port          int    `json:"port"`
+	Websocket     bool   `json:"websocket,omitempty"`
+	Healthcheck   string `json:"healthcheck,omitempty"`
+	DisableHealth bool   `json:"disable_health,omitempty"`
+	Direct        bool   `json:"direct,omitempty"`
+	IPOverride    string `json:"ip_override,omitempty"`
 }
 
 // serviceResponse matches the stevedore API response structure.
 type serviceResponse struct {
-	Deployment    string            `json:"deployment"`
-	Service       string            `json:"service"`
-	ContainerID   string            `json:"container_id"`
-	ContainerName string            `json:"container_name"`
-	Running       bool              `json:"running"`
-	Ingress       *ingressConfig    `json:"ingress,omitempty"`
-	Labels        map[string]string `json:"labels,omitempty"` // Legacy format
+	Deployment    string `json:"deployment"`
+	Service       string `json:"service"`
+	ContainerID   string `json:"container_id"`
+	ContainerName string `json:"container_name"`
+	// Running is nil when stevedore does not report the container state.
+	Running *bool             `json:"running,omitempty"`
+	Ingress *ingressConfig    `json:"ingress,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"` // Legacy format
 }
 
 // GetIngressServices returns all services with ingress labels.
 func (c *Client) GetIngressServices(ctx context.Context) ([]Service, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", "http://stevedore/services?ingress=true", nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/services?ingress=true", nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -106,12 +181,42 @@ func (c *Client) GetIngressServices(ctx context.Context) ([]Service, error) {
 		return nil, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, string(body))
 	}
 
-	var svcResponses []serviceResponse
-	if err := json.NewDecoder(resp.Body).Decode(&svcResponses); err != nil {
+	var rawServices []json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&rawServices); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	return c.parseServices(svcResponses), nil
+	decoded := decodeServiceResponses(rawServices)
+	if len(decoded) == 0 && len(rawServices) > 0 {
+		return nil, fmt.Errorf("all %d service entries in response were malformed", len(rawServices))
+	}
+	return c.parseServices(decoded), nil
+}
+
+// decodeServiceResponses decodes each service object independently so one
+// malformed entry is logged and skipped instead of failing the whole list.
+func decodeServiceResponses(raw []json.RawMessage) []serviceResponse {
+	responses := make([]serviceResponse, 0, len(raw))
+	for i, entry := range raw {
+		var r serviceResponse
+		if err := json.Unmarshal(entry, &r); err != nil {
+			slog.Warn("Skipping malformed service entry from stevedore",
+				"index", i,
+				"error", err,
+				"entry", truncate(string(entry), 200),
+			)
+			continue
+		}
+		responses = append(responses, r)
+	}
+	return responses
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
 }
 
 // EventType represents the type of change event from stevedore.
@@ -137,16 +242,42 @@ type Event struct {
 type pollResponse struct {
 	Changed   bool              `json:"changed"`
 	Timestamp int64             `json:"timestamp"`
-	Services  []serviceResponse `json:"services,omitempty"`
+	Services  []json.RawMessage `json:"services,omitempty"` // decoded per entry
 	Events    []Event           `json:"events,omitempty"`
 }
 
+// IngressChangeKind classifies why a previously routed service disappeared.
+type IngressChangeKind string
+
+const (
+	// IngressDisabled means stevedore still reports the service, but with
+	// ingress explicitly turned off.
+	IngressDisabled IngressChangeKind = "ingress_disabled"
+	// IngressGone means the service is no longer reported at all
+	// (removed, crashed, or filtered out by stevedore).
+	IngressGone IngressChangeKind = "gone"
+	// IngressStopped means stevedore still reports the service, but its
+	// container is not running.
+	IngressStopped IngressChangeKind = "stopped"
+)
+
+// IngressChange records a previously enabled service losing its route.
+type IngressChange struct {
+	Kind       IngressChangeKind
+	Deployment string
+	Container  string
+	Subdomain  string
+}
+
 // PollResult contains the result of a poll operation.
 type PollResult struct {
 	Services  []Service
 	Events    []Event
 	Timestamp time.Time
 	Changed   bool
+	// IngressChanges lists services that were routed before this poll and
+	// are not anymore, distinguishing deliberate disables from removals.
+	IngressChanges []IngressChange
 }
 
 // Poll long-polls for service changes. Returns services, events, and timestamp.
@@ -161,12 +292,7 @@ func (c *Client) Poll(ctx context.Context, since time.Time) ([]Service, time.Tim
 
 // PollWithEvents long-polls for service changes and returns full event details.
 func (c *Client) PollWithEvents(ctx context.Context, since time.Time) (*PollResult, error) {
-	url := "http://stevedore/poll"
-	if !since.IsZero() {
-		url += "?since=" + strconv.FormatInt(since.Unix(), 10)
-	}
-
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", c.pollURL(since), nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -207,7 +333,11 @@ func (c *Client) PollWithEvents(ctx context.Context, since time.Time) (*PollResu
 
 		// If services included in response, use them; otherwise fetch fresh
 		if len(pollResp.Services) > 0 {
-			result.Services = c.parseServices(pollResp.Services)
+			decoded := decodeServiceResponses(pollResp.Services)
+			if len(decoded) == 0 {
+				return nil, fmt.Errorf("all %d service entries in poll response were malformed", len(pollResp.Services))
+			}
+			result.Services, result.IngressChanges = c.parseServicesWithChanges(decoded)
 		} else {
 			// Poll returned changed=true but no services payload - fetch services explicitly
 			slog.Debug("Poll returned changed without services, fetching fresh service list")
@@ -216,30 +346,63 @@ func (c *Client) PollWithEvents(ctx context.Context, since time.Time) (*PollResu
 				return nil, fmt.Errorf("failed to fetch services after poll change: %w", err)
 			}
 			result.Services = services
+			result.IngressChanges = c.lastChanges()
 		}
 	}
 
 	return result, nil
 }
 
+// pollURL builds the /poll request URL. The timeout is always sent (in whole
+// seconds) so the server-side long-poll matches the client deadline.
+func (c *Client) pollURL(since time.Time) string {
+	query := url.Values{}
+	if !since.IsZero() {
+		query.Set("since", strconv.FormatInt(since.Unix(), 10))
+	}
+	query.Set("timeout", strconv.FormatInt(int64(c.pollTimeout/time.Second), 10))
+	return c.baseURL + "/poll?" + query.Encode()
+}
+
 // parseServices converts API responses to Service structs.
 func (c *Client) parseServices(responses []serviceResponse) []Service {
+	services, _ := c.parseServicesWithChanges(responses)
+	return services
+}
+
+// parseServicesWithChanges converts API responses to Service structs and
+// reports previously enabled services that are now disabled or gone.
+func (c *Client) parseServicesWithChanges(responses []serviceResponse) ([]Service, []IngressChange) {
 	var services []Service
+	var disabled, stopped []serviceResponse
 
 	for _, r := range responses {
 		var svc Service
 		var err error
 
+		if ingressExplicitlyDisabled(r) {
+			disabled = append(disabled, r)
+		}
+
+		// A stopped container's route would point at a dead port.
+		if r.Running != nil && !*r.Running && !c.includeStopped {
+			slog.Debug("Skipping service whose container is not running", "container", r.ContainerName)
+			stopped = append(stopped, r)
+			continue
+		}
+
 		// Try new structured format first
 		if r.Ingress != nil && r.Ingress.Enabled {
 			svc = Service{
-				Deployment:  r.Deployment,
-				Container:   r.ContainerName,
-				Subdomain:   r.Ingress.Subdomain,
-				Port:        r.Ingress.Port,
-				Websocket:   r.Ingress.Websocket,
-				HealthCheck: r.Ingress.Healthcheck,
-				Direct:      r.Ingress.Direct,
+				Deployment:    r.Deployment,
+				Container:     r.ContainerName,
+				Subdomain:     r.Ingress.Subdomain,
+				Port:          r.Ingress.Port,
+				Websocket:     r.Ingress.Websocket,
+				HealthCheck:   r.Ingress.Healthcheck,
+				DisableHealth: r.Ingress.DisableHealth,
+				Direct:        r.Ingress.Direct,
+				IPOverride:    r.Ingress.IPOverride,
 			}
 		} else if r.Labels != nil {
 			// Fall back to legacy labels format
@@ -256,7 +419,95 @@ func (c *Client) parseServices(responses []serviceResponse) []Service {
 		services = append(services, svc)
 	}
 
-	return services
+	return services, c.trackIngress(services, disabled, stopped)
+}
+
+// ingressExplicitlyDisabled reports whether stevedore returned the service
+// with ingress turned off, as opposed to not returning it at all.
+func ingressExplicitlyDisabled(r serviceResponse) bool {
+	if r.Ingress != nil {
+		return !r.Ingress.Enabled
+	}
+	if r.Labels != nil {
+		if enabled, ok := r.Labels["stevedore.ingress.enabled"]; ok {
+			return enabled != "true"
+		}
+	}
+	return false
+}
+
+func serviceIdentity(deployment, container string) string {
+	return deployment + "/" + container
+}
+
+// trackIngress updates the previously enabled set and returns transitions
+// for services that lost their route, logging each one.
+func (c *Client) trackIngress(services []Service, disabled, stopped []serviceResponse) []IngressChange {
+	c.enabledMu.Lock()
+	defer c.enabledMu.Unlock()
+
+	current := make(map[string]Service, len(services))
+	for _, svc := range services {
+		current[serviceIdentity(svc.Deployment, svc.Container)] = svc
+	}
+	explicitlyDisabled := make(map[string]bool, len(disabled))
+	for _, r := range disabled {
+		explicitlyDisabled[serviceIdentity(r.Deployment, r.ContainerName)] = true
+	}
+	notRunning := make(map[string]bool, len(stopped))
+	for _, r := range stopped {
+		notRunning[serviceIdentity(r.Deployment, r.ContainerName)] = true
+	}
+
+	var changes []IngressChange
+	for id, prev := range c.enabled {
+		if _, still := current[id]; still {
+			continue
+		}
+		change := IngressChange{
+			Kind:       IngressGone,
+			Deployment: prev.Deployment,
+			Container:  prev.Container,
+			Subdomain:  prev.Subdomain,
+		}
+		if explicitlyDisabled[id] {
+			change.Kind = IngressDisabled
+			slog.Info("Service ingress disabled",
+				"deployment", prev.Deployment,
+				"container", prev.Container,
+				"subdomain", prev.Subdomain,
+			)
+		} else if notRunning[id] {
+			change.Kind = IngressStopped
+			slog.Info("Service stopped",
+				"deployment", prev.Deployment,
+				"container", prev.Container,
+				"subdomain", prev.Subdomain,
+			)
+		} else {
+			slog.Info("Service gone",
+				"deployment", prev.Deployment,
+				"container", prev.Container,
+				"subdomain", prev.Subdomain,
+			)
+		}
+		changes = append(changes, change)
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return serviceIdentity(changes[i].Deployment, changes[i].Container) <
+			serviceIdentity(changes[j].Deployment, changes[j].Container)
+	})
+
+	c.enabled = current
+	c.changes = changes
+	return changes
+}
+
+// lastChanges returns the transitions computed by the most recent parse.
+func (c *Client) lastChanges() []IngressChange {
+	c.enabledMu.Lock()
+	defer c.enabledMu.Unlock()
+	return c.changes
 }
 
 // parseServiceFromLabels extracts service config from Docker labels.
@@ -286,22 +537,26 @@ func parseServiceFromLabels(deployment, container string, labels map[string]stri
 	// Get optional settings
 	websocket := labels["stevedore.ingress.websocket"] == "true"
 	healthCheck := labels["stevedore.ingress.healthcheck"]
+	disableHealth := labels["stevedore.ingress.disable_health"] == "true"
 	direct := labels["stevedore.ingress.direct"] == "true"
+	ipOverride := labels["stevedore.ingress.ip_override"]
 
 	return Service{
-		Deployment:  deployment,
-		Container:   container,
-		Subdomain:   subdomain,
-		Port:        port,
-		Websocket:   websocket,
-		HealthCheck: healthCheck,
-		Direct:      direct,
+		Deployment:    deployment,
+		Container:     container,
+		Subdomain:     subdomain,
+		Port:          port,
+		Websocket:     websocket,
+		HealthCheck:   healthCheck,
+		DisableHealth: disableHealth,
+		Direct:        direct,
+		IPOverride:    ipOverride,
 	}, nil
 }
 
 // HealthCheck verifies the stevedore socket is accessible.
 func (c *Client) HealthCheck(ctx context.Context) error {
-	req, err := http.NewRequestWithContext(ctx, "GET", "http://stevedore/healthz", nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/healthz", nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
@@ -3,10 +3,15 @@ package discovery
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -75,6 +80,25 @@ func TestParseServiceFromLabels(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name:       "with health checks disabled",
+			deployment: "legacy",
+			container:  "stevedore-legacy-app-1",
+			labels: map[string]string{
+				"stevedore.ingress.enabled":        "true",
+				"stevedore.ingress.subdomain":      "legacy",
+				"stevedore.ingress.port":           "8080",
+				"stevedore.ingress.disable_health": "true",
+			},
+			wantService: Service{
+				Deployment:    "legacy",
+				Container:     "stevedore-legacy-app-1",
+				Subdomain:     "legacy",
+				Port:          8080,
+				DisableHealth: true,
+			},
+			wantErr: false,
+		},
 		{
 			name:       "with direct mode",
 			deployment: "directapp",
@@ -260,7 +284,7 @@ func TestClient_MockServer(t *testing.T) {
 				Service:       "web",
 				ContainerID:   "abc123",
 				ContainerName: "stevedore-myapp-web-1",
-				Running:       true,
+				Running:       running(true),
 				Ingress: &ingressConfig{
 					Enabled:   true,
 					Subdomain: "myapp",
@@ -272,7 +296,7 @@ func TestClient_MockServer(t *testing.T) {
 				Service:       "server",
 				ContainerID:   "def456",
 				ContainerName: "stevedore-api-server-1",
-				Running:       true,
+				Running:       running(true),
 				Ingress: &ingressConfig{
 					Enabled:     true,
 					Subdomain:   "api",
@@ -348,6 +372,101 @@ func TestClient_MockServer(t *testing.T) {
 	})
 }
 
+// TestClient_TCP verifies an http:// STEVEDORE_SOCKET reaches the same
+// endpoints over TCP, with the same auth and under the URL's path prefix.
+func TestClient_TCP(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/api/services", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" || r.URL.Query().Get("ingress") != "true" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode([]serviceResponse{{
+			Deployment:    "myapp",
+			ContainerName: "stevedore-myapp-web-1",
+			Ingress:       &ingressConfig{Enabled: true, Subdomain: "myapp", Port: 3000},
+		}})
+	})
+	mux.HandleFunc("/api/poll", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" || r.URL.Query().Get("timeout") != "5" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		raw, _ := json.Marshal(serviceResponse{
+			Deployment:    "api",
+			ContainerName: "stevedore-api-server-1",
+			Ingress:       &ingressConfig{Enabled: true, Subdomain: "api", Port: 8080},
+		})
+		_ = json.NewEncoder(w).Encode(pollResponse{Changed: true, Timestamp: 1700000000, Services: []json.RawMessage{raw}})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := New(Config{SocketPath: server.URL + "/api/", Token: "test-token", PollTimeout: 5 * time.Second})
+
+	if err := client.HealthCheck(context.Background()); err != nil {
+		t.Errorf("HealthCheck() unexpected error: %v", err)
+	}
+
+	services, err := client.GetIngressServices(context.Background())
+	if err != nil {
+		t.Fatalf("GetIngressServices() unexpected error: %v", err)
+	}
+	want := []Service{{Deployment: "myapp", Container: "stevedore-myapp-web-1", Subdomain: "myapp", Port: 3000}}
+	if !reflect.DeepEqual(services, want) {
+		t.Errorf("GetIngressServices() = %+v, want %+v", services, want)
+	}
+
+	result, err := client.PollWithEvents(context.Background(), time.Time{})
+	if err != nil {
+		t.Fatalf("PollWithEvents() unexpected error: %v", err)
+	}
+	want = []Service{{Deployment: "api", Container: "stevedore-api-server-1", Subdomain: "api", Port: 8080}}
+	if !result.Changed || !reflect.DeepEqual(result.Services, want) {
+		t.Errorf("PollWithEvents() = %+v, want changed with %+v", result, want)
+	}
+
+	badClient := New(Config{SocketPath: server.URL + "/api", Token: "wrong-token"})
+	if _, err := badClient.GetIngressServices(context.Background()); err == nil {
+		t.Error("GetIngressServices() with bad token should return error")
+	}
+	// The scheme is case-insensitive, as in the config validation
+	upperClient := New(Config{SocketPath: "HTTP" + strings.TrimPrefix(server.URL, "http") + "/api", Token: "test-token"})
+	if err := upperClient.HealthCheck(context.Background()); err != nil {
+		t.Errorf("HealthCheck() with an uppercase scheme unexpected error: %v", err)
+	}
+}
+
+// TestClient_TCPProxy verifies a STEVEDORE_SOCKET URL is reached through
+// the environment proxy.
+func TestClient_TCPProxy(t *testing.T) {
+	var proxiedHost string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxiedHost = r.URL.Host
+		_ = json.NewEncoder(w).Encode([]serviceResponse{})
+	}))
+	defer proxy.Close()
+
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatalf("parse proxy URL: %v", err)
+	}
+	oldProxy := proxyFunc
+	proxyFunc = http.ProxyURL(proxyURL)
+	t.Cleanup(func() { proxyFunc = oldProxy })
+
+	client := New(Config{SocketPath: "http://stevedore.example.invalid:42107", Token: "test-token"})
+	if _, err := client.GetIngressServices(context.Background()); err != nil {
+		t.Fatalf("GetIngressServices() unexpected error: %v", err)
+	}
+	if proxiedHost != "stevedore.example.invalid:42107" {
+		t.Errorf("proxy saw host %q, want %q", proxiedHost, "stevedore.example.invalid:42107")
+	}
+}
+
 func TestNew(t *testing.T) {
 	cfg := Config{
 		SocketPath: "/var/run/stevedore/query.sock",
@@ -370,6 +489,74 @@ func TestNew(t *testing.T) {
 	}
 }
 
+// TestNew_PollTimeout verifies the configured long-poll timeout drives the
+// HTTP client deadline, and that zero falls back to DefaultPollTimeout.
+func TestNew_PollTimeout(t *testing.T) {
+	tests := []struct {
+		name        string
+		pollTimeout time.Duration
+		wantPoll    time.Duration
+	}{
+		{"default", 0, DefaultPollTimeout},
+		{"custom", 2 * time.Minute, 2 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := New(Config{SocketPath: "/tmp/x.sock", PollTimeout: tt.pollTimeout})
+			if client.pollTimeout != tt.wantPoll {
+				t.Errorf("pollTimeout = %v, want %v", client.pollTimeout, tt.wantPoll)
+			}
+			if want := tt.wantPoll + pollTimeoutGrace; client.httpClient.Timeout != want {
+				t.Errorf("httpClient.Timeout = %v, want %v", client.httpClient.Timeout, want)
+			}
+		})
+	}
+}
+
+// TestClient_PollSendsTimeout verifies /poll receives the configured timeout
+// (in seconds) alongside the since parameter.
+func TestClient_PollSendsTimeout(t *testing.T) {
+	socketPath := tempSocketPath(t)
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Failed to create socket: %v", err)
+	}
+	defer listener.Close()
+
+	gotQuery := make(chan url.Values, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/poll", func(w http.ResponseWriter, r *http.Request) {
+		gotQuery <- r.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(pollResponse{Changed: false, Timestamp: time.Now().Unix()})
+	})
+
+	server := &http.Server{Handler: mux}
+	go func() { _ = server.Serve(listener) }()
+	defer server.Close()
+
+	client := New(Config{
+		SocketPath:  socketPath,
+		Token:       "test-token",
+		PollTimeout: 25 * time.Second,
+	})
+
+	since := time.Unix(1700000000, 0)
+	if _, err := client.PollWithEvents(context.Background(), since); err != nil {
+		t.Fatalf("PollWithEvents() unexpected error: %v", err)
+	}
+
+	query := <-gotQuery
+	if got := query.Get("timeout"); got != "25" {
+		t.Errorf("timeout query = %q, want %q", got, "25")
+	}
+	if got := query.Get("since"); got != "1700000000" {
+		t.Errorf("since query = %q, want %q", got, "1700000000")
+	}
+}
+
 // TestClient_SocketNotExists tests behavior when socket doesn't exist.
 func TestClient_SocketNotExists(t *testing.T) {
 	client := New(Config{
@@ -435,7 +622,7 @@ func TestClient_PollWithoutServices(t *testing.T) {
 				Service:       "web",
 				ContainerID:   "abc123",
 				ContainerName: "stevedore-myapp-web-1",
-				Running:       true,
+				Running:       running(true),
 				Ingress: &ingressConfig{
 					Enabled:   true,
 					Subdomain: "myapp",
@@ -484,6 +671,168 @@ func TestClient_PollWithoutServices(t *testing.T) {
 	}
 }
 
+// TestClient_PollSkipsMalformedServices verifies that one malformed service
+// object in a poll response is skipped while the valid ones are returned.
+func TestClient_PollSkipsMalformedServices(t *testing.T) {
+	socketPath := tempSocketPath(t)
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Failed to create socket: %v", err)
+	}
+	defer listener.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/poll", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"changed": true, "timestamp": %d, "services": [
+			{"deployment": "a", "container_name": "a-1", "ingress": {"enabled": true, "subdomain": "alpha", "port": 8080}},
+			{"deployment": "b", "container_name": "b-1", "ingress": {"enabled": true, "subdomain": "bravo", "port": "not-a-number"}},
+			{"deployment": "c", "container_name": "c-1", "ingress": {"enabled": true, "subdomain": "charlie", "port": 9090}},
+			"garbage",
+			{"deployment": "d", "container_name": "d-1", "ingress": {"enabled": true, "subdomain": "delta", "port": 7070}}
+		]}`, time.Now().Unix())
+	})
+
+	server := &http.Server{Handler: mux}
+	go func() { _ = server.Serve(listener) }()
+	defer server.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	client := New(Config{SocketPath: socketPath, Token: "test-token"})
+	result, err := client.PollWithEvents(context.Background(), time.Time{})
+	if err != nil {
+		t.Fatalf("PollWithEvents() unexpected error: %v", err)
+	}
+
+	var got []string
+	for _, svc := range result.Services {
+		got = append(got, svc.Subdomain)
+	}
+	if want := []string{"alpha", "charlie", "delta"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("services = %v, want %v", got, want)
+	}
+}
+
+// TestClient_IngressDisabledVsGone verifies that a previously enabled service
+// reporting enabled:false is classified as disabled, while one that vanishes
+// from the response is classified as gone.
+func TestClient_IngressDisabledVsGone(t *testing.T) {
+	client := New(Config{SocketPath: "/nonexistent.sock", Token: "test-token"})
+
+	web := serviceResponse{
+		Deployment:    "myapp",
+		ContainerName: "stevedore-myapp-web-1",
+		Ingress:       &ingressConfig{Enabled: true, Subdomain: "myapp", Port: 3000},
+	}
+	api := serviceResponse{
+		Deployment:    "api",
+		ContainerName: "stevedore-api-server-1",
+		Ingress:       &ingressConfig{Enabled: true, Subdomain: "api", Port: 8080},
+	}
+	legacy := serviceResponse{
+		Deployment:    "legacy",
+		ContainerName: "stevedore-legacy-1",
+		Labels: map[string]string{
+			"stevedore.ingress.enabled":   "true",
+			"stevedore.ingress.subdomain": "legacy",
+			"stevedore.ingress.port":      "80",
+		},
+	}
+
+	services, changes := client.parseServicesWithChanges([]serviceResponse{web, api, legacy})
+	if len(services) != 3 {
+		t.Fatalf("initial parse returned %d services, want 3", len(services))
+	}
+	if len(changes) != 0 {
+		t.Fatalf("initial parse changes = %+v, want none", changes)
+	}
+
+	webDisabled := web
+	webDisabled.Ingress = &ingressConfig{Enabled: false, Subdomain: "myapp", Port: 3000}
+	legacyDisabled := legacy
+	legacyDisabled.Labels = map[string]string{"stevedore.ingress.enabled": "false"}
+
+	// web flips enabled:false, legacy flips its label, api disappears.
+	services, changes = client.parseServicesWithChanges([]serviceResponse{webDisabled, legacyDisabled})
+	if len(services) != 0 {
+		t.Errorf("second parse returned %d services, want 0", len(services))
+	}
+
+	got := map[string]IngressChangeKind{}
+	for _, c := range changes {
+		got[c.Subdomain] = c.Kind
+	}
+	want := map[string]IngressChangeKind{
+		"myapp":  IngressDisabled,
+		"legacy": IngressDisabled,
+		"api":    IngressGone,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("changes = %+v, want %v", changes, want)
+	}
+	for sub, kind := range want {
+		if got[sub] != kind {
+			t.Errorf("change for %q = %q, want %q", sub, got[sub], kind)
+		}
+	}
+
+	// Transitions are reported once; a stable disabled state is quiet.
+	if _, changes = client.parseServicesWithChanges([]serviceResponse{webDisabled}); len(changes) != 0 {
+		t.Errorf("repeat parse changes = %+v, want none", changes)
+	}
+}
+
+// TestClient_SkipsStoppedServices verifies that a service whose container
+// is not running is excluded from the parsed set and reported as stopped,
+// unless IncludeStopped is set; a service without a reported state stays.
+func TestClient_SkipsStoppedServices(t *testing.T) {
+	web := serviceResponse{
+		Deployment:    "myapp",
+		ContainerName: "stevedore-myapp-web-1",
+		Running:       running(true),
+		Ingress:       &ingressConfig{Enabled: true, Subdomain: "myapp", Port: 3000},
+	}
+	api := serviceResponse{
+		Deployment:    "api",
+		ContainerName: "stevedore-api-server-1",
+		Running:       running(true),
+		Ingress:       &ingressConfig{Enabled: true, Subdomain: "api", Port: 8080},
+	}
+	unknown := serviceResponse{
+		Deployment:    "old",
+		ContainerName: "stevedore-old-1",
+		Ingress:       &ingressConfig{Enabled: true, Subdomain: "old", Port: 8000},
+	}
+	apiStopped := api
+	apiStopped.Running = running(false)
+
+	client := New(Config{SocketPath: "/nonexistent.sock", Token: "test-token"})
+	if services := client.parseServices([]serviceResponse{web, api, unknown}); len(services) != 3 {
+		t.Fatalf("initial parse returned %d services, want 3", len(services))
+	}
+	services, changes := client.parseServicesWithChanges([]serviceResponse{web, apiStopped, unknown})
+	var got []string
+	for _, svc := range services {
+		got = append(got, svc.Subdomain)
+	}
+	if want := []string{"myapp", "old"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("services = %v, want %v", got, want)
+	}
+	if len(changes) != 1 || changes[0].Subdomain != "api" || changes[0].Kind != IngressStopped {
+		t.Errorf("changes = %+v, want api stopped", changes)
+	}
+
+	client = New(Config{SocketPath: "/nonexistent.sock", Token: "test-token", IncludeStopped: true})
+	if services := client.parseServices([]serviceResponse{web, apiStopped, unknown}); len(services) != 3 {
+		t.Errorf("IncludeStopped parse returned %d services, want 3", len(services))
+	}
+}
+
+func running(v bool) *bool {
+	return &v
+}
+
 // Ensure socket file is cleaned up in tests
 func TestMain(m *testing.M) {
 	code := m.Run()
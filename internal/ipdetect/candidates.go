@@ -0,0 +1,114 @@
+package ipdetect
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// selectsCandidates reports whether a candidate preference is configured
+// (IP_PREFER_CIDRS or IP_REACHABILITY_PROBE).
+func (d *Detector) selectsCandidates() bool {
+	return len(d.cfg.IPPreferCIDRs) > 0 || d.cfg.IPReachabilityProbe != ""
+}
+
+// detectFromCandidates collects every address the Fritzbox and the
+// external services report and picks one per family by the configured
+// preference. On a multi-WAN connection the services can see different
+// egress addresses, so all of them are asked.
+func (d *Detector) detectFromCandidates(ctx context.Context) (ipv4, ipv6 string, err error) {
+	var candidates4, candidates6 []string
+	fritzIPv4, fritzIPv6, err := d.detectFromFritzbox(ctx)
+	if err != nil {
+		slog.Debug("Fritzbox detection failed", "error", err)
+	}
+	candidates4 = appendCandidate(candidates4, fritzIPv4, isValidIPv4)
+	candidates6 = appendCandidate(candidates6, fritzIPv6, isValidIPv6)
+	for _, svc := range d.ipv4Services {
+		got, err := d.fetchIPFromService(ctx, svc)
+		if err != nil {
+			slog.Debug("IP service failed", "service", svc, "error", err)
+			continue
+		}
+		candidates4 = appendCandidate(candidates4, got, isValidIPv4)
+	}
+	for _, svc := range d.ipv6Services {
+		got, err := d.fetchIPFromService(ctx, svc)
+		if err != nil {
+			slog.Debug("IP service failed", "service", svc, "error", err)
+			continue
+		}
+		candidates6 = appendCandidate(candidates6, got, isValidIPv6)
+	}
+	slog.Debug("Collected IP candidates", "ipv4", candidates4, "ipv6", candidates6)
+
+	ipv4 = d.selectCandidate(ctx, candidates4)
+	ipv6 = d.selectCandidate(ctx, candidates6)
+	if ipv4 == "" && ipv6 == "" {
+		return "", "", fmt.Errorf("could not detect any IP address")
+	}
+	return ipv4, ipv6, nil
+}
+
+// appendCandidate adds ip to candidates when it is valid and not yet listed.
+func appendCandidate(candidates []string, ip string, valid func(string) bool) []string {
+	if ip == "" || !valid(ip) || slices.Contains(candidates, ip) {
+		return candidates
+	}
+	return append(candidates, ip)
+}
+
+// selectCandidate returns the candidate inside the first matching
+// IP_PREFER_CIDRS prefix, else the first one IP_REACHABILITY_PROBE reports
+// reachable, else the first candidate.
+func (d *Detector) selectCandidate(ctx context.Context, candidates []string) string {
+	if len(candidates) == 0 {
+		return ""
+	}
+	for _, prefix := range d.cfg.IPPreferCIDRs {
+		for _, c := range candidates {
+			if addr, err := netip.ParseAddr(c); err == nil && prefix.Contains(addr.Unmap()) {
+				slog.Debug("Selected IP candidate by prefix", "ip", c, "prefix", prefix, "candidates", candidates)
+				return c
+			}
+		}
+	}
+	if d.cfg.IPReachabilityProbe != "" {
+		for _, c := range candidates {
+			if err := d.probeReachable(ctx, c); err != nil {
+				slog.Debug("IP candidate not reachable", "ip", c, "error", err)
+				continue
+			}
+			slog.Debug("Selected IP candidate by reachability probe", "ip", c, "candidates", candidates)
+			return c
+		}
+	}
+	slog.Warn("No IP candidate matched the preference, using the first", "ip", candidates[0], "candidates", candidates)
+	return candidates[0]
+}
+
+// probeReachable asks IP_REACHABILITY_PROBE whether ip is reachable from
+// outside; any 2xx answer means it is.
+func (d *Detector) probeReachable(ctx context.Context, ip string) error {
+	probeURL := strings.ReplaceAll(d.cfg.IPReachabilityProbe, "{ip}", url.QueryEscape(ip))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, probeURL, nil)
+	if err != nil {
+		return err
+	}
+	d.setUserAgent(req)
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
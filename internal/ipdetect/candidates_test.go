@@ -0,0 +1,77 @@
+package ipdetect
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+)
+
+// TestDetector_Detect_SelectsPreferredCandidate verifies that with a
+// candidate preference every source is asked and the address matching
+// IP_PREFER_CIDRS, or reachable via IP_REACHABILITY_PROBE, is published.
+func TestDetector_Detect_SelectsPreferredCandidate(t *testing.T) {
+	// The Fritzbox reports WAN1; one external service egresses via WAN2.
+	fritzbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("SOAPAction") != wanIPConnectionService+"#GetExternalIPAddress" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>
+<u:GetExternalIPAddressResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1">
+<NewExternalIPAddress>203.0.113.42</NewExternalIPAddress>
+</u:GetExternalIPAddressResponse></s:Body></s:Envelope>`)
+	}))
+	defer fritzbox.Close()
+	services := make([]string, 0, 2)
+	for _, answer := range []string{"198.51.100.7", "203.0.113.42"} {
+		svc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, answer)
+		}))
+		defer svc.Close()
+		services = append(services, svc.URL)
+	}
+	// The probe reports only WAN2 reachable from outside.
+	probe := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("ip") != "198.51.100.7" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer probe.Close()
+
+	tests := []struct {
+		name  string
+		cidrs []string
+		probe string
+		want  string
+	}{
+		{name: "cidr", cidrs: []string{"192.0.2.0/24", "198.51.100.0/24"}, want: "198.51.100.7"},
+		{name: "cidr_order", cidrs: []string{"203.0.113.0/24", "198.51.100.0/24"}, want: "203.0.113.42"},
+		{name: "reachable", probe: probe.URL + "/check?ip={ip}", want: "198.51.100.7"},
+		{name: "no_match", cidrs: []string{"192.0.2.0/24"}, want: "203.0.113.42"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{IPReachabilityProbe: tt.probe}
+			for _, c := range tt.cidrs {
+				cfg.IPPreferCIDRs = append(cfg.IPPreferCIDRs, netip.MustParsePrefix(c))
+			}
+			detector := New(cfg)
+			detector.discoveredControlURL = fritzbox.URL
+			detector.ipv4Services = services
+			detector.ipv6Services = nil
+
+			ipv4, ipv6, err := detector.Detect(context.Background())
+			if err != nil {
+				t.Fatalf("Detect() error: %v", err)
+			}
+			if ipv4 != tt.want || ipv6 != "" {
+				t.Errorf("Detect() = %q, %q; want %q", ipv4, ipv6, tt.want)
+			}
+		})
+	}
+}
@@ -3,7 +3,7 @@ package ipdetect
 import (
 	"bytes"
 	"context"
-	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -16,13 +16,42 @@ import (
 	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
 )
 
+// Default external IP detection services, tried in order.
+var (
+	defaultIPv4Services = []string{
+		"https://api.showmyip.com/",
+		"https://api.ipify.org",
+		"https://checkip.amazonaws.com",
+		"https://ipv4.icanhazip.com",
+		"https://v4.ident.me",
+	}
+	defaultIPv6Services = []string{
+		"https://api6.ipify.org",
+		"https://ipv6.icanhazip.com",
+		"https://v6.ident.me",
+	}
+)
+
 // Detector handles IP address detection
 type Detector struct {
 	cfg *config.Config
 
 	lastIPv4 string
 	lastIPv6 string
-	lastMu   sync.RWMutex
+	// preferredIPv4/preferredIPv6 are the external services that produced
+	// the last committed addresses; they are tried first next cycle.
+	preferredIPv4 string
+	preferredIPv6 string
+	// discoveredControlURL is the WANIPConnection control URL found via
+	// SSDP (FRITZBOX_AUTODISCOVER); empty means use FRITZBOX_HOST.
+	discoveredControlURL string
+	// history holds the most recent address changes, guarded by lastMu.
+	history *ipHistory
+	lastMu  sync.RWMutex
+
+	ipv4Services []string
+	ipv6Services []string
+	ssdpAddr     string
 
 	httpClient *http.Client
 }
@@ -30,13 +59,37 @@ type Detector struct {
 // New creates a new IP detector
 func New(cfg *config.Config) *Detector {
 	return &Detector{
-		cfg: cfg,
+		cfg:          cfg,
+		ipv4Services: defaultIPv4Services,
+		ipv6Services: defaultIPv6Services,
+		ssdpAddr:     ssdpMulticastAddr,
+		history:      newIPHistory(cfg.IPHistorySize),
 		httpClient: &http.Client{
-			Timeout: 10 * time.Second,
+			Timeout:   10 * time.Second,
+			Transport: newTransport(),
 		},
 	}
 }
 
+// proxyFunc selects the proxy for outbound requests from HTTP_PROXY,
+// HTTPS_PROXY and NO_PROXY. A variable so tests can substitute it.
+var proxyFunc = http.ProxyFromEnvironment
+
+// setUserAgent identifies dyndns (and its version) on req when configured.
+func (d *Detector) setUserAgent(req *http.Request) {
+	if d.cfg.UserAgent != "" {
+		req.Header.Set("User-Agent", d.cfg.UserAgent)
+	}
+}
+
+// newTransport returns a transport with the default dial and TLS settings
+// that routes requests through proxyFunc.
+func newTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = proxyFunc
+	return t
+}
+
 // Detect returns the current public IPv4 and IPv6 addresses
 func (d *Detector) Detect(ctx context.Context) (ipv4, ipv6 string, err error) {
 	// Check for manual override
@@ -44,10 +97,50 @@ func (d *Detector) Detect(ctx context.Context) (ipv4, ipv6 string, err error) {
 		slog.Debug("Using manual IP configuration")
 		ipv4 = d.cfg.ManualIPv4
 		ipv6 = d.cfg.ManualIPv6
-		d.updateLast(ipv4, ipv6)
+		d.updateLast(ipv4, ipv6, ipSources{ipv4: "manual", ipv6: "manual"})
 		return ipv4, ipv6, nil
 	}
 
+	ipv4, ipv6, sources, err := d.detect(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	// Only a prefix is delegated: publish the host's address in it.
+	if d.cfg.IPv6Suffix.IsValid() {
+		ipv6 = d.applyIPv6Suffix(ctx, ipv6)
+		if ipv4 == "" && ipv6 == "" {
+			return "", "", fmt.Errorf("all IP detection methods failed: no usable IPv6 address with IPV6_SUFFIX")
+		}
+		sources.ipv6 += "+ipv6_suffix"
+	}
+	d.updateLast(ipv4, ipv6, sources)
+	return ipv4, ipv6, nil
+}
+
+// detect runs the detection methods in order of preference and names the
+// method (or external service) that produced each address.
+func (d *Detector) detect(ctx context.Context) (ipv4, ipv6 string, sources ipSources, err error) {
+	// Addresses written by an external updater; an unreadable or invalid
+	// file falls through to the other methods.
+	if d.cfg.IPFile != "" {
+		fileIPv4, fileIPv6, err := readIPFile(d.cfg.IPFile)
+		if err == nil {
+			slog.Debug("Got IP from file", "path", d.cfg.IPFile, "ipv4", fileIPv4, "ipv6", fileIPv6)
+			return fileIPv4, fileIPv6, ipSources{ipv4: "ip_file", ipv6: "ip_file"}, nil
+		}
+		slog.Warn("IP file unusable, falling back to detection", "error", err)
+	}
+
+	// Several candidate addresses (multi-WAN): pick by the configured
+	// preference.
+	if d.selectsCandidates() {
+		ipv4, ipv6, err := d.detectFromCandidates(ctx)
+		if err != nil {
+			return "", "", ipSources{}, fmt.Errorf("all IP detection methods failed: %w", err)
+		}
+		return ipv4, ipv6, ipSources{ipv4: "candidates", ipv6: "candidates"}, nil
+	}
+
 	// Try Fritzbox TR-064 first
 	fritzIPv4, fritzIPv6, err := d.detectFromFritzbox(ctx)
 	if err == nil && (fritzIPv4 != "" || fritzIPv6 != "") {
@@ -57,28 +150,34 @@ func (d *Detector) Detect(ctx context.Context) (ipv4, ipv6 string, err error) {
 		validatedIPv4, validatedIPv6 := d.validateWithExternalServices(ctx, fritzIPv4, fritzIPv6)
 
 		if validatedIPv4 != "" || validatedIPv6 != "" {
-			d.updateLast(validatedIPv4, validatedIPv6)
-			return validatedIPv4, validatedIPv6, nil
+			return validatedIPv4, validatedIPv6, ipSources{ipv4: "fritzbox", ipv6: "fritzbox"}, nil
 		}
 
 		// If validation failed but Fritzbox returned IPs, use them with a warning
 		slog.Warn("Could not validate Fritzbox IPs with external services, using Fritzbox values",
 			"ipv4", fritzIPv4, "ipv6", fritzIPv6)
-		d.updateLast(fritzIPv4, fritzIPv6)
-		return fritzIPv4, fritzIPv6, nil
+		return fritzIPv4, fritzIPv6, ipSources{ipv4: "fritzbox", ipv6: "fritzbox"}, nil
 	}
 	if err != nil {
 		slog.Warn("Fritzbox detection failed", "error", err)
 	}
 
 	// Fallback to external services
-	ipv4, ipv6, err = d.detectFromExternalServices(ctx)
+	ipv4, ipv6, sources, err = d.detectFromExternalServices(ctx)
 	if err != nil {
-		return "", "", fmt.Errorf("all IP detection methods failed: %w", err)
+		return "", "", ipSources{}, fmt.Errorf("all IP detection methods failed: %w", err)
 	}
 
-	d.updateLast(ipv4, ipv6)
-	return ipv4, ipv6, nil
+	d.updatePreferred(sources)
+	return ipv4, ipv6, sources, nil
+}
+
+// PreferredSources returns the external services that will be tried first
+// for IPv4 and IPv6 on the next detection cycle (empty if none).
+func (d *Detector) PreferredSources() (ipv4, ipv6 string) {
+	d.lastMu.RLock()
+	defer d.lastMu.RUnlock()
+	return d.preferredIPv4, d.preferredIPv6
 }
 
 // GetLastKnown returns the last detected IP addresses
@@ -88,25 +187,49 @@ func (d *Detector) GetLastKnown() (ipv4, ipv6 string, err error) {
 	return d.lastIPv4, d.lastIPv6, nil
 }
 
-func (d *Detector) updateLast(ipv4, ipv6 string) {
+// updateLast records a committed detection, adding each family whose
+// address changed to the history.
+func (d *Detector) updateLast(ipv4, ipv6 string, sources ipSources) {
 	d.lastMu.Lock()
 	defer d.lastMu.Unlock()
+	now := time.Now().UTC()
+	if ipv4 != d.lastIPv4 {
+		d.history.add(IPChange{Time: now, Family: "ipv4", IP: ipv4, Previous: d.lastIPv4, Source: sources.ipv4})
+	}
+	if ipv6 != d.lastIPv6 {
+		d.history.add(IPChange{Time: now, Family: "ipv6", IP: ipv6, Previous: d.lastIPv6, Source: sources.ipv6})
+	}
 	d.lastIPv4 = ipv4
 	d.lastIPv6 = ipv6
 }
 
+// ipSources names the services that produced a detection result.
+type ipSources struct {
+	ipv4 string
+	ipv6 string
+}
+
+// updatePreferred records the sources of a committed detection. A family
+// without a source keeps no preference, so the full chain runs next time.
+func (d *Detector) updatePreferred(sources ipSources) {
+	d.lastMu.Lock()
+	defer d.lastMu.Unlock()
+	d.preferredIPv4 = sources.ipv4
+	d.preferredIPv6 = sources.ipv6
+}
+
 // detectFromFritzbox uses TR-064 SOAP protocol to get external IP
 func (d *Detector) detectFromFritzbox(ctx context.Context) (ipv4, ipv6 string, err error) {
-	host := d.cfg.FritzboxHost
+	controlURL := d.fritzboxControlURL()
 
 	// Get IPv4 via WANIPConnection service
-	ipv4, err = d.fritzboxGetExternalIP(ctx, host, false)
+	ipv4, err = d.fritzboxGetExternalIP(ctx, controlURL, false)
 	if err != nil {
 		slog.Debug("Failed to get IPv4 from Fritzbox", "error", err)
 	}
 
 	// Get IPv6 via WANIPConnection service
-	ipv6, err = d.fritzboxGetExternalIP(ctx, host, true)
+	ipv6, err = d.fritzboxGetExternalIP(ctx, controlURL, true)
 	if err != nil {
 		slog.Debug("Failed to get IPv6 from Fritzbox", "error", err)
 	}
@@ -118,38 +241,39 @@ func (d *Detector) detectFromFritzbox(ctx context.Context) (ipv4, ipv6 string, e
 	return ipv4, ipv6, nil
 }
 
-func (d *Detector) fritzboxGetExternalIP(ctx context.Context, host string, isIPv6 bool) (string, error) {
-	// TR-064 SOAP envelope for GetExternalIPAddress
-	soapAction := "urn:schemas-upnp-org:service:WANIPConnection:1#GetExternalIPAddress"
+func (d *Detector) fritzboxGetExternalIP(ctx context.Context, controlURL string, isIPv6 bool) (string, error) {
+	action := "GetExternalIPAddress"
 	if isIPv6 {
-		soapAction = "urn:schemas-upnp-org:service:WANIPConnection:1#X_AVM_DE_GetExternalIPv6Address"
+		action = "X_AVM_DE_GetExternalIPv6Address"
 	}
 
-	soapBody := `<?xml version="1.0" encoding="utf-8"?>
-<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">
-  <s:Body>
-    <u:GetExternalIPAddress xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1"/>
-  </s:Body>
-</s:Envelope>`
+	body, err := d.fritzboxSOAP(ctx, controlURL, action)
+	if err != nil {
+		return "", err
+	}
 
-	if isIPv6 {
-		soapBody = `<?xml version="1.0" encoding="utf-8"?>
+	return d.parseSOAPIPResponse(string(body), isIPv6)
+}
+
+// fritzboxSOAP invokes a WANIPConnection action without arguments and
+// returns the raw SOAP response body.
+func (d *Detector) fritzboxSOAP(ctx context.Context, controlURL, action string) ([]byte, error) {
+	// TR-064 SOAP envelope
+	soapBody := `<?xml version="1.0" encoding="utf-8"?>
 <s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">
   <s:Body>
-    <u:X_AVM_DE_GetExternalIPv6Address xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1"/>
+    <u:` + action + ` xmlns:u="` + wanIPConnectionService + `"/>
   </s:Body>
 </s:Envelope>`
-	}
-
-	url := fmt.Sprintf("http://%s:49000/igdupnp/control/WANIPConn1", host)
 
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader([]byte(soapBody)))
+	req, err := http.NewRequestWithContext(ctx, "POST", controlURL, bytes.NewReader([]byte(soapBody)))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
-	req.Header.Set("SOAPAction", soapAction)
+	req.Header.Set("SOAPAction", wanIPConnectionService+"#"+action)
+	d.setUserAgent(req)
 
 	// Add authentication if configured
 	if d.cfg.FritzboxUser != "" && d.cfg.FritzboxPassword != "" {
@@ -158,47 +282,36 @@ func (d *Detector) fritzboxGetExternalIP(ctx context.Context, host string, isIPv
 
 	resp, err := d.httpClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("request failed: %w", err)
+		return nil, fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("unexpected status %d: %s", resp.StatusCode, string(body))
+		// TR-064 reports action errors as a SOAP Fault with status 500.
+		var fault *soapFault
+		if _, _, err := scanSOAP(body, ""); errors.As(err, &fault) {
+			return nil, fmt.Errorf("unexpected status %d: %w", resp.StatusCode, fault)
+		}
+		return nil, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, string(body))
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
-
-	// Parse SOAP response
-	ip := d.parseSOAPIPResponse(string(body), isIPv6)
-	if ip == "" {
-		return "", fmt.Errorf("no IP found in response")
-	}
-
-	return ip, nil
+	return body, nil
 }
 
-func (d *Detector) parseSOAPIPResponse(body string, isIPv6 bool) string {
-	// Simple XML parsing for the IP address
-	type ExternalIPResponse struct {
-		XMLName             xml.Name `xml:"Envelope"`
-		ExternalIPAddress   string   `xml:"Body>GetExternalIPAddressResponse>NewExternalIPAddress"`
-		ExternalIPv6Address string   `xml:"Body>X_AVM_DE_GetExternalIPv6AddressResponse>NewExternalIPv6Address"`
-	}
-
-	var response ExternalIPResponse
-	if err := xml.Unmarshal([]byte(body), &response); err != nil {
-		slog.Debug("Failed to parse SOAP response", "error", err)
-		return ""
-	}
-
+// parseSOAPIPResponse extracts the external address from a TR-064
+// response, matching elements by local name. A SOAP Fault or a missing or
+// empty address is an error.
+func (d *Detector) parseSOAPIPResponse(body string, isIPv6 bool) (string, error) {
+	field := "NewExternalIPAddress"
 	if isIPv6 {
-		return response.ExternalIPv6Address
+		field = "NewExternalIPv6Address"
 	}
-	return response.ExternalIPAddress
+	return soapField([]byte(body), field)
 }
 
 // validateWithExternalServices validates Fritzbox IPs against external services
@@ -244,51 +357,66 @@ func (d *Detector) validateWithExternalServices(ctx context.Context, fritzIPv4,
 	return ipv4, ipv6
 }
 
-// detectFromExternalServices uses public IP detection services as fallback
-func (d *Detector) detectFromExternalServices(ctx context.Context) (ipv4, ipv6 string, err error) {
+// detectFromExternalServices uses public IP detection services as fallback.
+// It also reports which service produced each address.
+func (d *Detector) detectFromExternalServices(ctx context.Context) (ipv4, ipv6 string, sources ipSources, err error) {
 	slog.Info("Falling back to external IP detection services")
 
-	// IPv4 detection services (including showmyip)
-	ipv4Services := []string{
-		"https://api.showmyip.com/",
-		"https://api.ipify.org",
-		"https://checkip.amazonaws.com",
-		"https://ipv4.icanhazip.com",
-		"https://v4.ident.me",
+	d.lastMu.RLock()
+	lastIPv4, lastIPv6 := d.lastIPv4, d.lastIPv6
+	preferredIPv4, preferredIPv6 := d.preferredIPv4, d.preferredIPv6
+	d.lastMu.RUnlock()
+
+	ipv4, sources.ipv4 = d.firstIPFromServices(ctx, d.ipv4Services, preferredIPv4, lastIPv4, isValidIPv4)
+	if ipv4 != "" {
+		slog.Debug("Got IPv4 from external service", "ip", ipv4, "service", sources.ipv4)
 	}
 
-	// IPv6 detection services
-	ipv6Services := []string{
-		"https://api6.ipify.org",
-		"https://ipv6.icanhazip.com",
-		"https://v6.ident.me",
+	ipv6, sources.ipv6 = d.firstIPFromServices(ctx, d.ipv6Services, preferredIPv6, lastIPv6, isValidIPv6)
+	if ipv6 != "" {
+		slog.Debug("Got IPv6 from external service", "ip", ipv6, "service", sources.ipv6)
 	}
 
-	// Try IPv4
-	for _, svc := range ipv4Services {
-		ip, err := d.fetchIPFromService(ctx, svc)
-		if err == nil && isValidIPv4(ip) {
-			slog.Debug("Got IPv4 from external service", "ip", ip, "service", svc)
-			ipv4 = ip
-			break
-		}
+	if ipv4 == "" && ipv6 == "" {
+		return "", "", ipSources{}, fmt.Errorf("could not detect any IP address")
 	}
 
-	// Try IPv6
-	for _, svc := range ipv6Services {
-		ip, err := d.fetchIPFromService(ctx, svc)
-		if err == nil && isValidIPv6(ip) {
-			slog.Debug("Got IPv6 from external service", "ip", ip, "service", svc)
-			ipv6 = ip
-			break
+	return ipv4, ipv6, sources, nil
+}
+
+// firstIPFromServices returns the first valid address from services. The
+// preferred service is asked first and trusted only if it agrees with the
+// last committed address; on failure or disagreement the full chain runs in
+// its configured order.
+func (d *Detector) firstIPFromServices(ctx context.Context, services []string, preferred, last string, valid func(string) bool) (ip, source string) {
+	var preferredIP string
+	preferredTried := false
+	if preferred != "" {
+		preferredTried = true
+		got, err := d.fetchIPFromService(ctx, preferred)
+		if err == nil && valid(got) {
+			if got == last {
+				return got, preferred
+			}
+			preferredIP = got
 		}
+		slog.Debug("Preferred IP source failed or disagreed, trying full chain",
+			"service", preferred, "got", got, "last", last, "error", err)
 	}
 
-	if ipv4 == "" && ipv6 == "" {
-		return "", "", fmt.Errorf("could not detect any IP address")
+	for _, svc := range services {
+		if preferredTried && svc == preferred {
+			if preferredIP != "" {
+				return preferredIP, svc
+			}
+			continue
+		}
+		got, err := d.fetchIPFromService(ctx, svc)
+		if err == nil && valid(got) {
+			return got, svc
+		}
 	}
-
-	return ipv4, ipv6, nil
+	return "", ""
 }
 
 func (d *Detector) fetchIPFromService(ctx context.Context, url string) (string, error) {
@@ -296,6 +424,7 @@ func (d *Detector) fetchIPFromService(ctx context.Context, url string) (string,
 	if err != nil {
 		return "", err
 	}
+	d.setUserAgent(req)
 
 	resp, err := d.httpClient.Do(req)
 	if err != nil {
@@ -6,6 +6,9 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
 	"testing"
 	"time"
 
@@ -108,6 +111,55 @@ func TestDetector_FetchIPFromService(t *testing.T) {
 	}
 }
 
+// TestDetector_UsesProxy verifies the detector's HTTP client sends requests
+// through the configured proxy function.
+func TestDetector_UsesProxy(t *testing.T) {
+	var proxiedHost string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A forward proxy receives the absolute target URL.
+		proxiedHost = r.URL.Host
+		fmt.Fprintln(w, "203.0.113.7")
+	}))
+	defer proxy.Close()
+
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatalf("parse proxy URL: %v", err)
+	}
+	oldProxy := proxyFunc
+	proxyFunc = http.ProxyURL(proxyURL)
+	t.Cleanup(func() { proxyFunc = oldProxy })
+
+	detector := New(&config.Config{})
+	ip, err := detector.fetchIPFromService(context.Background(), "http://ip.example.invalid/")
+	if err != nil {
+		t.Fatalf("fetchIPFromService() unexpected error: %v", err)
+	}
+	if ip != "203.0.113.7" {
+		t.Errorf("fetchIPFromService() = %q, want %q", ip, "203.0.113.7")
+	}
+	if proxiedHost != "ip.example.invalid" {
+		t.Errorf("proxy saw host %q, want %q", proxiedHost, "ip.example.invalid")
+	}
+}
+
+func TestDetector_FetchIPFromService_UserAgent(t *testing.T) {
+	var gotUA string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUA = r.Header.Get("User-Agent")
+		fmt.Fprintln(w, "203.0.113.42")
+	}))
+	defer server.Close()
+
+	detector := New(&config.Config{UserAgent: "stevedore-dyndns/1.2.3 (abc1234)"})
+	if _, err := detector.fetchIPFromService(context.Background(), server.URL); err != nil {
+		t.Fatalf("fetchIPFromService() unexpected error: %v", err)
+	}
+	if gotUA != "stevedore-dyndns/1.2.3 (abc1234)" {
+		t.Errorf("User-Agent = %q, want the configured one", gotUA)
+	}
+}
+
 func TestDetector_FetchIPFromService_Error(t *testing.T) {
 	// Create test server that returns error
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -166,7 +218,7 @@ func TestDetector_DetectFromExternalServices(t *testing.T) {
 
 	// This will fail to reach the real services quickly due to timeout
 	// which is expected behavior for a unit test
-	_, _, _ = detector.detectFromExternalServices(ctx)
+	_, _, _, _ = detector.detectFromExternalServices(ctx)
 }
 
 func TestIsValidIPv4(t *testing.T) {
@@ -234,7 +286,10 @@ func TestParseSOAPIPResponse_IPv4(t *testing.T) {
   </s:Body>
 </s:Envelope>`
 
-	ip := detector.parseSOAPIPResponse(soapResponse, false)
+	ip, err := detector.parseSOAPIPResponse(soapResponse, false)
+	if err != nil {
+		t.Fatalf("parseSOAPIPResponse() error: %v", err)
+	}
 	if ip != "203.0.113.42" {
 		t.Errorf("parseSOAPIPResponse() = %q, want %q", ip, "203.0.113.42")
 	}
@@ -254,7 +309,10 @@ func TestParseSOAPIPResponse_IPv6(t *testing.T) {
   </s:Body>
 </s:Envelope>`
 
-	ip := detector.parseSOAPIPResponse(soapResponse, true)
+	ip, err := detector.parseSOAPIPResponse(soapResponse, true)
+	if err != nil {
+		t.Fatalf("parseSOAPIPResponse() error: %v", err)
+	}
 	if ip != "2001:db8::42" {
 		t.Errorf("parseSOAPIPResponse() = %q, want %q", ip, "2001:db8::42")
 	}
@@ -267,9 +325,9 @@ func TestParseSOAPIPResponse_Invalid(t *testing.T) {
 	// Invalid SOAP response
 	soapResponse := `not valid xml`
 
-	ip := detector.parseSOAPIPResponse(soapResponse, false)
-	if ip != "" {
-		t.Errorf("parseSOAPIPResponse() = %q, want empty for invalid XML", ip)
+	ip, err := detector.parseSOAPIPResponse(soapResponse, false)
+	if err == nil || ip != "" {
+		t.Errorf("parseSOAPIPResponse() = %q, %v, want error for invalid XML", ip, err)
 	}
 }
 
@@ -287,9 +345,9 @@ func TestParseSOAPIPResponse_Empty(t *testing.T) {
   </s:Body>
 </s:Envelope>`
 
-	ip := detector.parseSOAPIPResponse(soapResponse, false)
-	if ip != "" {
-		t.Errorf("parseSOAPIPResponse() = %q, want empty for empty IP", ip)
+	ip, err := detector.parseSOAPIPResponse(soapResponse, false)
+	if err == nil || ip != "" {
+		t.Errorf("parseSOAPIPResponse() = %q, %v, want error for empty IP", ip, err)
 	}
 }
 
@@ -432,3 +490,75 @@ func TestSOAPResponseStructure(t *testing.T) {
 		})
 	}
 }
+
+// TestDetector_PrefersLastAgreeingSource verifies that after a successful
+// external detection the next cycle asks that source first, and that a
+// disagreeing preferred source falls back to the full chain.
+func TestDetector_PrefersLastAgreeingSource(t *testing.T) {
+	var mu sync.Mutex
+	var hits []string
+	answers := map[string]string{"a": "", "b": "203.0.113.42", "c": "203.0.113.99"}
+
+	servers := map[string]*httptest.Server{}
+	for _, name := range []string{"a", "b", "c"} {
+		servers[name] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			hits = append(hits, name)
+			answer := answers[name]
+			mu.Unlock()
+			if answer == "" {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprintln(w, answer)
+		}))
+		defer servers[name].Close()
+	}
+
+	detector := New(&config.Config{})
+	detector.ipv4Services = []string{servers["a"].URL, servers["b"].URL, servers["c"].URL}
+	detector.ipv6Services = nil
+
+	detect := func() (string, []string) {
+		mu.Lock()
+		hits = nil
+		mu.Unlock()
+		ipv4, _, sources, err := detector.detectFromExternalServices(context.Background())
+		if err != nil {
+			t.Fatalf("detectFromExternalServices() error: %v", err)
+		}
+		detector.updateLast(ipv4, "", sources)
+		detector.updatePreferred(sources)
+		mu.Lock()
+		defer mu.Unlock()
+		return ipv4, append([]string(nil), hits...)
+	}
+
+	// Cycle 1: no preference, "a" fails, "b" answers and becomes preferred.
+	ip, order := detect()
+	if ip != "203.0.113.42" || !reflect.DeepEqual(order, []string{"a", "b"}) {
+		t.Fatalf("cycle 1: ip=%q order=%v, want 203.0.113.42 via [a b]", ip, order)
+	}
+	if preferred, _ := detector.PreferredSources(); preferred != servers["b"].URL {
+		t.Errorf("preferred IPv4 source = %q, want b", preferred)
+	}
+
+	// Cycle 2: "b" is tried first and agrees, so nothing else is queried.
+	ip, order = detect()
+	if ip != "203.0.113.42" || !reflect.DeepEqual(order, []string{"b"}) {
+		t.Errorf("cycle 2: ip=%q order=%v, want 203.0.113.42 via [b]", ip, order)
+	}
+
+	// Cycle 3: "b" disagrees with the committed IP; the full chain runs.
+	mu.Lock()
+	answers["a"] = "203.0.113.7"
+	answers["b"] = "203.0.113.8"
+	mu.Unlock()
+	ip, order = detect()
+	if ip != "203.0.113.7" || !reflect.DeepEqual(order, []string{"b", "a"}) {
+		t.Errorf("cycle 3: ip=%q order=%v, want 203.0.113.7 via [b a]", ip, order)
+	}
+	if preferred, _ := detector.PreferredSources(); preferred != servers["a"].URL {
+		t.Errorf("preferred IPv4 source after disagreement = %q, want a", preferred)
+	}
+}
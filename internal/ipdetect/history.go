@@ -0,0 +1,65 @@
+package ipdetect
+
+import "time"
+
+// IPChange is one change of a family's detected address. IP is empty
+// when the family was lost, and Previous is empty for the first address.
+type IPChange struct {
+	Time     time.Time `json:"time"`
+	Family   string    `json:"family"`
+	IP       string    `json:"ip"`
+	Previous string    `json:"previous,omitempty"`
+	// Source is the detection method or external service that reported
+	// IP, e.g. "fritzbox" or "https://api.ipify.org".
+	Source string `json:"source,omitempty"`
+}
+
+// ipHistory is a ring buffer of the most recent address changes. A nil
+// value records nothing.
+type ipHistory struct {
+	entries []IPChange
+	// next is the slot the next change is written to; once the buffer
+	// is full it is also the oldest entry.
+	next int
+	full bool
+}
+
+// newIPHistory returns a history holding the last size changes, or nil
+// when size is not positive.
+func newIPHistory(size int) *ipHistory {
+	if size <= 0 {
+		return nil
+	}
+	return &ipHistory{entries: make([]IPChange, size)}
+}
+
+// add records a change, overwriting the oldest one when full.
+func (h *ipHistory) add(change IPChange) {
+	if h == nil {
+		return
+	}
+	h.entries[h.next] = change
+	h.next = (h.next + 1) % len(h.entries)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// list returns the recorded changes, oldest first.
+func (h *ipHistory) list() []IPChange {
+	if h == nil {
+		return nil
+	}
+	if !h.full {
+		return append([]IPChange(nil), h.entries[:h.next]...)
+	}
+	return append(append([]IPChange(nil), h.entries[h.next:]...), h.entries[:h.next]...)
+}
+
+// History returns the most recent address changes, oldest first, up to
+// IP_HISTORY_SIZE of them.
+func (d *Detector) History() []IPChange {
+	d.lastMu.RLock()
+	defer d.lastMu.RUnlock()
+	return d.history.list()
+}
@@ -0,0 +1,67 @@
+package ipdetect
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+)
+
+// TestDetector_History verifies that address changes are recorded in
+// order with their previous address and source, that an unchanged
+// detection adds nothing, and that the buffer keeps only the newest
+// IP_HISTORY_SIZE changes.
+func TestDetector_History(t *testing.T) {
+	cfg := &config.Config{IPHistorySize: 3}
+	detector := New(cfg)
+
+	for _, ipv4 := range []string{"203.0.113.1", "203.0.113.1", "203.0.113.2", "203.0.113.3", "203.0.113.4"} {
+		cfg.ManualIPv4 = ipv4
+		if _, _, err := detector.Detect(context.Background()); err != nil {
+			t.Fatalf("Detect() error: %v", err)
+		}
+	}
+
+	type change struct{ family, ip, previous, source string }
+	var got []change
+	history := detector.History()
+	for i, c := range history {
+		got = append(got, change{c.Family, c.IP, c.Previous, c.Source})
+		if c.Time.IsZero() || (i > 0 && c.Time.Before(history[i-1].Time)) {
+			t.Errorf("change %d time = %v, want set and not before the previous change", i, c.Time)
+		}
+	}
+	want := []change{
+		{"ipv4", "203.0.113.2", "203.0.113.1", "manual"},
+		{"ipv4", "203.0.113.3", "203.0.113.2", "manual"},
+		{"ipv4", "203.0.113.4", "203.0.113.3", "manual"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("History() = %+v, want %+v", got, want)
+	}
+}
+
+func TestIPHistory_Ring(t *testing.T) {
+	h := newIPHistory(2)
+	if got := h.list(); len(got) != 0 {
+		t.Errorf("empty history = %+v", got)
+	}
+	for _, ip := range []string{"a", "b", "c", "d", "e"} {
+		h.add(IPChange{IP: ip})
+	}
+	var ips []string
+	for _, c := range h.list() {
+		ips = append(ips, c.IP)
+	}
+	if want := []string{"d", "e"}; !reflect.DeepEqual(ips, want) {
+		t.Errorf("list() = %v, want %v", ips, want)
+	}
+
+	// A disabled history records nothing.
+	var disabled *ipHistory
+	disabled.add(IPChange{IP: "a"})
+	if got := disabled.list(); got != nil {
+		t.Errorf("disabled history = %+v, want nil", got)
+	}
+}
@@ -0,0 +1,72 @@
+package ipdetect
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/netaddr"
+)
+
+// readIPFile reads the addresses an external updater wrote to path. The
+// file holds one address per line (blank lines and "#" comments are
+// ignored) or a JSON object {"ipv4": "...", "ipv6": "..."}. Every address
+// must be public, and at most one per family is allowed. The file is
+// re-read on every call, so updates are picked up on the next cycle.
+func readIPFile(path string) (ipv4, ipv6 string, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read IP file: %w", err)
+	}
+
+	var values []string
+	if trimmed := bytes.TrimSpace(data); bytes.HasPrefix(trimmed, []byte("{")) {
+		var doc struct {
+			IPv4 string `json:"ipv4"`
+			IPv6 string `json:"ipv6"`
+		}
+		if err := json.Unmarshal(trimmed, &doc); err != nil {
+			return "", "", fmt.Errorf("failed to parse IP file %s: %w", path, err)
+		}
+		values = []string{doc.IPv4, doc.IPv6}
+	} else {
+		for _, line := range strings.Split(string(data), "\n") {
+			line, _, _ = strings.Cut(line, "#")
+			values = append(values, line)
+		}
+	}
+
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return "", "", fmt.Errorf("IP file %s: %q is not an IP address", path, value)
+		}
+		addr = addr.Unmap()
+		if !netaddr.IsPublic(addr) {
+			return "", "", fmt.Errorf("IP file %s: %q is not a public IP address", path, value)
+		}
+		if addr.Is4() {
+			if ipv4 != "" {
+				return "", "", fmt.Errorf("IP file %s has more than one IPv4 address", path)
+			}
+			ipv4 = addr.String()
+		} else {
+			if ipv6 != "" {
+				return "", "", fmt.Errorf("IP file %s has more than one IPv6 address", path)
+			}
+			ipv6 = addr.String()
+		}
+	}
+
+	if ipv4 == "" && ipv6 == "" {
+		return "", "", fmt.Errorf("IP file %s contains no IP address", path)
+	}
+	return ipv4, ipv6, nil
+}
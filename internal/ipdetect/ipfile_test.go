@@ -0,0 +1,108 @@
+package ipdetect
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+)
+
+func writeIPFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "public-ip")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("write IP file: %v", err)
+	}
+	return path
+}
+
+func TestReadIPFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		wantIPv4 string
+		wantIPv6 string
+		wantErr  bool
+	}{
+		{name: "lines", content: "203.0.113.7\n2001:4860::1\n", wantIPv4: "203.0.113.7", wantIPv6: "2001:4860::1"},
+		{name: "comments", content: "# written by modem-sync\n\n203.0.113.7 # wan\n", wantIPv4: "203.0.113.7"},
+		{name: "json", content: `{"ipv4": "203.0.113.7", "ipv6": "2001:4860::1"}`, wantIPv4: "203.0.113.7", wantIPv6: "2001:4860::1"},
+		{name: "json ipv6 only", content: `{"ipv6": "2001:4860::1"}`, wantIPv6: "2001:4860::1"},
+		{name: "private", content: "192.168.1.10\n", wantErr: true},
+		{name: "cgnat", content: "100.64.1.1\n", wantErr: true},
+		{name: "garbage", content: "not-an-ip\n", wantErr: true},
+		{name: "two ipv4", content: "203.0.113.7\n203.0.113.8\n", wantErr: true},
+		{name: "empty", content: "\n", wantErr: true},
+		{name: "bad json", content: `{"ipv4": `, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ipv4, ipv6, err := readIPFile(writeIPFile(t, tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readIPFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if ipv4 != tt.wantIPv4 || ipv6 != tt.wantIPv6 {
+				t.Errorf("readIPFile() = %q, %q; want %q, %q", ipv4, ipv6, tt.wantIPv4, tt.wantIPv6)
+			}
+		})
+	}
+}
+
+// TestDetector_Detect_IPFile verifies a valid file is used as-is and
+// re-read every cycle, while an invalid or missing file falls through to
+// the external services.
+func TestDetector_Detect_IPFile(t *testing.T) {
+	fritzbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer fritzbox.Close()
+	external := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "198.51.100.1")
+	}))
+	defer external.Close()
+
+	path := writeIPFile(t, "203.0.113.7\n")
+	detector := New(&config.Config{IPFile: path})
+	detector.discoveredControlURL = fritzbox.URL
+	detector.ipv4Services = []string{external.URL}
+	detector.ipv6Services = nil
+
+	detect := func() string {
+		t.Helper()
+		ipv4, _, err := detector.Detect(context.Background())
+		if err != nil {
+			t.Fatalf("Detect() error: %v", err)
+		}
+		return ipv4
+	}
+
+	if got := detect(); got != "203.0.113.7" {
+		t.Errorf("valid file: IPv4 = %q, want 203.0.113.7", got)
+	}
+
+	if err := os.WriteFile(path, []byte("203.0.113.9\n"), 0644); err != nil {
+		t.Fatalf("rewrite IP file: %v", err)
+	}
+	if got := detect(); got != "203.0.113.9" {
+		t.Errorf("rewritten file: IPv4 = %q, want 203.0.113.9", got)
+	}
+
+	if err := os.WriteFile(path, []byte("10.0.0.1\n"), 0644); err != nil {
+		t.Fatalf("rewrite IP file: %v", err)
+	}
+	if got := detect(); got != "198.51.100.1" {
+		t.Errorf("invalid file: IPv4 = %q, want the external service's 198.51.100.1", got)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("remove IP file: %v", err)
+	}
+	if got := detect(); got != "198.51.100.1" {
+		t.Errorf("missing file: IPv4 = %q, want the external service's 198.51.100.1", got)
+	}
+}
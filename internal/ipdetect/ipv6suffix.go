@@ -0,0 +1,80 @@
+package ipdetect
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"strconv"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/netaddr"
+)
+
+// applyIPv6Suffix builds the published AAAA from the delegated prefix and
+// IPV6_SUFFIX. Routers that only delegate a prefix report their own WAN
+// address, and the external services see whatever (often temporary)
+// address the host egresses from, so neither is the host's stable
+// address. The prefix comes from the Fritzbox when it reports one,
+// otherwise the first IPV6_PREFIX_LENGTH bits of the detected address are
+// used. Returns "" when no prefix is known or the result is not a global
+// address.
+func (d *Detector) applyIPv6Suffix(ctx context.Context, detected string) string {
+	prefix, err := d.fritzboxIPv6Prefix(ctx)
+	if err != nil {
+		slog.Debug("Fritzbox IPv6 prefix unavailable, using the detected address", "error", err)
+		addr, err := netip.ParseAddr(detected)
+		if err != nil || !addr.Is6() || addr.Is4In6() {
+			return ""
+		}
+		prefix = netip.PrefixFrom(addr, d.cfg.IPv6PrefixLength).Masked()
+	}
+
+	ipv6 := combineIPv6(prefix, d.cfg.IPv6Suffix)
+	if !netaddr.IsPublic(ipv6) {
+		slog.Error("IPv6 address built from prefix and IPV6_SUFFIX is not global, not publishing IPv6",
+			"prefix", prefix, "suffix", d.cfg.IPv6Suffix, "ipv6", ipv6)
+		return ""
+	}
+	slog.Debug("Built IPv6 from prefix and IPV6_SUFFIX", "prefix", prefix, "suffix", d.cfg.IPv6Suffix, "ipv6", ipv6)
+	return ipv6.String()
+}
+
+// combineIPv6 returns the address with the prefix bits of prefix and the
+// remaining bits of suffix.
+func combineIPv6(prefix netip.Prefix, suffix netip.Addr) netip.Addr {
+	p := prefix.Addr().As16()
+	s := suffix.As16()
+	var out [16]byte
+	for i := range out {
+		bits := min(max(prefix.Bits()-8*i, 0), 8)
+		mask := byte(0xff << (8 - bits))
+		out[i] = p[i]&mask | s[i]&^mask
+	}
+	return netip.AddrFrom16(out)
+}
+
+// fritzboxIPv6Prefix asks the Fritzbox for the IPv6 prefix delegated to the
+// LAN (X_AVM_DE_GetIPv6Prefix).
+func (d *Detector) fritzboxIPv6Prefix(ctx context.Context) (netip.Prefix, error) {
+	body, err := d.fritzboxSOAP(ctx, d.fritzboxControlURL(), "X_AVM_DE_GetIPv6Prefix")
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	rawPrefix, err := soapField(body, "NewIPv6Prefix")
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	rawLength, err := soapField(body, "NewPrefixLength")
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr, err := netip.ParseAddr(rawPrefix)
+	if err != nil || !addr.Is6() || addr.Is4In6() {
+		return netip.Prefix{}, fmt.Errorf("invalid IPv6 prefix %q", rawPrefix)
+	}
+	bits, err := strconv.Atoi(rawLength)
+	if err != nil || bits <= 0 || bits > 128 {
+		return netip.Prefix{}, fmt.Errorf("invalid IPv6 prefix length %q", rawLength)
+	}
+	return netip.PrefixFrom(addr, bits).Masked(), nil
+}
@@ -0,0 +1,131 @@
+package ipdetect
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+)
+
+func TestCombineIPv6(t *testing.T) {
+	tests := []struct {
+		prefix string
+		suffix string
+		want   string
+	}{
+		{"2001:db8:1:2::/64", "::1234:5678:9abc:def0", "2001:db8:1:2:1234:5678:9abc:def0"},
+		{"2001:db8:1:2:ffff::/64", "::1", "2001:db8:1:2::1"},
+		{"2001:db8:1:ab00::/56", "::cd:0:0:0:1", "2001:db8:1:abcd::1"},
+		{"2001:db8:1:ab80::/57", "::5:0:0:0:1", "2001:db8:1:ab85::1"},
+	}
+	for _, tt := range tests {
+		got := combineIPv6(netip.MustParsePrefix(tt.prefix), netip.MustParseAddr(tt.suffix))
+		if got.String() != tt.want {
+			t.Errorf("combineIPv6(%s, %s) = %s, want %s", tt.prefix, tt.suffix, got, tt.want)
+		}
+	}
+}
+
+// TestDetector_Detect_IPv6Suffix verifies that with IPV6_SUFFIX the
+// published AAAA is the delegated prefix plus the suffix, taking the
+// prefix from the Fritzbox when it reports one and from the detected
+// address otherwise.
+func TestDetector_Detect_IPv6Suffix(t *testing.T) {
+	newFritzbox := func(delegated bool) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Header.Get("SOAPAction") {
+			case wanIPConnectionService + "#X_AVM_DE_GetExternalIPv6Address":
+				// The router's own WAN address, not the host's.
+				fmt.Fprint(w, `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>
+<u:X_AVM_DE_GetExternalIPv6AddressResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1">
+<NewExternalIPv6Address>2001:db8:ffff::1</NewExternalIPv6Address>
+</u:X_AVM_DE_GetExternalIPv6AddressResponse></s:Body></s:Envelope>`)
+			case wanIPConnectionService + "#X_AVM_DE_GetIPv6Prefix":
+				if !delegated {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				fmt.Fprint(w, `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>
+<u:X_AVM_DE_GetIPv6PrefixResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1">
+<NewIPv6Prefix>2001:db8:1:ab00::</NewIPv6Prefix>
+<NewPrefixLength>56</NewPrefixLength>
+</u:X_AVM_DE_GetIPv6PrefixResponse></s:Body></s:Envelope>`)
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}))
+	}
+
+	tests := []struct {
+		name      string
+		delegated bool
+		suffix    string
+		want      string
+	}{
+		{name: "fritzbox_prefix", delegated: true, suffix: "::cd:0:0:0:42", want: "2001:db8:1:abcd::42"},
+		{name: "detected_prefix", suffix: "::1234:5678:9abc:def0", want: "2001:db8:ffff:0:1234:5678:9abc:def0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fritzbox := newFritzbox(tt.delegated)
+			defer fritzbox.Close()
+
+			detector := New(&config.Config{IPv6Suffix: netip.MustParseAddr(tt.suffix), IPv6PrefixLength: 64})
+			detector.discoveredControlURL = fritzbox.URL
+			detector.ipv4Services = nil
+			detector.ipv6Services = nil
+
+			_, ipv6, err := detector.Detect(context.Background())
+			if err != nil {
+				t.Fatalf("Detect() error: %v", err)
+			}
+			if ipv6 != tt.want {
+				t.Errorf("Detect() ipv6 = %q, want %q", ipv6, tt.want)
+			}
+			if _, last, _ := detector.GetLastKnown(); last != tt.want {
+				t.Errorf("GetLastKnown() ipv6 = %q, want %q", last, tt.want)
+			}
+		})
+	}
+}
+
+// TestDetector_Detect_IPv6SuffixNotGlobal verifies that a combined address
+// outside the global unicast space is not published.
+func TestDetector_Detect_IPv6SuffixNotGlobal(t *testing.T) {
+	fritzbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("SOAPAction") {
+		case wanIPConnectionService + "#GetExternalIPAddress":
+			fmt.Fprint(w, `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>
+<u:GetExternalIPAddressResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1">
+<NewExternalIPAddress>203.0.113.42</NewExternalIPAddress>
+</u:GetExternalIPAddressResponse></s:Body></s:Envelope>`)
+		case wanIPConnectionService + "#X_AVM_DE_GetIPv6Prefix":
+			// A unique local prefix.
+			fmt.Fprint(w, `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>
+<u:X_AVM_DE_GetIPv6PrefixResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1">
+<NewIPv6Prefix>fd00:1:2:3::</NewIPv6Prefix>
+<NewPrefixLength>64</NewPrefixLength>
+</u:X_AVM_DE_GetIPv6PrefixResponse></s:Body></s:Envelope>`)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer fritzbox.Close()
+
+	detector := New(&config.Config{IPv6Suffix: netip.MustParseAddr("::1"), IPv6PrefixLength: 64})
+	detector.discoveredControlURL = fritzbox.URL
+	detector.ipv4Services = nil
+	detector.ipv6Services = nil
+
+	ipv4, ipv6, err := detector.Detect(context.Background())
+	if err != nil {
+		t.Fatalf("Detect() error: %v", err)
+	}
+	if ipv4 != "203.0.113.42" || ipv6 != "" {
+		t.Errorf("Detect() = %q, %q; want 203.0.113.42 and no IPv6", ipv4, ipv6)
+	}
+}
@@ -0,0 +1,106 @@
+package ipdetect
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// soapFault is a SOAP Fault body. TR-064 devices put the UPnP error code
+// and description in its detail.
+type soapFault struct {
+	Code            string
+	String          string
+	UPnPCode        string
+	UPnPDescription string
+}
+
+func (f *soapFault) Error() string {
+	msg := "SOAP fault"
+	if f.Code != "" {
+		msg += " " + f.Code
+	}
+	if f.String != "" {
+		msg += ": " + f.String
+	}
+	if f.UPnPCode != "" || f.UPnPDescription != "" {
+		msg += fmt.Sprintf(" (UPnP error %s: %s)", f.UPnPCode, f.UPnPDescription)
+	}
+	return msg
+}
+
+// scanSOAP walks a SOAP envelope and returns the text of the first element
+// whose local name is field. Elements are matched by local name wherever
+// they appear, so differently namespaced or prefixed firmware responses
+// parse the same. A Fault body is returned as a *soapFault error.
+func scanSOAP(body []byte, field string) (value string, found bool, err error) {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	var (
+		path  []string
+		text  strings.Builder
+		fault *soapFault
+	)
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", false, fmt.Errorf("failed to parse SOAP response: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			path = append(path, t.Name.Local)
+			text.Reset()
+			if t.Name.Local == "Fault" && fault == nil {
+				fault = &soapFault{}
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			name, content := t.Name.Local, strings.TrimSpace(text.String())
+			text.Reset()
+			inFault := false
+			for _, p := range path {
+				inFault = inFault || p == "Fault"
+			}
+			switch {
+			case inFault && name == "faultcode":
+				fault.Code = content
+			case inFault && name == "faultstring":
+				fault.String = content
+			case inFault && name == "errorCode":
+				fault.UPnPCode = content
+			case inFault && name == "errorDescription":
+				fault.UPnPDescription = content
+			case !inFault && !found && field != "" && name == field:
+				value, found = content, true
+			}
+			if len(path) > 0 {
+				path = path[:len(path)-1]
+			}
+		}
+	}
+	if fault != nil {
+		return "", false, fault
+	}
+	return value, found, nil
+}
+
+// soapField returns the non-empty text of the element named field.
+func soapField(body []byte, field string) (string, error) {
+	value, found, err := scanSOAP(body, field)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", fmt.Errorf("no %s in SOAP response", field)
+	}
+	if value == "" {
+		return "", fmt.Errorf("empty %s in SOAP response", field)
+	}
+	return value, nil
+}
@@ -0,0 +1,107 @@
+package ipdetect
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+)
+
+const upnpFaultResponse = `<?xml version="1.0"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/">
+  <s:Body>
+    <s:Fault>
+      <faultcode>s:Client</faultcode>
+      <faultstring>UPnPError</faultstring>
+      <detail>
+        <UPnPError xmlns="urn:schemas-upnp-org:control-1-0">
+          <errorCode>401</errorCode>
+          <errorDescription>Invalid Action</errorDescription>
+        </UPnPError>
+      </detail>
+    </s:Fault>
+  </s:Body>
+</s:Envelope>`
+
+func TestParseSOAPIPResponse_Namespaced(t *testing.T) {
+	detector := New(&config.Config{})
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{
+			name: "default namespace",
+			body: `<?xml version="1.0"?>
+<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/">
+  <Body>
+    <GetExternalIPAddressResponse xmlns="urn:schemas-upnp-org:service:WANIPConnection:1">
+      <NewExternalIPAddress>203.0.113.42</NewExternalIPAddress>
+    </GetExternalIPAddressResponse>
+  </Body>
+</Envelope>`,
+		},
+		{
+			name: "other prefixes",
+			body: `<?xml version="1.0"?>
+<SOAP-ENV:Envelope xmlns:SOAP-ENV="http://schemas.xmlsoap.org/soap/envelope/">
+  <SOAP-ENV:Body>
+    <m:GetExternalIPAddressResponse xmlns:m="urn:dslforum-org:service:WANIPConnection:1">
+      <m:NewExternalIPAddress> 203.0.113.42 </m:NewExternalIPAddress>
+    </m:GetExternalIPAddressResponse>
+  </SOAP-ENV:Body>
+</SOAP-ENV:Envelope>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip, err := detector.parseSOAPIPResponse(tt.body, false)
+			if err != nil {
+				t.Fatalf("parseSOAPIPResponse() error: %v", err)
+			}
+			if ip != "203.0.113.42" {
+				t.Errorf("parseSOAPIPResponse() = %q, want %q", ip, "203.0.113.42")
+			}
+		})
+	}
+}
+
+func TestParseSOAPIPResponse_Fault(t *testing.T) {
+	detector := New(&config.Config{})
+
+	ip, err := detector.parseSOAPIPResponse(upnpFaultResponse, false)
+	if err == nil {
+		t.Fatalf("parseSOAPIPResponse() = %q, want fault error", ip)
+	}
+	var fault *soapFault
+	if !errors.As(err, &fault) {
+		t.Fatalf("error %v is not a SOAP fault", err)
+	}
+	want := "SOAP fault s:Client: UPnPError (UPnP error 401: Invalid Action)"
+	if err.Error() != want {
+		t.Errorf("error = %q, want %q", err.Error(), want)
+	}
+}
+
+func TestDetector_FritzboxGetExternalIP_FaultStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(upnpFaultResponse))
+	}))
+	defer server.Close()
+
+	detector := New(&config.Config{})
+	_, err := detector.fritzboxGetExternalIP(context.Background(), server.URL, false)
+	if err == nil {
+		t.Fatal("fritzboxGetExternalIP() should fail on a SOAP fault")
+	}
+	if !strings.Contains(err.Error(), "UPnP error 401: Invalid Action") {
+		t.Errorf("error = %q, want the UPnP fault description", err.Error())
+	}
+}
@@ -0,0 +1,194 @@
+package ipdetect
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// ssdpMulticastAddr is the standard SSDP discovery address.
+	ssdpMulticastAddr = "239.255.255.250:1900"
+	// wanIPConnectionService is the UPnP IGD service exposing
+	// GetExternalIPAddress (and AVM's X_AVM_DE_GetExternalIPv6Address).
+	wanIPConnectionService = "urn:schemas-upnp-org:service:WANIPConnection:1"
+	// ssdpSearchTimeout bounds how long discovery waits for responses.
+	ssdpSearchTimeout = 3 * time.Second
+)
+
+// DiscoverFritzbox locates the router's WANIPConnection control URL via
+// SSDP (UPnP IGD) and uses it for subsequent TR-064 queries instead of the
+// configured FRITZBOX_HOST. On failure the configured host keeps being used.
+// It returns the control URL in effect after discovery.
+func (d *Detector) DiscoverFritzbox(ctx context.Context) string {
+	controlURL, err := d.discoverIGDControlURL(ctx, d.ssdpAddr, ssdpSearchTimeout)
+	if err != nil {
+		slog.Warn("Fritzbox auto-discovery failed, using configured host",
+			"host", d.cfg.FritzboxHost, "error", err)
+		return d.fritzboxControlURL()
+	}
+
+	d.lastMu.Lock()
+	d.discoveredControlURL = controlURL
+	d.lastMu.Unlock()
+
+	slog.Info("Fritzbox discovered via SSDP", "control_url", controlURL)
+	return controlURL
+}
+
+// fritzboxControlURL returns the discovered control URL, or the default
+// Fritzbox IGD control URL on the configured host.
+func (d *Detector) fritzboxControlURL() string {
+	d.lastMu.RLock()
+	defer d.lastMu.RUnlock()
+	if d.discoveredControlURL != "" {
+		return d.discoveredControlURL
+	}
+	return fmt.Sprintf("http://%s:49000/igdupnp/control/WANIPConn1", d.cfg.FritzboxHost)
+}
+
+// discoverIGDControlURL sends an SSDP M-SEARCH for the WANIPConnection
+// service to ssdpAddr and resolves the control URL from the device
+// description of the first responder that advertises it.
+func (d *Detector) discoverIGDControlURL(ctx context.Context, ssdpAddr string, timeout time.Duration) (string, error) {
+	raddr, err := net.ResolveUDPAddr("udp4", ssdpAddr)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve SSDP address: %w", err)
+	}
+
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to open SSDP socket: %w", err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return "", fmt.Errorf("failed to set SSDP deadline: %w", err)
+	}
+
+	search := strings.Join([]string{
+		"M-SEARCH * HTTP/1.1",
+		"HOST: " + ssdpMulticastAddr,
+		`MAN: "ssdp:discover"`,
+		"MX: 2",
+		"ST: " + wanIPConnectionService,
+		"", "",
+	}, "\r\n")
+	if _, err := conn.WriteToUDP([]byte(search), raddr); err != nil {
+		return "", fmt.Errorf("failed to send SSDP search: %w", err)
+	}
+
+	buf := make([]byte, 2048)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return "", fmt.Errorf("no IGD responded to SSDP search: %w", err)
+		}
+
+		location, err := parseSSDPLocation(buf[:n])
+		if err != nil {
+			slog.Debug("Ignoring SSDP response", "error", err)
+			continue
+		}
+
+		controlURL, err := d.fetchControlURL(ctx, location)
+		if err != nil {
+			slog.Debug("Ignoring SSDP responder", "location", location, "error", err)
+			continue
+		}
+		return controlURL, nil
+	}
+}
+
+// parseSSDPLocation extracts the LOCATION header from an SSDP response.
+func parseSSDPLocation(packet []byte) (string, error) {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(packet)), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse SSDP response: %w", err)
+	}
+	defer resp.Body.Close()
+
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return "", fmt.Errorf("SSDP response has no LOCATION header")
+	}
+	return location, nil
+}
+
+// upnpDevice is the subset of a UPnP device description needed to find
+// the WANIPConnection control URL in a nested device tree.
+type upnpDevice struct {
+	Services []struct {
+		ServiceType string `xml:"serviceType"`
+		ControlURL  string `xml:"controlURL"`
+	} `xml:"serviceList>service"`
+	Devices []upnpDevice `xml:"deviceList>device"`
+}
+
+func (dev upnpDevice) findControlURL(serviceType string) string {
+	for _, svc := range dev.Services {
+		if svc.ServiceType == serviceType {
+			return svc.ControlURL
+		}
+	}
+	for _, child := range dev.Devices {
+		if u := child.findControlURL(serviceType); u != "" {
+			return u
+		}
+	}
+	return ""
+}
+
+// fetchControlURL downloads the device description at location and returns
+// the absolute WANIPConnection control URL.
+func (d *Detector) fetchControlURL(ctx context.Context, location string) (string, error) {
+	base, err := url.Parse(location)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") {
+		return "", fmt.Errorf("invalid LOCATION %q", location)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", location, nil)
+	if err != nil {
+		return "", err
+	}
+	d.setUserAgent(req)
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var desc struct {
+		Device upnpDevice `xml:"device"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&desc); err != nil {
+		return "", fmt.Errorf("failed to parse device description: %w", err)
+	}
+
+	controlPath := desc.Device.findControlURL(wanIPConnectionService)
+	if controlPath == "" {
+		return "", fmt.Errorf("device description has no %s service", wanIPConnectionService)
+	}
+	ref, err := url.Parse(controlPath)
+	if err != nil {
+		return "", fmt.Errorf("invalid controlURL %q: %w", controlPath, err)
+	}
+	return base.ResolveReference(ref).String(), nil
+}
@@ -0,0 +1,150 @@
+package ipdetect
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+)
+
+// startFakeSSDPResponder answers every M-SEARCH for the WANIPConnection
+// service with the given LOCATION and returns the responder address.
+func startFakeSSDPResponder(t *testing.T, location string) string {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("Failed to listen for SSDP: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			req := string(buf[:n])
+			if !strings.HasPrefix(req, "M-SEARCH") || !strings.Contains(req, wanIPConnectionService) {
+				continue
+			}
+			resp := "HTTP/1.1 200 OK\r\n" +
+				"CACHE-CONTROL: max-age=1800\r\n" +
+				"ST: " + wanIPConnectionService + "\r\n" +
+				"LOCATION: " + location + "\r\n" +
+				"\r\n"
+			_, _ = conn.WriteToUDP([]byte(resp), from)
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+// TestDetector_DiscoverFritzbox_UsesDiscoveredControlURL verifies that the
+// control URL found through SSDP and the device description is used for
+// the TR-064 query instead of the configured host.
+func TestDetector_DiscoverFritzbox_UsesDiscoveredControlURL(t *testing.T) {
+	var controlHits int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/igddesc.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprint(w, `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <device>
+    <deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType>
+    <deviceList>
+      <device>
+        <deviceType>urn:schemas-upnp-org:device:WANDevice:1</deviceType>
+        <deviceList>
+          <device>
+            <deviceType>urn:schemas-upnp-org:device:WANConnectionDevice:1</deviceType>
+            <serviceList>
+              <service>
+                <serviceType>urn:schemas-upnp-org:service:WANIPConnection:1</serviceType>
+                <controlURL>/discovered/control/WANIPConn1</controlURL>
+              </service>
+            </serviceList>
+          </device>
+        </deviceList>
+      </device>
+    </deviceList>
+  </device>
+</root>`)
+	})
+	mux.HandleFunc("/discovered/control/WANIPConn1", func(w http.ResponseWriter, r *http.Request) {
+		controlHits++
+		if r.Header.Get("SOAPAction") != wanIPConnectionService+"#GetExternalIPAddress" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprint(w, `<?xml version="1.0"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/">
+  <s:Body>
+    <u:GetExternalIPAddressResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1">
+      <NewExternalIPAddress>203.0.113.42</NewExternalIPAddress>
+    </u:GetExternalIPAddressResponse>
+  </s:Body>
+</s:Envelope>`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	detector := New(&config.Config{
+		// Unroutable (TEST-NET-1): must not be used once discovery succeeds.
+		FritzboxHost:         "192.0.2.1",
+		FritzboxAutodiscover: true,
+	})
+	detector.ssdpAddr = startFakeSSDPResponder(t, server.URL+"/igddesc.xml")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	want := server.URL + "/discovered/control/WANIPConn1"
+	if got := detector.DiscoverFritzbox(ctx); got != want {
+		t.Fatalf("DiscoverFritzbox() = %q, want %q", got, want)
+	}
+
+	ipv4, _, err := detector.detectFromFritzbox(ctx)
+	if err != nil {
+		t.Fatalf("detectFromFritzbox() unexpected error: %v", err)
+	}
+	if ipv4 != "203.0.113.42" {
+		t.Errorf("ipv4 = %q, want %q", ipv4, "203.0.113.42")
+	}
+	if controlHits == 0 {
+		t.Error("discovered control URL was never queried")
+	}
+}
+
+// TestDetector_DiscoverFritzbox_FallsBackToHost verifies the configured
+// host stays in use when no router answers the SSDP search.
+func TestDetector_DiscoverFritzbox_FallsBackToHost(t *testing.T) {
+	// A bound but silent UDP socket: the search is sent, nothing answers.
+	silent, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer silent.Close()
+
+	detector := New(&config.Config{FritzboxHost: "192.168.178.1", FritzboxAutodiscover: true})
+	detector.ssdpAddr = silent.LocalAddr().String()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	want := "http://192.168.178.1:49000/igdupnp/control/WANIPConn1"
+	if got := detector.DiscoverFritzbox(ctx); got != want {
+		t.Errorf("DiscoverFritzbox() = %q, want fallback %q", got, want)
+	}
+	if got := detector.fritzboxControlURL(); got != want {
+		t.Errorf("fritzboxControlURL() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,59 @@
+package ipdetect
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// ConnectionUptime returns how long the router's WAN connection has been up,
+// as reported by the WANIPConnection GetStatusInfo action.
+func (d *Detector) ConnectionUptime(ctx context.Context) (time.Duration, error) {
+	body, err := d.fritzboxSOAP(ctx, d.fritzboxControlURL(), "GetStatusInfo")
+	if err != nil {
+		return 0, fmt.Errorf("failed to query connection status: %w", err)
+	}
+
+	uptime, err := soapField(body, "NewUptime")
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse connection status: %w", err)
+	}
+	seconds, err := strconv.ParseUint(uptime, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid connection uptime: %q", uptime)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// WatchReconnects polls the connection uptime every interval and calls
+// onReconnect when it goes backwards, i.e. the router re-established its
+// PPPoE session and most likely got a new IP. Failed polls are logged and
+// skipped. It blocks until ctx is cancelled.
+func (d *Detector) WatchReconnects(ctx context.Context, interval time.Duration, onReconnect func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last time.Duration
+	known := false
+	for {
+		uptime, err := d.ConnectionUptime(ctx)
+		if err != nil {
+			slog.Debug("Failed to read Fritzbox connection uptime", "error", err)
+		} else {
+			if known && uptime < last {
+				slog.Info("Fritzbox connection re-established, triggering immediate update",
+					"uptime", uptime, "previous_uptime", last)
+				onReconnect()
+			}
+			last, known = uptime, true
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package ipdetect
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
+)
+
+// TestDetector_WatchReconnects verifies a drop in the reported connection
+// uptime triggers exactly one reconnect callback.
+func TestDetector_WatchReconnects(t *testing.T) {
+	var mu sync.Mutex
+	uptimes := []int{100, 130, 5, 35}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("SOAPAction") != wanIPConnectionService+"#GetStatusInfo" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		mu.Lock()
+		uptime := uptimes[0]
+		if len(uptimes) > 1 {
+			uptimes = uptimes[1:]
+		}
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprintf(w, `<?xml version="1.0"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/">
+  <s:Body>
+    <u:GetStatusInfoResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1">
+      <NewConnectionStatus>Connected</NewConnectionStatus>
+      <NewLastConnectionError>ERROR_NONE</NewLastConnectionError>
+      <NewUptime>%d</NewUptime>
+    </u:GetStatusInfoResponse>
+  </s:Body>
+</s:Envelope>`, uptime)
+	}))
+	defer server.Close()
+
+	detector := New(&config.Config{FritzboxHost: "192.0.2.1"})
+	detector.discoveredControlURL = server.URL
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	reconnects := make(chan struct{}, 4)
+	go detector.WatchReconnects(ctx, 10*time.Millisecond, func() {
+		reconnects <- struct{}{}
+	})
+
+	select {
+	case <-reconnects:
+	case <-ctx.Done():
+		t.Fatal("uptime reset did not trigger a reconnect")
+	}
+
+	// The remaining polls report a growing (then constant) uptime.
+	select {
+	case <-reconnects:
+		t.Error("reconnect triggered more than once")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
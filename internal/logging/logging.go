@@ -0,0 +1,150 @@
+// Package logging configures slog with a global level plus optional
+// per-component overrides (LOG_LEVEL_CLOUDFLARE, LOG_LEVEL_DISCOVERY, ...).
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// EnvPrefix is the prefix of per-component override variables. The rest of
+// the variable name, lowercased, is the component (package) name.
+const EnvPrefix = "LOG_LEVEL_"
+
+// ParseLevel accepts a named level (debug, info, warn/warning, error) or a
+// numeric slog level such as -4 or 8.
+func ParseLevel(s string) (slog.Level, error) {
+	s = strings.TrimSpace(s)
+	switch strings.ToLower(s) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return slog.LevelInfo, fmt.Errorf("invalid log level %q: must be debug, info, warn, error or an integer", s)
+	}
+	return slog.Level(n), nil
+}
+
+// ComponentLevels parses LOG_LEVEL_<COMPONENT> entries from environ (in
+// os.Environ form). Invalid values are returned as errors and skipped.
+func ComponentLevels(environ []string) (map[string]slog.Level, []error) {
+	levels := map[string]slog.Level{}
+	var errs []error
+	for _, kv := range environ {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(key, EnvPrefix) || value == "" {
+			continue
+		}
+		component := strings.ToLower(strings.TrimPrefix(key, EnvPrefix))
+		if component == "" {
+			continue
+		}
+		level, err := ParseLevel(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			continue
+		}
+		levels[component] = level
+	}
+	return levels, errs
+}
+
+// Handler filters records by the level configured for the component that
+// emitted them. The component is the name of the Go package of the calling
+// function (e.g. "cloudflare", "discovery", "main"), so existing slog.Info
+// calls need no changes.
+type Handler struct {
+	inner     slog.Handler
+	level     slog.Level
+	overrides map[string]slog.Level
+	minLevel  slog.Level
+	cache     *sync.Map // pc -> component
+}
+
+// NewHandler wraps inner, applying level globally and overrides per
+// component. inner should accept all levels; filtering happens here.
+func NewHandler(inner slog.Handler, level slog.Level, overrides map[string]slog.Level) *Handler {
+	minLevel := level
+	for _, l := range overrides {
+		if l < minLevel {
+			minLevel = l
+		}
+	}
+	return &Handler{
+		inner:     inner,
+		level:     level,
+		overrides: overrides,
+		minLevel:  minLevel,
+		cache:     &sync.Map{},
+	}
+}
+
+// Enabled reports whether any component could log at level.
+func (h *Handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.minLevel
+}
+
+// Handle drops the record if it is below its component's level.
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level < h.levelFor(r.PC) {
+		return nil
+	}
+	return h.inner.Handle(ctx, r)
+}
+
+// WithAttrs implements slog.Handler.
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.inner = h.inner.WithAttrs(attrs)
+	return &clone
+}
+
+// WithGroup implements slog.Handler.
+func (h *Handler) WithGroup(name string) slog.Handler {
+	clone := *h
+	clone.inner = h.inner.WithGroup(name)
+	return &clone
+}
+
+func (h *Handler) levelFor(pc uintptr) slog.Level {
+	if len(h.overrides) == 0 || pc == 0 {
+		return h.level
+	}
+	var component string
+	if cached, ok := h.cache.Load(pc); ok {
+		component = cached.(string)
+	} else {
+		frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+		component = componentOf(frame.Function)
+		h.cache.Store(pc, component)
+	}
+	if l, ok := h.overrides[component]; ok {
+		return l
+	}
+	return h.level
+}
+
+// componentOf extracts the package name from a fully qualified function
+// name, e.g. "github.com/x/y/internal/cloudflare.(*Client).Update" yields
+// "cloudflare".
+func componentOf(function string) string {
+	if i := strings.LastIndex(function, "/"); i >= 0 {
+		function = function[i+1:]
+	}
+	if i := strings.Index(function, "."); i >= 0 {
+		function = function[:i]
+	}
+	return function
+}
@@ -0,0 +1,107 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    slog.Level
+		wantErr bool
+	}{
+		{"debug", slog.LevelDebug, false},
+		{"INFO", slog.LevelInfo, false},
+		{"", slog.LevelInfo, false},
+		{"warn", slog.LevelWarn, false},
+		{"warning", slog.LevelWarn, false},
+		{"error", slog.LevelError, false},
+		{"-4", slog.LevelDebug, false},
+		{"2", slog.Level(2), false},
+		{"verbose", slog.LevelInfo, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLevel(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseLevel(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseLevel(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestComponentLevels(t *testing.T) {
+	levels, errs := ComponentLevels([]string{
+		"LOG_LEVEL=warn",
+		"LOG_LEVEL_CLOUDFLARE=debug",
+		"LOG_LEVEL_DISCOVERY=-4",
+		"LOG_LEVEL_CADDY=loud",
+		"LOG_LEVEL_MAPPING=",
+		"PATH=/usr/bin",
+	})
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "LOG_LEVEL_CADDY") {
+		t.Errorf("errs = %v, want one error for LOG_LEVEL_CADDY", errs)
+	}
+	want := map[string]slog.Level{"cloudflare": slog.LevelDebug, "discovery": slog.LevelDebug}
+	if len(levels) != len(want) {
+		t.Fatalf("levels = %v, want %v", levels, want)
+	}
+	for k, v := range want {
+		if levels[k] != v {
+			t.Errorf("levels[%q] = %v, want %v", k, levels[k], v)
+		}
+	}
+}
+
+func TestComponentOf(t *testing.T) {
+	tests := map[string]string{
+		"github.com/jonnyzzz/stevedore-dyndns/internal/cloudflare.(*Client).UpdateRecord": "cloudflare",
+		"github.com/jonnyzzz/stevedore-dyndns/internal/discovery.(*Client).Poll.func1":    "discovery",
+		"main.runControlLoop": "main",
+		"":                    "",
+	}
+	for in, want := range tests {
+		if got := componentOf(in); got != want {
+			t.Errorf("componentOf(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// TestHandler_ComponentOverride verifies a component override lets that
+// component's debug logs through while the global level stays info. Records
+// logged from this test belong to the "logging" component.
+func TestHandler_ComponentOverride(t *testing.T) {
+	newLogger := func(overrides map[string]slog.Level) (*slog.Logger, *bytes.Buffer) {
+		var buf bytes.Buffer
+		inner := slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})
+		return slog.New(NewHandler(inner, slog.LevelInfo, overrides)), &buf
+	}
+
+	logger, buf := newLogger(map[string]slog.Level{"logging": slog.LevelDebug})
+	logger.Debug("component debug")
+	if !strings.Contains(buf.String(), "component debug") {
+		t.Errorf("debug record missing with component override: %q", buf.String())
+	}
+
+	logger, buf = newLogger(map[string]slog.Level{"cloudflare": slog.LevelDebug})
+	logger.Debug("other component debug")
+	logger.With("k", "v").Info("global info")
+	out := buf.String()
+	if strings.Contains(out, "other component debug") {
+		t.Errorf("debug record emitted without override for its component: %q", out)
+	}
+	if !strings.Contains(out, "global info") || !strings.Contains(out, `"k":"v"`) {
+		t.Errorf("info record missing at global level: %q", out)
+	}
+
+	logger, buf = newLogger(map[string]slog.Level{"logging": slog.LevelError})
+	logger.Warn("quieted warning")
+	if buf.Len() != 0 {
+		t.Errorf("override above global should suppress warn: %q", buf.String())
+	}
+}
@@ -0,0 +1,40 @@
+package mapping
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/netaddr"
+)
+
+// ParseIPOverride parses an ip_override value: one IPv4 and/or one IPv6
+// address, comma-separated. Every address must be public. An empty value
+// returns no addresses.
+func ParseIPOverride(value string) (ipv4, ipv6 string, err error) {
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		addr, err := netip.ParseAddr(part)
+		if err != nil {
+			return "", "", fmt.Errorf("ip_override %q is not an IP address", part)
+		}
+		if !netaddr.IsPublic(addr) {
+			return "", "", fmt.Errorf("ip_override %q is not a public IP address", part)
+		}
+		if addr.Is4() || addr.Is4In6() {
+			if ipv4 != "" {
+				return "", "", fmt.Errorf("ip_override %q has more than one IPv4 address", value)
+			}
+			ipv4 = addr.Unmap().String()
+		} else {
+			if ipv6 != "" {
+				return "", "", fmt.Errorf("ip_override %q has more than one IPv6 address", value)
+			}
+			ipv6 = addr.String()
+		}
+	}
+	return ipv4, ipv6, nil
+}
@@ -0,0 +1,38 @@
+package mapping
+
+import "testing"
+
+func TestParseIPOverride(t *testing.T) {
+	tests := []struct {
+		value    string
+		wantIPv4 string
+		wantIPv6 string
+		wantErr  bool
+	}{
+		{value: ""},
+		{value: "198.51.100.7", wantIPv4: "198.51.100.7"},
+		{value: "2a01:4f8::7", wantIPv6: "2a01:4f8::7"},
+		{value: "198.51.100.7, 2a01:4f8::7", wantIPv4: "198.51.100.7", wantIPv6: "2a01:4f8::7"},
+		{value: "::ffff:198.51.100.7", wantIPv4: "198.51.100.7"},
+		{value: "vps.example.com", wantErr: true},
+		{value: "192.168.1.10", wantErr: true},
+		{value: "10.0.0.1", wantErr: true},
+		{value: "100.64.0.1", wantErr: true},
+		{value: "127.0.0.1", wantErr: true},
+		{value: "fd00::1", wantErr: true},
+		{value: "fe80::1", wantErr: true},
+		{value: "198.51.100.7,198.51.100.8", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			ipv4, ipv6, err := ParseIPOverride(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseIPOverride(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if ipv4 != tt.wantIPv4 || ipv6 != tt.wantIPv6 {
+				t.Errorf("ParseIPOverride(%q) = %q, %q; want %q, %q", tt.value, ipv4, ipv6, tt.wantIPv4, tt.wantIPv6)
+			}
+		})
+	}
+}
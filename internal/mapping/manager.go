@@ -1,38 +1,89 @@
 package mapping
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"gopkg.in/yaml.v3"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
 )
 
 // subdomainRegex validates DNS label format
 // Must start and end with alphanumeric, can contain hyphens, max 63 chars
 var subdomainRegex = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
 
+// headerNameRegex validates HTTP header names rendered into the Caddyfile
+var headerNameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]*$`)
+
 // Mapping represents a subdomain to service mapping
 type Mapping struct {
-	Subdomain      string         `yaml:"subdomain"`
-	Target         string         `yaml:"target,omitempty"`          // Direct host:port target
-	ComposeProject string         `yaml:"compose_project,omitempty"` // Docker Compose project name
-	ComposeService string         `yaml:"compose_service,omitempty"` // Docker Compose service name
-	Container      string         `yaml:"container,omitempty"`       // Docker container name
-	Port           int            `yaml:"port,omitempty"`            // Port for container/compose service
-	Options        MappingOptions `yaml:"options,omitempty"`
+	// Subdomain is a DNS label, or "@" (or empty) for the bare domain.
+	Subdomain      string `yaml:"subdomain"`
+	Target         string `yaml:"target,omitempty"`          // Direct host:port target
+	ComposeProject string `yaml:"compose_project,omitempty"` // Docker Compose project name
+	ComposeService string `yaml:"compose_service,omitempty"` // Docker Compose service name
+	Container      string `yaml:"container,omitempty"`       // Docker container name
+	Port           int    `yaml:"port,omitempty"`            // Port for container/compose service
+	// CanaryOf names another mapping's subdomain this one mirrors: the
+	// canary inherits that mapping's options (options set on the canary
+	// override them) but keeps its own target.
+	CanaryOf string         `yaml:"canary_of,omitempty"`
+	Options  MappingOptions `yaml:"options,omitempty"`
 }
 
 // MappingOptions contains optional configuration for a mapping
 type MappingOptions struct {
-	Websocket      bool   `yaml:"websocket,omitempty"`
-	BufferRequests bool   `yaml:"buffer_requests,omitempty"`
-	HealthPath     string `yaml:"health_path,omitempty"`
+	Websocket      bool   `yaml:"websocket,omitempty" json:"websocket,omitempty"`
+	BufferRequests bool   `yaml:"buffer_requests,omitempty" json:"buffer_requests,omitempty"`
+	HealthPath     string `yaml:"health_path,omitempty" json:"health_path,omitempty"`
+	// DisableHealth omits active health checks for upstreams that have no
+	// health endpoint, so Caddy never marks them down.
+	DisableHealth bool `yaml:"disable_health,omitempty" json:"disable_health,omitempty"`
+	// HealthInterval and HealthTimeout tune the active health checks
+	// (default 30s and 5s).
+	HealthInterval string `yaml:"health_interval,omitempty" json:"health_interval,omitempty"`
+	HealthTimeout  string `yaml:"health_timeout,omitempty" json:"health_timeout,omitempty"`
+	// FailDuration enables passive health checks: an upstream that failed
+	// MaxFails requests (default 1) within FailDuration is marked down.
+	FailDuration string `yaml:"fail_duration,omitempty" json:"fail_duration,omitempty"`
+	MaxFails     int    `yaml:"max_fails,omitempty" json:"max_fails,omitempty"`
+	// LBTryDuration and LBTryInterval make Caddy retry a failed upstream
+	// connection for up to LBTryDuration (every LBTryInterval) instead of
+	// returning 502 immediately, e.g. while a container restarts. Empty
+	// falls back to PROXY_LB_TRY_DURATION / PROXY_LB_TRY_INTERVAL.
+	LBTryDuration string `yaml:"lb_try_duration,omitempty" json:"lb_try_duration,omitempty"`
+	LBTryInterval string `yaml:"lb_try_interval,omitempty" json:"lb_try_interval,omitempty"`
+	// WSHandshakeTimeout bounds how long Caddy waits for the upstream's
+	// upgrade response (response_header_timeout). Websocket mappings only.
+	WSHandshakeTimeout string `yaml:"ws_handshake_timeout,omitempty" json:"ws_handshake_timeout,omitempty"`
+	// WSHeaders are request headers (e.g. Sec-WebSocket-Protocol) passed
+	// to the upstream explicitly. Websocket mappings only.
+	WSHeaders []string `yaml:"ws_headers,omitempty" json:"ws_headers,omitempty"`
+	// StripHeaders are inbound request headers removed before proxying
+	// (header_up -Name), in addition to the global STRIP_HEADERS. A
+	// trailing "*" removes every header with that prefix.
+	StripHeaders []string `yaml:"strip_headers,omitempty" json:"strip_headers,omitempty"`
+	// IPOverride pins the subdomain's DNS records to fixed public
+	// addresses (one IPv4 and/or one IPv6, comma-separated) instead of
+	// the detected IP, e.g. for a service hosted on an external VPS.
+	IPOverride string `yaml:"ip_override,omitempty" json:"ip_override,omitempty"`
+	// RateLimit caps each client's requests to the subdomain, or with its
+	// path set only to matching paths.
+	RateLimit *RateLimit `yaml:"rate_limit,omitempty" json:"rate_limit,omitempty"`
+	// Match is an extra single-line Caddy matcher (e.g. "header X-Env
+	// staging") that requests must satisfy besides the host to be routed.
+	Match string `yaml:"match,omitempty" json:"match,omitempty"`
 }
 
 // MappingsFile represents the structure of the mappings.yaml file
@@ -45,6 +96,8 @@ type Manager struct {
 	filePath string
 	mappings []Mapping
 	mu       sync.RWMutex
+	// unknownFields is the MAPPINGS_UNKNOWN_FIELDS policy; empty warns.
+	unknownFields string
 }
 
 // New creates a new mapping manager
@@ -55,6 +108,14 @@ func New(filePath string) *Manager {
 	}
 }
 
+// SetUnknownFields sets the policy for keys that no mapping field matches,
+// one of config.UnknownFieldsWarn (the default) or config.UnknownFieldsError.
+func (m *Manager) SetUnknownFields(policy string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.unknownFields = policy
+}
+
 // Load reads the mappings from the file
 func (m *Manager) Load() error {
 	m.mu.Lock()
@@ -74,6 +135,14 @@ func (m *Manager) Load() error {
 	if err := yaml.Unmarshal(data, &file); err != nil {
 		return fmt.Errorf("failed to parse mappings file: %w", err)
 	}
+	if unknown := unknownFields(data); len(unknown) > 0 {
+		if m.unknownFields == config.UnknownFieldsError {
+			return fmt.Errorf("unknown fields in mappings file: %s", strings.Join(unknown, "; "))
+		}
+		for _, field := range unknown {
+			slog.Warn("Ignoring unknown field in mappings file", "path", m.filePath, "field", field)
+		}
+	}
 
 	// Validate and resolve mappings, only keeping valid ones
 	validMappings := make([]Mapping, 0, len(file.Mappings))
@@ -88,12 +157,32 @@ func (m *Manager) Load() error {
 		}
 		validMappings = append(validMappings, file.Mappings[i])
 	}
+	validMappings = resolveCanaries(validMappings)
 
 	m.mappings = validMappings
 	slog.Info("Loaded mappings", "valid", len(validMappings), "total", len(file.Mappings))
 	return nil
 }
 
+// unknownFields decodes data strictly and returns one message per key that
+// no field matches, with its line (e.g. "line 4: field websoket not found
+// in type mapping.MappingOptions").
+func unknownFields(data []byte) []string {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	var typeErr *yaml.TypeError
+	if err := dec.Decode(&MappingsFile{}); !errors.As(err, &typeErr) {
+		return nil
+	}
+	var unknown []string
+	for _, msg := range typeErr.Errors {
+		if strings.Contains(msg, " not found in type ") {
+			unknown = append(unknown, msg)
+		}
+	}
+	return unknown
+}
+
 // Get returns all current mappings
 func (m *Manager) Get() []Mapping {
 	m.mu.RLock()
@@ -156,15 +245,25 @@ func (m *Manager) Watch(ctx context.Context, onChange func()) {
 }
 
 func (m *Manager) validateMapping(mapping *Mapping) error {
+	// An empty subdomain, like "@", maps the bare domain.
 	if mapping.Subdomain == "" {
-		return fmt.Errorf("subdomain is required")
+		mapping.Subdomain = config.ApexSubdomain
 	}
 
 	// Validate subdomain format (DNS label)
-	if !subdomainRegex.MatchString(mapping.Subdomain) {
+	if mapping.Subdomain != config.ApexSubdomain && !subdomainRegex.MatchString(mapping.Subdomain) {
 		return fmt.Errorf("subdomain %q is invalid: must be alphanumeric with optional hyphens, 1-63 chars", mapping.Subdomain)
 	}
 
+	if mapping.CanaryOf != "" {
+		if !subdomainRegex.MatchString(mapping.CanaryOf) {
+			return fmt.Errorf("canary_of %q is not a valid subdomain", mapping.CanaryOf)
+		}
+		if mapping.CanaryOf == mapping.Subdomain {
+			return fmt.Errorf("canary_of must reference another subdomain")
+		}
+	}
+
 	// Must have at least one target specification
 	hasTarget := mapping.Target != ""
 	hasCompose := mapping.ComposeProject != "" && mapping.ComposeService != ""
@@ -179,6 +278,120 @@ func (m *Manager) validateMapping(mapping *Mapping) error {
 		return fmt.Errorf("port must be between 1 and 65535, got %d", mapping.Port)
 	}
 
+	if err := ValidateDuration("lb_try_duration", mapping.Options.LBTryDuration); err != nil {
+		return err
+	}
+	if err := ValidateDuration("lb_try_interval", mapping.Options.LBTryInterval); err != nil {
+		return err
+	}
+	if err := ValidateDuration("ws_handshake_timeout", mapping.Options.WSHandshakeTimeout); err != nil {
+		return err
+	}
+	if err := ValidateDuration("health_interval", mapping.Options.HealthInterval); err != nil {
+		return err
+	}
+	if err := ValidateDuration("health_timeout", mapping.Options.HealthTimeout); err != nil {
+		return err
+	}
+	if err := ValidateDuration("fail_duration", mapping.Options.FailDuration); err != nil {
+		return err
+	}
+	if mapping.Options.MaxFails < 0 {
+		return fmt.Errorf("max_fails must not be negative, got %d", mapping.Options.MaxFails)
+	}
+	if mapping.Options.MaxFails > 0 && mapping.Options.FailDuration == "" {
+		return fmt.Errorf("max_fails requires fail_duration")
+	}
+	for _, h := range mapping.Options.WSHeaders {
+		if !headerNameRegex.MatchString(h) {
+			return fmt.Errorf("ws_headers entry %q is not a valid header name", h)
+		}
+	}
+	for _, h := range mapping.Options.StripHeaders {
+		if !headerNameRegex.MatchString(strings.TrimSuffix(h, "*")) {
+			return fmt.Errorf("strip_headers entry %q is not a valid header name", h)
+		}
+	}
+	if _, _, err := ParseIPOverride(mapping.Options.IPOverride); err != nil {
+		return err
+	}
+	if err := ValidateMatch(mapping.Options.Match); err != nil {
+		return err
+	}
+	if mapping.Options.RateLimit != nil {
+		if err := mapping.Options.RateLimit.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resolveCanaries merges each canary's options over those of the mapping it
+// mirrors. Canaries whose referenced subdomain is not a loaded, non-canary
+// mapping are dropped.
+func resolveCanaries(mappings []Mapping) []Mapping {
+	bases := make(map[string]*Mapping, len(mappings))
+	for i := range mappings {
+		if mappings[i].CanaryOf == "" {
+			bases[mappings[i].Subdomain] = &mappings[i]
+		}
+	}
+
+	result := make([]Mapping, 0, len(mappings))
+	for _, m := range mappings {
+		if m.CanaryOf != "" {
+			base, ok := bases[m.CanaryOf]
+			if !ok {
+				slog.Warn("Skipping canary mapping: referenced subdomain has no mapping", "subdomain", m.Subdomain, "canary_of", m.CanaryOf)
+				continue
+			}
+			opts, err := mergeOptions(base.Options, m.Options)
+			if err != nil {
+				slog.Warn("Skipping canary mapping", "subdomain", m.Subdomain, "error", err)
+				continue
+			}
+			m.Options = opts
+		}
+		result = append(result, m)
+	}
+	return result
+}
+
+// mergeOptions returns base with every option set in override applied on
+// top. Only non-empty override values count as set, so a canary cannot
+// switch an inherited boolean off.
+func mergeOptions(base, override MappingOptions) (MappingOptions, error) {
+	data, err := yaml.Marshal(override)
+	if err != nil {
+		return base, fmt.Errorf("failed to merge options: %w", err)
+	}
+	merged := base
+	merged.WSHeaders = append([]string(nil), base.WSHeaders...)
+	merged.StripHeaders = append([]string(nil), base.StripHeaders...)
+	if base.RateLimit != nil {
+		rateLimit := *base.RateLimit
+		merged.RateLimit = &rateLimit
+	}
+	if err := yaml.Unmarshal(data, &merged); err != nil {
+		return base, fmt.Errorf("failed to merge options: %w", err)
+	}
+	return merged, nil
+}
+
+// ValidateDuration checks that an optional duration option is a positive
+// Go duration (e.g. "5s", "250ms"). An empty value is valid.
+func ValidateDuration(name, value string) error {
+	if value == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("%s %q is invalid: %w", name, value, err)
+	}
+	if d <= 0 {
+		return fmt.Errorf("%s %q must be positive", name, value)
+	}
 	return nil
 }
 
@@ -4,8 +4,11 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/config"
 )
 
 func TestManager_Load_FileNotExists(t *testing.T) {
@@ -101,7 +104,7 @@ func TestManager_Load_SkipsInvalidMappings(t *testing.T) {
 mappings:
   - subdomain: valid-app
     target: "192.168.1.100:8080"
-  - subdomain: ""
+  - subdomain: under_score
     target: "should-be-skipped"
   - subdomain: -invalid-start
     target: "192.168.1.101:8080"
@@ -275,6 +278,62 @@ mappings:
 	}
 }
 
+// TestManager_Watch_RecoversFromInvalidFile verifies that after a failed
+// first load (invalid YAML) the next valid edit loads the mappings.
+func TestManager_Watch_RecoversFromInvalidFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "mappings.yaml")
+
+	if err := os.WriteFile(tmpFile, []byte("mappings: [\n  - subdomain: app\n"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	mgr := New(tmpFile)
+	if err := mgr.Load(); err == nil {
+		t.Fatal("Load() expected error for invalid YAML")
+	}
+	if got := mgr.Get(); len(got) != 0 {
+		t.Fatalf("After failed load, got %d mappings, want 0", len(got))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changed := make(chan bool, 1)
+	go mgr.Watch(ctx, func() {
+		select {
+		case changed <- true:
+		default:
+		}
+	})
+
+	// Give watcher time to start
+	time.Sleep(100 * time.Millisecond)
+
+	content := `
+mappings:
+  - subdomain: app
+    target: "192.168.1.100:8080"
+`
+	if err := os.WriteFile(tmpFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to update test file: %v", err)
+	}
+
+	// The truncating write may be observed as an empty file first; wait
+	// for the end state.
+	deadline := time.After(2 * time.Second)
+	for {
+		if len(mgr.Get()) == 1 {
+			return
+		}
+		select {
+		case <-changed:
+		case <-deadline:
+			t.Fatalf("Watch() never recovered: got %d mappings, want 1", len(mgr.Get()))
+		}
+	}
+}
+
 func TestValidateMapping(t *testing.T) {
 	mgr := New("")
 
@@ -284,8 +343,18 @@ func TestValidateMapping(t *testing.T) {
 		wantErr bool
 	}{
 		{
-			name:    "empty subdomain",
+			name:    "empty subdomain is the apex",
 			mapping: Mapping{Subdomain: "", Target: "host:80"},
+			wantErr: false,
+		},
+		{
+			name:    "apex subdomain",
+			mapping: Mapping{Subdomain: "@", Target: "host:80"},
+			wantErr: false,
+		},
+		{
+			name:    "invalid subdomain - apex marker inside a label",
+			mapping: Mapping{Subdomain: "app@", Target: "host:80"},
 			wantErr: true,
 		},
 		{
@@ -358,6 +427,146 @@ func TestValidateMapping(t *testing.T) {
 			mapping: Mapping{Subdomain: "app", Container: "c", Port: 8080},
 			wantErr: false,
 		},
+		{
+			name:    "valid lb_try durations",
+			mapping: Mapping{Subdomain: "app", Target: "host:80", Options: MappingOptions{LBTryDuration: "5s", LBTryInterval: "250ms"}},
+			wantErr: false,
+		},
+		{
+			name:    "invalid lb_try_duration",
+			mapping: Mapping{Subdomain: "app", Target: "host:80", Options: MappingOptions{LBTryDuration: "five seconds"}},
+			wantErr: true,
+		},
+		{
+			name:    "valid websocket tuning",
+			mapping: Mapping{Subdomain: "app", Target: "host:80", Options: MappingOptions{Websocket: true, WSHandshakeTimeout: "30s", WSHeaders: []string{"Sec-WebSocket-Protocol"}}},
+			wantErr: false,
+		},
+		{
+			name:    "invalid ws_handshake_timeout",
+			mapping: Mapping{Subdomain: "app", Target: "host:80", Options: MappingOptions{Websocket: true, WSHandshakeTimeout: "30"}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid ws_headers entry",
+			mapping: Mapping{Subdomain: "app", Target: "host:80", Options: MappingOptions{Websocket: true, WSHeaders: []string{"Bad Header}"}}},
+			wantErr: true,
+		},
+		{
+			name:    "valid strip_headers",
+			mapping: Mapping{Subdomain: "app", Target: "host:80", Options: MappingOptions{StripHeaders: []string{"X-Internal", "X-Debug-*"}}},
+			wantErr: false,
+		},
+		{
+			name:    "invalid strip_headers entry",
+			mapping: Mapping{Subdomain: "app", Target: "host:80", Options: MappingOptions{StripHeaders: []string{"X-Bad Header"}}},
+			wantErr: true,
+		},
+		{
+			name:    "negative lb_try_interval",
+			mapping: Mapping{Subdomain: "app", Target: "host:80", Options: MappingOptions{LBTryInterval: "-1s"}},
+			wantErr: true,
+		},
+		{
+			name:    "valid health checks",
+			mapping: Mapping{Subdomain: "app", Target: "host:80", Options: MappingOptions{HealthInterval: "10s", HealthTimeout: "2s", FailDuration: "30s", MaxFails: 3}},
+			wantErr: false,
+		},
+		{
+			name:    "invalid health_interval",
+			mapping: Mapping{Subdomain: "app", Target: "host:80", Options: MappingOptions{HealthInterval: "often"}},
+			wantErr: true,
+		},
+		{
+			name:    "zero health_timeout",
+			mapping: Mapping{Subdomain: "app", Target: "host:80", Options: MappingOptions{HealthTimeout: "0s"}},
+			wantErr: true,
+		},
+		{
+			name:    "negative max_fails",
+			mapping: Mapping{Subdomain: "app", Target: "host:80", Options: MappingOptions{FailDuration: "30s", MaxFails: -1}},
+			wantErr: true,
+		},
+		{
+			name:    "max_fails without fail_duration",
+			mapping: Mapping{Subdomain: "app", Target: "host:80", Options: MappingOptions{MaxFails: 3}},
+			wantErr: true,
+		},
+		{
+			name:    "valid rate_limit",
+			mapping: Mapping{Subdomain: "app", Target: "host:80", Options: MappingOptions{RateLimit: &RateLimit{Events: 10, Window: "1m"}}},
+			wantErr: false,
+		},
+		{
+			name:    "valid path-scoped rate_limit",
+			mapping: Mapping{Subdomain: "app", Target: "host:80", Options: MappingOptions{RateLimit: &RateLimit{Events: 5, Window: "1m", Path: "/api/*"}}},
+			wantErr: false,
+		},
+		{
+			name:    "rate_limit path without leading slash",
+			mapping: Mapping{Subdomain: "app", Target: "host:80", Options: MappingOptions{RateLimit: &RateLimit{Events: 5, Window: "1m", Path: "login"}}},
+			wantErr: true,
+		},
+		{
+			name:    "rate_limit path with a brace",
+			mapping: Mapping{Subdomain: "app", Target: "host:80", Options: MappingOptions{RateLimit: &RateLimit{Events: 5, Window: "1m", Path: "/login}"}}},
+			wantErr: true,
+		},
+		{
+			name:    "rate_limit path with an inner wildcard",
+			mapping: Mapping{Subdomain: "app", Target: "host:80", Options: MappingOptions{RateLimit: &RateLimit{Events: 5, Window: "1m", Path: "/*/login"}}},
+			wantErr: true,
+		},
+		{
+			name:    "rate_limit without events",
+			mapping: Mapping{Subdomain: "app", Target: "host:80", Options: MappingOptions{RateLimit: &RateLimit{Window: "1m"}}},
+			wantErr: true,
+		},
+		{
+			name:    "rate_limit without window",
+			mapping: Mapping{Subdomain: "app", Target: "host:80", Options: MappingOptions{RateLimit: &RateLimit{Events: 5}}},
+			wantErr: true,
+		},
+		{
+			name:    "valid header match",
+			mapping: Mapping{Subdomain: "app", Target: "host:80", Options: MappingOptions{Match: "header X-Env staging"}},
+			wantErr: false,
+		},
+		{
+			name:    "valid negated query match",
+			mapping: Mapping{Subdomain: "app", Target: "host:80", Options: MappingOptions{Match: "not query debug=*"}},
+			wantErr: false,
+		},
+		{
+			name:    "valid quoted header match",
+			mapping: Mapping{Subdomain: "app", Target: "host:80", Options: MappingOptions{Match: "header User-Agent \"Health Probe*\""}},
+			wantErr: false,
+		},
+		{
+			name:    "match with an unsupported matcher",
+			mapping: Mapping{Subdomain: "app", Target: "host:80", Options: MappingOptions{Match: "expression {path} == \"/\""}},
+			wantErr: true,
+		},
+		{
+			name:    "match with a block",
+			mapping: Mapping{Subdomain: "app", Target: "host:80", Options: MappingOptions{Match: "header X-Env staging } handle {"}},
+			wantErr: true,
+		},
+		{
+			name:    "match with a newline",
+			mapping: Mapping{Subdomain: "app", Target: "host:80", Options: MappingOptions{Match: "header X-Env staging\nrespond 200"}},
+			wantErr: true,
+		},
+		{
+			name:    "match without arguments",
+			mapping: Mapping{Subdomain: "app", Target: "host:80", Options: MappingOptions{Match: "method"}},
+			wantErr: true,
+		},
+		{
+			name:    "match with an unbalanced quote",
+			mapping: Mapping{Subdomain: "app", Target: "host:80", Options: MappingOptions{Match: "header X-Env \"staging"}},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -493,3 +702,67 @@ mappings:
 		<-done
 	}
 }
+
+// TestManager_Load_UnknownFields verifies typo'd keys are reported with
+// their line instead of being dropped silently: the mappings still load by
+// default and the load fails under MAPPINGS_UNKNOWN_FIELDS=error.
+func TestManager_Load_UnknownFields(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "mappings.yaml")
+	content := `mappings:
+  - subdomain: app
+    target: "192.168.1.100:8080"
+    options:
+      websoket: true
+      helth_path: /healthz
+  - subdomain: api
+    targte: "192.168.1.101:8080"
+    target: "192.168.1.101:8080"
+`
+	if err := os.WriteFile(tmpFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	unknown := unknownFields([]byte(content))
+	want := []string{
+		"line 5: field websoket not found in type mapping.MappingOptions",
+		"line 6: field helth_path not found in type mapping.MappingOptions",
+		"line 8: field targte not found in type mapping.Mapping",
+	}
+	if strings.Join(unknown, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unknownFields() = %q, want %q", unknown, want)
+	}
+
+	mgr := New(tmpFile)
+	if err := mgr.Load(); err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if got := len(mgr.Get()); got != 2 {
+		t.Errorf("Load() got %d mappings, want 2", got)
+	}
+
+	strict := New(tmpFile)
+	strict.SetUnknownFields(config.UnknownFieldsError)
+	err := strict.Load()
+	if err == nil || !strings.Contains(err.Error(), "websoket") || !strings.Contains(err.Error(), "targte") {
+		t.Fatalf("Load() error = %v, want the unknown fields", err)
+	}
+	if got := len(strict.Get()); got != 0 {
+		t.Errorf("Load() kept %d mappings from a rejected file", got)
+	}
+}
+
+func TestUnknownFields_ValidFile(t *testing.T) {
+	content := `mappings:
+  - subdomain: app
+    target: "192.168.1.100:8080"
+    options:
+      websocket: true
+      health_path: /healthz
+`
+	if unknown := unknownFields([]byte(content)); len(unknown) != 0 {
+		t.Errorf("unknownFields() = %q, want none", unknown)
+	}
+	if unknown := unknownFields(nil); len(unknown) != 0 {
+		t.Errorf("unknownFields(empty) = %q, want none", unknown)
+	}
+}
@@ -0,0 +1,47 @@
+package mapping
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// matchMatchers are the Caddy request matchers a mapping's match option may
+// use. Host is implied by the subdomain, and matchers that take a block or
+// run arbitrary expressions are left out.
+var matchMatchers = []string{
+	"header", "header_regexp", "query", "path", "path_regexp",
+	"method", "protocol", "remote_ip", "client_ip",
+}
+
+// ValidateMatch checks a match option: a single-line Caddy matcher
+// (e.g. "header X-Env staging"), optionally negated with "not", that is
+// rendered next to the host matcher. An empty value is valid.
+func ValidateMatch(expr string) error {
+	if expr == "" {
+		return nil
+	}
+	if strings.ContainsAny(expr, "{}#`\\") {
+		return fmt.Errorf("match %q must not contain braces, comments, backticks or backslashes", expr)
+	}
+	for _, r := range expr {
+		if r < ' ' || r == 0x7f {
+			return fmt.Errorf("match %q must be a single line without control characters", expr)
+		}
+	}
+	if strings.Count(expr, `"`)%2 != 0 {
+		return fmt.Errorf("match %q has an unbalanced quote", expr)
+	}
+
+	fields := strings.Fields(expr)
+	if fields[0] == "not" {
+		fields = fields[1:]
+	}
+	if len(fields) < 2 {
+		return fmt.Errorf("match %q needs a matcher and its arguments", expr)
+	}
+	if !slices.Contains(matchMatchers, fields[0]) {
+		return fmt.Errorf("match %q uses unsupported matcher %q (want one of %s)", expr, fields[0], strings.Join(matchMatchers, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package mapping
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// rateLimitPathRegex accepts a URL path rendered as a Caddy path matcher:
+// a leading "/", path characters only and an optional trailing "*".
+var rateLimitPathRegex = regexp.MustCompile(`^/[A-Za-z0-9._~!$&'()+,;=:@%/-]*\*?$`)
+
+// RateLimit caps the requests each client may send within Window (Caddy's
+// rate_limit handler). With Path set, only requests matching the path are
+// limited, e.g. "/login" or "/api/*"; otherwise the whole subdomain is.
+type RateLimit struct {
+	Events int    `yaml:"events" json:"events"`
+	Window string `yaml:"window" json:"window"`
+	Path   string `yaml:"path,omitempty" json:"path,omitempty"`
+}
+
+// Validate checks that the limit has positive events and window and, when
+// set, a path Caddy can match.
+func (r *RateLimit) Validate() error {
+	if r.Events < 1 {
+		return fmt.Errorf("rate_limit events must be positive, got %d", r.Events)
+	}
+	if r.Window == "" {
+		return fmt.Errorf("rate_limit requires window")
+	}
+	if err := ValidateDuration("rate_limit window", r.Window); err != nil {
+		return err
+	}
+	if r.Path != "" && !rateLimitPathRegex.MatchString(r.Path) {
+		return fmt.Errorf("rate_limit path %q is invalid: must start with / and contain only URL path characters, with an optional trailing *", r.Path)
+	}
+	return nil
+}
@@ -18,6 +18,8 @@ import (
 	"strings"
 
 	"github.com/9seconds/mtg/v2/mtglib"
+
+	"github.com/jonnyzzz/stevedore-dyndns/internal/atomicfile"
 )
 
 const (
@@ -157,12 +159,12 @@ func (s *Store) Rotate(subdomain, fqdn string) (Binding, error) {
 
 func (s *Store) persist(b Binding) error {
 	secretPath := filepath.Join(s.Dir, b.Subdomain+".secret")
-	if err := writeFileAtomic(secretPath, []byte(b.SecretHex()+"\n"), SecretFileMode); err != nil {
+	if err := atomicfile.Write(secretPath, []byte(b.SecretHex()+"\n"), SecretFileMode); err != nil {
 		return fmt.Errorf("mtproto: write %s: %w", secretPath, err)
 	}
 
 	tgPath := filepath.Join(s.Dir, b.Subdomain+".tg")
-	if err := writeFileAtomic(tgPath, []byte(b.TelegramURL()+"\n"), SecretFileMode); err != nil {
+	if err := atomicfile.Write(tgPath, []byte(b.TelegramURL()+"\n"), SecretFileMode); err != nil {
 		return fmt.Errorf("mtproto: write %s: %w", tgPath, err)
 	}
 	return nil
@@ -175,26 +177,3 @@ func generateSecret(fqdn string) (mtglib.Secret, error) {
 	}
 	return mtglib.Secret{Key: key, Host: fqdn}, nil
 }
-
-func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
-	dir := filepath.Dir(path)
-	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
-	if err != nil {
-		return err
-	}
-	tmpName := tmp.Name()
-	defer os.Remove(tmpName)
-
-	if _, err := tmp.Write(data); err != nil {
-		tmp.Close()
-		return err
-	}
-	if err := tmp.Chmod(mode); err != nil {
-		tmp.Close()
-		return err
-	}
-	if err := tmp.Close(); err != nil {
-		return err
-	}
-	return os.Rename(tmpName, path)
-}
@@ -0,0 +1,19 @@
+// Package netaddr holds the address checks shared by the IP detection
+// and the mapping options.
+package netaddr
+
+import "net/netip"
+
+// cgnatPrefix is the shared address space (RFC 6598) carriers use behind
+// NAT; it is not reachable from the internet.
+var cgnatPrefix = netip.MustParsePrefix("100.64.0.0/10")
+
+// IsPublic reports whether addr is a globally routable unicast address.
+// An IPv4-mapped IPv6 address is judged by its IPv4 address.
+func IsPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() &&
+		!addr.IsPrivate() &&
+		!cgnatPrefix.Contains(addr) &&
+		addr.Zone() == ""
+}
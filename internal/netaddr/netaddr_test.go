@@ -0,0 +1,31 @@
+package netaddr
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestIsPublic(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"203.0.113.10", true},
+		{"2a01:4f8::7", true},
+		{"::ffff:198.51.100.7", true},
+		{"192.168.1.10", false},
+		{"10.0.0.1", false},
+		{"100.64.0.1", false},
+		{"::ffff:100.64.0.1", false},
+		{"127.0.0.1", false},
+		{"169.254.1.1", false},
+		{"fd00::1", false},
+		{"fe80::1", false},
+		{"::1", false},
+	}
+	for _, tt := range tests {
+		if got := IsPublic(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("IsPublic(%s) = %t, want %t", tt.addr, got, tt.want)
+		}
+	}
+}